@@ -0,0 +1,172 @@
+package stc
+
+import (
+	"fmt"
+	"github.com/xdrpp/stc/ini"
+	"io"
+	"sort"
+)
+
+// Account annotations and signer comments for a network, in a form
+// that can be shared between users so a team sees the same names for
+// the same keys.  Written as an INI file with the same [accounts] and
+// [signers] sections as a network configuration file, plus the
+// network-id in a [net] section.
+type AddressBook struct {
+	NetworkId string
+	Accounts  AccountHints
+	Signers   SignerCache
+}
+
+// Returns a copy of the address book of net, which does not change
+// when net does.
+func (net *StellarNet) GetAddressBook() *AddressBook {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	accts := make(AccountHints, len(net.Accounts))
+	for k, v := range net.Accounts {
+		accts[k] = v
+	}
+	return &AddressBook{
+		NetworkId: net.NetworkId,
+		Accounts:  accts,
+		Signers:   net.Signers.Clone(),
+	}
+}
+
+// Writes an address book in INI format, in sorted order so that
+// exported files can be compared.
+func (ab *AddressBook) WriteTo(out io.Writer) (int64, error) {
+	var n int64
+	printf := func(f string, args ...interface{}) error {
+		k, err := fmt.Fprintf(out, f, args...)
+		n += int64(k)
+		return err
+	}
+	if err := printf("[net]\n\tnetwork-id = %s\n\n[accounts]\n",
+		ini.EscapeIniValue(ab.NetworkId)); err != nil {
+		return n, err
+	}
+	var keys []string
+	for k := range ab.Accounts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := printf("\t%s = %s\n", k,
+			ini.EscapeIniValue(ab.Accounts[k])); err != nil {
+			return n, err
+		}
+	}
+	if err := printf("\n[signers]\n"); err != nil {
+		return n, err
+	}
+	comments := map[string]string{}
+	keys = keys[:0]
+	for _, skis := range ab.Signers {
+		for i := range skis {
+			k := skis[i].Key.String()
+			keys = append(keys, k)
+			comments[k] = skis[i].Comment
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := printf("\t%s = %s\n", k,
+			ini.EscapeIniValue(comments[k])); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Parses an address book written by AddressBook.WriteTo.
+func ReadAddressBook(filename string, contents []byte) (*AddressBook, error) {
+	var net StellarNet
+	if err := ini.IniParseContents(net.IniSink(), filename,
+		contents); err != nil {
+		return nil, err
+	}
+	return net.GetAddressBook(), nil
+}
+
+// Decides between the existing comment and a different imported one
+// for the same account or signer (kind is "account" or "signer").
+// Returns the comment to keep.
+type ConflictResolver func(kind, key, old, new string) string
+
+// Keeps existing comments when importing an address book.
+func KeepExisting(_, _, old, _ string) string { return old }
+
+// Replaces existing comments when importing an address book.
+func ReplaceExisting(_, _, _, new string) string { return new }
+
+// Adds the accounts and signers of ab to net, calling resolve when
+// both have a different comment for the same key.  Returns the
+// number of entries added or changed, which will be saved with the
+// network configuration.  resolve is called without net locked.
+func (net *StellarNet) ImportAddressBook(ab *AddressBook,
+	resolve ConflictResolver) int {
+	n := 0
+	var accts []string
+	for k := range ab.Accounts {
+		accts = append(accts, k)
+	}
+	sort.Strings(accts)
+	for _, acct := range accts {
+		note := ab.Accounts[acct]
+		net.mu.Lock()
+		old, ok := net.Accounts[acct]
+		net.mu.Unlock()
+		if ok && old != note {
+			note = resolve("account", acct, old, note)
+			if note == old {
+				continue
+			}
+		} else if ok {
+			continue
+		}
+		net.AddHint(acct, note)
+		n++
+	}
+
+	var signers []SignerKeyInfo
+	for _, skis := range ab.Signers {
+		signers = append(signers, skis...)
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return signers[i].Key.String() < signers[j].Key.String()
+	})
+	for _, ski := range signers {
+		key, comment := ski.Key.String(), ski.Comment
+		net.mu.Lock()
+		old, ok := net.signerComment(&ski.Key)
+		net.mu.Unlock()
+		if ok {
+			if old == comment {
+				continue
+			} else if comment = resolve("signer", key, old,
+				comment); comment == old {
+				continue
+			}
+		}
+		net.mu.Lock()
+		net.Signers.Del(key)
+		net.addSigner(key, comment)
+		net.mu.Unlock()
+		n++
+	}
+	return n
+}
+
+// Like SignerCache.LookupComment, but also reports whether the signer
+// is known at all.  The caller must hold net.mu.
+func (net *StellarNet) signerComment(key *SignerKey) (string, bool) {
+	k := key.String()
+	for _, ski := range net.Signers[key.Hint()] {
+		if ski.Key.String() == k {
+			return ski.Comment, true
+		}
+	}
+	return "", false
+}
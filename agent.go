@@ -0,0 +1,435 @@
+package stc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// How long a KeyAgent holds each key unless told otherwise.
+const DefaultAgentTimeout = 15 * time.Minute
+
+// Error returned by AgentClient methods when no agent is listening on
+// the socket.
+var ErrNoAgent = errors.New("No key agent running")
+
+// Returns the path of the socket on which the stc command's key agent
+// listens:  $STCAGENT if set, and otherwise agent.sock in the
+// configuration directory.
+func AgentSocketPath() string {
+	if path, ok := os.LookupEnv("STCAGENT"); ok && path != "" {
+		return path
+	}
+	return ConfigPath("agent.sock")
+}
+
+type agentKey struct {
+	sk    PrivateKey
+	timer *time.Timer
+}
+
+// A KeyAgent holds decrypted private keys in memory for a limited
+// time, so that a batch of signing operations needs the passphrase of
+// each key only once, and serves clients (see AgentClient) over a
+// local socket.  Clients can sign with the keys without ever seeing
+// them.  Each key is forgotten Timeout after it was added.  A KeyAgent
+// is safe for concurrent use.
+//
+// The protocol is meant to be simple enough for other local tools to
+// speak.  A client sends requests, each a JSON object on one line,
+// and the agent answers each with one line of JSON, an object whose
+// "error" field, if present, explains why the request failed (e.g.,
+// "No such key").  Binary values are base64.  The requests are:
+//
+//	{"op":"list"}
+//	    → {"keys":[{"name":NAME,"public_key":"G..."},...]}
+//	{"op":"sign","name":NAME,"hash":HASH}
+//	    → {"signature":SIG}, the ed25519 signature of the 32-byte HASH
+//	{"op":"add","name":NAME,"key":"S..."}
+//	    → {}, caching key S... as NAME
+//	{"op":"remove","name":NAME}
+//	    → {}
+type KeyAgent struct {
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	keys     map[string]*agentKey
+	listener net.Listener
+	path     string
+}
+
+// Returns a KeyAgent that holds keys for timeout, or for
+// DefaultAgentTimeout if timeout is not positive.
+func NewKeyAgent(timeout time.Duration) *KeyAgent {
+	if timeout <= 0 {
+		timeout = DefaultAgentTimeout
+	}
+	return &KeyAgent{Timeout: timeout, keys: make(map[string]*agentKey)}
+}
+
+// Overwrites the secret of a key that is no longer needed, if it is
+// one whose memory stc controls.
+func wipeKey(sk PrivateKey) {
+	if k, ok := sk.PrivateKeyInterface.(stcdetail.Ed25519Priv); ok {
+		for i := range k {
+			k[i] = 0
+		}
+	}
+}
+
+// Adds a copy of key sk under name, replacing any key already of
+// that name.
+func (a *KeyAgent) Add(name string, sk PrivateKey) {
+	if k, ok := sk.PrivateKeyInterface.(stcdetail.Ed25519Priv); ok {
+		sk = PrivateKey{append(stcdetail.Ed25519Priv(nil), k...)}
+	}
+	ak := &agentKey{sk: sk}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.remove(name)
+	ak.timer = time.AfterFunc(a.Timeout, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.keys[name] == ak {
+			a.remove(name)
+		}
+	})
+	a.keys[name] = ak
+}
+
+func (a *KeyAgent) remove(name string) {
+	if ak, ok := a.keys[name]; ok {
+		ak.timer.Stop()
+		wipeKey(ak.sk)
+		delete(a.keys, name)
+	}
+}
+
+// Forgets the key called name.
+func (a *KeyAgent) Remove(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.remove(name)
+}
+
+// Forgets all keys.
+func (a *KeyAgent) RemoveAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for name := range a.keys {
+		a.remove(name)
+	}
+}
+
+// Returns the names of the keys the agent holds, in sorted order.
+func (a *KeyAgent) Names() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ret := make([]string, 0, len(a.keys))
+	for name := range a.keys {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// A key held by a KeyAgent.
+type AgentKey struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+// Returns the keys the agent holds, sorted by name.
+func (a *KeyAgent) List() []AgentKey {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ret := make([]AgentKey, 0, len(a.keys))
+	for name, ak := range a.keys {
+		ret = append(ret, AgentKey{name, ak.sk.Public().String()})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Signs hash, which must be 32 bytes (such as the result of
+// StellarNet.HashTx), with the key called name.  Refusing other
+// messages keeps clients from using the agent's keys for anything but
+// signing hashes.
+func (a *KeyAgent) Sign(name string, hash []byte) ([]byte, error) {
+	if len(hash) != len(stx.Hash{}) {
+		return nil, fmt.Errorf("hash must be %d bytes", len(stx.Hash{}))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ak, ok := a.keys[name]
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+	return ak.sk.Sign(hash)
+}
+
+// A request to a KeyAgent, sent as one line of JSON, to which the
+// agent replies with one line of JSON holding an agentResponse.
+type agentRequest struct {
+	// "list", "sign", "add", or "remove"
+	Op   string `json:"op,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Key to add, in strkey format
+	Key string `json:"key,omitempty"`
+	// Hash to sign
+	Hash []byte `json:"hash,omitempty"`
+}
+
+type agentResponse struct {
+	// Empty on success
+	Error     string     `json:"error,omitempty"`
+	Keys      []AgentKey `json:"keys,omitempty"`
+	Signature []byte     `json:"signature,omitempty"`
+}
+
+func (a *KeyAgent) handle(req *agentRequest) (resp agentResponse) {
+	var err error
+	switch req.Op {
+	case "list":
+		resp.Keys = a.List()
+	case "sign":
+		if resp.Signature, err = a.Sign(req.Name, req.Hash); err != nil {
+			resp.Error = err.Error()
+		}
+	case "add":
+		if sk, err := ParsePrivateKey(req.Key); err != nil {
+			resp.Error = err.Error()
+		} else {
+			a.Add(req.Name, sk)
+			wipeKey(sk)
+		}
+	case "remove":
+		a.Remove(req.Name)
+	default:
+		resp.Error = "unknown operation " + req.Op
+	}
+	return
+}
+
+func (a *KeyAgent) serveConn(conn net.Conn) {
+	defer conn.Close()
+	dec, enc := json.NewDecoder(conn), json.NewEncoder(conn)
+	for {
+		var req agentRequest
+		if err := dec.Decode(&req); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				enc.Encode(agentResponse{Error: err.Error()})
+			}
+			return
+		}
+		if enc.Encode(a.handle(&req)) != nil {
+			return
+		}
+	}
+}
+
+// Serves clients connecting to l until Close is called, in which case
+// it returns nil, or l fails.  Where the system reports who is at the
+// other end of a Unix-domain socket (on Linux), hangs up on clients
+// that run as another user.
+func (a *KeyAgent) Serve(l net.Listener) error {
+	a.mu.Lock()
+	a.listener = l
+	a.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			a.mu.Lock()
+			closed := a.listener == nil
+			a.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if checkAgentPeer(conn) != nil {
+			conn.Close()
+			continue
+		}
+		go a.serveConn(conn)
+	}
+}
+
+// Listens on the Unix-domain socket path, which only the current user
+// may connect to, and serves clients as Serve does.  Replaces a stale
+// socket left by an agent that exited uncleanly, but fails with
+// os.ErrExist if another agent is listening on path.
+//
+// So that no one else can connect between the socket's creation and
+// the restriction of its permissions, the socket is created in a new
+// directory that only the current user may enter, and moved to path
+// once its mode is 0600.
+func (a *KeyAgent) ListenAndServe(path string) error {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return &os.PathError{Op: "listen", Path: path, Err: os.ErrExist}
+	}
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".agent")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		os.Remove(dir)
+		return err
+	}
+	// The socket outlives its original name, so Close removes path
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err = os.Chmod(tmp, 0600); err == nil {
+		os.Remove(path)
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		l.Close()
+		os.Remove(tmp)
+	}
+	os.Remove(dir)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.path = path
+	a.mu.Unlock()
+	return a.Serve(l)
+}
+
+// Stops serving clients, removes the socket created by
+// ListenAndServe, and forgets all keys.
+func (a *KeyAgent) Close() error {
+	a.mu.Lock()
+	l, path := a.listener, a.path
+	a.listener, a.path = nil, ""
+	a.mu.Unlock()
+	var err error
+	if l != nil {
+		err = l.Close()
+	}
+	if path != "" {
+		os.Remove(path)
+	}
+	a.RemoveAll()
+	return err
+}
+
+// A client of a KeyAgent, identified by the path of the agent's
+// socket (e.g., AgentClient(AgentSocketPath())).
+type AgentClient string
+
+// How long an AgentClient waits for the agent to answer.
+const agentClientTimeout = 10 * time.Second
+
+func (c AgentClient) call(req *agentRequest) (*agentResponse, error) {
+	conn, err := net.DialTimeout("unix", string(c), agentClientTimeout)
+	if err != nil {
+		return nil, ErrNoAgent
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentClientTimeout))
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp agentResponse
+	if err = json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	} else if resp.Error == ErrNoSuchKey.Error() {
+		return nil, ErrNoSuchKey
+	} else if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// Hands key sk to the agent under name, for it to hold until its
+// timeout.
+func (c AgentClient) AddKey(name string, sk PrivateKey) error {
+	_, err := c.call(&agentRequest{Op: "add", Name: name, Key: sk.String()})
+	return err
+}
+
+// Tells the agent to forget the key called name.
+func (c AgentClient) RemoveKey(name string) error {
+	_, err := c.call(&agentRequest{Op: "remove", Name: name})
+	return err
+}
+
+// Returns the keys the agent holds, sorted by name.
+func (c AgentClient) List() ([]AgentKey, error) {
+	resp, err := c.call(&agentRequest{Op: "list"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// Returns the names of the keys the agent holds, or nil if the agent
+// cannot be reached.
+func (c AgentClient) KeyNames() []string {
+	keys, _ := c.List()
+	var ret []string
+	for i := range keys {
+		ret = append(ret, keys[i].Name)
+	}
+	return ret
+}
+
+// Asks the agent to sign hash with the key called name.
+func (c AgentClient) Sign(name string, hash []byte) ([]byte, error) {
+	resp, err := c.call(&agentRequest{Op: "sign", Name: name, Hash: hash})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+// A key that signs by asking an agent, so its secret never leaves the
+// agent.
+type agentSigner struct {
+	c    AgentClient
+	name string
+	pk   stx.PublicKey
+}
+
+func (s agentSigner) String() string        { return "agent:" + s.name }
+func (s agentSigner) Public() stx.PublicKey { return s.pk }
+func (s agentSigner) Sign(msg []byte) ([]byte, error) {
+	return s.c.Sign(s.name, msg)
+}
+
+// Returns a PrivateKey that signs with the key the agent holds under
+// name, by asking the agent for each signature, or ErrNoSuchKey if
+// the agent holds no such key.  The returned key works with SignTx,
+// but since its secret stays in the agent, it prints as "agent:name"
+// rather than in strkey format, and so cannot be saved.
+func (c AgentClient) Signer(name string) (PrivateKey, error) {
+	keys, err := c.List()
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	for i := range keys {
+		if keys[i].Name != name {
+			continue
+		}
+		var pk stx.PublicKey
+		if _, err = fmt.Sscan(keys[i].PublicKey, &pk); err != nil {
+			return PrivateKey{}, err
+		}
+		return PrivateKey{agentSigner{c, name, pk}}, nil
+	}
+	return PrivateKey{}, ErrNoSuchKey
+}
@@ -0,0 +1,34 @@
+package stc
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// Fails unless the process at the other end of conn, if it is a
+// Unix-domain socket, runs as the current user, going by the
+// credentials the kernel recorded when it connected (SO_PEERCRED).
+func checkAgentPeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cred *syscall.Ucred
+	if cerr := rc.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd),
+			syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); cerr != nil {
+		return cerr
+	} else if err != nil {
+		return err
+	} else if int(cred.Uid) != os.Getuid() {
+		return errors.New("key agent client belongs to another user")
+	}
+	return nil
+}
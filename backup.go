@@ -0,0 +1,186 @@
+package stc
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// One file in a backup of the configuration directory.  Name is
+// relative to ConfigPath() and uses '/' as a separator.  If Link is
+// not empty, the file is a symbolic link to Link, and Data is empty.
+type BackupEntry struct {
+	Name string
+	Mode os.FileMode
+	Link string
+	Data []byte
+}
+
+var ErrEmptyPassphrase = errors.New("Backups require a passphrase")
+
+// Returns true for files in the configuration directory that belong
+// in a backup:  keys, per-network configuration (which holds account
+// annotations and signers), and global configuration.
+func backupFile(name string) bool {
+	if strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".lock") {
+		return false
+	}
+	return strings.HasPrefix(name, "keys/") ||
+		strings.HasSuffix(name, ".net") ||
+		name == "global.conf" || name == configFileName
+}
+
+// Returns true if link, the target of symbolic link name in a backup,
+// is a relative path that stays within the configuration directory,
+// so that restoring the link cannot point it at other files.
+func backupLinkOK(name, link string) bool {
+	target := path.Join(path.Dir(name), link)
+	return link != "" && !path.IsAbs(link) && target != ".." &&
+		!strings.HasPrefix(target, "../")
+}
+
+// Returns the files in the configuration directory that a backup
+// contains, in sorted order.
+func ConfigBackupEntries() ([]BackupEntry, error) {
+	var names []string
+	for _, dir := range []string{"", "keys"} {
+		d, err := os.Open(ConfigPath(dir))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ns, err := d.Readdirnames(-1)
+		d.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range ns {
+			if n = path.Join(dir, n); backupFile(n) {
+				names = append(names, n)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var ret []BackupEntry
+	for _, n := range names {
+		p := ConfigPath(n)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return nil, err
+		}
+		be := BackupEntry{Name: n, Mode: fi.Mode() & os.ModePerm}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if be.Link, err = os.Readlink(p); err != nil {
+				return nil, err
+			}
+		} else if !fi.Mode().IsRegular() {
+			continue
+		} else if be.Data, err = ioutil.ReadFile(p); err != nil {
+			return nil, err
+		}
+		ret = append(ret, be)
+	}
+	return ret, nil
+}
+
+// Writes entries to out as a tar archive, symmetrically encrypted in
+// ASCII-armored GPG format with passphrase.  Keys that are already
+// encrypted remain encrypted with their own passphrases inside the
+// archive.
+func WriteBackup(out io.Writer, entries []BackupEntry,
+	passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return ErrEmptyPassphrase
+	}
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+	for i := range entries {
+		be := &entries[i]
+		hdr := &tar.Header{
+			Name:    be.Name,
+			Mode:    int64(be.Mode),
+			ModTime: now,
+		}
+		if be.Link != "" {
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = be.Link
+		} else {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(be.Data))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		} else if _, err = tw.Write(be.Data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	w, err := encryptArmored(out, passphrase)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\n")
+	return err
+}
+
+// Reads a backup written by WriteBackup.  Fails if the backup contains
+// a file outside the configuration directory or a symbolic link to
+// one.
+func ReadBackup(in io.Reader, passphrase []byte) ([]BackupEntry, error) {
+	body, err := decryptArmored(in, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var ret []BackupEntry
+	tr := tar.NewReader(body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || strings.HasPrefix(name, "../") ||
+			!backupFile(name) {
+			return nil, errors.New("Invalid file name in backup: " + hdr.Name)
+		}
+		be := BackupEntry{Name: name, Mode: os.FileMode(hdr.Mode) & os.ModePerm}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			if !backupLinkOK(name, hdr.Linkname) {
+				return nil, errors.New("Invalid symbolic link in backup: " +
+					hdr.Name + " -> " + hdr.Linkname)
+			}
+			be.Link = hdr.Linkname
+		case tar.TypeReg:
+			if be.Data, err = ioutil.ReadAll(tr); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		ret = append(ret, be)
+	}
+	return ret, nil
+}
@@ -0,0 +1,426 @@
+package stc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// A transaction in a Bundle.
+type BundleTx struct {
+	// Name by which other transactions in the bundle refer to this
+	// one.
+	Label string
+
+	// Labels of transactions that must succeed before this one is
+	// submitted.
+	After []string
+
+	*TransactionEnvelope
+}
+
+// A Bundle holds several related transactions (for example, the ones
+// that set up an escrow account) that must be submitted in an order
+// consistent with their dependencies.  In text form, each transaction
+// is in txrep format, preceded by a header line of the form
+//
+//	=== LABEL [after LABEL1 LABEL2 ...]
+//
+// Lines before the first header may contain only comments.
+type Bundle []*BundleTx
+
+// Prefix of the header line that starts each transaction of a bundle.
+const bundleHeader = "=== "
+
+// Error passed to PostBundle's callback for a transaction that was
+// not submitted because a transaction it comes after failed.
+var ErrDependencyFailed = errors.New("an earlier transaction it " +
+	"depends on failed")
+
+// Returns true if input looks like a Bundle in text form, meaning the
+// first line that is neither blank nor a comment is a bundle header.
+func IsBundle(input string) bool {
+	for _, line := range strings.Split(input, "\n") {
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+			return strings.HasPrefix(line, bundleHeader)
+		}
+	}
+	return false
+}
+
+func (bt *BundleTx) header() string {
+	if len(bt.After) == 0 {
+		return bundleHeader + bt.Label
+	}
+	return bundleHeader + bt.Label + " after " + strings.Join(bt.After, " ")
+}
+
+// Renders a Bundle in text form, with each transaction in txrep.
+func (net *StellarNet) BundleToRep(b Bundle) string {
+	out := &strings.Builder{}
+	for i, bt := range b {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintln(out, bt.header())
+		out.WriteString(net.TxToRep(bt.TransactionEnvelope))
+	}
+	return out.String()
+}
+
+// Parses a Bundle in text form.  Errors are of type
+// stcdetail.TxrepError, with line numbers counted from the start of
+// input.  Checks that labels are unique and that every label after
+// "after" names a transaction in the bundle, but not for cycles (see
+// Order).
+func BundleFromRep(input string,
+	dialect stcdetail.TxrepDialect) (Bundle, error) {
+	return bundleFromRep(input, dialect, false)
+}
+
+// Like BundleFromRep, but reject fields that transactions do not use,
+// as TxFromRepStrict does.
+func BundleFromRepStrict(input string,
+	dialect stcdetail.TxrepDialect) (Bundle, error) {
+	return bundleFromRep(input, dialect, true)
+}
+
+func bundleFromRep(input string, dialect stcdetail.TxrepDialect,
+	strict bool) (Bundle, error) {
+	var b Bundle
+	var errs stcdetail.TxrepError
+	fail := func(line int, f string, args ...interface{}) {
+		errs = append(errs, struct {
+			Line int
+			Msg  string
+		}{line, fmt.Sprintf(f, args...)})
+	}
+	lines := strings.SplitAfter(input, "\n")
+	headers := map[string]int{}
+	parse := func(start, end int) {
+		if start == 0 {
+			return
+		}
+		e, err := txFromRep(strings.Join(lines[start:end], ""),
+			dialect, strict, nil)
+		if te, ok := err.(stcdetail.TxrepError); ok {
+			for i := range te {
+				fail(te[i].Line+start, "%s", te[i].Msg)
+			}
+		} else if err != nil {
+			fail(start, "%s", err)
+		}
+		b[len(b)-1].TransactionEnvelope = e
+	}
+	start := 0
+	for i, line := range lines {
+		if !strings.HasPrefix(line, bundleHeader) {
+			if trimmed := strings.TrimSpace(line); start == 0 &&
+				trimmed != "" && trimmed[0] != '#' {
+				fail(i+1, "expected %q line", bundleHeader+"LABEL")
+				return nil, errs
+			}
+			continue
+		}
+		parse(start, i)
+		start = i + 1
+		words := strings.Fields(line[len(bundleHeader):])
+		bt := &BundleTx{}
+		if len(words) == 0 {
+			fail(i+1, "missing label")
+		} else if len(words) > 1 && words[1] != "after" {
+			fail(i+1, "expected \"after\" following label %s", words[0])
+		} else {
+			bt.Label = words[0]
+			if len(words) > 1 {
+				bt.After = words[2:]
+			}
+			if prev, ok := headers[bt.Label]; ok {
+				fail(i+1, "label %s already used on line %d", bt.Label, prev)
+			}
+			headers[bt.Label] = i + 1
+		}
+		b = append(b, bt)
+	}
+	parse(start, len(lines))
+	for _, bt := range b {
+		for _, dep := range bt.After {
+			if _, ok := headers[dep]; !ok {
+				fail(headers[bt.Label], "unknown label %s", dep)
+			}
+		}
+	}
+	if len(b) == 0 {
+		fail(1, "bundle contains no transactions")
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return b, nil
+}
+
+// Returns the transactions of a Bundle in an order in which they can
+// be submitted, with each transaction after the ones it depends on
+// and otherwise in the order of the bundle.  Fails if the
+// dependencies contain a cycle or an unknown label.
+func (b Bundle) Order() (Bundle, error) {
+	done := make(map[string]bool, len(b))
+	labels := make(map[string]bool, len(b))
+	for _, bt := range b {
+		labels[bt.Label] = true
+	}
+	ret := make(Bundle, 0, len(b))
+	for len(ret) < len(b) {
+		progress := false
+	next:
+		for _, bt := range b {
+			if done[bt.Label] {
+				continue
+			}
+			for _, dep := range bt.After {
+				if !labels[dep] {
+					return nil, fmt.Errorf("%s: unknown label %s",
+						bt.Label, dep)
+				} else if !done[dep] {
+					continue next
+				}
+			}
+			done[bt.Label] = true
+			ret = append(ret, bt)
+			progress = true
+			break
+		}
+		if !progress {
+			var stuck []string
+			for _, bt := range b {
+				if !done[bt.Label] {
+					stuck = append(stuck, bt.Label)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle among %s",
+				strings.Join(stuck, ", "))
+		}
+	}
+	return ret, nil
+}
+
+// Posts the transactions of a Bundle in the order returned by Order,
+// calling report with the result of each.  A transaction that comes
+// after one that failed is not submitted, and report gets
+// ErrDependencyFailed for it.  Only returns an error if the bundle
+// cannot be ordered, in which case nothing is submitted.
+func (net *StellarNet) PostBundle(b Bundle,
+	report func(bt *BundleTx, res *TransactionResult, err error)) error {
+	order, err := b.Order()
+	if err != nil {
+		return err
+	}
+	failed := map[string]bool{}
+	for _, bt := range order {
+		var res *TransactionResult
+		var err error
+		for _, dep := range bt.After {
+			if failed[dep] {
+				err = ErrDependencyFailed
+				break
+			}
+		}
+		if err == nil {
+			res, err = net.Post(bt.TransactionEnvelope)
+		}
+		if err != nil {
+			failed[bt.Label] = true
+		}
+		if report != nil {
+			report(bt, res, err)
+		}
+	}
+	return nil
+}
+
+// Outcome of SubmitBundle:  which transactions executed, which one
+// failed, and which were never submitted.
+type BundleReport struct {
+	// Transactions that executed, in the order they were submitted
+	Executed []*BundleTx
+	// Result of each transaction in Executed
+	Results []*TransactionResult
+
+	// The transaction at which SubmitBundle stopped and why, or nil
+	// if every transaction executed
+	Failed *BundleTx
+	Err    error
+	// True if Failed may have executed anyway, because horizon never
+	// reported its outcome
+	Unknown bool
+
+	// Transactions after Failed, which were not submitted
+	NotSubmitted []*BundleTx
+}
+
+// Returns true if every transaction executed.
+func (r *BundleReport) Success() bool {
+	return r.Failed == nil
+}
+
+// Renders the report with one line per transaction, in the order
+// SubmitBundle handled them.
+func (r *BundleReport) String() string {
+	out := &strings.Builder{}
+	for i, bt := range r.Executed {
+		fmt.Fprintf(out, "executed: %s (%s)\n", bt.Label,
+			r.Results[i].Result.Code)
+	}
+	if r.Unknown {
+		fmt.Fprintf(out, "UNKNOWN: %s may or may not have executed: %s\n",
+			r.Failed.Label, r.Err)
+	} else if r.Failed != nil {
+		fmt.Fprintf(out, "FAILED: %s: %s\n", r.Failed.Label, r.Err)
+	}
+	for _, bt := range r.NotSubmitted {
+		fmt.Fprintf(out, "not submitted: %s\n", bt.Label)
+	}
+	return out.String()
+}
+
+// How often SubmitBundle retries a transaction whose submission timed
+// out, and how long it keeps trying before giving up with the outcome
+// unknown.  Horizon times out waiting for a transaction to be
+// included in a ledger when the network is congested.
+var (
+	bundlePostRetry = 5 * time.Second
+	bundlePostWait  = 2 * time.Minute
+)
+
+// Like PostBundle, but stops at the first failure, which suits
+// bundles whose later transactions need the effects of earlier ones,
+// such as accounts they create.  Transactions are submitted one at a
+// time, in the order returned by Order, each once the one before it
+// has been included in a ledger.  A transaction whose sequence number
+// is 0 gets the next one its source account has not used, counting
+// the transactions before it in the bundle; this is fetched from the
+// network when it is needed, so accounts created by earlier
+// transactions work.  Since that changes what must be signed, prepare
+// (if not nil) is called on each transaction just before it is
+// submitted, for instance to sign it, and an error from prepare also
+// stops the submission.  If horizon times out or is unavailable,
+// SubmitBundle retries until it learns the outcome, ctx is Done, or
+// two minutes pass.  Only returns an error if the bundle cannot be
+// ordered, in which case nothing is submitted.
+func (net *StellarNet) SubmitBundle(ctx context.Context, b Bundle,
+	prepare func(bt *BundleTx) error) (*BundleReport, error) {
+	order, err := b.Order()
+	if err != nil {
+		return nil, err
+	}
+	ret := &BundleReport{}
+	next := map[string]stx.SequenceNumber{}
+	for i, bt := range order {
+		var res *TransactionResult
+		unknown := false
+		err := net.reserveSeq(bt.TransactionEnvelope, next)
+		if err == nil && prepare != nil {
+			err = prepare(bt)
+		}
+		if err == nil {
+			res, unknown, err = net.postAndWait(ctx, bt.TransactionEnvelope)
+		}
+		if err != nil {
+			ret.Failed, ret.Err, ret.Unknown = bt, err, unknown
+			ret.NotSubmitted = order[i+1:]
+			break
+		}
+		ret.Executed = append(ret.Executed, bt)
+		ret.Results = append(ret.Results, res)
+	}
+	return ret, nil
+}
+
+// Sets e's sequence number, if it is 0, to the next one for its source
+// account, which is next[source] or else fetched from the network.
+// Then records in next the sequence number after e's.
+func (net *StellarNet) reserveSeq(e *TransactionEnvelope,
+	next map[string]stx.SequenceNumber) error {
+	seq := stcdetail.TxSeqNum(e.TransactionEnvelope)
+	if seq == nil {
+		return nil
+	}
+	tx := e.TransactionEnvelope
+	if e.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		tx = e.InnerTx().TransactionEnvelope
+	}
+	src, _ := txSourceOps(tx)
+	if *seq == 0 {
+		n, ok := next[src]
+		if !ok {
+			ae, err := net.GetAccountEntry(src)
+			if err != nil {
+				return fmt.Errorf("reserving sequence number: %s", err)
+			} else if n = ae.NextSeq(); n == 0 {
+				return fmt.Errorf("reserving sequence number: %s has "+
+					"no next sequence number", src)
+			}
+		}
+		*seq = n
+	}
+	if n, err := stcdetail.NextSeq(*seq); err == nil {
+		next[src] = n
+	} else {
+		delete(next, src)
+	}
+	return nil
+}
+
+// Reports whether err, returned by Post, leaves open whether the
+// transaction reached the network (as when horizon times out waiting
+// for it to be included in a ledger).
+func postUncertain(err error) bool {
+	if he, ok := err.(*stcdetail.HTTPerror); ok {
+		return he.Resp.StatusCode >= 500
+	}
+	return IsTemporary(err)
+}
+
+// Posts e, retrying while horizon is rate limiting requests or its
+// outcome is uncertain, until it learns the outcome, ctx is Done, or
+// bundlePostWait passes.  unknown is true if e might have executed
+// although err is not nil.
+func (net *StellarNet) postAndWait(ctx context.Context,
+	e *TransactionEnvelope) (res *TransactionResult, unknown bool,
+	err error) {
+	deadline := time.Now().Add(bundlePostWait)
+	for {
+		res, err = net.Post(e)
+		if tf, ok := err.(TxFailure); ok && unknown &&
+			tf.Result.Code == stx.TxBAD_SEQ {
+			// An earlier attempt may have executed and used up the
+			// sequence number
+			if r, gerr := net.GetTxResult(
+				fmt.Sprintf("%x", *net.HashTx(e))); gerr == nil {
+				if c := r.Result.Result.Code; c != stx.TxSUCCESS &&
+					c != stx.TxFEE_BUMP_INNER_SUCCESS {
+					return nil, false, TxFailure{&r.Result}
+				}
+				return &r.Result, false, nil
+			}
+		}
+		if err == nil {
+			return res, false, nil
+		}
+		delay, retry := retryDelay(err, bundlePostRetry)
+		if postUncertain(err) {
+			unknown, retry = true, true
+		}
+		if !retry {
+			return nil, false, err
+		} else if ctx.Err() != nil || time.Now().Add(delay).After(deadline) {
+			return nil, unknown, err
+		}
+		sleepCtx(ctx, delay)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	. "github.com/xdrpp/stc"
+)
+
+// Account entries fetched from the network during one run of stc, so
+// that getAccounts, fixTx, and -inspect, which often need the same
+// accounts, query each account only once and agree on its state.
+type accountCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedAccount
+}
+
+type cachedAccount struct {
+	once sync.Once
+	ae   *HorizonAccountEntry
+	err  error
+}
+
+var accountEntries accountCache
+
+// Returns the entry for account acct on net, fetching it the first
+// time it is requested.  Concurrent requests for the same account
+// share one query.  Failures are cached too, so each account is
+// queried at most once per run.
+func (c *accountCache) get(net *StellarNet, acct string) (
+	*HorizonAccountEntry, error) {
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[string]*cachedAccount{}
+	}
+	ca, ok := c.entries[acct]
+	if !ok {
+		ca = &cachedAccount{}
+		c.entries[acct] = ca
+	}
+	c.mu.Unlock()
+	ca.once.Do(func() {
+		ca.ae, ca.err = net.GetAccountEntry(acct)
+	})
+	return ca.ae, ca.err
+}
+
+// Returns the oldest and newest ledgers as of which cached entries
+// were fetched, or 0, 0 if horizon did not say or no entries were
+// fetched.  Must not be called while fetches are in progress.
+func (c *accountCache) ledgers() (oldest, newest uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ca := range c.entries {
+		if ca.ae == nil || ca.ae.LatestLedger == 0 {
+			continue
+		}
+		if l := ca.ae.LatestLedger; oldest == 0 || l < oldest {
+			oldest = l
+		}
+		if l := ca.ae.LatestLedger; l > newest {
+			newest = l
+		}
+	}
+	return
+}
+
+// Describes how fresh the cached entries are, e.g., "ledger 1234",
+// or returns "" if unknown.
+func (c *accountCache) freshness() string {
+	switch oldest, newest := c.ledgers(); {
+	case newest == 0:
+		return ""
+	case oldest == newest:
+		return fmt.Sprintf("ledger %d", newest)
+	default:
+		return fmt.Sprintf("ledgers %d to %d", oldest, newest)
+	}
+}
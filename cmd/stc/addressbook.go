@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// Implements -export-addresses:  writes the network's account
+// annotations and signers to file (or standard output if file is
+// "-").
+func doExportAddresses(net *StellarNet, file string) {
+	var out strings.Builder
+	net.GetNetworkId()
+	net.GetAddressBook().WriteTo(&out)
+	var err error
+	if file == "-" {
+		fmt.Print(out.String())
+	} else if !dryRunWrite(file, out.String()) {
+		err = stcdetail.SafeCreateFile(file, out.String(), 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Asks the user which comment to keep when an imported address book
+// disagrees with the network configuration.
+func askConflict(kind, key, old, new string) string {
+	fmt.Printf("%s %s:\n  existing: %s\n  imported: %s\n", kind, key,
+		old, new)
+	if askYesNo("Replace existing comment") {
+		return new
+	}
+	return old
+}
+
+// Implements -import-addresses:  merges an address book written by
+// -export-addresses into the network configuration.  onConflict is
+// "ask", "keep", or "replace".
+func doImportAddresses(net *StellarNet, file, onConflict string) {
+	resolve := map[string]ConflictResolver{
+		"ask":     askConflict,
+		"keep":    KeepExisting,
+		"replace": ReplaceExisting,
+	}[onConflict]
+	if resolve == nil {
+		fmt.Fprintf(stderr, "invalid -on-conflict %q\n", onConflict)
+		os.Exit(2)
+	}
+	var input []byte
+	var err error
+	if file == "-" {
+		input, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		input, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	ab, err := ReadAddressBook(file, input)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	} else if ab.NetworkId != "" && ab.NetworkId != net.GetNetworkId() {
+		fmt.Fprintf(stderr, "%s: address book is for network %q\n",
+			file, ab.NetworkId)
+		os.Exit(1)
+	}
+	n := net.ImportAddressBook(ab, resolve)
+	mustSaveNet(net)
+	fmt.Printf("imported %d entries\n", n)
+}
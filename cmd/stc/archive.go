@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// Namespace of archival signatures, which keeps ssh-keygen from
+// accepting signatures made for other purposes with the same key.
+const archiveNamespace = "stc-archive"
+
+// Suffix of the file holding the archival signature of a file.
+const archiveSuffix = ".sig"
+
+// Runs ssh-keygen with args and input on standard input, returning
+// its standard output.  Standard error goes to the terminal, so that
+// ssh-keygen can prompt for a passphrase and report problems.
+func sshKeygen(input string, args ...string) (string, error) {
+	cmd := exec.Command("ssh-keygen", args...)
+	cmd.Stdin = strings.NewReader(input)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	return out.String(), err
+}
+
+// If net.archive-key is set, adds to txn an archival signature of
+// contents, which txn also writes to file.
+func archiveSign(txn *stcdetail.FileTxn, file, contents string) error {
+	if netConf.archiveKey == "" {
+		return nil
+	}
+	sig, err := sshKeygen(contents, "-q", "-Y", "sign",
+		"-f", netConf.archiveKey, "-n", archiveNamespace)
+	if err != nil {
+		return fmt.Errorf("cannot make archival signature of %s: %s",
+			file, err)
+	}
+	return txn.WriteFile(file+archiveSuffix, sig, 0666)
+}
+
+// Writes contents to file, along with its archival signature if
+// net.archive-key is set.
+func writeArchived(file, contents string) error {
+	if dryRunWrite(file, contents) {
+		return nil
+	}
+	var txn stcdetail.FileTxn
+	err := txn.WriteFile(file, contents, 0666)
+	if err == nil {
+		err = archiveSign(&txn, file, contents)
+	}
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	return txn.Commit()
+}
+
+// Implements -verify-archive:  checks the archival signature of
+// file, against the keys in net.archive-signers if set, and exits 1 if
+// it is missing or does not verify.
+func doVerifyArchive(file string) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	sigfile := file + archiveSuffix
+	if _, err = os.Stat(sigfile); err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	var out string
+	if netConf.archiveSigners == "" {
+		out, err = sshKeygen(string(contents), "-Y", "check-novalidate",
+			"-n", archiveNamespace, "-s", sigfile)
+	} else {
+		var principals string
+		principals, err = sshKeygen("", "-Y", "find-principals",
+			"-f", netConf.archiveSigners, "-s", sigfile)
+		if p := strings.Fields(principals); err == nil && len(p) > 0 {
+			out, err = sshKeygen(string(contents), "-Y", "verify",
+				"-f", netConf.archiveSigners, "-I", p[0],
+				"-n", archiveNamespace, "-s", sigfile)
+		} else if err == nil {
+			err = fmt.Errorf("no principals")
+		}
+	}
+	fmt.Print(out)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: archival signature does not verify\n",
+			file)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stx"
+)
+
+// One line of the audit log, which records every signature stc makes.
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Network string    `json:"network"`
+	TxHash  string    `json:"txhash"`
+	Signer  string    `json:"signer"`
+	// Key file used, or empty if the key was typed in
+	Key  string `json:"key,omitempty"`
+	File string `json:"file"`
+}
+
+func auditLogPath() string {
+	return ConfigPath("audit.log")
+}
+
+// Appends to the audit log a record of the signature that key (whose
+// public key is signer) made of a transaction with hash h in file
+// (or "-" for standard input), which is logged as an absolute path.
+// The log is only ever appended to, one
+// JSON object per line.
+func auditSignature(net *StellarNet, h *stx.Hash, signer, key,
+	file string) error {
+	if file != "-" {
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+	}
+	line, err := json.Marshal(auditEntry{
+		Time:    time.Now().UTC(),
+		Network: net.Name,
+		TxHash:  fmt.Sprintf("%x", h[:]),
+		Signer:  signer,
+		Key:     key,
+		File:    file,
+	})
+	if err != nil {
+		return err
+	}
+	path := auditLogPath()
+	if dryRunSkip("record signature by %s in %s", signer, path) {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot record signature in audit log: %s", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return fmt.Errorf("cannot record signature in audit log: %s", err)
+	}
+	return nil
+}
+
+// Implements -audit-log:  prints one line per logged signature.
+func doAuditLog() {
+	f, err := os.Open(auditLogPath())
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			fmt.Fprintf(stderr, "%s:%d: %s\n", auditLogPath(), lineno, err)
+			continue
+		}
+		key := e.Key
+		if key == "" {
+			key = "-"
+		}
+		fmt.Printf("%s %s %s %s %s %s\n",
+			e.Time.Local().Format(time.RFC3339), e.Network, e.TxHash,
+			e.Signer, key, e.File)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// Implements -backup-keys:  writes an encrypted archive of the keys
+// and network configuration in $STCDIR to file (or standard output if
+// file is "-").
+func doBackupKeys(file string) {
+	entries, err := ConfigBackupEntries()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	var out strings.Builder
+	err = WriteBackup(&out, entries,
+		stcdetail.GetPass2("Passphrase for backup: "))
+	if err == nil {
+		if file == "-" {
+			fmt.Print(out.String())
+		} else if dryRunSkip("write backup to %s", file) {
+			return
+		} else {
+			err = stcdetail.SafeCreateFile(file, out.String(), 0600)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(stderr, "backed up %d files\n", len(entries))
+}
+
+// Returns true if be matches what is already at path.
+func sameAsBackup(path string, be *BackupEntry) bool {
+	if be.Link != "" {
+		link, err := os.Readlink(path)
+		return err == nil && link == be.Link
+	}
+	data, err := ioutil.ReadFile(path)
+	return err == nil && bytes.Equal(data, be.Data)
+}
+
+// Implements -restore-keys:  restores files from a backup into
+// $STCDIR, asking before replacing any file that differs.
+func doRestoreKeys(file string) {
+	var input []byte
+	var err error
+	if file == "-" {
+		input, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		input, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	entries, err := ReadBackup(bytes.NewReader(input),
+		stcdetail.GetPass("Passphrase for backup: "))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+
+	if !dryRun {
+		os.MkdirAll(ConfigPath("keys"), 0700)
+	}
+	restored := 0
+	for i := range entries {
+		be := &entries[i]
+		path := ConfigPath(be.Name)
+		if _, err := os.Lstat(path); err == nil {
+			if sameAsBackup(path, be) ||
+				!askYesNo(fmt.Sprintf("%s differs from backup; replace it",
+					be.Name)) {
+				continue
+			}
+		}
+		if dryRunSkip("restore %s", be.Name) {
+			continue
+		} else if be.Link != "" {
+			os.Remove(path)
+			err = os.Symlink(be.Link, path)
+		} else {
+			err = stcdetail.SafeWriteFile(path, string(be.Data), be.Mode)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			continue
+		}
+		restored++
+	}
+	fmt.Fprintf(stderr, "restored %d of %d files\n", restored,
+		len(entries))
+}
+
+// Implements -split-key:  prints n shares of the key in file, one per
+// line, any k of which can recover it with -join-key.
+func doSplitKey(file, ks, ns string) {
+	k, err1 := strconv.Atoi(ks)
+	n, err2 := strconv.Atoi(ns)
+	if err1 != nil || err2 != nil {
+		fmt.Fprintln(stderr, "-split-key: K and N must be integers")
+		os.Exit(2)
+	}
+	sk, err := LoadPrivateKey(file)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	shares, err := sk.SplitKey(k, n)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	for _, s := range shares {
+		fmt.Println(s)
+	}
+}
+
+// Implements -join-key:  reads shares from standard input, one per
+// line, until a blank line or end of file.  Saves the recovered key
+// to file, or prints it if file is empty.
+func doJoinKey(file string) {
+	fmt.Fprintln(stderr,
+		"Enter key shares, one per line, followed by a blank line:")
+	in := bufio.NewReader(os.Stdin)
+	var shares []string
+	for {
+		line, err := stcdetail.ReadTextLine(in)
+		if s := strings.TrimSpace(string(line)); s != "" {
+			shares = append(shares, s)
+		} else if len(shares) > 0 {
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+	if stcdetail.PassphraseFile == os.Stdin && in.Buffered() > 0 {
+		// Passphrase follows the shares in piped input
+		stcdetail.PassphraseFile = in
+	}
+	sk, err := JoinKeyShares(shares)
+	if err == nil && file != "" &&
+		!dryRunSkip("save key %s to %s", sk.Public(), file) {
+		err = sk.Save(file, stcdetail.GetPass2("Passphrase: "))
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	if file == "" {
+		fmt.Println(sk)
+	}
+	fmt.Println(sk.Public())
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Fewest transactions -bump-seq will leave an account able to submit
+// without -force.  New accounts start at their creation ledger times
+// 2^32, so this is the room one ledger's worth of sequence numbers
+// gives.
+const bumpSeqMinHeadroom = 1 << 32
+
+// Parses the TARGET argument of -bump-seq, which is either an
+// absolute sequence number or +N to skip N sequence numbers past the
+// one the bump transaction itself uses (next).
+func parseBumpTarget(arg string, next stx.SequenceNumber) (
+	stx.SequenceNumber, error) {
+	if strings.HasPrefix(arg, "+") {
+		n, err := strconv.ParseInt(arg[1:], 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid sequence number increment %q", arg)
+		}
+		return stcdetail.AddSeq(next, n)
+	}
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sequence number %q", arg)
+	}
+	return stx.SequenceNumber(n), nil
+}
+
+// Implements -bump-seq:  builds a transaction from account acct (with
+// the current sequence number and fee) whose only operation raises
+// acct's sequence number to target, which is how to invalidate
+// pre-signed or leaked transactions.  Warns about the sequence
+// numbers this skips, and exits without building anything if target
+// would leave acct fewer than bumpSeqMinHeadroom transactions, unless
+// force is true.
+func bumpSeqTx(net *StellarNet, acct, target string,
+	force bool) *TransactionEnvelope {
+	acct = mustResolveAccount(net, acct)
+	var id AccountID
+	if _, err := fmt.Sscan(acct, &id); err != nil {
+		fmt.Fprintln(stderr, "syntactically invalid account")
+		os.Exit(1)
+	}
+	ae, err := net.GetAccountEntry(acct)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	cur := stx.SequenceNumber(ae.Sequence)
+	next, err := stcdetail.NextSeq(cur)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s is at sequence number %d and can never "+
+			"submit another transaction\n", acct, cur)
+		os.Exit(1)
+	}
+	to, err := parseBumpTarget(target, next)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(2)
+	}
+	op, err := stcdetail.BumpSeqOp(to)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(2)
+	} else if to <= next {
+		fmt.Fprintf(stderr, "bumping to %d has no effect, since the "+
+			"bump transaction itself uses sequence number %d\n", to, next)
+		os.Exit(1)
+	}
+
+	refuse := false
+	if left := stcdetail.SeqHeadroom(to); left == 0 {
+		fmt.Fprintf(stderr, "warning: %d is the largest sequence number; "+
+			"%s could never submit another transaction\n", to, acct)
+		refuse = true
+	} else if left < bumpSeqMinHeadroom {
+		fmt.Fprintf(stderr, "warning: bumping to %d leaves %s room for "+
+			"only %d more transactions\n", to, acct, left)
+		refuse = true
+	}
+	if refuse && !force {
+		fmt.Fprintln(stderr, "not bumping; use -force to bump anyway")
+		os.Exit(1)
+	}
+	if to-next == 1 {
+		fmt.Fprintf(stderr, "warning: any transaction for %s with "+
+			"sequence number %d, including pre-signed ones, will never "+
+			"be valid\n", acct, to)
+	} else {
+		fmt.Fprintf(stderr, "warning: transactions for %s with sequence "+
+			"numbers %d through %d (%d in all), including pre-signed ones, "+
+			"will never be valid\n", acct, next+1, to, to-next)
+	}
+	npreauth := 0
+	for i := range ae.Signers {
+		if ae.Signers[i].Key.Type == stx.SIGNER_KEY_TYPE_PRE_AUTH_TX {
+			npreauth++
+		}
+	}
+	if npreauth > 0 {
+		fmt.Fprintf(stderr, "warning: %s has %d pre-authorized "+
+			"transaction signer(s), whose transactions may be among "+
+			"them\n", acct, npreauth)
+	}
+
+	e := NewTransactionEnvelope()
+	e.SetSourceAccount(id)
+	e.V1().Tx.SeqNum = next
+	e.Append(nil, BumpSequence(op))
+	if fs, err := net.GetFeeStats(); err != nil {
+		fmt.Fprintf(stderr, "error fetching fee stats: %s\n", err)
+		os.Exit(1)
+	} else {
+		e.SetFee(fs.Percentile(20))
+	}
+	return e
+}
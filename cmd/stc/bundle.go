@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Reads the bundle in file infile, or returns nil if infile is
+// standard input or does not contain a bundle.
+func readBundle(infile string) Bundle {
+	if infile == "-" {
+		return nil
+	}
+	input, err := ioutil.ReadFile(infile)
+	if err != nil || !IsBundle(string(input)) {
+		return nil
+	}
+	var b Bundle
+	if txrepStrict {
+		b, err = BundleFromRepStrict(string(input), txrepDialect)
+	} else {
+		b, err = BundleFromRep(string(input), txrepDialect)
+	}
+	if err != nil {
+		fmt.Fprint(stderr,
+			ParseError{err.(stcdetail.TxrepError), infile}.Error())
+		os.Exit(1)
+	}
+	return b
+}
+
+// Implements -edit for a bundle, editing all of its transactions as
+// one file.
+func doEditBundle(net *StellarNet, arg string, b Bundle) {
+	for _, bt := range b {
+		getAccounts(net, bt.TransactionEnvelope, false)
+	}
+
+	path := newDraftFile(net)
+	defer shredDrafts()
+
+	var err error
+	var contents, lastcontents []byte
+	var history [][]byte
+	var warned bool
+	for {
+		if err == nil {
+			lastcontents = draftContents(net.BundleToRep(b), &warned)
+			ioutil.WriteFile(path, lastcontents, 0600)
+			if n := len(history); n == 0 ||
+				!bytes.Equal(history[n-1], lastcontents) {
+				history = append(history, lastcontents)
+				if n >= editHistory {
+					history = history[1:]
+				}
+			}
+		}
+
+		line := firstDifferentLine(contents, lastcontents)
+		if err != nil {
+			fmt.Fprint(stderr, err.Error())
+			if pe, ok := err.(ParseError); ok {
+				line = pe.TxrepError[0].Line
+			}
+			if old := promptUndo(&history); old != nil {
+				// Earlier versions parsed successfully when saved
+				b, _ = BundleFromRep(string(old), txrepDialect)
+				lastcontents, contents, err = old, old, nil
+				ioutil.WriteFile(path, old, 0600)
+				line = 1
+			}
+		}
+		editor(fmt.Sprintf("+%d", line), path)
+
+		contents, err = ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			exit(1)
+		}
+		if bytes.Equal(contents, lastcontents) {
+			break
+		}
+		newb, pe := BundleFromRep(string(contents), txrepDialect)
+		if pe != nil {
+			err = ParseError{pe.(stcdetail.TxrepError), path}
+		} else {
+			err = nil
+			b = newb
+		}
+	}
+
+	shredDrafts()
+	if err := writeArchived(arg, net.BundleToRep(b)); err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// Implements -post for a bundle, read from file, exiting with
+// status 1 unless every transaction executes.  If sign is true,
+// signs each transaction whose sequence number SubmitBundle fills in
+// with the key in key (prompting for it once if key is empty).
+func doPostBundle(net *StellarNet, b Bundle, file string, sign bool,
+	key string) {
+	if dryRun {
+		order, err := b.Order()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+		for _, bt := range order {
+			dryRunSkip("post transaction %s to network %s", bt.Label,
+				net.Name)
+		}
+		return
+	}
+	var sk PrivateKey
+	reserved := map[*BundleTx]bool{}
+	if sign {
+		for _, bt := range b {
+			seq := stcdetail.TxSeqNum(
+				bt.TransactionEnvelope.TransactionEnvelope)
+			if seq != nil && *seq == 0 {
+				reserved[bt] = true
+			}
+		}
+		var err error
+		if len(reserved) > 0 {
+			if sk, err = loadSigningKey(key); err != nil {
+				os.Exit(1)
+			}
+		}
+	}
+	report, err := net.SubmitBundle(context.Background(), b,
+		func(bt *BundleTx) error {
+			if !reserved[bt] {
+				return nil
+			}
+			feeBump := bt.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP
+			return signTxWith(net, sk, key, bt.TransactionEnvelope, file,
+				true, feeBump)
+		})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	for i, bt := range report.Executed {
+		runPostHooks(net, bt.Label, bt.TransactionEnvelope, report.Results[i])
+	}
+	fmt.Print(report)
+	if tf, ok := report.Err.(TxFailure); ok {
+		printResultHints(tf)
+	}
+	if !report.Success() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/xdrpp/goxdr/xdr"
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// A problem found by -check, in a form easy for editor plugins to
+// consume.  Lines and columns start at 1.
+type checkDiagnostic struct {
+	Line        int      `json:"line"`
+	Column      int      `json:"column"`
+	Severity    string   `json:"severity"`
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// Returns the column at which the value starts on a txrep line, or 1
+// if the line has no value.
+func valueColumn(line string) int {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return 1
+	}
+	for i++; i < len(line) && line[i] == ' '; i++ {
+	}
+	return i + 1
+}
+
+// Returns symbolic values that could go in field name of e.
+func fieldValues(e *TransactionEnvelope, name string) []string {
+	if strings.HasSuffix(name, "._present") {
+		return []string{"true", "false"}
+	}
+	v, ok := stcdetail.GetTxrepField(e, name).(xdr.XdrEnum)
+	if !ok {
+		return nil
+	}
+	var ret []string
+	for _, n := range v.XdrEnumNames() {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func readCheckFile(file string) (string, *TransactionEnvelope, error) {
+	var input []byte
+	var err error
+	if file == "-" {
+		input, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		input, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	e, err := txFromRep(string(input))
+	return string(input), e, err
+}
+
+// Implements -check:  writes a JSON array of diagnostics for a txrep
+// file to standard output, and exits 1 if there are any errors.
+// Problems with the size or fee of a transaction that parses are
+// warnings.
+func doCheck(file string) {
+	input, e, err := readCheckFile(file)
+	lines := strings.Split(input, "\n")
+	diags := []checkDiagnostic{}
+	if te, ok := err.(stcdetail.TxrepError); ok {
+		for _, pe := range te {
+			d := checkDiagnostic{
+				Line:     pe.Line,
+				Severity: "error",
+				Message:  pe.Msg,
+			}
+			if pe.Line > 0 && pe.Line <= len(lines) {
+				line := lines[pe.Line-1]
+				d.Column = valueColumn(line)
+				if i := strings.IndexByte(line, ':'); i > 0 {
+					d.Suggestions = fieldValues(e, line[:i])
+				}
+			}
+			diags = append(diags, d)
+		}
+	}
+	nerrs := len(diags)
+	if err == nil {
+		problems := stcdetail.TxSize(e.TransactionEnvelope).Problems()
+		problems = append(problems,
+			stcdetail.SeqProblems(e.TransactionEnvelope)...)
+		for _, p := range problems {
+			diags = append(diags, checkDiagnostic{
+				Line:     1,
+				Column:   1,
+				Severity: "warning",
+				Message:  p,
+			})
+		}
+	}
+	out, _ := json.MarshalIndent(diags, "", "  ")
+	fmt.Println(string(out))
+	if nerrs > 0 {
+		os.Exit(1)
+	}
+}
+
+// Implements -check -complete LINE[:COL]:  writes a JSON array of
+// possible completions for the text to the left of the cursor.
+// Before the colon, completions are field names the transaction
+// would contain; after it, they are symbolic values for the field.
+func doComplete(file string, pos string) {
+	var lineno, col int
+	if n, _ := fmt.Sscanf(pos, "%d:%d", &lineno, &col); n < 1 || lineno < 1 {
+		fmt.Fprintf(stderr, "invalid position %q (want LINE[:COL])\n", pos)
+		os.Exit(2)
+	}
+	input, e, _ := readCheckFile(file)
+	lines := strings.Split(input, "\n")
+	var line string
+	if lineno <= len(lines) {
+		line = strings.TrimRight(lines[lineno-1], "\r")
+	}
+	if col >= 1 && col-1 < len(line) {
+		line = line[:col-1]
+	}
+
+	ret := []string{}
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		prefix := strings.TrimLeft(line[i+1:], " ")
+		for _, v := range fieldValues(e, line[:i]) {
+			if strings.HasPrefix(v, prefix) {
+				ret = append(ret, v)
+			}
+		}
+	} else {
+		for _, l := range strings.Split((*StellarNet)(nil).TxToRep(e), "\n") {
+			if i := strings.IndexByte(l, ':'); i > 0 &&
+				strings.HasPrefix(l, line) {
+				ret = append(ret, l[:i])
+			}
+		}
+	}
+	out, _ := json.MarshalIndent(ret, "", "  ")
+	fmt.Println(string(out))
+}
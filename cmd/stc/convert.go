@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Number of envelopes -convert reads before converting them, which
+// bounds its memory use on large inputs while giving every worker
+// plenty to do.
+const convertBatch = 4096
+
+// Longest line -convert accepts.  Envelopes with large Soroban
+// footprints or Wasm uploads can be hundreds of kilobytes of base64.
+const convertMaxLine = 16 << 20
+
+// Returns the TxFormat for -convert to write f, annotating txrep with
+// the comments in net's address book.
+func convertFormat(net *StellarNet, f format) stcdetail.TxFormat {
+	switch f {
+	case fmt_compiled:
+		return stcdetail.Base64Format
+	case fmt_json:
+		return stcdetail.JSONFormat
+	}
+	return func(e *stx.TransactionEnvelope) (string, error) {
+		var out strings.Builder
+		err := net.WriteTxRep(&out, &TransactionEnvelope{
+			TransactionEnvelope: e,
+		})
+		return out.String(), err
+	}
+}
+
+// Implements -convert:  reads transaction envelopes in base64 XDR,
+// one per line, from each of files (or standard input for "-"), and
+// writes them to standard output in format f, in the same order,
+// using workers goroutines.  Blank lines are ignored.  Txrep output
+// separates transactions with a blank line.  A line that cannot be
+// converted is reported and skipped, and makes stc exit 1 after
+// converting the rest.
+func doConvert(net *StellarNet, files []string, f format, workers int) {
+	txf := convertFormat(net, f)
+	failed := false
+	first := true
+	var inputs, where []string
+	flush := func() {
+		for i, r := range stcdetail.ConvertAll(inputs, txf, workers) {
+			if r.Err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", where[i], r.Err)
+				failed = true
+				continue
+			}
+			if f == fmt_txrep && !first {
+				mustPrint("\n")
+			}
+			mustPrint(r.Output)
+			first = false
+		}
+		inputs, where = inputs[:0], where[:0]
+	}
+	for _, file := range files {
+		var in io.Reader
+		name := file
+		if file == "-" {
+			in, name = os.Stdin, "(stdin)"
+		} else if fin, err := os.Open(file); err != nil {
+			fmt.Fprintln(stderr, err)
+			failed = true
+			continue
+		} else {
+			defer fin.Close()
+			in = fin
+		}
+		sc := bufio.NewScanner(in)
+		sc.Buffer(nil, convertMaxLine)
+		for lineno := 1; sc.Scan(); lineno++ {
+			if line := strings.TrimSpace(sc.Text()); line != "" {
+				inputs = append(inputs, line)
+				where = append(where, fmt.Sprintf("%s:%d", name, lineno))
+				if len(inputs) == convertBatch {
+					flush()
+				}
+			}
+		}
+		if err := sc.Err(); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", name, err)
+			failed = true
+		}
+	}
+	flush()
+	if failed {
+		exit(1)
+	}
+}
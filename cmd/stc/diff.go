@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/xdrpp/stc"
+)
+
+// Summarizes how txrep b differs from txrep a, for confirming -i.
+// Returns a "-" line with the old value and a "+" line with the new
+// value of each field that changed, in the order fields appear in b,
+// followed by "-" lines for fields only in a.  Comments after values
+// count as part of them, so a signature that stops verifying shows up
+// as a change.
+func txrepDiff(a, b string) []string {
+	field := func(line string) string {
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			return line[:i]
+		}
+		return line
+	}
+	old := map[string]string{}
+	var oldFields []string
+	for _, line := range strings.Split(a, "\n") {
+		if line != "" {
+			f := field(line)
+			old[f] = line
+			oldFields = append(oldFields, f)
+		}
+	}
+	var ret []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(b, "\n") {
+		if line == "" {
+			continue
+		}
+		f := field(line)
+		seen[f] = true
+		if oldline, ok := old[f]; !ok {
+			ret = append(ret, "+"+line)
+		} else if oldline != line {
+			ret = append(ret, "-"+oldline, "+"+line)
+		}
+	}
+	for _, f := range oldFields {
+		if !seen[f] {
+			ret = append(ret, "-"+old[f])
+		}
+	}
+	return ret
+}
+
+// Shows how writing e in place of orig would change file, and asks
+// whether to go ahead.  Returns true without asking if the txrep of
+// the two is the same.
+func confirmOverwrite(net *StellarNet, file string,
+	orig, e *TransactionEnvelope) bool {
+	diff := txrepDiff(net.TxToRep(orig), net.TxToRep(e))
+	if len(diff) == 0 {
+		return true
+	}
+	fmt.Printf("Changes to %s:\n", file)
+	for _, line := range diff {
+		fmt.Println(line)
+	}
+	return askYesNo(fmt.Sprintf("Overwrite %s", file))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/ini"
+)
+
+// Set by -dry-run.  Instead of writing files, saving configuration
+// changes, or submitting transactions, stc reports on standard error
+// what it would have done.
+var dryRun bool
+
+// If -dry-run is in effect, reports that stc would do what format and
+// args describe and returns true, so the caller can skip doing it.
+func dryRunSkip(format string, args ...interface{}) bool {
+	if !dryRun {
+		return false
+	}
+	fmt.Fprintf(stderr, "dry run: would "+format+"\n", args...)
+	return true
+}
+
+// Reports that stc would write contents to file, and prints contents
+// to standard output.  Returns false if -dry-run is not in effect.
+func dryRunWrite(file, contents string) bool {
+	if !dryRunSkip("write %s", file) {
+		return false
+	}
+	mustPrint(contents)
+	return true
+}
+
+// Reports the changes saving net's configuration would make, one
+// "-" or "+" line per line removed from or added to the file, or
+// nothing if the file would not change.  Returns false if -dry-run
+// is not in effect.
+func dryRunSave(net *StellarNet) bool {
+	if !dryRun {
+		return false
+	}
+	edits := net.GetEdits()
+	if len(edits) == 0 {
+		return true
+	}
+	contents, err := ioutil.ReadFile(net.SavePath)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(stderr, err)
+	}
+	ie, _ := ini.NewIniEdit(net.SavePath, contents)
+	edits.Apply(ie)
+	if diff := lineDiff(string(contents), ie.String()); len(diff) > 0 {
+		dryRunSkip("save configuration %s", net.SavePath)
+		for _, line := range diff {
+			fmt.Fprintln(stderr, "  "+line)
+		}
+	}
+	return true
+}
+
+// Returns a "-" line for each line of a missing from b, followed by a
+// "+" line for each line of b missing from a.  Unlike txrepDiff, this
+// does not assume each line has a distinct field name, which is not
+// true of configuration files.
+func lineDiff(a, b string) []string {
+	count := map[string]int{}
+	for _, line := range strings.Split(b, "\n") {
+		count[line]++
+	}
+	var ret []string
+	for _, line := range strings.Split(a, "\n") {
+		if count[line] > 0 {
+			count[line]--
+		} else if line != "" {
+			ret = append(ret, "-"+line)
+		}
+	}
+	for _, line := range strings.Split(b, "\n") {
+		if count[line] > 0 {
+			count[line]--
+			if line != "" {
+				ret = append(ret, "+"+line)
+			}
+		}
+	}
+	return ret
+}
+
+// Saves net's configuration, or with -dry-run reports how it would
+// change.  Exits on failure.
+func mustSaveNet(net *StellarNet) {
+	if dryRunSave(net) {
+		return
+	}
+	if err := net.Save(); err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+)
+
+// Editor to run when neither STCEDITOR nor EDITOR is set
+const defaultEditor = "vi"
+
+// Returns the argv with which to run editor ed on args.
+func editorArgv(ed string, args []string) []string {
+	if path, err := exec.LookPath(ed); err == nil {
+		ed = path
+	}
+	return append([]string{ed}, args...)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Editor to run when neither STCEDITOR nor EDITOR is set
+const defaultEditor = "notepad"
+
+// Returns the argv with which to run editor ed on args.  An editor
+// that is not a program on the PATH (for example, a command with
+// arguments such as "code --wait") is run through cmd /c.  Notepad
+// does not understand the +LINE argument that -edit passes, so it is
+// dropped.
+func editorArgv(ed string, args []string) []string {
+	if base := strings.ToLower(filepath.Base(ed)); base == "notepad" ||
+		base == "notepad.exe" {
+		var kept []string
+		for _, a := range args {
+			if !strings.HasPrefix(a, "+") {
+				kept = append(kept, a)
+			}
+		}
+		args = kept
+	}
+	if path, err := exec.LookPath(ed); err == nil {
+		return append([]string{path}, args...)
+	}
+	cmd, ok := os.LookupEnv("ComSpec")
+	if !ok {
+		cmd = `C:\Windows\System32\cmd.exe`
+	}
+	return append([]string{cmd, "/c", ed}, args...)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// Keys of the [net] section that -env reports, in the order it
+// reports them.
+var envNetKeys = []string{
+	"network-id", "horizon", "soroban-rpc", "native-asset",
+	"price-oracle", "price-currency", "archive-key", "archive-signers",
+	"policy", "post-hook", "post-webhook", "edit-dir",
+}
+
+// Describes where the value of environment variable name came from,
+// or returns def if it is not set.
+func envVarSource(name, def string) string {
+	if _, ok := os.LookupEnv(name); ok {
+		return "env " + name
+	}
+	return def
+}
+
+// Implements -env:  prints the configuration directory and profile,
+// the settings of network netname (as chosen by -net) and which file
+// or option each comes from, the networks that are defined, and where
+// stc keeps keys and other state.  profile, horizon, and sorobanRPC
+// are the -profile, -horizon, and -soroban-rpc options, which
+// override the environment and configuration.  Meant for
+// working out why stc is not using the server or keys you expect, so
+// it still prints everything else, then exits 1, if netname is not a
+// valid network.
+func doEnv(profile, netname, horizon, sorobanRPC string) {
+	show := func(name, value, source string) {
+		if value == "" {
+			value = "(unset)"
+		}
+		if source == "" {
+			fmt.Printf("%-16s %s\n", name, value)
+		} else {
+			fmt.Printf("%-16s %s [%s]\n", name, value, source)
+		}
+	}
+
+	show("STCDIR", ProfileDir(DefaultProfile),
+		envVarSource("STCDIR", "default"))
+	profileSource := "flag -profile"
+	if profile == "" {
+		profileSource = envVarSource("STCPROFILE", "default")
+	}
+	dir := ConfigPath()
+	show("profile", CurrentProfile(), profileSource)
+	show("config dir", dir, "")
+	sysconf, sysconfSource := GlobalConfigPath(), ""
+	if sysconf == "" {
+		sysconf, sysconfSource = "built-in", "no stc.conf found"
+	}
+	show("system config", sysconf, sysconfSource)
+
+	netname, nameSource := resolveNetName(netname)
+	netfile := ConfigPath(netname + ".net")
+	if target, err := os.Readlink(netfile); err == nil {
+		show("network", fmt.Sprintf("%s (%s)", netname,
+			strings.TrimSuffix(filepath.Base(target), ".net")), nameSource)
+	} else {
+		show("network", netname, nameSource)
+	}
+	show("network file", netfile, "")
+
+	srcs := loadNetKeys(netname)
+	conf := srcs.cliConfig()
+	net := DefaultStellarNet(netname)
+	if net == nil {
+		fmt.Printf("network %q is not defined\n", netname)
+	} else {
+		values := map[string]string{
+			"network-id":      net.NetworkId,
+			"horizon":         net.Horizon,
+			"soroban-rpc":     net.SorobanRPC,
+			"native-asset":    net.NativeAsset,
+			"price-oracle":    net.PriceOracle,
+			"price-currency":  net.PriceCurrency,
+			"archive-key":     conf.archiveKey,
+			"archive-signers": conf.archiveSigners,
+			"policy":          net.Policy,
+			"post-hook":       conf.postHook,
+			"post-webhook":    conf.postWebhook,
+			"edit-dir":        conf.editDir,
+		}
+		overrides := map[string]string{
+			"horizon":     horizon,
+			"soroban-rpc": sorobanRPC,
+		}
+		for _, key := range envNetKeys {
+			value, source := values[key], srcs.sources[key]
+			if o := overrides[key]; o != "" {
+				value, source = o, "flag -"+key
+			} else if source != "" {
+				source = "config " + source
+			}
+			if key == "network-id" && value != "" {
+				value = fmt.Sprintf("%q", value)
+			}
+			show(key, value, source)
+		}
+		// Header values are often credentials, so only show names
+		var headers []string
+		for name := range net.HTTPHeader {
+			headers = append(headers, name)
+		}
+		sort.Strings(headers)
+		for _, name := range headers {
+			show("http-header", name+": (value hidden)", "")
+		}
+	}
+
+	var nets []string
+	if names, err := filepath.Glob(filepath.Join(dir, "*.net")); err == nil {
+		for _, name := range names {
+			srcs.nets[strings.TrimSuffix(filepath.Base(name), ".net")] = true
+		}
+	}
+	for name := range srcs.nets {
+		nets = append(nets, name)
+	}
+	sort.Strings(nets)
+	show("networks", strings.Join(nets, " "), "")
+
+	keys := ConfigPath("keys")
+	show("key store", fmt.Sprintf("%s (%d keys)", keys, len(GetKeyNames())),
+		"")
+	sock := AgentSocketPath()
+	agent := "not running"
+	if ks, err := AgentClient(sock).List(); err == nil {
+		agent = fmt.Sprintf("running, holding %d keys", len(ks))
+	}
+	show("key agent", fmt.Sprintf("%s (%s)", sock, agent),
+		envVarSource("STCAGENT", "default"))
+	if net != nil {
+		n := 0
+		for _, skis := range net.GetSigners() {
+			n += len(skis)
+		}
+		show("signer cache", fmt.Sprintf("%s (%d signers)", net.SavePath, n),
+			"")
+	}
+	show("audit log", auditLogPath(), "")
+	drafts := ""
+	if conf.editDir != "" {
+		drafts = conf.editDir
+	} else if d, err := stcdetail.PrivateTempDir(); err == nil {
+		drafts = d
+	}
+	show("edit drafts", drafts, "")
+	editor, source := defaultEditor, "default"
+	for _, v := range []string{"STCEDITOR", "EDITOR"} {
+		if ed, ok := os.LookupEnv(v); ok {
+			editor, source = ed, "env "+v
+			break
+		}
+	}
+	show("editor", editor, source)
+	backup := stcdetail.BackupSuffix
+	if backup == "" {
+		backup = "(none)"
+	}
+	show("backup suffix", backup, envVarSource("STCBACKUP", "default"))
+	if net == nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Extracts the maximum fee, number of operations, and time bounds of
+// any kind of envelope (for fee bumps, the operations and time bounds
+// are those of the inner transaction).
+func txSummaryFields(e *TransactionEnvelope) (
+	fee int64, ops []stx.Operation, tb *stx.TimeBounds) {
+	switch e.Type {
+	case stx.ENVELOPE_TYPE_TX_V0:
+		tx := &e.V0().Tx
+		return int64(tx.Fee), tx.Operations, tx.TimeBounds
+	case stx.ENVELOPE_TYPE_TX:
+		tx := &e.V1().Tx
+		return int64(tx.Fee), tx.Operations, tx.TimeBounds
+	case stx.ENVELOPE_TYPE_TX_FEE_BUMP:
+		tx := &e.FeeBump().Tx.InnerTx.V1().Tx
+		return e.FeeBump().Tx.Fee, tx.Operations, tx.TimeBounds
+	}
+	return
+}
+
+type inspector struct {
+	*StellarNet
+
+	// Show approximate values of amounts from the price oracle
+	prices    bool
+	priceErrs map[string]bool
+}
+
+func (net *inspector) amount(v int64) string {
+	return fmt.Sprintf("%d (%s %s)", v, stcdetail.ScaleFmt(v, 7),
+		net.GetNativeAsset())
+}
+
+func (net *inspector) timeBounds(tb *stx.TimeBounds) {
+	now := time.Now()
+	if tb == nil {
+		fmt.Println("valid: no time bounds; never expires")
+		return
+	}
+	if tb.MinTime > 0 {
+		t := time.Unix(int64(tb.MinTime), 0)
+		if d := t.Sub(now); d > 0 {
+			fmt.Printf("valid after: %s (in %s)\n", t.Format(time.UnixDate),
+				d.Round(time.Second))
+		} else {
+			fmt.Printf("valid after: %s (now valid)\n",
+				t.Format(time.UnixDate))
+		}
+	}
+	if tb.MaxTime == 0 {
+		fmt.Println("expires: never")
+	} else {
+		t := time.Unix(int64(tb.MaxTime), 0)
+		if d := t.Sub(now); d > 0 {
+			fmt.Printf("expires: %s (in %s)\n", t.Format(time.UnixDate),
+				d.Round(time.Second))
+		} else {
+			fmt.Printf("expires: %s (EXPIRED %s ago)\n",
+				t.Format(time.UnixDate), (-d).Round(time.Second))
+		}
+	}
+}
+
+func (net *inspector) thresholds(e *TransactionEnvelope, ops []stx.Operation) {
+	// Level required of each source account, in order of appearance
+	var accts []string
+	levels := map[string]ThresholdLevel{}
+	need := func(ac stx.IsAccount, l ThresholdLevel) {
+		k := ac.ToMuxedAccount().ToSignerKey().String()
+		if old, ok := levels[k]; !ok {
+			accts = append(accts, k)
+			levels[k] = l
+		} else if l > old {
+			levels[k] = l
+		}
+	}
+	need(e.SourceAccount(), LowThreshold)
+	for i := range ops {
+		if ops[i].SourceAccount != nil {
+			need(ops[i].SourceAccount, OpThreshold(&ops[i]))
+		} else {
+			need(e.SourceAccount(), OpThreshold(&ops[i]))
+		}
+	}
+
+	for _, ac := range accts {
+		name := net.acctName(ac)
+		ae, err := accountEntries.get(net.StellarNet, ac)
+		if err != nil {
+			fmt.Printf("account %s: cannot check signatures: %s\n", name, err)
+			continue
+		}
+		needed := ae.Thresholds.Get(levels[ac])
+		signed := net.SignedWeight(e, ae.Signers)
+		status := "ok"
+		if signed < uint32(needed) || signed == 0 {
+			status = "INSUFFICIENT"
+		}
+		fmt.Printf("account %s: %s threshold %d, signed weight %d, %s\n",
+			name, levels[ac], needed, signed, status)
+	}
+}
+
+func (net *inspector) signatures(label string, e *TransactionEnvelope) {
+	sigs := *e.Signatures()
+	valid := 0
+	for _, ski := range net.GetSigners().LookupAll(net.GetNetworkId(),
+		e.TransactionEnvelope, sigs) {
+		if ski != nil {
+			valid++
+		}
+	}
+	fmt.Printf("%s: %d (%d verified)\n", label, len(sigs), valid)
+}
+
+func (net *inspector) assetName(asset string) string {
+	if asset == "native" && net.GetNativeAsset() != "" {
+		return net.GetNativeAsset()
+	}
+	return asset
+}
+
+func (net *inspector) acctName(acct string) string {
+	if note := net.AccountIDNote(acct); note != "" {
+		return acct + " (" + note + ")"
+	}
+	return acct
+}
+
+// Shows who can claim the balance created by each
+// CREATE_CLAIMABLE_BALANCE operation, and when, with predicates as
+// indented expressions.
+func (net *inspector) claimants(ops []stx.Operation) {
+	for i := range ops {
+		if ops[i].Body.Type != stx.CREATE_CLAIMABLE_BALANCE {
+			continue
+		}
+		fmt.Printf("op %d claimants:\n", i)
+		for _, c := range ops[i].Body.CreateClaimableBalanceOp().Claimants {
+			v0 := c.V0()
+			fmt.Printf("  %s: %s\n", net.acctName(v0.Destination.String()),
+				stcdetail.PredicateIndent(&v0.Predicate, "  ", "  "))
+		}
+	}
+}
+
+func (net *inspector) printAmounts(prefix string, aa stcdetail.AssetAmounts) {
+	var assets []string
+	for k := range aa {
+		assets = append(assets, k)
+	}
+	sort.Strings(assets)
+	for _, k := range assets {
+		fmt.Printf("%s%s %s%s\n", prefix, stcdetail.ScaleFmt(aa[k], 7),
+			net.assetName(k), net.value(k, aa[k]))
+	}
+}
+
+// Returns the approximate value of amount of asset according to the
+// price oracle, formatted to follow the amount, or "" if prices are
+// not enabled or not available.
+func (net *inspector) value(asset string, amount int64) string {
+	if !net.prices {
+		return ""
+	}
+	p, err := net.GetPrice(asset)
+	if err != nil {
+		if !net.priceErrs[asset] {
+			fmt.Fprintf(stderr, "cannot fetch price of %s: %s\n",
+				net.assetName(asset), err)
+			if net.priceErrs == nil {
+				net.priceErrs = make(map[string]bool)
+			}
+			net.priceErrs[asset] = true
+		}
+		return ""
+	}
+	currency := net.PriceCurrency
+	if currency == "" {
+		currency = "USD"
+	}
+	return fmt.Sprintf(" (~%.2f %s)", float64(amount)/1e7*p, currency)
+}
+
+// Implements -totals:  shows how much a transaction sends and the
+// most each source account can lose.
+func (net *inspector) totals(e *TransactionEnvelope) {
+	tt := stcdetail.TxTotals(e.TransactionEnvelope)
+	fmt.Println("total sent:")
+	net.printAmounts("  ", tt.Sent)
+	var accts []string
+	for k := range tt.MaxDebit {
+		accts = append(accts, k)
+	}
+	sort.Strings(accts)
+	for _, ac := range accts {
+		fmt.Printf("source %s:\n", net.acctName(ac))
+		if len(tt.BySource[ac]) > 0 {
+			fmt.Println("  sends:")
+			net.printAmounts("    ", tt.BySource[ac])
+		}
+		fmt.Println("  max debit:")
+		net.printAmounts("    ", tt.MaxDebit[ac])
+	}
+	for _, ac := range tt.Merged {
+		fmt.Printf("WARNING: merges %s, sending its entire balance\n",
+			net.acctName(ac))
+	}
+}
+
+func doTotals(net *StellarNet, e *TransactionEnvelope) {
+	(&inspector{StellarNet: net}).totals(e)
+}
+
+// Implements -inspect:  shows the transaction with every annotation
+// stc knows how to produce, followed by a summary of fees, validity
+// period, signing status, and amounts.  Never writes anything.
+func doInspect(net0 *StellarNet, e *TransactionEnvelope) {
+	net := &inspector{StellarNet: net0, prices: net0.PriceOracle != ""}
+	getAccounts(net.StellarNet, e, true)
+	if err := net.FetchOffers(e); err != nil {
+		fmt.Fprintf(stderr, "cannot fetch offers: %s\n", err)
+	}
+	mustPrint(net.TxToRep(e))
+
+	fmt.Println("==== SUMMARY ====")
+	fee, ops, tb := txSummaryFields(e)
+	fmt.Printf("max fee: %s for %d operations\n", net.amount(fee), len(ops))
+	st := stcdetail.TxSize(e.TransactionEnvelope)
+	fmt.Printf("size: %d bytes, %d signatures, minimum fee %s\n", st.Bytes,
+		st.Signatures, net.amount(st.MinFee))
+	for _, p := range st.Problems() {
+		fmt.Println("WARNING:", p)
+	}
+	for _, p := range stcdetail.SeqProblems(e.TransactionEnvelope) {
+		fmt.Println("WARNING:", p)
+	}
+	if fs, err := net.GetFeeCache(); err == nil {
+		fmt.Printf("current base fee: %s per operation\n",
+			net.amount(int64(fs.Last_ledger_base_fee)))
+		if est := int64(fs.Percentile(20)) * int64(len(ops)); est > fee {
+			fmt.Printf("WARNING: fee below typical %s\n", net.amount(est))
+		}
+	} else {
+		fmt.Fprintf(stderr, "cannot fetch fee stats: %s\n", err)
+	}
+	net.timeBounds(tb)
+	net.claimants(ops)
+
+	if inner := e.InnerTx(); inner != nil {
+		// The fee source signs the outer transaction, while the
+		// inner transaction needs the usual signatures for its
+		// operations.
+		fmt.Printf("fee bump hash: %x\n", *net.HashTx(e))
+		fmt.Printf("fee source: %s\n",
+			net.acctName(e.SourceAccount().String()))
+		net.signatures("fee bump signatures", e)
+		net.thresholds(e, nil)
+		fmt.Printf("inner tx hash: %x\n", *net.HashTx(inner))
+		fmt.Printf("inner tx source: %s\n",
+			net.acctName(inner.SourceAccount().String()))
+		net.signatures("inner tx signatures", inner)
+		net.thresholds(inner, ops)
+	} else {
+		fmt.Printf("hash: %x\n", *net.HashTx(e))
+		net.signatures("signatures", e)
+		net.thresholds(e, ops)
+	}
+	if f := accountEntries.freshness(); f != "" {
+		fmt.Printf("account data as of %s\n", f)
+	}
+	for _, w := range net.LockoutWarnings(e) {
+		fmt.Println("WARNING:", w)
+	}
+	for _, w := range net.StartingBalanceWarnings(e) {
+		fmt.Println("WARNING:", w)
+	}
+	net.totals(e)
+}
+
+// Implements -simulate-signers:  reports whether signatures by keys
+// would meet the threshold each operation requires of its source
+// account.  Returns false if any threshold would not be met.
+func doSimulateSigners(net0 *StellarNet, e *TransactionEnvelope,
+	keys []SignerKey) bool {
+	net := &inspector{StellarNet: net0}
+	_, ops, _ := txSummaryFields(e)
+	entries := map[string]*HorizonAccountEntry{}
+	ok := true
+	for _, req := range SigningRequirements(e) {
+		what := "tx"
+		if req.Op >= 0 {
+			what = fmt.Sprintf("op %d (%s)", req.Op, ops[req.Op].Body.Type)
+		}
+		ae, found := entries[req.Account]
+		if !found {
+			var err error
+			if ae, err = net.GetAccountEntry(req.Account); err != nil {
+				fmt.Printf("%s: account %s: cannot fetch signers: %s\n",
+					what, net.acctName(req.Account), err)
+				ok = false
+				continue
+			}
+			entries[req.Account] = ae
+		}
+		needed := ae.Thresholds.Get(req.Level)
+		weight := SimulatedWeight(ae.Signers, keys)
+		status := "ok"
+		if weight < uint32(needed) || weight == 0 {
+			status = "INSUFFICIENT"
+			ok = false
+		}
+		fmt.Printf("%s: account %s: %s threshold %d, weight %d, %s\n",
+			what, net.acctName(req.Account), req.Level, needed, weight,
+			status)
+	}
+	return ok
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/ini"
+)
+
+// Settings of the [net] section that only the stc command uses, and
+// that the library therefore leaves out of StellarNet.
+type cliNetConfig struct {
+	// SSH private key with which to co-sign transaction files for
+	// long-term archives (net.archive-key), or "" for none.
+	archiveKey string
+
+	// File of SSH keys allowed to make archival signatures, in the
+	// format of ssh-keygen's allowed_signers (net.archive-signers),
+	// or "" to accept any key.
+	archiveSigners string
+
+	// Shell command to run after each transaction -post submits
+	// successfully (net.post-hook), or "" for none.
+	postHook string
+
+	// URL to which to POST a JSON description of each transaction
+	// -post submits successfully (net.post-webhook), or "" for none.
+	postWebhook string
+
+	// Directory in which -edit keeps its draft (net.edit-dir), or ""
+	// for stcdetail.PrivateTempDir().
+	editDir string
+}
+
+// Configuration of the network selected with -net.
+var netConf cliNetConfig
+
+// Returns the name of the network that DefaultStellarNet(netname)
+// loads, and where the name comes from.
+func resolveNetName(netname string) (string, string) {
+	if ValidNetName(netname) {
+		return netname, "flag -net"
+	} else if netname = os.Getenv("STCNET"); ValidNetName(netname) {
+		return netname, "env STCNET"
+	}
+	return "default", "default"
+}
+
+// Records the value of each key of network name's [net] section, and
+// the configuration file that sets it.  Since the first setting of a
+// key wins, feed it files in the order LoadStellarNet parses them.  A
+// key listed without a value undoes earlier settings, so a later file
+// can set it again.  Also records the networks that [net "NAME"]
+// sections define.
+type netKeySources struct {
+	name    string
+	file    string
+	inNet   bool
+	values  map[string]string
+	sources map[string]string
+	nets    map[string]bool
+}
+
+func (s *netKeySources) Section(iss ini.IniSecStart) error {
+	s.inNet = iss.Section == "net" &&
+		(iss.Subsection == nil || *iss.Subsection == s.name)
+	if iss.Section == "net" && iss.Subsection != nil {
+		s.nets[*iss.Subsection] = true
+	}
+	return nil
+}
+
+func (s *netKeySources) Item(ii ini.IniItem) error {
+	if !s.inNet {
+		return nil
+	} else if ii.Value == nil {
+		delete(s.values, ii.Key)
+		delete(s.sources, ii.Key)
+	} else if _, ok := s.sources[ii.Key]; !ok && *ii.Value != "" {
+		s.values[ii.Key] = *ii.Value
+		s.sources[ii.Key] = s.file
+	}
+	return nil
+}
+
+func (s *netKeySources) parse(file string, contents []byte) {
+	s.file = file
+	ini.IniParseContents(s, file, contents)
+}
+
+// Parses the configuration of network name (as resolved by
+// resolveNetName) from the same files as DefaultStellarNet.
+func loadNetKeys(name string) *netKeySources {
+	srcs := &netKeySources{
+		name:    name,
+		values:  map[string]string{},
+		sources: map[string]string{},
+		nets:    map[string]bool{},
+	}
+	for _, file := range []string{ConfigPath(name + ".net"),
+		ConfigPath("global.conf")} {
+		if contents, err := ioutil.ReadFile(file); err == nil {
+			srcs.parse(file, contents)
+		}
+	}
+	if sysconf := GlobalConfigPath(); sysconf == "" {
+		srcs.parse("built-in stc.conf", DefaultGlobalConfigContents)
+	} else if contents, err := ioutil.ReadFile(sysconf); err == nil {
+		srcs.parse(sysconf, contents)
+	}
+	return srcs
+}
+
+// Returns the stc command's own settings from srcs.
+func (s *netKeySources) cliConfig() cliNetConfig {
+	return cliNetConfig{
+		archiveKey:     s.values["archive-key"],
+		archiveSigners: s.values["archive-signers"],
+		postHook:       s.values["post-hook"],
+		postWebhook:    s.values["post-webhook"],
+		editDir:        s.values["edit-dir"],
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// What post hooks learn about a transaction that was posted
+// successfully.
+type postNotice struct {
+	Network    string `json:"network"`
+	Label      string `json:"label,omitempty"`
+	TxHash     string `json:"txhash"`
+	Result     string `json:"result"`
+	FeeCharged int64  `json:"fee_charged"`
+	Source     string `json:"source"`
+	Operations int    `json:"operations"`
+	Summary    string `json:"summary"`
+}
+
+// How long to wait for net.post-webhook to respond
+const webhookTimeout = 10 * time.Second
+
+func newPostNotice(net *StellarNet, label string, e *TransactionEnvelope,
+	res *TransactionResult) *postNotice {
+	tx := e
+	if inner := e.InnerTx(); inner != nil {
+		tx = inner
+	}
+	_, ops, _ := txSummaryFields(e)
+	var types []string
+	for i := range ops {
+		types = append(types, ops[i].Body.Type.String())
+	}
+	source := tx.SourceAccount().String()
+	name := source
+	if note := net.AccountIDNote(source); note != "" {
+		name += " (" + note + ")"
+	}
+	summary := fmt.Sprintf("%d ops from %s", len(ops), name)
+	if len(types) > 0 {
+		summary += ": " + strings.Join(types, ", ")
+	}
+	return &postNotice{
+		Network:    net.Name,
+		Label:      label,
+		TxHash:     fmt.Sprintf("%x", net.HashTx(e)[:]),
+		Result:     res.Result.Code.String(),
+		FeeCharged: int64(res.FeeCharged),
+		Source:     source,
+		Operations: len(ops),
+		Summary:    summary,
+	}
+}
+
+// Runs net.post-hook and sends net.post-webhook, if configured, for
+// transaction e (labeled label in a bundle) that posted with result
+// res.  Failures are only warnings, since the transaction has already
+// been executed.
+func runPostHooks(net *StellarNet, label string, e *TransactionEnvelope,
+	res *TransactionResult) {
+	if netConf.postHook == "" && netConf.postWebhook == "" {
+		return
+	}
+	n := newPostNotice(net, label, e, res)
+	body, err := json.Marshal(n)
+	if err != nil {
+		panic(err)
+	}
+	if netConf.postHook != "" {
+		cmd := exec.Command("/bin/sh", "-c", netConf.postHook)
+		cmd.Env = append(os.Environ(),
+			"STC_NETWORK="+n.Network,
+			"STC_LABEL="+n.Label,
+			"STC_TXHASH="+n.TxHash,
+			"STC_RESULT="+n.Result,
+			"STC_SUMMARY="+n.Summary,
+		)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(stderr, "warning: post hook failed: %s\n", err)
+		}
+	}
+	if netConf.postWebhook != "" {
+		if err := postWebhook(netConf.postWebhook, body); err != nil {
+			fmt.Fprintf(stderr, "warning: post webhook failed: %s\n",
+				err)
+		}
+	}
+}
+
+// POSTs body as JSON to url.  The network's HTTP headers are not
+// sent, as they may hold credentials for horizon.
+func postWebhook(url string, body []byte) error {
+	req, err := stcdetail.NewRequest("POST", url, bytes.NewReader(body),
+		nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return stcdetail.NewHTTPerror(resp)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	. "github.com/xdrpp/stc"
+)
+
+// Implements -list-profiles:  prints each profile and its
+// configuration directory, marking with "*" the profile named current
+// (from -profile or $STCPROFILE, or the default profile if "").
+func doListProfiles(current string) {
+	if current == "" {
+		current = DefaultProfile
+	}
+	found := false
+	for _, name := range ProfileNames() {
+		mark := " "
+		if name == current {
+			mark, found = "*", true
+		}
+		fmt.Printf("%s %-12s %s\n", mark, name, ProfileDir(name))
+	}
+	if !found {
+		fmt.Fprintf(stderr, "profile %q does not exist\n", current)
+		os.Exit(1)
+	}
+}
+
+// Implements -create-profile:  creates profile name and prints its
+// configuration directory.
+func doCreateProfile(name string) {
+	if dryRunSkip("create profile %s in %s", name, ProfileDir(name)) {
+		return
+	}
+	dir, err := CreateProfile(name)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(dir)
+}
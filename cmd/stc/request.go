@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// Reads the signing request in file infile, or returns nil if infile
+// is standard input or does not contain a signing request.  Exits if
+// the request cannot be parsed or its transaction has changed since
+// it was proposed.
+func readRequest(net *StellarNet, infile string) *TransactionEnvelope {
+	if infile == "-" {
+		return nil
+	}
+	input, err := ioutil.ReadFile(infile)
+	if err != nil || !IsSigningRequest(string(input)) {
+		return nil
+	}
+	e, err := net.RequestFromRep(string(input), txrepDialect)
+	if te, ok := err.(stcdetail.TxrepError); ok {
+		fmt.Fprint(stderr, ParseError{te, infile}.Error())
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", infile, err)
+		os.Exit(1)
+	}
+	return e
+}
+
+// Implements -propose:  turns the transaction in infile into a
+// signing request, written to outfile or standard output.
+func doPropose(net *StellarNet, infile, outfile string) {
+	e, _ := mustReadTx(infile)
+	output := net.RequestToRep(e)
+	if outfile == "" {
+		mustPrint(output)
+	} else if err := writeArchived(outfile, output); err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Implements -approve:  shows the transaction of the signing request
+// in file and, once confirmed (or right away if yes is true), signs
+// it with key and adds the signature to file.
+func doApprove(net *StellarNet, file, key string, yes bool) {
+	e := readRequest(net, file)
+	if e == nil {
+		fmt.Fprintf(stderr, "%s: not a signing request\n", file)
+		os.Exit(1)
+	}
+	if !yes {
+		mustPrint(net.TxToRep(e))
+		if !askYesNo(fmt.Sprintf("Sign transaction %x", net.HashTx(e)[:])) {
+			fmt.Fprintln(stderr, "not signing")
+			os.Exit(1)
+		}
+	}
+	if err := signTx(net, key, e, file, true, false); err != nil {
+		os.Exit(1)
+	}
+	if err := writeArchived(file, net.RequestToRep(e)); err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+}
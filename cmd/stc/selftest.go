@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcfixtures"
+)
+
+// Implements -selftest:  runs stcfixtures.SelfTest against net,
+// printing a line for each check as it finishes, and exits 1 if any
+// check failed.
+func doSelfTest(net *StellarNet) {
+	if dryRunSkip("run a self-test against network %s", net.Name) {
+		return
+	}
+	res, err := stcfixtures.SelfTest(net, func(r stcfixtures.Result) {
+		fmt.Println(r)
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", net.Name, err)
+		os.Exit(1)
+	}
+	for _, r := range res {
+		if r.Err != nil {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	. "github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Reads an AccountSnapshot in text form from file, exiting on error.
+func mustReadSnapshot(file string) AccountSnapshot {
+	input, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	s, err := SnapshotFromRep(string(input))
+	if te, ok := err.(stcdetail.TxrepError); ok {
+		fmt.Fprint(stderr, ParseError{te, file}.Error())
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", file, err)
+		os.Exit(1)
+	}
+	return s
+}
+
+// Fetches the current state of account acct, exiting on error.
+func mustGetSnapshot(net *StellarNet, acct string) AccountSnapshot {
+	s, err := net.GetAccountSnapshot(acct)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	return s
+}
+
+// Implements -snapshot:  writes the current state of account acct to
+// outfile or standard output.
+func doSnapshot(net *StellarNet, acct, outfile string) {
+	output := net.SnapshotToRep(mustGetSnapshot(net, acct))
+	if outfile == "" {
+		mustPrint(output)
+	} else if err := writeArchived(outfile, output); err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Implements -snapshot-diff:  compares the snapshot in file oldfile
+// with the one in newfile or, if newfile is empty, with the current
+// state of the same account.  Exits 1 if they differ.
+func doSnapshotDiff(net *StellarNet, oldfile, newfile string) {
+	old := mustReadSnapshot(oldfile)
+	var cur AccountSnapshot
+	if newfile != "" {
+		cur = mustReadSnapshot(newfile)
+	} else if old[0].Data.Type != stx.ACCOUNT {
+		fmt.Fprintf(stderr, "%s: snapshot does not start with an "+
+			"account entry\n", oldfile)
+		os.Exit(1)
+	} else {
+		cur = mustGetSnapshot(net,
+			old[0].Data.Account().AccountID.String())
+	}
+	if diff := net.SnapshotDiff(old, cur, ""); diff != "" {
+		fmt.Print(diff)
+		os.Exit(1)
+	}
+}
@@ -6,15 +6,20 @@ package main
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	. "github.com/xdrpp/stc"
@@ -28,8 +33,18 @@ const (
 	fmt_compiled = format(iota)
 	fmt_txrep
 	fmt_json
+	fmt_hex
+	fmt_auto
 )
 
+// Names accepted by -informat
+var formatNames = map[string]format{
+	"b64":   fmt_compiled,
+	"txrep": fmt_txrep,
+	"json":  fmt_json,
+	"hex":   fmt_hex,
+}
+
 type isSignerKey interface {
 	ToSignerKey() SignerKey
 }
@@ -38,8 +53,8 @@ func getAccounts(net *StellarNet, e *TransactionEnvelope, usenet bool) {
 	accounts := make(map[string][]HorizonSigner)
 	record := func(ac isSignerKey) {
 		k := ac.ToSignerKey()
-		if !isZeroAccount(k) {
-			accounts[k.String()] = []HorizonSigner{{Key: k}}
+		if !stx.IsZeroAccountID(k) {
+			accounts[k.String()] = []HorizonSigner{{Key: k, Type: k.Type}}
 		}
 	}
 	record(e.SourceAccount())
@@ -51,7 +66,7 @@ func getAccounts(net *StellarNet, e *TransactionEnvelope, usenet bool) {
 		c := make(chan func())
 		for ac := range accounts {
 			go func(ac string) {
-				if ae, err := net.GetAccountEntry(ac); err == nil {
+				if ae, err := accountEntries.get(net, ac); err == nil {
 					c <- func() { accounts[ac] = ae.Signers }
 				} else {
 					c <- func() {}
@@ -63,6 +78,7 @@ func getAccounts(net *StellarNet, e *TransactionEnvelope, usenet bool) {
 		}
 	}
 
+	now := time.Now()
 	for ac, signers := range accounts {
 		for _, signer := range signers {
 			var comment string
@@ -70,6 +86,15 @@ func getAccounts(net *StellarNet, e *TransactionEnvelope, usenet bool) {
 				comment = fmt.Sprintf("signer for account %s", ac)
 			}
 			net.AddSigner(signer.Key.String(), comment)
+			if usenet && signer.Weight > 0 {
+				net.NoteSigner(signer.Key.String(), SignerMeta{
+					Account: ac,
+					Weight:  signer.Weight,
+					Source:  "horizon",
+					Time:    now,
+					Network: net.Name,
+				})
+			}
 		}
 	}
 }
@@ -87,7 +112,7 @@ func FileExists(path string) bool {
 
 func AdjustKeyName(key string) string {
 	if key == "" {
-		fmt.Fprintln(os.Stderr, "missing private key name")
+		fmt.Fprintln(stderr, "missing private key name")
 		os.Exit(1)
 	}
 	if dir, _ := filepath.Split(key); dir != "" {
@@ -114,17 +139,19 @@ func doKeyGen(outfile string) {
 		// fmt.Printf("%x\n", sk.Public().Hint())
 	} else {
 		if FileExists(outfile) {
-			fmt.Fprintf(os.Stderr, "%s: file already exists\n", outfile)
+			fmt.Fprintf(stderr, "%s: file already exists\n", outfile)
+			return
+		} else if dryRunSkip("save a new key to %s", outfile) {
 			return
 		}
 		bytePassword := stcdetail.GetPass2("Passphrase: ")
 		if FileExists(outfile) {
-			fmt.Fprintf(os.Stderr, "%s: file already exists\n", outfile)
+			fmt.Fprintf(stderr, "%s: file already exists\n", outfile)
 			return
 		}
 		err := sk.Save(outfile, bytePassword)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
+			fmt.Fprintln(stderr, err.Error())
 		} else {
 			fmt.Println(sk.Public())
 			//fmt.Printf("%x\n", sk.Public().Hint())
@@ -141,11 +168,107 @@ func getSecKey(file string) (PrivateKey, error) {
 		sk, err = LoadPrivateKey(file)
 	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+		fmt.Fprintln(stderr, err.Error())
+	}
+	return sk, err
+}
+
+// Implements -keygen -n:  creates count keypairs.  With no prefix,
+// prints each secret and public key separated by a tab.  Otherwise,
+// saves the keys as prefix1, prefix2, ..., all encrypted with the
+// same passphrase, and prints each key name and public key.
+func doKeyGenBulk(count int, prefix string) {
+	if prefix == "" {
+		for i := 0; i < count; i++ {
+			sk := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+			fmt.Printf("%s\t%s\n", sk, sk.Public())
+		}
+		return
+	}
+	names := make([]string, count)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s%d", prefix, i+1)
+		if FileExists(AdjustKeyName(names[i])) {
+			fmt.Fprintf(stderr, "%s: file already exists\n", names[i])
+			os.Exit(1)
+		}
+	}
+	if dryRun {
+		for _, name := range names {
+			dryRunSkip("save a new key to %s", AdjustKeyName(name))
+		}
+		return
+	}
+	bytePassword := stcdetail.GetPass2("Passphrase: ")
+	for _, name := range names {
+		sk := NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+		if err := sk.Save(AdjustKeyName(name), bytePassword); err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("%s\t%s\n", name, sk.Public())
+	}
+}
+
+// Prefix of -key arguments naming a key that the key agent should
+// sign with, so the key itself is never loaded.
+const agentKeyPrefix = "agent:"
+
+// Loads the signing key called name, or prompts for one if name is
+// empty.  A name of the form agent:NAME yields a key whose signatures
+// come from the key agent's key NAME.  Otherwise, if a key agent is
+// running (see -agent), keys named in $STCDIR/keys are handed to it
+// once decrypted, and while it holds them yield keys that sign
+// through the agent, so that their passphrases need to be typed only
+// once per agent timeout.
+func loadSigningKey(name string) (PrivateKey, error) {
+	if name == "" {
+		return getSecKey("")
+	}
+	agent := AgentClient(AgentSocketPath())
+	if strings.HasPrefix(name, agentKeyPrefix) {
+		sk, err := agent.Signer(name[len(agentKeyPrefix):])
+		if err != nil {
+			err = fmt.Errorf("%s: %s", name, err)
+			fmt.Fprintln(stderr, err)
+		}
+		return sk, err
+	}
+	file := AdjustKeyName(name)
+	cache := file == ConfigPath("keys", name)
+	if cache {
+		if sk, err := agent.Signer(name); err == nil {
+			return sk, nil
+		}
+	}
+	sk, err := getSecKey(file)
+	if err == nil && cache {
+		if err := agent.AddKey(name, sk); err != nil && err != ErrNoAgent {
+			fmt.Fprintf(stderr, "key agent: %s\n", err)
+		}
 	}
 	return sk, err
 }
 
+// Implements -agent:  serves decrypted keys on AgentSocketPath()
+// until interrupted.
+func doAgent(timeout time.Duration) {
+	path := AgentSocketPath()
+	agent := NewKeyAgent(timeout)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-sigs
+		agent.Close()
+	}()
+	fmt.Fprintf(stderr, "key agent listening on %s, caching keys for %s\n",
+		path, timeout)
+	if err := agent.ListenAndServe(path); err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+}
+
 func doSec2pub(file string) {
 	sk, err := getSecKey(file)
 	if err == nil {
@@ -153,13 +276,6 @@ func doSec2pub(file string) {
 	}
 }
 
-var u256zero stx.Uint256
-func isZeroAccount(ac isSignerKey) bool {
-	k := ac.ToSignerKey()
-	return k.Type == stx.SIGNER_KEY_TYPE_ED25519 &&
-		bytes.Compare(k.Ed25519()[:], u256zero[:]) == 0
-}
-
 func fixTx(net *StellarNet, e *TransactionEnvelope) {
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -170,18 +286,15 @@ func fixTx(net *StellarNet, e *TransactionEnvelope) {
 			e.SetFee(h.Percentile(20))
 		}
 	}()
-	if !isZeroAccount(e.SourceAccount()) {
+	if !stx.IsZeroAccountID(e.SourceAccount()) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if a, _ := net.GetAccountEntry(
+			if a, _ := accountEntries.get(net,
 				e.SourceAccount().ToSignerKey().String());
-			a != nil {
-				switch e.Type {
-				case stx.ENVELOPE_TYPE_TX:
-					e.V1().Tx.SeqNum = a.NextSeq()
-				case stx.ENVELOPE_TYPE_TX_V0:
-					e.V0().Tx.SeqNum = a.NextSeq()
+			a != nil && e.Type != stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+				if seq := stcdetail.TxSeqNum(e.TransactionEnvelope); seq != nil {
+					*seq = a.NextSeq()
 				}
 			}
 		}()
@@ -189,23 +302,89 @@ func fixTx(net *StellarNet, e *TransactionEnvelope) {
 	wg.Wait()
 }
 
-// Guess whether input is key: value lines or compiled base64
+// Returns u, which must be an absolute http or https URL, with the
+// trailing slash that StellarNet endpoints require, or exits with an
+// error naming option opt.
+func mustEndpointURL(opt, u string) string {
+	if pu, err := url.Parse(u); err != nil ||
+		(pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+		fmt.Fprintf(stderr, "%s: invalid URL %q\n", opt, u)
+		os.Exit(2)
+	}
+	if !strings.HasSuffix(u, "/") {
+		u += "/"
+	}
+	return u
+}
+
+// Warns if the network appears to have been reset since stc last
+// used it, which would make learned signers and sequence numbers
+// stale.
+func warnReset(net *StellarNet) {
+	if reset, err := net.CheckReset(); err == nil && reset {
+		fmt.Fprintf(stderr, "warning: network %s appears to have been "+
+			"reset; run %s -check-reset -net=%s\n", net.Name, progname,
+			net.Name)
+	}
+}
+
+// Returns the bytes encoded in hex input (ignoring whitespace), or
+// nil if input is not hex.
+func hexInput(input string) []byte {
+	bs, err := hex.DecodeString(strings.Join(strings.Fields(input), ""))
+	if err != nil || len(bs) == 0 {
+		return nil
+	}
+	return bs
+}
+
+// Guess whether input is key: value lines or compiled base64 or hex
 func guessFormat(content string) format {
 	if len(content) == 0 {
 		return fmt_compiled
 	}
-	if strings.IndexAny(content, ":{") == -1 {
-		bs, err := base64.StdEncoding.DecodeString(content)
-		if err == nil && len(bs) > 0 {
-			return fmt_compiled
+	// Hex is usually valid base64 too, so only call it hex if it
+	// decodes to exactly one transaction.
+	if bs := hexInput(content); bs != nil {
+		e := NewTransactionEnvelope()
+		if stcdetail.XdrFromBin(e, string(bs)) == nil &&
+			len(stcdetail.XdrToBin(e)) == len(bs) {
+			return fmt_hex
 		}
 	}
+	if _, ok := stcdetail.ExtractBase64(content); ok {
+		return fmt_compiled
+	}
 	if content[0] == '{' {
 		return fmt_json
 	}
 	return fmt_txrep
 }
 
+// Txrep dialect selected by -sep11
+var txrepDialect stcdetail.TxrepDialect
+
+// Reject unknown txrep fields, unless -lenient or -edit
+var txrepStrict = true
+
+// Network whose address book and keys may name accounts in txrep
+// input, once the network is known
+var txrepNet *StellarNet
+
+// Parses txrep input in the selected dialect, rejecting unknown
+// fields when txrepStrict is set.
+func txFromRep(input string) (*TransactionEnvelope, error) {
+	if txrepNet != nil {
+		return txrepNet.TxFromRep(input, txrepStrict)
+	} else if txrepStrict {
+		return TxFromRepStrict(input, txrepDialect)
+	}
+	return TxFromRepDialect(input, txrepDialect)
+}
+
+// Input format selected by -informat
+var inputFormat = fmt_auto
+
 type ParseError struct {
 	stcdetail.TxrepError
 	Filename string
@@ -228,80 +407,245 @@ func readTx(infile string) (
 		return
 	}
 	sinput := string(input)
+	if IsBundle(sinput) {
+		err = fmt.Errorf("%s: transaction bundles are only supported "+
+			"by -edit and -post", infile)
+		return
+	} else if IsSigningRequest(sinput) {
+		err = fmt.Errorf("%s: signing requests are only supported "+
+			"by -approve, -inspect, and -post", infile)
+		return
+	}
+	if f = inputFormat; f == fmt_auto {
+		f = guessFormat(sinput)
+	}
 
-	switch f = guessFormat(sinput); f {
+	switch f {
 	case fmt_txrep:
-		if newe, pe := TxFromRep(sinput); pe != nil {
+		if newe, pe := txFromRep(sinput); pe != nil {
 			err = ParseError{pe.(stcdetail.TxrepError), infile}
 		} else {
 			txe = newe
 		}
 	case fmt_compiled:
+		if b64, ok := stcdetail.ExtractBase64(sinput); ok {
+			sinput = b64
+		}
 		txe, err = TxFromBase64(sinput)
+	case fmt_hex:
+		if bs := hexInput(sinput); bs == nil {
+			err = fmt.Errorf("%s: invalid hex input", infile)
+		} else {
+			e := NewTransactionEnvelope()
+			if err = stcdetail.XdrFromBin(e, string(bs)); err == nil {
+				txe = e
+			}
+		}
 	case fmt_json:
 		e := NewTransactionEnvelope()
-		if err = stcdetail.JsonToXdr(e, input); err == nil {
+		if !json.Valid(input) {
+			err = fmt.Errorf("%s: invalid JSON input", infile)
+		} else if err = stcdetail.JsonToXdr(e, input); err == nil {
 			txe = e
 		}
 	}
 	return
 }
 
+// Reads the transaction for -template from a file or, if arg is not
+// a file but is a transaction hash, from the network.
+func readTemplate(net *StellarNet, arg string) *TransactionEnvelope {
+	var txid stx.Hash
+	if arg == "-" || FileExists(arg) {
+		e, _ := mustReadTx(arg)
+		return e
+	} else if _, err := fmt.Sscanf(arg, "%v",
+		stx.XDR_Hash(&txid)); err != nil {
+		fmt.Fprintf(stderr, "%s: no such file or transaction hash\n", arg)
+		os.Exit(1)
+	}
+	txr, err := net.GetTxResult(arg)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	return &TransactionEnvelope{TransactionEnvelope: &txr.Env}
+}
+
 func mustReadTx(infile string) (*TransactionEnvelope, format) {
 	e, f, err := readTx(infile)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(stderr, err)
 		os.Exit(1)
 	}
 	return e, f
 }
 
-func writeTx(outfile string, e *TransactionEnvelope, net *StellarNet,
-	f format) error {
-	var output string
+// Exits with an error if e was written for a network other than net,
+// as recorded by the networkPassphrase line in its txrep.
+func mustCheckNetwork(net *StellarNet, e *TransactionEnvelope,
+	infile string) {
+	if err := net.CheckNetwork(e); err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", infile, err)
+		os.Exit(1)
+	}
+}
+
+// Returns the strkey of the account that arg names, which may also be
+// an address-book comment or key name, exiting on error.
+func mustResolveAccount(net *StellarNet, arg string) string {
+	acct, err := net.ResolveAccount(arg)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		os.Exit(1)
+	}
+	return acct
+}
+
+// Parses an arbitrary XDR type in txrep format from a file (or
+// standard input if infile is "-").
+func readTxrepFile(infile string, t xdr.XdrType) error {
+	var input []byte
+	var err error
+	if infile == "-" {
+		input, err = ioutil.ReadAll(os.Stdin)
+		infile = "(stdin)"
+	} else {
+		input, err = ioutil.ReadFile(infile)
+	}
+	if err != nil {
+		return err
+	}
+	if pe := stcdetail.XdrFromTxrep(strings.NewReader(string(input)), "",
+		t); pe != nil {
+		return ParseError{pe, infile}
+	}
+	return nil
+}
+
+func formatTx(e *TransactionEnvelope, net *StellarNet, f format) string {
 	switch f {
 	case fmt_compiled:
-		output = TxToBase64(e) + "\n"
+		return TxToBase64(e) + "\n"
+	case fmt_hex:
+		return hex.EncodeToString([]byte(stcdetail.XdrToBin(e))) + "\n"
 	case fmt_txrep:
-		output = net.TxToRep(e)
+		return net.TxToRep(e)
 	case fmt_json:
 		if boutput, err := stcdetail.XdrToJson(e); err != nil {
 			panic(err)
 		} else {
-			output = string(boutput)
+			return string(boutput)
 		}
 	}
+	return ""
+}
 
+func writeTx(outfile string, e *TransactionEnvelope, net *StellarNet,
+	f format) error {
+	output := formatTx(e, net, f)
 	if outfile == "" {
-		fmt.Print(output)
+		if _, err := io.WriteString(os.Stdout, output); err != nil {
+			return err
+		}
 	} else {
-		if err := stcdetail.SafeWriteFile(outfile, output, 0666); err != nil {
+		if err := writeArchived(outfile, output); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Prints s to standard output, exiting with an error if it cannot be
+// written in full (e.g., because the disk is full), rather than
+// leaving truncated output that looks complete.
+func mustPrint(s string) {
+	if _, err := io.WriteString(os.Stdout, s); err != nil {
+		fmt.Fprintln(stderr, err)
+		exit(1)
+	}
+}
+
 func mustWriteTx(outfile string, e *TransactionEnvelope, net *StellarNet,
 	f format) {
 	if err := writeTx(outfile, e, net, f); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+		fmt.Fprintln(stderr, err.Error())
 		os.Exit(1)
 	}
 }
 
-func signTx(net *StellarNet, key string, e *TransactionEnvelope) error {
-	if key != "" {
-		key = AdjustKeyName(key)
+// Submits e to the network and prints the result, or exits 1 if the
+// transaction fails.
+func mustPost(net *StellarNet, e *TransactionEnvelope) {
+	if dryRunSkip("post transaction %x to network %s", *net.HashTx(e),
+		net.Name) {
+		return
+	}
+	res, err := net.Post(e)
+	if err != nil {
+		fmt.Fprintf(stderr, "Post transaction failed: %s\n", err)
+		if tf, ok := err.(TxFailure); ok {
+			printResultHints(tf)
+		}
+		os.Exit(1)
 	}
-	sk, err := getSecKey(key)
+	fmt.Print(xdr.XdrToString(res))
+	runPostHooks(net, "", e, res)
+}
+
+// Signs e, read from file, with the key in file key (or prompts for a
+// key if key is empty).  For fee bumps, signs the outer transaction
+// if outer is true and the inner transaction if inner is true.  Each
+// signature is recorded in the audit log.
+func signTx(net *StellarNet, key string, e *TransactionEnvelope,
+	file string, outer, inner bool) error {
+	sk, err := loadSigningKey(key)
 	if err != nil {
 		return err
 	}
+	return signTxWith(net, sk, key, e, file, outer, inner)
+}
+
+// Like signTx, but with sk, already loaded from key, so that several
+// transactions can be signed without asking for the key each time.
+func signTxWith(net *StellarNet, sk PrivateKey, key string,
+	e *TransactionEnvelope, file string, outer, inner bool) (err error) {
+	if key != "" && !strings.HasPrefix(key, agentKeyPrefix) {
+		key = AdjustKeyName(key)
+	}
 	net.AddSigner(sk.Public().String(), "")
-	if err = net.SignTx(sk, e); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return err
+	if len(net.GetSignerInfo(sk.Public().String())) == 0 {
+		net.NoteSigner(sk.Public().String(), SignerMeta{
+			Source:  "key",
+			Time:    time.Now(),
+			Network: net.Name,
+		})
+	}
+	if inner {
+		if n := len(*e.Signatures()); n > 0 {
+			fmt.Fprintf(stderr, "warning: signing the inner transaction "+
+				"invalidates %d fee bump signature(s)\n", n)
+		}
+		if err = net.SignInnerTx(sk, e); err != nil {
+			fmt.Fprintln(stderr, err)
+			return err
+		}
+		if err = auditSignature(net, net.HashTx(e.FeeBump().Tx.InnerTx.V1()),
+			sk.Public().String(), key, file); err != nil {
+			fmt.Fprintln(stderr, err)
+			return err
+		}
+	}
+	if outer {
+		if err = net.SignTx(sk, e); err != nil {
+			fmt.Fprintln(stderr, err)
+			return err
+		}
+		if err = auditSignature(net, net.HashTx(e), sk.Public().String(),
+			key, file); err != nil {
+			fmt.Fprintln(stderr, err)
+			return err
+		}
 	}
 	return nil
 }
@@ -312,19 +656,16 @@ func editor(args ...string) {
 		ed, ok = os.LookupEnv("EDITOR")
 	}
 	if !ok {
-		ed = "vi"
-	}
-	if path, err := exec.LookPath(ed); err == nil {
-		ed = path
+		ed = defaultEditor
 	}
 
-	argv := append([]string{ed}, args...)
-	proc, err := os.StartProcess(ed, argv, &os.ProcAttr{
+	argv := editorArgv(ed, args)
+	proc, err := os.StartProcess(argv[0], argv, &os.ProcAttr{
 		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
 	})
 	if err != nil {
 		fmt.Println(err.Error())
-		os.Exit(1)
+		exit(1)
 	}
 	proc.Wait()
 }
@@ -355,105 +696,510 @@ func firstDifferentLine(a []byte, b []byte) (lineno int) {
 	return
 }
 
-func doEdit(net *StellarNet, arg string) {
-	if arg == "" || arg == "-" {
-		fmt.Fprintln(os.Stderr, "Must supply file name to edit")
-		os.Exit(1)
+// Record the types of fields for which help was requested so that
+// help persists across edit iterations and applies to all fields of
+// the same type.  The file has one XDR type name per line.
+func saveHelp(path string, e *TransactionEnvelope) {
+	types := map[string]struct{}{}
+	if contents, err := ioutil.ReadFile(path); err == nil {
+		for _, t := range strings.Fields(string(contents)) {
+			types[t] = struct{}{}
+		}
+	}
+	for name := range e.Help {
+		if f := stcdetail.GetTxrepField(e, name); f != nil {
+			if _, ok := f.(xdr.XdrEnum); ok {
+				types[f.XdrTypeName()] = struct{}{}
+			}
+		}
 	}
+	if len(types) == 0 {
+		return
+	}
+	out := &strings.Builder{}
+	for t := range types {
+		fmt.Fprintln(out, t)
+	}
+	ioutil.WriteFile(path, []byte(out.String()), 0600)
+}
 
-	e, txfmt, err := readTx(arg)
-	if os.IsNotExist(err) {
-		e = NewTransactionEnvelope()
-		txfmt = fmt_compiled
-	} else if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+func loadHelp(path string, e *TransactionEnvelope) {
+	if contents, err := ioutil.ReadFile(path); err == nil {
+		for _, t := range strings.Fields(string(contents)) {
+			e.SetHelp(t)
+		}
 	}
-	getAccounts(net, e, false)
+}
+
+// Warns about signatures that a change to the transaction has
+// invalidated, and returns their indices.
+func warnInvalidSigs(net *StellarNet, e *TransactionEnvelope) []int {
+	idx := net.InvalidSignatures(e)
+	sigs := *e.Signatures()
+	for _, i := range idx {
+		fmt.Fprintf(stderr,
+			"warning: signature %d (hint %x) is not valid for this transaction\n",
+			i, sigs[i].Hint)
+	}
+	return idx
+}
+
+// Implements -lint-online:  checks Horizon for signs that e is a
+// mistake, namely a recent transaction with identical operations, an
+// operation whose source account does not exist, a sequence number
+// the source account has already used, or a path payment
+// that cannot execute now or allows more than slippage percent
+// slippage.  Returns false if there were any warnings.
+func lintOnline(net *StellarNet, e *TransactionEnvelope,
+	window time.Duration, slippage float64) bool {
+	ok := lintOpSources(net, e)
+	if !lintSeq(net, e) {
+		ok = false
+	}
+	for _, w := range net.OfferWarnings(e) {
+		fmt.Fprintln(stderr, "warning:", w)
+		ok = false
+	}
+	for _, w := range net.SlippageWarnings(e, slippage/100) {
+		fmt.Fprintln(stderr, "warning:", w)
+		ok = false
+	}
+	dups, err := net.RecentDuplicates(e, window)
+	if err != nil {
+		fmt.Fprintf(stderr, "warning: cannot check recent transactions: %s\n",
+			err)
+		return false
+	}
+	for _, r := range dups {
+		fmt.Fprintf(stderr,
+			"warning: identical operations already executed in %x at %s\n",
+			r.Txhash, r.Time.Format(time.UnixDate))
+	}
+	if len(dups) > 0 {
+		fmt.Fprintln(stderr, "warning: transaction may be a double submission")
+		return false
+	}
+	return ok
+}
 
-	f, err := ioutil.TempFile("", progname)
+// Warns if the sequence number of e's source account has already
+// reached or passed e's, so that e can never be valid.  Returns false
+// if there were any warnings.
+func lintSeq(net *StellarNet, e *TransactionEnvelope) bool {
+	if inner := e.InnerTx(); inner != nil {
+		e = inner
+	}
+	seq := stcdetail.TxSeqNum(e.TransactionEnvelope)
+	if seq == nil || *seq == 0 {
+		return true
+	}
+	acct := e.SourceAccount().ToSignerKey().String()
+	ae, err := net.GetAccountEntry(acct)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+		return true
+	} else if cur := stx.SequenceNumber(ae.Sequence); *seq <= cur {
+		fmt.Fprintf(stderr, "warning: sequence number %d can never be "+
+			"valid, since %s is already at %d\n", *seq, acct, cur)
+		return false
 	}
-	path := f.Name()
-	f.Close()
-	defer os.Remove(path + "~")
-	defer os.Remove(path)
+	return true
+}
 
-	var contents, lastcontents []byte
-	for {
-		if err == nil {
-			lastcontents = []byte(net.TxToRep(e))
-			ioutil.WriteFile(path, lastcontents, 0600)
+// Warns about operations whose source accounts do not exist on the
+// network.  Returns false if there were any warnings.
+func lintOpSources(net *StellarNet, e *TransactionEnvelope) bool {
+	if inner := e.InnerTx(); inner != nil {
+		e = inner
+	}
+	ops := e.Operations()
+	if ops == nil {
+		return true
+	}
+	ok := true
+	checked := map[string]bool{}
+	for i := range *ops {
+		src := (*ops)[i].SourceAccount
+		if src == nil {
+			continue
 		}
-
-		fi1, staterr := os.Stat(path)
-		if staterr != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
+		acct := src.ToSignerKey().String()
+		if checked[acct] {
+			continue
 		}
+		checked[acct] = true
+		if _, err := net.GetAccountEntry(acct); IsNotFound(err) {
+			fmt.Fprintf(stderr, "warning: operation %d: source account "+
+				"%s does not exist\n", i, acct)
+			ok = false
+		}
+	}
+	return ok
+}
 
-		line := firstDifferentLine(contents, lastcontents)
-		if err != nil {
-			fmt.Fprint(os.Stderr, err.Error())
-			fmt.Printf("Press return to run editor.")
-			b := make([]byte, 1)
-			for n, err := os.Stdin.Read(b);
-			err != nil && n > 0 && b[0] != '\n'; {
-				fmt.Printf("Read %c\n", b)
-			}
-			if pe, ok := err.(ParseError); ok {
-				line = pe.TxrepError[0].Line
+// Implements -list-signers:  shows the known signers (only those seen
+// on acct if acct is not empty), with how and when each was learned.
+func listSigners(net *StellarNet, acct string) {
+	var keys []string
+	for _, skis := range net.GetSigners() {
+		for i := range skis {
+			keys = append(keys, skis[i].Key.String())
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		metas := net.GetSignerInfo(k)
+		if acct == "" && len(metas) == 0 {
+			fmt.Println(k)
+		}
+		for _, m := range metas {
+			if acct == "" || m.Account == acct {
+				fmt.Println(k, m)
 			}
 		}
-		editor(fmt.Sprintf("+%d", line), path)
+	}
+}
 
-		if err == nil {
-			fi2, staterr := os.Stat(path)
-			if staterr != nil {
-				fmt.Println(err.Error())
-				os.Exit(1)
+// Implements -prune-signers:  forgets learned signers that were last
+// seen longer ago than olderThan or, if olderThan is 0, that are no
+// longer signers on the accounts where they were seen.  Local signing
+// keys and signers whose accounts cannot be queried are kept.
+func pruneSigners(net *StellarNet, olderThan time.Duration) []string {
+	cutoff := time.Now().Add(-olderThan)
+	current := map[string]map[string]bool{}
+	onAccount := func(signer, acct string) bool {
+		if _, ok := current[acct]; !ok {
+			if ae, err := net.GetAccountEntry(acct); err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", acct, err)
+				current[acct] = nil
+			} else {
+				current[acct] = map[string]bool{}
+				for _, s := range ae.Signers {
+					current[acct][s.Key.String()] = true
+				}
 			}
-			if fi1.Size() == fi2.Size() && fi1.ModTime() == fi2.ModTime() {
-				break
+		}
+		return current[acct] == nil || current[acct][signer]
+	}
+	return net.PruneSigners(func(signer string, metas []SignerMeta) bool {
+		if len(metas) == 0 {
+			return true
+		}
+		for _, m := range metas {
+			if m.Source == "key" {
+				return true
+			} else if olderThan > 0 {
+				if m.Time.After(cutoff) {
+					return true
+				}
+			} else if m.Account == "" || onAccount(signer, m.Account) {
+				return true
 			}
 		}
+		return false
+	})
+}
 
-		contents, err = ioutil.ReadFile(path)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
+// Parses the argument of -remove-sig, which is either a signer in
+// strkey format or a signature hint in hex.
+func parseHint(arg string) (hint stx.SignatureHint, ok bool) {
+	var signer SignerKey
+	if _, err := fmt.Sscan(arg, &signer); err == nil {
+		return signer.Hint(), true
+	}
+	if bs, err := hex.DecodeString(arg); err == nil && len(bs) == len(hint) {
+		copy(hint[:], bs)
+		return hint, true
+	}
+	return
+}
+
+// Returns a Stellar Laboratory URL that loads e on net, for -lab-url.
+func labURL(net *StellarNet, e *TransactionEnvelope) string {
+	q := url.Values{"xdr": {TxToBase64(e)}}
+	switch net.NetworkId {
+	case "Public Global Stellar Network ; September 2015":
+		q.Set("network", "public")
+	case "Test SDF Network ; September 2015":
+		q.Set("network", "test")
+	default:
+		q.Set("network", "custom")
+		q.Set("networkPassphrase", net.NetworkId)
+		if net.Horizon != "" {
+			q.Set("horizonURL", net.Horizon)
 		}
-		err = nil
-		if newe, pe := TxFromRep(string(contents)); pe != nil {
-			err = ParseError{pe.(stcdetail.TxrepError), path}
-		} else {
-			e = newe
+	}
+	return "https://laboratory.stellar.org/#txsigner?" + q.Encode()
+}
+
+// Prints the likely cause and fix of each result code in a failed
+// transaction, for -post.
+func printResultHints(tf TxFailure) {
+	seen := map[string]bool{}
+	for _, code := range tf.ResultCodes() {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		if hint := stcdetail.ExplainResultCode(code); hint != "" {
+			fmt.Fprintf(stderr, "hint: %s: %s\n", code, hint)
 		}
 	}
+}
 
-	mustWriteTx(arg, e, net, txfmt)
+// Removes signatures on e that do not verify against any known
+// signer, returning the number removed.
+func stripSigs(net *StellarNet, e *TransactionEnvelope) int {
+	var idx []int
+	for i, ski := range net.GetSigners().LookupAll(net.GetNetworkId(),
+		e.TransactionEnvelope, *e.Signatures()) {
+		if ski == nil {
+			idx = append(idx, i)
+		}
+	}
+	e.DelSignatures(idx...)
+	return len(idx)
 }
 
-func b2i(bs ...bool) int {
-	ret := 0
-	for _, b := range bs {
-		if b {
-			ret++
+// Removes signatures with a particular hint from e, returning the
+// number removed.
+func removeSig(e *TransactionEnvelope, hint stx.SignatureHint) int {
+	var idx []int
+	sigs := *e.Signatures()
+	for i := range sigs {
+		if sigs[i].Hint == hint {
+			idx = append(idx, i)
 		}
 	}
-	return ret
+	e.DelSignatures(idx...)
+	return len(idx)
 }
 
-var progname string
+// Asks a yes or no question on the terminal, defaulting to no.
+func askYesNo(question string) bool {
+	fmt.Printf("%s [y/N]? ", question)
+	input, _ := stcdetail.ReadTextLine(os.Stdin)
+	a := strings.TrimSpace(string(input))
+	return a == "y" || a == "Y"
+}
 
-var dateFormats = []string {
-	time.RFC3339,
-	"2006-01-02T15:04:05",
-	"2006-01-02T15:04",
-	"2006-01-02",
-	"20060102150405",
+// Number of previous versions of a transaction that -edit remembers
+const editHistory = 10
+
+// After a parse error, let the user either fix the file or step back
+// through earlier versions.  Returns the version to restore, or nil
+// to re-edit the file as is.
+func promptUndo(history *[][]byte) []byte {
+	var ret []byte
+	for {
+		if len(*history) == 0 {
+			fmt.Printf("Press return to run editor.")
+		} else {
+			fmt.Printf("Press return to run editor, " +
+				"or u and return to undo (%d saved). ", len(*history))
+		}
+		input, err := stcdetail.ReadTextLine(os.Stdin)
+		if err != nil || strings.TrimSpace(string(input)) != "u" {
+			return ret
+		} else if n := len(*history); n > 0 {
+			ret = (*history)[n-1]
+			*history = (*history)[:n-1]
+			fmt.Printf("Restored previous version.\n")
+		}
+	}
+}
+
+// Temporary files holding drafts that -edit is editing, along with
+// the editor's backups of them.  Drafts can reveal confidential
+// business activity, so shredDrafts overwrites them however stc
+// exits.
+var draftFiles struct {
+	sync.Mutex
+	paths []string
+}
+
+// Creates the temporary file for a draft, readable only by the user,
+// in net.edit-dir or else the user's private temporary directory.
+func newDraftFile(net *StellarNet) string {
+	f, err := stcdetail.PrivateTempFile(netConf.editDir, progname)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		os.Exit(1)
+	}
+	path := f.Name()
+	f.Close()
+	draftFiles.Lock()
+	defer draftFiles.Unlock()
+	if draftFiles.paths == nil {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		go func() {
+			<-sigs
+			exit(1)
+		}()
+	}
+	draftFiles.paths = append(draftFiles.paths, path, path+"~",
+		path+".help")
+	return path
+}
+
+// Returns rep, the text of a draft, unchanged, since redacting it
+// would change what gets signed when the draft is read back.  Instead,
+// warns (once, using *warned) if rep contains something Redact would
+// remove, which will then be in the temporary file.
+func draftContents(rep string, warned *bool) []byte {
+	if !*warned && stcdetail.HasSecret(rep) {
+		fmt.Fprintln(stderr, "warning: the draft contains what looks like "+
+			"a secret key or passphrase")
+		*warned = true
+	}
+	return []byte(rep)
+}
+
+func shredDrafts() {
+	draftFiles.Lock()
+	defer draftFiles.Unlock()
+	for _, path := range draftFiles.paths {
+		if err := stcdetail.ShredFile(path); err != nil {
+			fmt.Fprintln(stderr, err.Error())
+		}
+	}
+	draftFiles.paths = draftFiles.paths[:0]
+}
+
+// Shreds any drafts before exiting.
+func exit(code int) {
+	shredDrafts()
+	os.Exit(code)
+}
+
+func doEdit(net *StellarNet, arg string) {
+	if arg == "" || arg == "-" {
+		fmt.Fprintln(stderr, "Must supply file name to edit")
+		os.Exit(1)
+	}
+	if b := readBundle(arg); b != nil {
+		doEditBundle(net, arg, b)
+		return
+	}
+
+	e, txfmt, err := readTx(arg)
+	if os.IsNotExist(err) {
+		e, txfmt, err = NewTransactionEnvelope(), fmt_compiled, nil
+	} else if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		os.Exit(1)
+	}
+	mustCheckNetwork(net, e, arg)
+	getAccounts(net, e, false)
+
+	path := newDraftFile(net)
+	defer shredDrafts()
+	helpPath := path + ".help"
+
+	var contents, lastcontents []byte
+	var history [][]byte
+	var warned bool
+	for {
+		if err == nil {
+			saveHelp(helpPath, e)
+			loadHelp(helpPath, e)
+			lastcontents = draftContents(net.TxToRep(e), &warned)
+			ioutil.WriteFile(path, lastcontents, 0600)
+			if n := len(history); n == 0 ||
+				!bytes.Equal(history[n-1], lastcontents) {
+				history = append(history, lastcontents)
+				if n >= editHistory {
+					history = history[1:]
+				}
+			}
+		}
+
+		fi1, staterr := os.Stat(path)
+		if staterr != nil {
+			fmt.Println(err.Error())
+			exit(1)
+		}
+
+		line := firstDifferentLine(contents, lastcontents)
+		if err != nil {
+			fmt.Fprint(stderr, err.Error())
+			if pe, ok := err.(ParseError); ok {
+				line = pe.TxrepError[0].Line
+			}
+			if old := promptUndo(&history); old != nil {
+				// Earlier versions parsed successfully when saved
+				e, _ = net.TxFromRep(string(old), false)
+				lastcontents, contents, err = old, old, nil
+				ioutil.WriteFile(path, old, 0600)
+				if fi1, staterr = os.Stat(path); staterr != nil {
+					fmt.Println(staterr.Error())
+					exit(1)
+				}
+				line = 1
+			}
+		}
+		editor(fmt.Sprintf("+%d", line), path)
+
+		if err == nil {
+			fi2, staterr := os.Stat(path)
+			if staterr != nil {
+				fmt.Println(err.Error())
+				exit(1)
+			}
+			if fi1.Size() == fi2.Size() && fi1.ModTime() == fi2.ModTime() {
+				break
+			}
+		}
+
+		contents, err = ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			exit(1)
+		}
+		err = nil
+		if newe, pe := net.TxFromRep(string(contents),
+			false); pe != nil {
+			err = ParseError{pe.(stcdetail.TxrepError), path}
+		} else if nerr := net.CheckNetwork(newe); nerr != nil {
+			err = fmt.Errorf("%s: %s\n", path, nerr)
+		} else {
+			if *net.HashTx(newe) != *net.HashTx(e) {
+				if idx := warnInvalidSigs(net, newe); len(idx) > 0 {
+					if askYesNo("Remove invalidated signatures") {
+						newe.DelSignatures(idx...)
+					}
+				}
+			}
+			e = newe
+		}
+	}
+
+	shredDrafts()
+	mustWriteTx(arg, e, net, txfmt)
+}
+
+func b2i(bs ...bool) int {
+	ret := 0
+	for _, b := range bs {
+		if b {
+			ret++
+		}
+	}
+	return ret
+}
+
+var progname string
+
+// Where diagnostics go, with secret keys and passphrases redacted so
+// that they cannot leak into logs that capture stc's errors
+var stderr = stcdetail.RedactWriter(os.Stderr)
+
+var dateFormats = []string {
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"20060102150405",
 	"200601021504",
 	"20060102",
 }
@@ -462,16 +1208,40 @@ func main() {
 	opt_compile := flag.Bool("c", false, "Compile output to base64 XDR")
 	opt_json := flag.Bool("json", false, "Output transaction in JSON format")
 	opt_keygen := flag.Bool("keygen", false, "Create a new signing keypair")
+	opt_count := flag.Int("n", 0, "With -keygen, create `COUNT` keypairs")
+	opt_stellar_cli := flag.String("stellar-cli", "", "With -import-key "+
+		"or -export-key, read or write stellar-cli identity `IDENTITY`")
+	opt_prefix := flag.String("prefix", "",
+		"With -keygen -n, save keys as `NAME`1, NAME2, ...")
 	opt_sec2pub := flag.Bool("pub", false, "Get public key from private")
 	opt_output := flag.String("o", "", "Output to `FILE` instead of stdout")
 	opt_preauth := flag.Bool("preauth", false,
 		"Hash transaction to strkey for use as a pre-auth transaction signer")
 	opt_txhash := flag.Bool("txhash", false, "Hash transaction to hex format")
+	opt_payload_hash := flag.Bool("payload-hash", false,
+		"Print the hash an external signer must sign, in hex")
+	opt_payload_b64 := flag.Bool("payload-b64", false,
+		"Print the signature payload whose hash is signed, in base64")
+	opt_attach_raw_sig := flag.Bool("attach-raw-sig", false,
+		"Attach hex signature SIGHEX by PUBKEY made by an external signer")
+	opt_lab_url := flag.Bool("lab-url", false,
+		"Print a Stellar Laboratory URL that loads the transaction")
 	opt_inplace := flag.Bool("i", false, "Edit the input file in place")
+	opt_yes := flag.Bool("y", false,
+		"With -i, overwrite the input file without showing changes")
 	opt_sign := flag.Bool("sign", false, "Sign the transaction")
-	opt_key := flag.String("key", "", "Use secret signing key in `FILE`")
+	opt_sign_inner := flag.Bool("sign-inner", false,
+		"Sign the inner transaction of a fee bump")
+	opt_sign_outer := flag.Bool("sign-outer", false,
+		"Sign the outer transaction of a fee bump")
+	opt_key := flag.String("key", "", "Use secret signing key in `FILE`"+
+		" (or agent:NAME to have the key agent sign with key NAME)")
 	opt_netname := flag.String("net", "",
 		"Use Network `NET` (e.g., test); default: $STCNET or \"default\"")
+	opt_horizon := flag.String("horizon", "",
+		"Use horizon at `URL` instead of the network's configured one")
+	opt_soroban_rpc := flag.String("soroban-rpc", "",
+		"Use Soroban RPC server at `URL` instead of the configured one")
 	opt_update := flag.Bool("u", false,
 		"Query network to update fee and sequence number")
 	opt_learn := flag.Bool("l", false, "Learn new signers")
@@ -479,24 +1249,81 @@ func main() {
 	opt_post := flag.Bool("post", false,
 		"Post transaction instead of editing it")
 	opt_nopass := flag.Bool("nopass", false, "Never prompt for passwords")
+	opt_propose := flag.Bool("propose", false,
+		"Turn a transaction into a signing request")
+	opt_approve := flag.Bool("approve", false,
+		"Sign a signing request, if unchanged since proposed")
 	opt_edit := flag.Bool("edit", false,
 		"keep editing the file until it doesn't change")
 	opt_import_key := flag.Bool("import-key", false,
 		"Import signing key to your $STCDIR directory")
 	opt_export_key := flag.Bool("export-key", false,
 		"Export signing key from your $STCDIR directory")
+	opt_list_signers := flag.Bool("list-signers", false,
+		"List known signers and how they were learned")
+	opt_forget_signer := flag.Bool("forget-signer", false,
+		"Remove a learned signer from the network configuration")
+	opt_export_addresses := flag.Bool("export-addresses", false,
+		"Write the network's account annotations and signers to FILE")
+	opt_import_addresses := flag.Bool("import-addresses", false,
+		"Merge account annotations and signers from FILE")
+	opt_on_conflict := flag.String("on-conflict", "ask",
+		"With -import-addresses, handle differing comments by `MODE` "+
+			"(ask, keep, or replace)")
+	opt_check_reset := flag.Bool("check-reset", false,
+		"Check whether the network was reset and offer to clear stale data")
+	opt_prune_signers := flag.Bool("prune-signers", false,
+		"Remove learned signers that are no longer on their accounts")
+	opt_older_than := flag.Duration("older-than", 0,
+		"With -prune-signers, remove signers not seen in `DURATION`")
+	opt_backup_keys := flag.Bool("backup-keys", false,
+		"Write an encrypted backup of all keys and configuration to FILE")
+	opt_restore_keys := flag.Bool("restore-keys", false,
+		"Restore keys and configuration from a backup in FILE")
+	opt_split_key := flag.Bool("split-key", false,
+		"Split signing key NAME into N shares, any K of which recover it")
+	opt_join_key := flag.Bool("join-key", false,
+		"Recover a signing key from shares made by -split-key")
 	opt_list_keys := flag.Bool("list-keys", false,
 		"List keys that have been stored in $STCDIR")
+	opt_agent := flag.Bool("agent", false,
+		"Run a key agent that caches decrypted signing keys")
+	opt_agent_timeout := flag.Duration("agent-timeout",
+		DefaultAgentTimeout,
+		"With -agent, forget each key `DURATION` after it is cached")
 	opt_fee_stats := flag.Bool("fee-stats", false,
 		"Dump fee stats from network")
 	opt_ledger_header := flag.Bool("ledger-header", false,
 		"Dump ledger header from network")
+	opt_ledger_entry := flag.Bool("ledger-entry", false,
+		"Fetch the ledger entry whose txrep LedgerKey is in FILE")
+	opt_snapshot := flag.Bool("snapshot", false,
+		"Save the ledger entries of account ACCT")
+	opt_snapshot_diff := flag.Bool("snapshot-diff", false,
+		"Compare snapshot OLD with snapshot NEW or the current state")
+	opt_convert := flag.Bool("convert", false,
+		"Convert base64 transactions in FILE... (one per line) in parallel")
+	opt_workers := flag.Int("workers", 0,
+		"With -convert, convert `N` transactions at once "+
+			"(default one per CPU)")
+	opt_bump_seq := flag.Bool("bump-seq", false,
+		"Build a transaction bumping ACCT's sequence number to TARGET")
+	opt_selftest := flag.Bool("selftest", false,
+		"Run a battery of transactions against a local test network")
+	opt_offers := flag.Bool("offers", false,
+		"List the open offers of account ACCT")
 	opt_acctinfo := flag.Bool("qa", false,
 		"Query Horizon for information on account")
+	opt_xdr := flag.Bool("xdr", false,
+		"With -qa, output the AccountEntry in base64 XDR")
 	opt_txinfo := flag.Bool("qt", false,
 		"Query Horizon for information on transaction")
 	opt_txacct := flag.Bool("qta", false,
 		"Query Horizon for transactions on account")
+	opt_watch := flag.Bool("watch", false,
+		"Print a line for each new transaction on the accounts ACCT...")
+	opt_hook := flag.String("hook", "",
+		"With -watch, run shell `COMMAND` for each transaction")
 	opt_mux := flag.Bool("mux", false,
 		"Created a MuxedAccount from an AccountID and uint64")
 	opt_demux := flag.Bool("demux", false,
@@ -509,44 +1336,151 @@ func main() {
 		"Be more verbose for some operations")
 	opt_hint := flag.Bool("hint", false,
 		"Print signature hint for a public key")
+	opt_audit_log := flag.Bool("audit-log", false,
+		"Print the log of signatures made by stc")
+	opt_profile := flag.String("profile", "",
+		"Use the configuration and keys of profile `NAME` "+
+			"(default: $STCPROFILE)")
+	opt_list_profiles := flag.Bool("list-profiles", false,
+		"List profiles, marking the one in use")
+	opt_create_profile := flag.Bool("create-profile", false,
+		"Create a profile with its own configuration and keys")
+	opt_env := flag.Bool("env", false,
+		"Show the configuration in effect and where each setting comes from")
+	opt_verify_archive := flag.Bool("verify-archive", false,
+		"Check the archival signature of a transaction file")
+	opt_explain := flag.Bool("explain", false,
+		"Describe a txrep field and the values it accepts")
 	opt_print_default_config := flag.Bool("builtin-config", false,
 		"Print the built-in stc.conf file used when none is found")
 	opt_zerosig := flag.Bool("z", false, "Zero out the signatures vector")
+	opt_stripsigs := flag.Bool("strip-sigs", false,
+		"Remove signatures that do not verify against a known signer")
+	opt_upgrade := flag.Bool("upgrade-envelope", false,
+		"Convert an ENVELOPE_TYPE_TX_V0 transaction to ENVELOPE_TYPE_TX")
+	opt_elide_op_source := flag.Bool("elide-op-source", false,
+		"Remove operation source accounts equal to the transaction's")
+	opt_removesig := flag.String("remove-sig", "",
+		"Remove signatures matching `HINT|SIGNER` (hex hint or strkey)")
 	opt_opid := flag.Bool("opid", false, "Calculate a balance entry ID")
+	opt_check := flag.Bool("check", false,
+		"Report txrep errors in FILE as JSON diagnostics")
+	opt_complete := flag.String("complete", "",
+		"With -check, list completions at `LINE[:COL]` as JSON")
+	opt_inspect := flag.Bool("inspect", false,
+		"Review a transaction with all annotations, without changing it")
+	opt_dumpxdr := flag.Bool("dump-xdr", false,
+		"Print compiled XDR as a hex dump annotated with field names")
+	opt_totals := flag.Bool("totals", false,
+		"Summarize amounts sent and maximum debits per source account")
+	opt_lint_online := flag.Bool("lint-online", false,
+		"Query Horizon for recent transactions this one may duplicate")
+	opt_lint_window := flag.Duration("lint-window", 24*time.Hour,
+		"With -lint-online, look back `DURATION` for duplicates")
+	opt_lint_slippage := flag.Float64("lint-slippage", 5,
+		"With -lint-online, warn about path payments allowing more than "+
+			"`PERCENT` slippage")
+	opt_version := flag.Bool("version", false,
+		"Print version information (as JSON with -json)")
+	opt_force := flag.Bool("force", false,
+		"Sign even if SetOptions could lock an account, or bump a "+
+			"sequence number near the maximum")
+	opt_simulate_signers := flag.String("simulate-signers", "",
+		"Check whether signatures by `KEY1,KEY2,...` would meet thresholds")
+	opt_template := flag.Bool("template", false,
+		"Print a reusable copy of a transaction from a file or TXHASH")
+	opt_source := flag.String("source", "",
+		"With -template, make `ACCT` the transaction's source account")
+	opt_sep11 := flag.Bool("sep11", false,
+		"Read and write strict SEP-0011 txrep instead of stc's dialect")
+	opt_compact := flag.Bool("compact", false,
+		"Write txrep without _present and len lines that can be inferred")
+	opt_lenient := flag.Bool("lenient", false,
+		"Accept unknown and missing txrep fields (always the case with -edit)")
+	opt_informat := flag.String("informat", "",
+		"Parse input as `FORMAT` (hex, b64, txrep, or json) instead of "+
+			"guessing")
+	opt_dry_run := flag.Bool("dry-run", false,
+		"Report files, configuration changes, and transactions that "+
+			"would be written, saved, or submitted, but change nothing")
 	if pos := strings.LastIndexByte(os.Args[0], '/'); pos >= 0 {
 		progname = os.Args[0][pos+1:]
 	} else {
 		progname = os.Args[0]
 	}
+	flag.CommandLine.SetOutput(stderr)
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(),
-`Usage: %[1]s [-net=ID] [-z] [-sign] [-c|-json] [-l] [-u] \
-           [-i | -o OUTPUT-FILE] INPUT-FILE
-       %[1]s -edit [-net=ID] FILE
-       %[1]s -post [-net=ID] INPUT-FILE
+`Usage: %[1]s [-net=ID] [-sep11 | -compact] [-lenient] [-informat FMT] [-z | -strip-sigs | -remove-sig HINT] \
+           [-upgrade-envelope] [-elide-op-source] \
+           [-lint-online [-lint-window DURATION] [-lint-slippage PERCENT]] \
+           [-sign | -sign-inner | -sign-outer [-force]] [-c|-json] [-l] [-u] [-i [-y] | -o OUTPUT-FILE] \
+           INPUT-FILE
+       %[1]s -edit [-net=ID] [-sep11 | -compact] FILE
+       %[1]s -check [-sep11] [-lenient] [-complete LINE[:COL]] FILE
+       %[1]s -post [-net=ID] [-sign] [-key NAME] INPUT-FILE
+       %[1]s -propose [-net=ID] [-o OUTPUT-FILE] INPUT-FILE
+       %[1]s -approve [-net=ID] [-key NAME] [-y] FILE
+       %[1]s -inspect [-net=ID] [-lint-online] INPUT-FILE
+       %[1]s -dump-xdr INPUT-FILE
+       %[1]s -totals [-net=ID] INPUT-FILE
+       %[1]s -convert [-net=ID] [-sep11 | -compact] [-c|-json] [-workers N] INPUT-FILE...
+       %[1]s -template [-net=ID] [-source ACCT] INPUT-FILE|TXHASH
+       %[1]s -bump-seq [-net=ID] [-force] [-sign] [-key NAME] [-c|-json] \
+           [-o FILE | -post] ACCT TARGET|+N
+       %[1]s -simulate-signers KEY1,KEY2,... [-net=ID] INPUT-FILE
        %[1]s -preauth [-net=ID] INPUT-FILE
        %[1]s -txhash [-net=ID] _INPUT-FILE
+       %[1]s -payload-hash | -payload-b64 [-net=ID] [-sign-inner] INPUT-FILE
+       %[1]s -attach-raw-sig [-net=ID] [-c|-json] [-i | -o OUTPUT-FILE] PUBKEY SIGHEX INPUT-FILE
+       %[1]s -lab-url [-net=ID] INPUT-FILE
+       %[1]s -selftest [-net=ID] [-horizon URL]
        %[1]s -fee-stats
        %[1]s -ledger-header
-       %[1]s -qa [-net=ID] ACCT
+       %[1]s -ledger-entry [-net=ID] KEY-FILE
+       %[1]s -snapshot [-net=ID] [-o OUTPUT-FILE] ACCT
+       %[1]s -snapshot-diff [-net=ID] OLD-FILE [NEW-FILE]
+       %[1]s -offers [-net=ID] ACCT
+       %[1]s -qa [-net=ID] [-json|-xdr] ACCT
        %[1]s -qt [-net=ID] TXHASH
        %[1]s -qta [-net=ID] ACCT
        %[1]s -create [-net=ID] ACCT
+       %[1]s -watch [-net=ID] [-hook COMMAND] ACCT...
        %[1]s -keygen [NAME]
+       %[1]s -keygen -n COUNT [-prefix NAME]
        %[1]s -pub [NAME]
-       %[1]s -import-key NAME
-       %[1]s -export-key NAME
+       %[1]s -import-key [-stellar-cli IDENTITY] NAME
+       %[1]s -export-key [-stellar-cli IDENTITY] NAME
        %[1]s -list-keys
+       %[1]s -backup-keys FILE
+       %[1]s -restore-keys FILE
+       %[1]s -split-key NAME K N
+       %[1]s -join-key [NAME]
+       %[1]s -agent [-agent-timeout DURATION]
+       %[1]s -audit-log
+       %[1]s -list-signers [-net=ID] [ACCT]
+       %[1]s -forget-signer [-net=ID] SIGNER
+       %[1]s -prune-signers [-net=ID] [-older-than DURATION]
+       %[1]s -check-reset [-net=ID]
+       %[1]s -export-addresses [-net=ID] FILE
+       %[1]s -import-addresses [-net=ID] [-on-conflict ask|keep|replace] FILE
        %[1]s -date YYYY-MM-DD[Thh:mm:ss[Z]]
+       %[1]s -verify-archive [-net=ID] FILE
        %[1]s -hint PUBKEY
+       %[1]s -explain FIELD
        %[1]s -mux ACCT U64
        %[1]s -demux ACCT
        %[1]s -opid ACCT SEQNO OPNO
+       %[1]s -env [-net=ID] [-horizon URL] [-soroban-rpc URL]
+       %[1]s -list-profiles
+       %[1]s -create-profile NAME
        %[1]s -builtin-config
+       %[1]s -version [-json]
 `, progname)
+		printSubcommands(flag.CommandLine.Output())
 		flag.PrintDefaults()
 	}
-	flag.Parse()
+	flag.CommandLine.Parse(expandSubcommand(os.Args[1:]))
 	if *opt_help {
 		flag.CommandLine.SetOutput(os.Stdout)
 		flag.Usage()
@@ -556,23 +1490,79 @@ func main() {
 		os.Stdout.Write(DefaultGlobalConfigContents)
 		return
 	}
+	if *opt_version {
+		if *opt_json {
+			js, _ := json.MarshalIndent(GetVersionInfo(), "", "  ")
+			fmt.Println(string(js))
+		} else {
+			fmt.Print(GetVersionInfo())
+		}
+		return
+	}
+	if *opt_sep11 {
+		txrepDialect = stcdetail.TxrepSEP11
+		if *opt_compact {
+			fmt.Fprintln(stderr,
+				"-sep11 and -compact are mutually exclusive")
+			os.Exit(2)
+		}
+	} else if *opt_compact {
+		txrepDialect = stcdetail.TxrepCompact
+	}
+	if *opt_lenient || *opt_edit {
+		txrepStrict = false
+	}
+	dryRun = *opt_dry_run
+	if *opt_informat != "" {
+		if f, ok := formatNames[*opt_informat]; ok {
+			inputFormat = f
+		} else {
+			fmt.Fprintf(stderr, "-informat must be hex, b64, txrep, "+
+				"or json\n")
+			os.Exit(2)
+		}
+	}
 
-	nmode := b2i(*opt_preauth, *opt_txhash, *opt_post, *opt_edit,
+	nmode := b2i(*opt_preauth, *opt_txhash, *opt_payload_hash,
+		*opt_payload_b64, *opt_post && !*opt_bump_seq, *opt_edit,
+		*opt_propose, *opt_approve,
 		*opt_keygen, *opt_date, *opt_sec2pub, *opt_import_key,
-		*opt_export_key, *opt_acctinfo, *opt_txinfo, *opt_txacct,
-		*opt_friendbot, *opt_list_keys, *opt_fee_stats,
-		*opt_ledger_header, *opt_print_default_config, *opt_mux,
-		*opt_demux, *opt_opid, *opt_hint)
+		*opt_export_key, *opt_backup_keys, *opt_restore_keys,
+		*opt_split_key, *opt_join_key, *opt_agent,
+		*opt_acctinfo, *opt_txinfo, *opt_txacct, *opt_watch,
+		*opt_friendbot, *opt_list_keys, *opt_list_signers,
+		*opt_forget_signer, *opt_prune_signers, *opt_check_reset,
+		*opt_export_addresses, *opt_import_addresses, *opt_verify_archive,
+		*opt_audit_log,		*opt_fee_stats, *opt_env,
+		*opt_list_profiles, *opt_create_profile,
+		*opt_ledger_header, *opt_ledger_entry, *opt_print_default_config,
+		*opt_snapshot, *opt_snapshot_diff, *opt_offers, *opt_convert,
+		*opt_bump_seq, *opt_selftest,
+		*opt_mux, *opt_demux, *opt_opid, *opt_hint, *opt_explain, *opt_check,
+		*opt_inspect, *opt_dumpxdr, *opt_totals, *opt_template,
+		*opt_lab_url, *opt_simulate_signers != "")
 
 	argsMin, argsMax := 1, 1
 	switch {
 	case *opt_fee_stats || *opt_ledger_header ||
-		*opt_print_default_config || *opt_list_keys:
+		*opt_print_default_config || *opt_list_keys || *opt_prune_signers ||
+		*opt_check_reset || *opt_audit_log || *opt_agent ||
+		*opt_selftest || *opt_env || *opt_list_profiles:
 		argsMin, argsMax = 0, 0
-	case *opt_keygen || *opt_sec2pub:
+	case *opt_keygen && *opt_count != 0:
+		argsMin, argsMax = 0, 0
+	case *opt_keygen || *opt_sec2pub || *opt_list_signers || *opt_join_key:
 		argsMin = 0
-	case *opt_mux:
+	case *opt_split_key:
+		argsMin, argsMax = 3, 3
+	case *opt_watch || *opt_convert:
+		argsMax = len(flag.Args())
+	case *opt_mux || *opt_bump_seq:
 		argsMin, argsMax = 2, 2
+	case *opt_snapshot_diff:
+		argsMax = 2
+	case *opt_attach_raw_sig:
+		argsMin, argsMax = 3, 3
 	case *opt_opid:
 		argsMax, argsMax = 3, 3
 	}
@@ -586,7 +1576,7 @@ func main() {
 	if *opt_compile {
 		outfmt = fmt_compiled
 		if *opt_json {
-			fmt.Fprintln(os.Stderr, "-json and -c are mutually exclusive")
+			fmt.Fprintln(stderr, "-json and -c are mutually exclusive")
 			os.Exit(2)
 		}
 	} else if *opt_json {
@@ -595,75 +1585,280 @@ func main() {
 
 	if nmode > 0 {
 		bail := false
-		if *opt_sign || *opt_key != "" {
-			fmt.Fprintln(os.Stderr,
-				"--sign and --key only availble in default mode")
+		if *opt_force && !*opt_bump_seq {
+			fmt.Fprintln(stderr,
+				"-force only available in default and -bump-seq modes")
+			bail = true
+		} else if *opt_sign && !*opt_bump_seq && !*opt_post {
+			fmt.Fprintln(stderr, "--sign only available in default, "+
+				"-post, and -bump-seq modes")
+			bail = true
+		} else if *opt_post && *opt_bump_seq && !*opt_sign && *opt_key == "" {
+			fmt.Fprintln(stderr, "-post with -bump-seq requires -sign")
+			bail = true
+		}
+		if (*opt_sign_inner || *opt_sign_outer) &&
+			!*opt_payload_hash && !*opt_payload_b64 {
+			fmt.Fprintln(stderr, "-sign-inner and -sign-outer "+
+				"only available in default mode")
+			bail = true
+		}
+		if *opt_attach_raw_sig {
+			fmt.Fprintln(stderr,
+				"-attach-raw-sig only available in default mode")
+			bail = true
+		}
+		if *opt_key != "" && !*opt_approve && !*opt_bump_seq && !*opt_post {
+			fmt.Fprintln(stderr, "--key only available in default, "+
+				"-approve, -post, and -bump-seq modes")
 			bail = true
 		}
 		if *opt_learn || *opt_update {
-			fmt.Fprintln(os.Stderr, "-l and -u only availble in default mode")
+			fmt.Fprintln(stderr, "-l and -u only availble in default mode")
 			bail = true
 		}
-		if *opt_inplace || *opt_output != "" {
-			fmt.Fprintln(os.Stderr, "-i and -o only availble in default mode")
+		if *opt_inplace {
+			fmt.Fprintln(stderr, "-i only available in default mode")
 			bail = true
 		}
-		if *opt_compile {
-			fmt.Fprintln(os.Stderr, "-c only availble in default mode")
+		if *opt_output != "" && !*opt_propose && !*opt_snapshot &&
+			!*opt_bump_seq {
+			fmt.Fprintln(stderr, "-o only available in default, -propose, "+
+				"-snapshot, and -bump-seq modes")
 			bail = true
 		}
-		if *opt_json {
-			fmt.Fprintln(os.Stderr, "-json only availble in default mode")
+		if *opt_yes && !*opt_approve {
+			fmt.Fprintln(stderr,
+				"-y only available in default and -approve modes")
 			bail = true
 		}
-		if *opt_zerosig {
-			fmt.Fprintln(os.Stderr, "-z only availble in default mode")
+		if *opt_compile && !*opt_convert && !*opt_bump_seq {
+			fmt.Fprintln(stderr,
+				"-c only available in default, -convert, and -bump-seq modes")
+			bail = true
+		}
+		if *opt_json && !*opt_acctinfo && !*opt_convert && !*opt_bump_seq {
+			fmt.Fprintln(stderr, "-json only available in default, -qa, "+
+				"-convert, and -bump-seq modes")
+			bail = true
+		}
+		if *opt_workers != 0 && !*opt_convert {
+			fmt.Fprintln(stderr, "-workers only available with -convert")
+			bail = true
+		} else if *opt_workers < 0 {
+			fmt.Fprintln(stderr, "-workers must be positive")
+			bail = true
+		}
+		if *opt_xdr && !*opt_acctinfo {
+			fmt.Fprintln(stderr, "-xdr only available with -qa")
+			bail = true
+		} else if *opt_xdr && *opt_json {
+			fmt.Fprintln(stderr, "-json and -xdr are mutually exclusive")
+			bail = true
+		}
+		if *opt_zerosig || *opt_stripsigs || *opt_removesig != "" {
+			fmt.Fprintln(stderr,
+				"-z, -strip-sigs, and -remove-sig only available in default mode")
+			bail = true
+		}
+		if *opt_upgrade || *opt_elide_op_source {
+			fmt.Fprintln(stderr, "-upgrade-envelope and -elide-op-source "+
+				"only available in default mode")
+			bail = true
+		}
+		if *opt_lint_online && !*opt_inspect {
+			fmt.Fprintln(stderr,
+				"-lint-online only available in default and -inspect modes")
+			bail = true
+		}
+		if *opt_older_than != 0 && !*opt_prune_signers {
+			fmt.Fprintln(stderr, "-older-than only available with -prune-signers")
+			bail = true
+		}
+		if *opt_agent_timeout != DefaultAgentTimeout && !*opt_agent {
+			fmt.Fprintln(stderr, "-agent-timeout only available with -agent")
+			bail = true
+		} else if *opt_agent_timeout <= 0 {
+			fmt.Fprintln(stderr, "-agent-timeout must be positive")
+			bail = true
+		}
+		if *opt_complete != "" && !*opt_check {
+			fmt.Fprintln(stderr, "-complete only available with -check")
+			bail = true
+		}
+		if *opt_hook != "" && !*opt_watch {
+			fmt.Fprintln(stderr, "-hook only available with -watch")
+			bail = true
+		}
+		if *opt_source != "" && !*opt_template {
+			fmt.Fprintln(stderr, "-source only available with -template")
+			bail = true
+		}
+		if *opt_on_conflict != "ask" && !*opt_import_addresses {
+			fmt.Fprintln(stderr,
+				"-on-conflict only available with -import-addresses")
+			bail = true
+		}
+		if *opt_stellar_cli != "" && !*opt_import_key && !*opt_export_key {
+			fmt.Fprintln(stderr, "-stellar-cli only available with "+
+				"-import-key and -export-key")
+			bail = true
+		}
+		if (*opt_count != 0 || *opt_prefix != "") && !*opt_keygen {
+			fmt.Fprintln(stderr, "-n and -prefix only available with -keygen")
+			bail = true
+		} else if *opt_count < 0 {
+			fmt.Fprintln(stderr, "-n must be positive")
+			bail = true
+		} else if *opt_prefix != "" && *opt_count == 0 {
+			fmt.Fprintln(stderr, "-prefix requires -n")
 			bail = true
 		}
 		if bail {
 			os.Exit(2)
 		}
 	} else if *opt_inplace && *opt_output != "" {
-		fmt.Fprintln(os.Stderr, "-i and -o are mutually exclusive")
+		fmt.Fprintln(stderr, "-i and -o are mutually exclusive")
+		os.Exit(2)
+	} else if *opt_yes && !*opt_inplace {
+		fmt.Fprintln(stderr, "-y only available with -i")
+		os.Exit(2)
+	} else if *opt_complete != "" {
+		fmt.Fprintln(stderr, "-complete only available with -check")
+		os.Exit(2)
+	} else if *opt_xdr {
+		fmt.Fprintln(stderr, "-xdr only available with -qa")
+		os.Exit(2)
+	} else if *opt_older_than != 0 {
+		fmt.Fprintln(stderr, "-older-than only available with -prune-signers")
+		os.Exit(2)
+	} else if *opt_agent_timeout != DefaultAgentTimeout {
+		fmt.Fprintln(stderr, "-agent-timeout only available with -agent")
+		os.Exit(2)
+	} else if *opt_count != 0 || *opt_prefix != "" {
+		fmt.Fprintln(stderr, "-n and -prefix only available with -keygen")
+		os.Exit(2)
+	} else if *opt_stellar_cli != "" {
+		fmt.Fprintln(stderr,
+			"-stellar-cli only available with -import-key and -export-key")
+		os.Exit(2)
+	} else if *opt_on_conflict != "ask" {
+		fmt.Fprintln(stderr,
+			"-on-conflict only available with -import-addresses")
+		os.Exit(2)
+	} else if *opt_source != "" {
+		fmt.Fprintln(stderr, "-source only available with -template")
+		os.Exit(2)
+	} else if *opt_hook != "" {
+		fmt.Fprintln(stderr, "-hook only available with -watch")
+		os.Exit(2)
+	} else if *opt_workers != 0 {
+		fmt.Fprintln(stderr, "-workers only available with -convert")
 		os.Exit(2)
 	}
 
+	var rmhint stx.SignatureHint
+	if *opt_removesig != "" {
+		var ok bool
+		if rmhint, ok = parseHint(*opt_removesig); !ok {
+			fmt.Fprintf(stderr, "invalid signature hint or signer %q\n",
+				*opt_removesig)
+			os.Exit(2)
+		}
+	}
+
 	var arg string
 	if len(flag.Args()) >= 1 {
 		arg = flag.Args()[0]
 	}
 
+	var rawSigKey PublicKey
+	var rawSig []byte
+	if *opt_attach_raw_sig {
+		if _, err := fmt.Sscan(arg, &rawSigKey); err != nil {
+			fmt.Fprintf(stderr, "invalid PublicKey %s\n", arg)
+			os.Exit(2)
+		}
+		var err error
+		if rawSig, err = hex.DecodeString(flag.Args()[1]); err != nil ||
+			len(rawSig) != 64 {
+			fmt.Fprintf(stderr, "invalid hex signature %s\n",
+				flag.Args()[1])
+			os.Exit(2)
+		}
+		arg = flag.Args()[2]
+	}
+
 	if *opt_nopass {
 		stcdetail.PassphraseFile = io.MultiReader()
 	} else if arg == "-" {
 		stcdetail.PassphraseFile = nil
 	}
 
+	// Profiles must be chosen before anything uses ConfigPath, but
+	// listing and creating them works even if the one chosen is bad
+	profile := *opt_profile
+	if profile == "" {
+		profile = os.Getenv("STCPROFILE")
+	}
+	switch {
+	case *opt_list_profiles:
+		doListProfiles(profile)
+		return
+	case *opt_create_profile:
+		doCreateProfile(arg)
+		return
+	}
+	if profile != "" {
+		if err := UseProfile(profile); err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+	}
+
 	switch {
+	case *opt_check:
+		if *opt_complete != "" {
+			doComplete(arg, *opt_complete)
+		} else {
+			doCheck(arg)
+		}
+		return
+	case *opt_dumpxdr:
+		e, _ := mustReadTx(arg)
+		stcdetail.WriteXdrDump(os.Stdout, e)
+		return
 	case *opt_hint:
 		var pk PublicKey
 		if _, err := fmt.Sscan(arg, &pk); err != nil {
-			fmt.Fprintf(os.Stderr, "invalid PublicKey %s\n", arg)
+			fmt.Fprintf(stderr, "invalid PublicKey %s\n", arg)
 			os.Exit(2)
 		}
 		fmt.Printf("%x\n", pk.Hint())
 		os.Exit(0)
+	case *opt_explain:
+		if doc := stcdetail.ExplainTxrepField(arg); doc != "" {
+			fmt.Print(doc)
+			return
+		}
+		fmt.Fprintf(stderr, "unknown txrep field %s\n", arg)
+		os.Exit(1)
 	case *opt_opid:
 		var opid stx.OperationID
 		opid.Type = stx.ENVELOPE_TYPE_OP_ID
 		if _, err := fmt.Sscan(arg, &opid.Id().SourceAccount); err != nil {
-			fmt.Fprintf(os.Stderr, "invalid account ID %s\n", arg)
+			fmt.Fprintf(stderr, "invalid account ID %s\n", arg)
 			os.Exit(2)
 		}
 		arg = flag.Args()[1]
 		if _, err := fmt.Sscan(arg, &opid.Id().SeqNum); err != nil {
-			fmt.Fprintf(os.Stderr, "invalid SequenceNumber %q (%s)\n",
+			fmt.Fprintf(stderr, "invalid SequenceNumber %q (%s)\n",
 				arg, err)
 			os.Exit(2)
 		}
 		arg = flag.Args()[2]
 		if _, err := fmt.Sscan(arg, &opid.Id().OpNum); err != nil {
-			fmt.Fprintf(os.Stderr, "invalid operation number %q (%s)\n",
+			fmt.Fprintf(stderr, "invalid operation number %q (%s)\n",
 				arg, err)
 			os.Exit(2)
 		}
@@ -676,17 +1871,17 @@ func main() {
 		var pk AccountID
 		var id uint64
 		if _, err := fmt.Sscan(arg, &pk); err != nil {
-			fmt.Fprintf(os.Stderr, "invalid account ID %s\n", arg)
+			fmt.Fprintf(stderr, "invalid account ID %s\n", arg)
 			os.Exit(2)
 		}
 		arg1 := flag.Args()[1]
 		if _, err := fmt.Sscan(arg1, &id); err != nil {
-			fmt.Fprintf(os.Stderr, "invalid uint64 %q (%s)\n", arg1, err)
+			fmt.Fprintf(stderr, "invalid uint64 %q (%s)\n", arg1, err)
 			os.Exit(2)
 		}
 		m := MuxAcct(&pk, &id)
 		if m == nil {
-			fmt.Fprintf(os.Stderr, "cannot multiplex account\n")
+			fmt.Fprintf(stderr, "cannot multiplex account\n")
 			os.Exit(2)
 		}
 		fmt.Println(m.String())
@@ -694,12 +1889,12 @@ func main() {
 	case *opt_demux:
 		var m MuxedAccount
 		if _, err := fmt.Sscan(arg, &m); err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(stderr, err)
 			os.Exit(2)
 		}
 		pk, id := DemuxAcct(&m)
 		if pk == nil {
-			fmt.Fprintf(os.Stderr, "cannot demultiplex account\n")
+			fmt.Fprintf(stderr, "cannot demultiplex account\n")
 			os.Exit(2)
 		}
 		fmt.Print(pk)
@@ -716,8 +1911,11 @@ func main() {
 				return
 			}
 		}
-		fmt.Fprintf(os.Stderr, "%s: cannot parse date %q\n", progname, arg)
+		fmt.Fprintf(stderr, "%s: cannot parse date %q\n", progname, arg)
 		os.Exit(1)
+	case *opt_keygen && *opt_count != 0:
+		doKeyGenBulk(*opt_count, *opt_prefix)
+		return
 	case *opt_keygen:
 		if arg != "" {
 			arg = AdjustKeyName(arg)
@@ -732,12 +1930,21 @@ func main() {
 		return
 	case *opt_import_key:
 		arg = AdjustKeyName(arg)
-		sk, err := InputPrivateKey("Secret key: ")
-		if err == nil {
+		var sk PrivateKey
+		var err error
+		if *opt_stellar_cli != "" {
+			sk, err = LoadStellarCliIdentity(
+				StellarCliIdentityPath(*opt_stellar_cli))
+		} else {
+			sk, err = InputPrivateKey("Secret key: ")
+		}
+		if err == nil && dryRunSkip("save key %s to %s", sk.Public(), arg) {
+			return
+		} else if err == nil {
 			err = sk.Save(arg, stcdetail.GetPass2("Passphrase: "))
 		}
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
+			fmt.Fprintln(stderr, err.Error())
 			os.Exit(1)
 		}
 		return
@@ -745,32 +1952,198 @@ func main() {
 		arg = AdjustKeyName(arg)
 		sk, err := LoadPrivateKey(arg)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
+			fmt.Fprintln(stderr, err.Error())
 			os.Exit(1)
 		}
+		if *opt_stellar_cli != "" {
+			file := StellarCliIdentityPath(*opt_stellar_cli)
+			if dryRunSkip("write key %s to %s", sk.Public(), file) {
+				return
+			}
+			if err = sk.SaveStellarCliIdentity(file); err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", file, err)
+				os.Exit(1)
+			}
+			fmt.Println(file)
+			return
+		}
 		fmt.Println(sk)
 		return
+	case *opt_backup_keys:
+		doBackupKeys(arg)
+		return
+	case *opt_restore_keys:
+		doRestoreKeys(arg)
+		return
+	case *opt_split_key:
+		doSplitKey(AdjustKeyName(arg), flag.Args()[1], flag.Args()[2])
+		return
+	case *opt_join_key:
+		if arg != "" {
+			arg = AdjustKeyName(arg)
+		}
+		doJoinKey(arg)
+		return
 	case *opt_list_keys:
 		for _, k := range GetKeyNames() {
 			fmt.Println(k)
 		}
 		return
+	case *opt_audit_log:
+		doAuditLog()
+		return
+	case *opt_env:
+		doEnv(*opt_profile, *opt_netname, *opt_horizon, *opt_soroban_rpc)
+		return
+	case *opt_agent:
+		doAgent(*opt_agent_timeout)
+		return
 	}
 
 	net := DefaultStellarNet(*opt_netname)
 	if net == nil {
-		fmt.Fprintf(os.Stderr, "unknown network %q\n", *opt_netname)
+		fmt.Fprintf(stderr, "unknown network %q\n", *opt_netname)
 		os.Exit(1)
 	}
+	net.TxrepDialect = txrepDialect
+	net.TxrepNetwork = true
+	netname, _ := resolveNetName(*opt_netname)
+	netConf = loadNetKeys(netname).cliConfig()
+	if *opt_horizon != "" {
+		net.Horizon = mustEndpointURL("-horizon", *opt_horizon)
+	}
+	if *opt_soroban_rpc != "" {
+		net.SorobanRPC = mustEndpointURL("-soroban-rpc", *opt_soroban_rpc)
+	}
+	txrepNet = net
+
+	if *opt_convert {
+		doConvert(net, flag.Args(), outfmt, *opt_workers)
+		return
+	}
+
+	if *opt_selftest {
+		doSelfTest(net)
+		return
+	}
+
+	if *opt_bump_seq {
+		if *opt_output != "" && *opt_post {
+			fmt.Fprintln(stderr, "-o and -post are mutually exclusive")
+			os.Exit(2)
+		}
+		e := bumpSeqTx(net, flag.Arg(0), flag.Arg(1), *opt_force)
+		if (*opt_sign || *opt_key != "") &&
+			signTx(net, *opt_key, e, "", true, false) != nil {
+			exit(1)
+		}
+		if *opt_post {
+			mustPost(net, e)
+		} else {
+			mustWriteTx(*opt_output, e, net, outfmt)
+		}
+		return
+	}
+
+	if *opt_list_signers {
+		if arg != "" {
+			arg = mustResolveAccount(net, arg)
+			var acct AccountID
+			if _, err := fmt.Sscan(arg, &acct); err != nil {
+				fmt.Fprintln(stderr, "syntactically invalid account")
+				os.Exit(1)
+			}
+		}
+		listSigners(net, arg)
+		return
+	}
+
+	if *opt_forget_signer {
+		var signer SignerKey
+		if _, err := fmt.Sscan(arg, &signer); err != nil {
+			fmt.Fprintln(stderr, "syntactically invalid signer")
+			os.Exit(1)
+		}
+		known := false
+		for _, ski := range net.GetSigners()[signer.Hint()] {
+			known = known || ski.Key.String() == signer.String()
+		}
+		if !known {
+			fmt.Fprintf(stderr, "warning: %s is not a known signer\n", arg)
+		}
+		if err := net.ForgetSigner(arg); err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+		mustSaveNet(net)
+		return
+	}
+
+	if *opt_prune_signers {
+		for _, k := range pruneSigners(net, *opt_older_than) {
+			fmt.Println("forgot", k)
+		}
+		mustSaveNet(net)
+		return
+	}
+
+	if *opt_export_addresses {
+		doExportAddresses(net, arg)
+		return
+	}
+
+	if *opt_import_addresses {
+		doImportAddresses(net, arg, *opt_on_conflict)
+		return
+	}
+
+	if *opt_verify_archive {
+		doVerifyArchive(arg)
+		return
+	}
+
+	if *opt_check_reset {
+		reset, err := net.CheckReset()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+		if !reset {
+			fmt.Printf("network %s has not been reset (latest ledger %d)\n",
+				net.Name, net.LastLedger)
+		} else if askYesNo(fmt.Sprintf("Network %s appears to have been "+
+			"reset.  Forget learned signers", net.Name)) {
+			for _, k := range net.ResetNetworkData() {
+				fmt.Println("forgot", k)
+			}
+			net.CheckReset()
+		}
+		mustSaveNet(net)
+		return
+	}
 
 	if *opt_acctinfo {
+		arg = mustResolveAccount(net, arg)
 		var acct AccountID
 		if _, err := fmt.Sscan(arg, &acct); err != nil {
-			fmt.Fprintln(os.Stderr, "syntactically invalid account")
+			fmt.Fprintln(stderr, "syntactically invalid account")
 			os.Exit(1)
 		}
-		if ae, err := net.GetAccountEntry(arg); err != nil {
-			fmt.Fprintln(os.Stderr, err)
+		if *opt_json || *opt_xdr {
+			ae, err := net.GetAccountEntryXdr(arg)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				os.Exit(1)
+			} else if *opt_xdr {
+				fmt.Println(stcdetail.XdrToBase64(ae))
+			} else if js, err := stcdetail.XdrToJson(ae); err != nil {
+				fmt.Fprintln(stderr, err)
+				os.Exit(1)
+			} else {
+				os.Stdout.Write(js)
+			}
+		} else if ae, err := net.GetAccountEntry(arg); err != nil {
+			fmt.Fprintln(stderr, err)
 			os.Exit(1)
 		} else {
 			fmt.Print(ae)
@@ -781,34 +2154,35 @@ func main() {
 	if *opt_txinfo {
 		var txid stx.Hash
 		if _, err := fmt.Sscanf(arg, "%v", stx.XDR_Hash(&txid)); err != nil {
-			fmt.Fprintln(os.Stderr, "syntactically invalid txid")
+			fmt.Fprintln(stderr, "syntactically invalid txid")
 			os.Exit(1)
 		} else if txr, err := net.GetTxResult(arg); err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(stderr, err)
 			os.Exit(1)
 		} else if *opt_verbose {
 			fmt.Print(txr)
 		} else {
 			fmt.Printf("created_at: %s\n", txr.Time)
-			fmt.Print("==== TRANSACTION ====\n", net.ToRep(&txr.Env),
+			mustPrint(fmt.Sprint("==== TRANSACTION ====\n",
+				net.ToRep(&txr.Env),
 				"==== RESULT ====\n", net.ToRep(&txr.Result),
 				"==== EFFECTS ====\n",
-				net.AccountDelta(&txr.StellarMetas, nil, ""))
+				net.AccountDelta(&txr.StellarMetas, nil, "")))
 		}
 		return
 	}
 
 	if *opt_txacct {
+		arg = mustResolveAccount(net, arg)
 		var acct AccountID
 		if _, err := fmt.Sscan(arg, &acct); err != nil {
-			fmt.Fprintln(os.Stderr, "syntactically invalid account")
+			fmt.Fprintln(stderr, "syntactically invalid account")
 			os.Exit(1)
 		}
 
 		nl := false
-		err := net.IterateJSON(nil, "accounts/" + arg +
-			"/transactions?order=desc&limit=200",
-			func(r *HorizonTxResult) {
+		err := net.Iterate(nil, "accounts/" + arg + "/transactions",
+			url.Values{"order": {"desc"}}, func(r *HorizonTxResult) {
 				if *opt_verbose {
 					if !nl {
 						nl = true
@@ -822,20 +2196,39 @@ func main() {
 				}
 			})
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(stderr, err)
 			os.Exit(1)
 		}
 		return
 	}
 
+	if *opt_watch {
+		accts := make([]string, len(flag.Args()))
+		for i, a := range flag.Args() {
+			accts[i] = mustResolveAccount(net, a)
+			var acct AccountID
+			if _, err := fmt.Sscan(accts[i], &acct); err != nil {
+				fmt.Fprintf(stderr, "syntactically invalid account %s\n", a)
+				os.Exit(1)
+			}
+		}
+		doWatch(net, accts, *opt_hook)
+		return
+	}
+
 	if *opt_friendbot {
+		arg = mustResolveAccount(net, arg)
 		var acct AccountID
 		if _, err := fmt.Sscan(arg, &acct); err != nil {
-			fmt.Fprintln(os.Stderr, "syntactically invalid account")
+			fmt.Fprintln(stderr, "syntactically invalid account")
 			os.Exit(1)
 		}
+		if dryRunSkip("ask the friendbot of network %s to create %s",
+			net.Name, arg) {
+			return
+		}
 		if _, err := net.Get("friendbot?addr=" + arg); err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(stderr, err)
 			os.Exit(1)
 		}
 		return
@@ -844,7 +2237,7 @@ func main() {
 	if *opt_fee_stats {
 		fs, err := net.GetFeeStats()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error fetching fee stats: %s\n",
+			fmt.Fprintf(stderr, "error fetching fee stats: %s\n",
 				err.Error())
 			os.Exit(1)
 		}
@@ -855,11 +2248,65 @@ func main() {
 	if *opt_ledger_header {
 		lh, err := net.GetLedgerHeader()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error fetching fee stats: %s\n",
+			fmt.Fprintf(stderr, "error fetching fee stats: %s\n",
 				err.Error())
 			os.Exit(1)
 		}
-		fmt.Print(net.ToRep(lh))
+		mustPrint(net.ToRep(lh))
+		return
+	}
+
+	if *opt_ledger_entry {
+		var key stx.LedgerKey
+		if err := readTxrepFile(arg, &key); err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+		le, err := net.GetLedgerEntry(&key)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+		mustPrint(net.ToRep(le))
+		return
+	}
+
+	if *opt_snapshot {
+		arg = mustResolveAccount(net, arg)
+		var acct AccountID
+		if _, err := fmt.Sscan(arg, &acct); err != nil {
+			fmt.Fprintln(stderr, "syntactically invalid account")
+			os.Exit(1)
+		}
+		doSnapshot(net, arg, *opt_output)
+		return
+	}
+
+	if *opt_offers {
+		arg = mustResolveAccount(net, arg)
+		var acct AccountID
+		if _, err := fmt.Sscan(arg, &acct); err != nil {
+			fmt.Fprintln(stderr, "syntactically invalid account")
+			os.Exit(1)
+		}
+		offers, err := net.GetOffers(arg)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			os.Exit(1)
+		}
+		for i := range offers {
+			fmt.Printf("%d: %s\n", offers[i].OfferID,
+				net.OfferString(&offers[i]))
+		}
+		return
+	}
+
+	if *opt_snapshot_diff {
+		newfile := ""
+		if len(flag.Args()) > 1 {
+			newfile = flag.Arg(1)
+		}
+		doSnapshotDiff(net, arg, newfile)
 		return
 	}
 
@@ -868,44 +2315,221 @@ func main() {
 		return
 	}
 
-	e, infmt := mustReadTx(arg)
+	if *opt_propose {
+		doPropose(net, arg, *opt_output)
+		return
+	}
+
+	if *opt_approve {
+		doApprove(net, arg, *opt_key, *opt_yes)
+		return
+	}
+
+	if *opt_template {
+		e := readTemplate(net, arg).Template()
+		if *opt_source != "" {
+			var acct MuxedAccount
+			if _, err := fmt.Sscan(mustResolveAccount(net, *opt_source),
+				&acct); err != nil {
+				fmt.Fprintf(stderr, "invalid account %q\n", *opt_source)
+				os.Exit(2)
+			}
+			e.SetSourceAccount(&acct)
+		}
+		mustPrint(net.TxToRep(e))
+		return
+	}
+
+	if *opt_post {
+		if b := readBundle(arg); b != nil {
+			doPostBundle(net, b, arg, *opt_sign || *opt_key != "", *opt_key)
+			return
+		} else if *opt_sign || *opt_key != "" {
+			fmt.Fprintln(stderr,
+				"-sign and -key with -post only available for bundles")
+			os.Exit(2)
+		}
+	}
+
+	var e *TransactionEnvelope
+	var infmt format
+	if *opt_post || *opt_inspect {
+		e, infmt = readRequest(net, arg), fmt_txrep
+	}
+	if e == nil {
+		e, infmt = mustReadTx(arg)
+	}
+	mustCheckNetwork(net, e, arg)
 	switch {
 	case *opt_post:
-		res, err := net.Post(e)
-		if err == nil {
-			fmt.Print(xdr.XdrToString(res))
-		} else {
-			fmt.Fprintf(os.Stderr, "Post transaction failed: %s\n", err)
+		mustPost(net, e)
+	case *opt_inspect:
+		doInspect(net, e)
+		if *opt_lint_online {
+			lintOnline(net, e, *opt_lint_window, *opt_lint_slippage)
+		}
+	case *opt_totals:
+		doTotals(net, e)
+	case *opt_simulate_signers != "":
+		var keys []SignerKey
+		for _, k := range strings.Split(*opt_simulate_signers, ",") {
+			var key SignerKey
+			if _, err := fmt.Sscan(k, &key); err != nil {
+				fmt.Fprintf(stderr, "invalid signer %q\n", k)
+				os.Exit(2)
+			}
+			keys = append(keys, key)
+		}
+		if !doSimulateSigners(net, e, keys) {
 			os.Exit(1)
 		}
 	case *opt_txhash:
 		fmt.Printf("%x\n", *net.HashTx(e))
+	case *opt_payload_hash || *opt_payload_b64:
+		var tx stx.Signable = e
+		if *opt_sign_inner {
+			if e.Type != stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+				fmt.Fprintln(stderr,
+					"-sign-inner requires a fee-bump transaction")
+				os.Exit(1)
+			}
+			tx = e.FeeBump().Tx.InnerTx.V1()
+		}
+		if *opt_payload_hash {
+			fmt.Printf("%x\n", *net.HashTx(tx))
+		} else {
+			fmt.Println(base64.StdEncoding.EncodeToString(
+				net.SignaturePayload(tx)))
+		}
+	case *opt_lab_url:
+		fmt.Println(labURL(net, e))
 	case *opt_preauth:
 		sk := stx.SignerKey{Type: stx.SIGNER_KEY_TYPE_PRE_AUTH_TX}
 		*sk.PreAuthTx() = *net.HashTx(e)
 		fmt.Println(&sk)
 	default:
+		if *opt_learn || *opt_update {
+			warnReset(net)
+		}
 		getAccounts(net, e, *opt_learn)
+		var orig *TransactionEnvelope
+		if *opt_inplace && !*opt_yes {
+			orig = NewTransactionEnvelope()
+			stcdetail.XdrFromBin(orig, stcdetail.XdrToBin(e))
+		}
+		if *opt_upgrade {
+			e.UpgradeEnvelope()
+		}
+		if *opt_elide_op_source && e.ElideOpSources() > 0 &&
+			len(*e.Signatures()) > 0 && !*opt_zerosig {
+			fmt.Fprintln(stderr, "warning: removing operation source "+
+				"accounts invalidates existing signatures")
+		}
+		if *opt_removesig != "" && removeSig(e, rmhint) == 0 {
+			fmt.Fprintf(stderr, "warning: no signature matches %s\n",
+				*opt_removesig)
+		}
 		if *opt_zerosig {
 			*e.Signatures() = nil
+		} else if *opt_stripsigs {
+			stripSigs(net, e)
+		} else {
+			warnInvalidSigs(net, e)
 		}
 		if *opt_update {
 			fixTx(net, e)
 		}
-		if *opt_sign || *opt_key != "" {
-			if err := signTx(net, *opt_key, e); err != nil {
+		if *opt_learn || *opt_update {
+			if f := accountEntries.freshness(); f != "" {
+				fmt.Fprintf(stderr, "account data as of %s\n", f)
+			}
+		}
+		if *opt_lint_online {
+			lintOnline(net, e, *opt_lint_window, *opt_lint_slippage)
+		}
+		if (*opt_sign_inner || *opt_sign_outer) &&
+			e.Type != stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+			fmt.Fprintln(stderr,
+				"-sign-inner and -sign-outer require a fee-bump transaction")
+			os.Exit(1)
+		}
+		if *opt_attach_raw_sig {
+			nouter := len(*e.Signatures())
+			if err := net.AttachSignature(e, rawSigKey, rawSig); err != nil {
+				fmt.Fprintln(stderr, err)
 				os.Exit(1)
+			} else if len(*e.Signatures()) == nouter && nouter > 0 {
+				fmt.Fprintf(stderr, "warning: signing the inner "+
+					"transaction invalidates %d fee bump signature(s)\n",
+					nouter)
 			}
 		}
-		if *opt_learn {
-			net.Save()
+		if *opt_sign || *opt_sign_inner || *opt_sign_outer || *opt_key != "" {
+			for _, w := range net.StartingBalanceWarnings(e) {
+				fmt.Fprintln(stderr, "warning:", w)
+			}
+			if ws := net.LockoutWarnings(e); len(ws) > 0 {
+				for _, w := range ws {
+					fmt.Fprintln(stderr, "warning:", w)
+				}
+				if !*opt_force {
+					fmt.Fprintln(stderr,
+						"not signing; use -force to sign anyway")
+					os.Exit(1)
+				}
+			}
+			outer := *opt_sign || *opt_sign_outer || !*opt_sign_inner
+			if err := signTx(net, *opt_key, e, arg, outer,
+				*opt_sign_inner); err != nil {
+				os.Exit(1)
+			}
 		}
 		if *opt_inplace {
+			if orig != nil && !confirmOverwrite(net, arg, orig, e) {
+				fmt.Fprintf(stderr, "not overwriting %s\n", arg)
+				os.Exit(1)
+			}
 			*opt_output = arg
-			if infmt == fmt_compiled && outfmt == fmt_txrep {
+			if (infmt == fmt_compiled || infmt == fmt_hex) &&
+				outfmt == fmt_txrep {
 				outfmt = infmt
 			}
 		}
-		mustWriteTx(*opt_output, e, net, outfmt)
+		if dryRun {
+			if *opt_learn {
+				dryRunSave(net)
+			}
+			if *opt_output != "" {
+				dryRunWrite(*opt_output, formatTx(e, net, outfmt))
+			} else {
+				mustPrint(formatTx(e, net, outfmt))
+			}
+			return
+		}
+		// Save learned signers and the output file together, so a
+		// failure cannot leave one updated without the other.
+		var txn stcdetail.FileTxn
+		var err error
+		if *opt_learn {
+			err = net.SaveIn(&txn, 0666)
+		}
+		if err == nil && *opt_output != "" {
+			output := formatTx(e, net, outfmt)
+			err = txn.WriteFile(*opt_output, output, 0666)
+			if err == nil {
+				err = archiveSign(&txn, *opt_output, output)
+			}
+		}
+		if err == nil {
+			err = txn.Commit()
+		} else {
+			txn.Abort()
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			os.Exit(1)
+		} else if *opt_output == "" {
+			mustPrint(formatTx(e, net, outfmt))
+		}
 	}
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A subcommand is an alias for one or more options.  For example,
+// "stc keys gen mykey" is equivalent to "stc -keygen mykey".  Options
+// that follow the subcommand are passed through unchanged, so the
+// usual checks for mutually exclusive options still apply.
+type subcommand struct {
+	name  string
+	flags []string
+}
+
+// Subcommands grouped by their first word.  Commands of one word
+// have an empty second word.
+var subcommands = []struct {
+	group string
+	cmds  []subcommand
+}{
+	{"tx", []subcommand{
+		{"sign", []string{"-sign"}},
+		{"compile", []string{"-c"}},
+		{"edit", []string{"-edit"}},
+		{"check", []string{"-check"}},
+		{"inspect", []string{"-inspect"}},
+		{"totals", []string{"-totals"}},
+		{"dump", []string{"-dump-xdr"}},
+		{"hash", []string{"-txhash"}},
+		{"preauth", []string{"-preauth"}},
+		{"payload-hash", []string{"-payload-hash"}},
+		{"payload-b64", []string{"-payload-b64"}},
+		{"attach-sig", []string{"-attach-raw-sig"}},
+		{"post", []string{"-post"}},
+		{"propose", []string{"-propose"}},
+		{"approve", []string{"-approve"}},
+		{"template", []string{"-template"}},
+		{"bump-seq", []string{"-bump-seq"}},
+	}},
+	{"keys", []subcommand{
+		{"gen", []string{"-keygen"}},
+		{"pub", []string{"-pub"}},
+		{"import", []string{"-import-key"}},
+		{"export", []string{"-export-key"}},
+		{"list", []string{"-list-keys"}},
+		{"backup", []string{"-backup-keys"}},
+		{"restore", []string{"-restore-keys"}},
+		{"split", []string{"-split-key"}},
+		{"join", []string{"-join-key"}},
+		{"agent", []string{"-agent"}},
+	}},
+	{"signers", []subcommand{
+		{"list", []string{"-list-signers"}},
+		{"forget", []string{"-forget-signer"}},
+		{"prune", []string{"-prune-signers"}},
+	}},
+	{"addresses", []subcommand{
+		{"export", []string{"-export-addresses"}},
+		{"import", []string{"-import-addresses"}},
+	}},
+	{"profile", []subcommand{
+		{"list", []string{"-list-profiles"}},
+		{"create", []string{"-create-profile"}},
+	}},
+	{"net", []subcommand{
+		{"account", []string{"-qa"}},
+		{"tx", []string{"-qt"}},
+		{"history", []string{"-qta"}},
+		{"watch", []string{"-watch"}},
+		{"create", []string{"-create"}},
+		{"fee-stats", []string{"-fee-stats"}},
+		{"ledger-header", []string{"-ledger-header"}},
+		{"ledger-entry", []string{"-ledger-entry"}},
+		{"snapshot", []string{"-snapshot"}},
+		{"snapshot-diff", []string{"-snapshot-diff"}},
+		{"offers", []string{"-offers"}},
+		{"check-reset", []string{"-check-reset"}},
+		{"selftest", []string{"-selftest"}},
+	}},
+	{"", []subcommand{
+		{"sign", []string{"-sign"}},
+		{"edit", []string{"-edit"}},
+		{"post", []string{"-post"}},
+		{"propose", []string{"-propose"}},
+		{"approve", []string{"-approve"}},
+		{"date", []string{"-date"}},
+		{"hint", []string{"-hint"}},
+		{"explain", []string{"-explain"}},
+		{"mux", []string{"-mux"}},
+		{"demux", []string{"-demux"}},
+		{"opid", []string{"-opid"}},
+		{"env", []string{"-env"}},
+		{"agent", []string{"-agent"}},
+		{"version", []string{"-version"}},
+		{"help", []string{"-help"}},
+	}},
+}
+
+// Prints the subcommands and the options for which they stand.
+func printSubcommands(out io.Writer) {
+	fmt.Fprintln(out, "Subcommands (aliases for options):")
+	for _, g := range subcommands {
+		for _, c := range g.cmds {
+			name := strings.TrimSpace(g.group + " " + c.name)
+			fmt.Fprintf(out, "  %s %-20s %s\n", progname, name,
+				strings.Join(c.flags, " "))
+		}
+	}
+}
+
+// Replaces a subcommand at the start of args with the options it
+// stands for.  Arguments that do not start with a subcommand are
+// returned unchanged, as is a lone argument naming an existing file.
+// Otherwise, input files whose names collide with a subcommand must
+// be given with a directory (e.g., "./post").
+func expandSubcommand(args []string) []string {
+	if len(args) == 0 || len(args) == 1 && FileExists(args[0]) {
+		return args
+	}
+	for _, g := range subcommands {
+		if g.group == "" {
+			for _, c := range g.cmds {
+				if args[0] == c.name {
+					return append(append([]string{}, c.flags...),
+						args[1:]...)
+				}
+			}
+			continue
+		} else if args[0] != g.group {
+			continue
+		}
+		if len(args) > 1 {
+			for _, c := range g.cmds {
+				if args[1] == c.name {
+					return append(append([]string{}, c.flags...),
+						args[2:]...)
+				}
+			}
+		}
+		fmt.Fprintf(stderr, "%s %s: missing or unknown subcommand\n",
+			progname, g.group)
+		printSubcommands(stderr)
+		os.Exit(2)
+	}
+	return args
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/xdrpp/stc"
+)
+
+// Returns a one-line summary of transaction r on account acct for
+// -watch.
+func watchSummary(net *StellarNet, acct string, r *HorizonTxResult) string {
+	e := &TransactionEnvelope{TransactionEnvelope: &r.Env}
+	if inner := e.InnerTx(); inner != nil {
+		e = inner
+	}
+	name := acct
+	if note := net.AccountIDNote(acct); note != "" {
+		name += " (" + note + ")"
+	}
+	return fmt.Sprintf("%s %s %x ledger %d %s %d ops from %s",
+		r.Time.Format(time.RFC3339), name, r.Txhash, r.Ledger,
+		r.Result.Result.Code, len(*e.Operations()),
+		e.SourceAccount())
+}
+
+// Runs the -hook command for transaction r on account acct, with
+// details in environment variables and the transaction on standard
+// input.
+func runWatchHook(net *StellarNet, hook, acct string,
+	r *HorizonTxResult) {
+	if dryRunSkip("run -hook for transaction %x on %s", r.Txhash, acct) {
+		return
+	}
+	cmd := exec.Command("/bin/sh", "-c", hook)
+	cmd.Env = append(os.Environ(),
+		"STC_ACCOUNT="+acct,
+		"STC_TXHASH="+fmt.Sprintf("%x", r.Txhash),
+		"STC_LEDGER="+fmt.Sprint(r.Ledger),
+		"STC_RESULT="+r.Result.Result.Code.String(),
+		"STC_NETWORK="+net.Name,
+	)
+	cmd.Stdin = strings.NewReader(r.String())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(stderr, "%s: hook failed: %s\n", acct, err)
+	}
+}
+
+// Implements -watch:  prints a summary line for each new transaction
+// on any of accts, running hook (if not empty) for each one.  Runs
+// until an account cannot be watched.
+func doWatch(net *StellarNet, accts []string, hook string) {
+	var mu sync.Mutex
+	errs := make(chan error)
+	for _, acct := range accts {
+		go func(acct string) {
+			errs <- net.WatchTransactions(nil, acct, "",
+				func(r *HorizonTxResult) error {
+					mu.Lock()
+					defer mu.Unlock()
+					fmt.Println(watchSummary(net, acct, r))
+					if hook != "" {
+						runWatchHook(net, hook, acct, r)
+					}
+					return nil
+				})
+		}(acct)
+	}
+	err := <-errs
+	fmt.Fprintln(stderr, err)
+	os.Exit(1)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/xdrpp/stc/ini"
 	"github.com/xdrpp/stc/stcdetail"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -34,6 +35,7 @@ native-asset = TestXLM
 `)
 
 var globalConfigContents []byte
+var globalConfigPath string
 
 func getGlobalConfigContents() []byte {
 	if globalConfigContents != nil {
@@ -49,7 +51,7 @@ func getGlobalConfigContents() []byte {
 	}
 	for _, conf := range confs {
 		if contents, err := ioutil.ReadFile(conf); err == nil {
-			globalConfigContents = contents
+			globalConfigContents, globalConfigPath = contents, conf
 			break
 		}
 	}
@@ -59,39 +61,67 @@ func getGlobalConfigContents() []byte {
 	return globalConfigContents
 }
 
+// Returns the path of the system configuration file (stc.conf) that
+// ParseConfigFiles uses, or "" if none exists and it uses
+// DefaultGlobalConfigContents.
+func GlobalConfigPath() string {
+	getGlobalConfigContents()
+	return globalConfigPath
+}
+
 var stcDir string
 
-func getConfigDir(create bool) string {
-	if stcDir != "" {
-		return stcDir
-	} else if d, ok := os.LookupEnv("STCDIR"); ok {
-		stcDir = d
+// The configuration directory without regard to profiles:  $STCDIR,
+// or stc under UserConfigDir(), or else ./.stc.
+func baseConfigDir() string {
+	var dir string
+	if d, ok := os.LookupEnv("STCDIR"); ok {
+		dir = d
 	} else if d, err := os.UserConfigDir(); err == nil {
-		stcDir = filepath.Join(d, "stc")
+		dir = filepath.Join(d, "stc")
 	} else {
-		stcDir = ".stc"
+		dir = ".stc"
 	}
-	if len(stcDir) > 0 && stcDir[0] != '/' {
-		if d, err := filepath.Abs(stcDir); err == nil {
-			stcDir = d
+	if len(dir) > 0 && dir[0] != '/' {
+		if d, err := filepath.Abs(dir); err == nil {
+			dir = d
 		}
 	}
+	return dir
+}
+
+func getConfigDir(create bool) string {
+	if stcDir != "" {
+		return stcDir
+	}
+	stcDir = baseConfigDir()
+	if p := os.Getenv("STCPROFILE"); ValidProfileName(p) {
+		stcDir, stcProfile = ProfileDir(p), p
+	}
 	if _, err := os.Stat(stcDir); os.IsNotExist(err) && create &&
 		os.MkdirAll(stcDir, 0777) == nil {
-		if _, err = LoadStellarNet("main",
-			path.Join(stcDir, "main.net")); err == nil {
-				os.Symlink("main.net", path.Join(stcDir, "default.net"))
-			}
+		initConfigDir(stcDir)
 	}
 	return stcDir
 }
 
+// Populates a new configuration directory, making the main network
+// the default.
+func initConfigDir(dir string) {
+	if _, err := LoadStellarNet("main",
+		path.Join(dir, "main.net")); err == nil {
+		os.Symlink("main.net", path.Join(dir, "default.net"))
+	}
+}
+
 // Return the path to a file under the user's configuration directory.
 // The configuration directory is found based on environment
 // variables.  From highest to lowest precedence tries $STCDIR,
 // UserConfigDir() (i.e., on Unix $XDG_CONFIG_HOME/.stc or
 // $HOME/.config/stc), or ./.stc, using the first one with for which
-// the environment variable exists.  If the configuration directory
+// the environment variable exists.  If a profile is in use (see
+// UseProfile), the configuration directory is that profile's
+// directory under it instead.  If the configuration directory
 // doesn't exist, it gets created, but the underlying path requested
 // will not be created.
 func ConfigPath(components...string) string {
@@ -163,10 +193,28 @@ func (snp *stellarNetParser) doNet(ii ini.IniItem) error {
 		}
 	case "horizon":
 		target = &snp.Horizon
+	case "soroban-rpc":
+		target = &snp.SorobanRPC
 	case "native-asset":
 		target = &snp.NativeAsset
 	case "network-id":
 		target = &snp.NetworkId
+	case "price-oracle":
+		target = &snp.PriceOracle
+	case "price-currency":
+		target = &snp.PriceCurrency
+	case "policy":
+		target = &snp.Policy
+	case "http-header":
+		return snp.doHTTPHeader(ii)
+	case "last-ledger":
+		if ii.Value == nil {
+			snp.LastLedger = 0
+		} else if snp.LastLedger == 0 {
+			if _, err := fmt.Sscan(ii.Val(), &snp.LastLedger); err != nil {
+				return ini.BadValue(err.Error())
+			}
+		}
 	}
 	if target != nil {
 		if ii.Value == nil {
@@ -178,6 +226,28 @@ func (snp *stellarNetParser) doNet(ii ini.IniItem) error {
 	return nil
 }
 
+// Parses an http-header item of the form "Name: value".  As with
+// other keys, the first setting of each header name wins, so a
+// network's own file can override global configuration.  An empty
+// value removes a header set in a later file.
+func (snp *stellarNetParser) doHTTPHeader(ii ini.IniItem) error {
+	if ii.Value == nil {
+		return nil
+	}
+	kv := strings.SplitN(ii.Val(), ":", 2)
+	name := http.CanonicalHeaderKey(strings.TrimSpace(kv[0]))
+	if len(kv) != 2 || name == "" || strings.ContainsAny(name, " \t") {
+		return ini.BadValue("http-header must have the form \"Name: value\"")
+	}
+	if snp.HTTPHeader == nil {
+		snp.HTTPHeader = http.Header{}
+	}
+	if _, ok := snp.HTTPHeader[name]; !ok {
+		snp.HTTPHeader[name] = []string{strings.TrimSpace(kv[1])}
+	}
+	return nil
+}
+
 func (snp *stellarNetParser) doAccounts(ii ini.IniItem) error {
 	var acct MuxedAccount
 	if _, err := fmt.Sscan(ii.Key, &acct); err != nil {
@@ -204,6 +274,28 @@ func (snp *stellarNetParser) doSigners(ii ini.IniItem) error {
 	return nil
 }
 
+func (snp *stellarNetParser) doSignerInfo(ii ini.IniItem) error {
+	var signer SignerKey
+	if _, err := fmt.Sscan(ii.Key, &signer); err != nil {
+		return ini.BadKey(err.Error())
+	}
+	if ii.Value == nil {
+		delete(snp.SignerInfo, ii.Key)
+		return nil
+	}
+	meta, err := ParseSignerMeta(*ii.Value)
+	if err != nil {
+		return ini.BadValue(err.Error())
+	}
+	for _, m := range snp.SignerInfo[ii.Key] {
+		if m.Account == meta.Account {
+			return nil
+		}
+	}
+	snp.SignerInfo[ii.Key] = append(snp.SignerInfo[ii.Key], meta)
+	return nil
+}
+
 func (snp *stellarNetParser) Section(iss ini.IniSecStart) error {
 	snp.itemCB = nil
 	if iss.Subsection == nil ||
@@ -215,6 +307,8 @@ func (snp *stellarNetParser) Section(iss ini.IniSecStart) error {
 			snp.itemCB = snp.doAccounts
 		case "signers":
 			snp.itemCB = snp.doSigners
+		case "signer-info":
+			snp.itemCB = snp.doSignerInfo
 		}
 	}
 	return nil
@@ -247,6 +341,9 @@ func (net *StellarNet) IniSink() ini.IniSink {
 	if net.Accounts == nil {
 		net.Accounts = make(AccountHints)
 	}
+	if net.SignerInfo == nil {
+		net.SignerInfo = make(SignerInfo)
+	}
 	return &stellarNetParser{
 		StellarNet: net,
 		setName: true,
@@ -269,10 +366,43 @@ func LoadStellarNet(name string, paths...string) (*StellarNet, error) {
 	} else if err = ret.Validate(); err != nil {
 		return nil, err
 	}
+	ret.migrateSignerInfo()
 	ret.Save()
 	return &ret, nil
 }
 
+// Returns a network that exists only in memory, for programs such as
+// serverless functions that have no $STCDIR and may not be able to
+// write files.  configs hold configuration in the INI format of a
+// network's .net file, such as [accounts] and [signers] sections, and
+// take precedence over the built-in configuration of network name in
+// DefaultGlobalConfigContents (which knows "main" and "test").  No
+// files are read or written:  the network has no SavePath, so Save
+// fails if there are changes to save, and Keys is an empty
+// MemKeyStore.  To inject signers or keys from elsewhere, set Signers
+// or Keys.
+func NewMemStellarNet(name string,
+	configs ...[]byte) (*StellarNet, error) {
+	ret := StellarNet{Name: name}
+	sink := ret.IniSink()
+	for _, config := range configs {
+		if err := ini.IniParseContents(sink, "", config); err != nil {
+			return nil, err
+		}
+	}
+	if err := ini.IniParseContents(sink, "",
+		DefaultGlobalConfigContents); err != nil {
+		return nil, err
+	}
+	if err := ret.Validate(); err != nil {
+		return nil, err
+	}
+	ret.migrateSignerInfo()
+	ret.Edits = nil
+	ret.Keys = MemKeyStore{}
+	return &ret, nil
+}
+
 var netCache map[string]*StellarNet
 
 // Load a network from under the ConfigPath() ($STCDIR) directory.  If
@@ -299,7 +429,7 @@ func DefaultStellarNet(name string) *StellarNet {
 	ret, err := LoadStellarNet(name, ConfigPath(name + ".net"),
 		ConfigPath("global.conf"))
 	if ret == nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, stcdetail.Redact(err.Error()))
 	} else {
 		netCache[name] = ret
 	}
@@ -309,19 +439,30 @@ func DefaultStellarNet(name string) *StellarNet {
 // Save any changes to SavePath.  If SavePath does not exist, then
 // create it with permissions Perm (subject to umask, of course).
 func (net *StellarNet) SavePerm(perm os.FileMode) error {
+	var txn stcdetail.FileTxn
+	defer txn.Abort()
+	if err := net.SaveIn(&txn, perm); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// Like SavePerm, but only stage the changes in txn, so that they are
+// saved atomically with other files when txn commits.
+func (net *StellarNet) SaveIn(txn *stcdetail.FileTxn,
+	perm os.FileMode) error {
+	net.mu.Lock()
+	defer net.mu.Unlock()
 	if len(net.Edits) == 0 {
 		return nil
 	}
 	if net.SavePath == "" {
 		return os.ErrInvalid
 	}
-	var lf stcdetail.LockedFile
-	var err error
-	lf, err = stcdetail.LockFile(net.SavePath, perm)
+	lf, err := txn.LockFile(net.SavePath, perm)
 	if err != nil {
 		return err
 	}
-	defer lf.Abort()
 
 	contents, err := lf.ReadFile()
 	if err != nil && !os.IsNotExist(err) {
@@ -330,8 +471,8 @@ func (net *StellarNet) SavePerm(perm os.FileMode) error {
 
 	ie, _ := ini.NewIniEdit(net.SavePath, contents)
 	net.Edits.Apply(ie)
-	ie.WriteTo(lf)
-	return lf.Commit()
+	_, err = ie.WriteTo(lf)
+	return err
 }
 
 // Save any changes to to SavePath.  Equivalent to SavePerm(0666).
@@ -3,6 +3,7 @@ package stc
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -44,6 +45,15 @@ func IsTemporary(err error) bool {
 	return dial_not_dns
 }
 
+// Returns true if err is horizon reporting that the requested
+// resource (such as an account) does not exist.
+func IsNotFound(err error) bool {
+	var he *stcdetail.HTTPerror
+	var nf horizonNotFound
+	return errors.As(err, &nf) ||
+		errors.As(err, &he) && he.Resp.StatusCode == http.StatusNotFound
+}
+
 // A communication error with horizon
 type horizonFailure string
 
@@ -53,20 +63,36 @@ func (e horizonFailure) Error() string {
 
 const badHorizonURL horizonFailure = "Missing or invalid horizon URL"
 
-func getURL(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// A 404 response to a horizon query, which IsNotFound recognizes
+type horizonNotFound struct{ horizonFailure }
+
+func (net *StellarNet) getURL(url string) ([]byte, error) {
+	body, _, err := net.getURLHeader(url)
+	return body, err
+}
+
+// Like getURL, but also returns the response headers.
+func (net *StellarNet) getURLHeader(url string) (
+	[]byte, http.Header, error) {
+	req, err := stcdetail.NewRequest("GET", url, nil, net.HTTPHeader)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	if resp.StatusCode != 200 {
-		return nil, horizonFailure(body)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, horizonNotFound{horizonFailure(body)}
+	} else if resp.StatusCode != 200 {
+		return nil, nil, horizonFailure(body)
 	}
-	return body, nil
+	return body, resp.Header, nil
 }
 
 // Send an HTTP request to horizon
@@ -74,7 +100,7 @@ func (net *StellarNet) Get(query string) ([]byte, error) {
 	if net.Horizon == "" {
 		return nil, badHorizonURL
 	}
-	return getURL(net.Horizon + query)
+	return net.getURL(net.Horizon + query)
 }
 
 // Send an HTTP request to horizon and perse the result as JSON
@@ -131,25 +157,26 @@ func (net *StellarNet) StreamJSON(
 	query = net.Horizon + query
 
 	netval := reflect.ValueOf(net)
-	return stcdetail.Stream(ctx, query, func(evtype string, data []byte) error {
-		switch evtype {
-		case "error":
-			return ErrEventStream(data)
-		case "message":
-			v := reflect.New(tp)
-			setField(v, "Net", netval)
-			if err := json.Unmarshal(data, v.Interface()); err != nil {
-				return err
-			}
-			errs := cbv.Call([]reflect.Value{v})
-			if len(errs) != 0 {
-				if err, ok := errs[0].Interface().(error); ok && err != nil {
+	return stcdetail.StreamHeader(ctx, query, net.HTTPHeader,
+		func(evtype string, data []byte) error {
+			switch evtype {
+			case "error":
+				return ErrEventStream(data)
+			case "message":
+				v := reflect.New(tp)
+				setField(v, "Net", netval)
+				if err := json.Unmarshal(data, v.Interface()); err != nil {
 					return err
 				}
+				errs := cbv.Call([]reflect.Value{v})
+				if len(errs) != 0 {
+					if err, ok := errs[0].Interface().(error); ok && err != nil {
+						return err
+					}
+				}
 			}
-		}
-		return nil
-	})
+			return nil
+		})
 }
 
 type jsonInterface struct {
@@ -159,14 +186,34 @@ func (ji *jsonInterface) UnmarshalJSON(data []byte) error {
 	return json.Unmarshal(data, ji.i)
 }
 
-// Send a request to horizon and iterate through a series of embedded
-// records in the response, continuing to fetch more records until
-// zero records are returned.  cb is a callback function which must
-// have type func(obj *T)error or func(obj *T), where *T is a type
-// into which JSON can be unmarshalled.  Returns if there is an error
-// or the ctx argument is Done.
-func (net *StellarNet) IterateJSON(
-	ctx context.Context, query string, cb interface{}) error {
+// Most records horizon returns per page, which Iterate requests
+// unless params say otherwise
+const horizonMaxLimit = "200"
+
+// Returns how long to wait before retrying a request that horizon
+// has rate-limited:  as long as its Retry-After header says, if
+// present, and backoff otherwise.
+func retryAfter(resp *http.Response, backoff time.Duration) time.Duration {
+	if n, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(n) * time.Second
+	}
+	return backoff
+}
+
+// Fetches a series of records from horizon, one page at a time, and
+// calls cb on each record.  cb must have type func(obj *T)error or
+// func(obj *T), where *T is a type into which JSON can be
+// unmarshalled.  path is the resource (e.g., "accounts/G.../offers"),
+// and params are the query parameters of the first page, such as
+// cursor (to start after a paging token), order ("asc" or "desc"),
+// and limit (records per page, 200 if not set).  Iterate follows
+// horizon's links to subsequent pages until a page has no records.
+// When horizon rate-limits requests, Iterate waits as long as the
+// Retry-After header says, or with exponential backoff, and tries
+// again.  Returns if there is an error, including one returned by
+// cb, or ctx (which may be nil) is Done.
+func (net *StellarNet) Iterate(ctx context.Context, path string,
+	params url.Values, cb interface{}) error {
 	if net.Horizon == "" {
 		return badHorizonURL
 	}
@@ -203,10 +250,14 @@ func (net *StellarNet) IterateJSON(
 
 	netval := reflect.ValueOf(net)
 
+	q := url.Values{"limit": {horizonMaxLimit}}
+	for k, v := range params {
+		q[k] = v
+	}
+	href := net.Horizon + path + "?" + q.Encode()
 	backoff := time.Second
-	for url := net.Horizon + query; ctx == nil || ctx.Err() == nil; url =
-		j.Links.Next.Href {
-		req, err := http.NewRequest("GET", url, nil)
+	for ctx == nil || ctx.Err() == nil {
+		req, err := stcdetail.NewRequest("GET", href, nil, net.HTTPHeader)
 		if err != nil {
 			return err
 		} else if ctx != nil {
@@ -217,30 +268,29 @@ func (net *StellarNet) IterateJSON(
 		if err != nil || ctx != nil && ctx.Err() != nil {
 			return err
 		} else if resp.StatusCode != 200 {
-			if resp.StatusCode != 429 {
+			if resp.StatusCode != http.StatusTooManyRequests {
 				return stcdetail.NewHTTPerror(resp)
 			}
+			delay := retryAfter(resp, backoff)
 			if ctx != nil {
 				select {
 				case <-ctx.Done():
-				case <-time.After(backoff):
+				case <-time.After(delay):
 				}
 			} else {
-				time.Sleep(backoff)
+				time.Sleep(delay)
 			}
 			backoff *= 2
 			continue
 		}
 		backoff = time.Second
+		j.Links.Next.Href = ""
 		dec := json.NewDecoder(resp.Body)
 		if err = dec.Decode(&j); err != nil {
 			return err
 		}
 		v := reflect.ValueOf(j.Embedded.Records.i).Elem()
 		n := v.Len()
-		if n == 0 {
-			break
-		}
 		for i := 0; i < n; i++ {
 			setField(v.Index(i), "Net", netval)
 			errs := cbv.Call([]reflect.Value{v.Index(i).Addr()})
@@ -250,10 +300,29 @@ func (net *StellarNet) IterateJSON(
 				}
 			}
 		}
+		if n == 0 || j.Links.Next.Href == "" {
+			break
+		}
+		href = j.Links.Next.Href
 	}
 	return nil
 }
 
+// Like Iterate, but with any query parameters in query after a '?'
+// (e.g., "accounts/G.../transactions?order=desc").
+func (net *StellarNet) IterateJSON(
+	ctx context.Context, query string, cb interface{}) error {
+	path, rawq := query, ""
+	if i := strings.IndexByte(query, '?'); i >= 0 {
+		path, rawq = query[:i], query[i+1:]
+	}
+	params, err := url.ParseQuery(rawq)
+	if err != nil {
+		return err
+	}
+	return net.Iterate(ctx, path, params, cb)
+}
+
 type HorizonThresholds struct {
 	Low_threshold  uint8
 	Med_threshold  uint8
@@ -264,9 +333,46 @@ type HorizonFlags struct {
 	Auth_revocable bool
 	Auth_immutable bool
 }
+
+// A signer of an account, as horizon lists it.  Horizon includes the
+// master key among the signers, with the master weight.
 type HorizonSigner struct {
 	Key    SignerKey
 	Weight uint32
+	// The kind of signer, always the same as Key.Type
+	Type stx.SignerKeyType `json:"-"`
+	// The account paying the reserve for the signer, or nil if the
+	// account itself pays it (as it always does for the master key)
+	Sponsor *AccountID
+}
+
+// Horizon's names for signer key types
+var horizonSignerTypes = map[string]stx.SignerKeyType{
+	"ed25519_public_key": stx.SIGNER_KEY_TYPE_ED25519,
+	"preauth_tx":         stx.SIGNER_KEY_TYPE_PRE_AUTH_TX,
+	"sha256_hash":        stx.SIGNER_KEY_TYPE_HASH_X,
+}
+
+func (hs *HorizonSigner) UnmarshalJSON(data []byte) error {
+	type jhs HorizonSigner
+	var jtype struct {
+		Type string
+	}
+	if err := json.Unmarshal(data, (*jhs)(hs)); err != nil {
+		return err
+	} else if err = json.Unmarshal(data, &jtype); err != nil {
+		return err
+	}
+	hs.Type = hs.Key.Type
+	if jtype.Type == "" {
+		return nil
+	} else if t, ok := horizonSignerTypes[jtype.Type]; !ok {
+		return horizonFailure("unknown signer type " + jtype.Type)
+	} else if t != hs.Key.Type {
+		return horizonFailure(fmt.Sprintf("signer %s has type %s",
+			hs.Key, jtype.Type))
+	}
+	return nil
 }
 
 type HorizonBalance struct {
@@ -318,6 +424,9 @@ func (hb *HorizonBalance) UnmarshalJSON(data []byte) error {
 // horizon for an account endpoint
 type HorizonAccountEntry struct {
 	Net                   *StellarNet `json:"-"`
+	// The latest ledger horizon had ingested when it returned the
+	// entry (from its Latest-Ledger header), or 0 if unknown
+	LatestLedger          uint32 `json:"-"`
 	Sequence              stcdetail.JsonInt64
 	Balance               stcdetail.JsonInt64e7
 	Subentry_count        uint32
@@ -328,13 +437,38 @@ type HorizonAccountEntry struct {
 	Thresholds            HorizonThresholds
 	Balances              []HorizonBalance
 	Signers               []HorizonSigner
-	Data                  map[string]string
+	Data                  map[string]HorizonDataValue
+}
+
+// The value of an account data entry, base64-encoded as Horizon
+// returns it.  Use Bytes() to get the decoded value.
+type HorizonDataValue string
+
+// Returns the decoded value, or nil if it is not valid base64.
+func (v HorizonDataValue) Bytes() []byte {
+	bs, err := base64.StdEncoding.DecodeString(string(v))
+	if err != nil {
+		return nil
+	}
+	return bs
+}
+
+// Renders the value the way txrep renders a DataValue:  as a quoted
+// string if it is text, and otherwise in hex.
+func (v HorizonDataValue) String() string {
+	bs := v.Bytes()
+	if stcdetail.IsText(bs) {
+		return fmt.Sprintf("%q", bs)
+	}
+	return stcdetail.PrintVecOpaque(bs)
 }
 
 func (net *StellarNet) prettyPrintAux(i interface{}) (string, bool) {
-	if _, ok := i.(StellarNet); ok {
+	switch i.(type) {
+	case StellarNet:
 		return "", true
-	} else if net == nil {
+	}
+	if net == nil {
 		return "", false
 	}
 	switch v := i.(type) {
@@ -344,6 +478,8 @@ func (net *StellarNet) prettyPrintAux(i interface{}) (string, bool) {
 		}
 	case stx.SignerKey:
 		b := stcdetail.XdrToBin(&v)
+		net.mu.Lock()
+		defer net.mu.Unlock()
 		if skis, ok := net.Signers[v.Hint()]; ok {
 			for j := range skis {
 				if stcdetail.XdrToBin(&skis[j].Key) == b {
@@ -360,14 +496,17 @@ func (hs *HorizonAccountEntry) String() string {
 }
 
 // Return the next sequence number (1 + Sequence) as an int64 (or 0 if
-// an invalid sequence number was returned by horizon).
+// an invalid sequence number was returned by horizon, or if Sequence
+// is stcdetail.MaxSeqNum, so that the account has no next sequence
+// number).
 func (ae *HorizonAccountEntry) NextSeq() stx.SequenceNumber {
 	val := stx.SequenceNumber(ae.Sequence)
 	if val <= 0 {
 		return 0
-	} else {
-		return val + 1
+	} else if next, err := stcdetail.NextSeq(val); err == nil {
+		return next
 	}
+	return 0
 }
 
 func (ae *HorizonAccountEntry) UnmarshalJSON(data []byte) error {
@@ -385,17 +524,327 @@ func (ae *HorizonAccountEntry) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// Fetch the decoded value of data entry key on account acct.
+func (net *StellarNet) GetAccountData(acct, key string) ([]byte, error) {
+	var ret struct{ Value []byte }
+	if err := net.GetJSON("accounts/"+acct+"/data/"+url.PathEscape(key),
+		&ret); err != nil {
+		return nil, err
+	}
+	return ret.Value, nil
+}
+
 // Fetch the sequence number and signers of an account over the
-// network.
+// network.  The entry's LatestLedger says how recent it is.
 func (net *StellarNet) GetAccountEntry(acct string) (
 	*HorizonAccountEntry, error) {
 	ret := HorizonAccountEntry{ Net: net }
-	if err := net.GetJSON("accounts/"+acct, &ret); err != nil {
+	if net.Horizon == "" {
+		return nil, badHorizonURL
+	}
+	body, hdr, err := net.getURLHeader(net.Horizon + "accounts/" + acct)
+	if err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(body, &ret); err != nil {
 		return nil, err
 	}
+	if n, err := strconv.ParseUint(hdr.Get("Latest-Ledger"),
+		10, 32); err == nil {
+		ret.LatestLedger = uint32(n)
+	}
 	return &ret, nil
 }
 
+// Reconstructs the ledger's AccountEntry from the JSON horizon returns
+// for an account endpoint.
+func accountEntryFromJSON(data []byte) (*stx.AccountEntry, error) {
+	var hae HorizonAccountEntry
+	var j struct {
+		Account_id     AccountID
+		Num_sponsored  uint32
+		Num_sponsoring uint32
+		Flags          struct {
+			Auth_clawback_enabled bool
+		}
+		Balances []HorizonBalance
+	}
+	if err := json.Unmarshal(data, &hae); err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+
+	ret := &stx.AccountEntry{
+		AccountID:     j.Account_id,
+		Balance:       int64(hae.Balance),
+		SeqNum:        stx.SequenceNumber(hae.Sequence),
+		NumSubEntries: hae.Subentry_count,
+		InflationDest: hae.Inflation_destination,
+		HomeDomain:    hae.Home_domain,
+	}
+	for _, f := range []struct {
+		set  bool
+		flag stx.AccountFlags
+	}{
+		{hae.Flags.Auth_required, stx.AUTH_REQUIRED_FLAG},
+		{hae.Flags.Auth_revocable, stx.AUTH_REVOCABLE_FLAG},
+		{hae.Flags.Auth_immutable, stx.AUTH_IMMUTABLE_FLAG},
+		{j.Flags.Auth_clawback_enabled, stx.AUTH_CLAWBACK_ENABLED_FLAG},
+	} {
+		if f.set {
+			ret.Flags |= uint32(f.flag)
+		}
+	}
+	ret.Thresholds[stx.THRESHOLD_LOW] = hae.Thresholds.Low_threshold
+	ret.Thresholds[stx.THRESHOLD_MED] = hae.Thresholds.Med_threshold
+	ret.Thresholds[stx.THRESHOLD_HIGH] = hae.Thresholds.High_threshold
+
+	// Horizon lists the master key as a signer, but the ledger
+	// stores its weight in the thresholds.  The ledger also keeps
+	// signers sorted by key, with sponsors in a parallel array.
+	master := j.Account_id.ToSignerKey()
+	masterBin := stcdetail.XdrToBin(&master)
+	sort.SliceStable(hae.Signers, func(a, b int) bool {
+		return stcdetail.XdrToBin(&hae.Signers[a].Key) <
+			stcdetail.XdrToBin(&hae.Signers[b].Key)
+	})
+	var sponsors []stx.SponsorshipDescriptor
+	sponsored := false
+	for i := range hae.Signers {
+		js := &hae.Signers[i]
+		if stcdetail.XdrToBin(&js.Key) == masterBin {
+			ret.Thresholds[stx.THRESHOLD_MASTER_WEIGHT] = uint8(js.Weight)
+			continue
+		}
+		ret.Signers = append(ret.Signers, stx.Signer{
+			Key:    js.Key,
+			Weight: js.Weight,
+		})
+		sponsors = append(sponsors, js.Sponsor)
+		if js.Sponsor != nil {
+			sponsored = true
+		}
+	}
+
+	var liabilities stx.Liabilities
+	for i := range j.Balances {
+		if j.Balances[i].Asset.Type == stx.ASSET_TYPE_NATIVE {
+			liabilities.Buying = int64(j.Balances[i].Buying_liabilities)
+			liabilities.Selling = int64(j.Balances[i].Selling_liabilities)
+		}
+	}
+	if sponsored || j.Num_sponsored != 0 || j.Num_sponsoring != 0 {
+		ret.Ext.V = 1
+		ret.Ext.V1().Liabilities = liabilities
+		ret.Ext.V1().Ext.V = 2
+		v2 := ret.Ext.V1().Ext.V2()
+		v2.NumSponsored = j.Num_sponsored
+		v2.NumSponsoring = j.Num_sponsoring
+		v2.SignerSponsoringIDs = sponsors
+	} else if liabilities.Buying != 0 || liabilities.Selling != 0 {
+		ret.Ext.V = 1
+		ret.Ext.V1().Liabilities = liabilities
+	}
+	return ret, nil
+}
+
+// Like accountEntryFromJSON, but fills in a whole LedgerEntry.
+func accountLedgerEntryFromJSON(body []byte, e *stx.LedgerEntry) error {
+	var j struct{ Last_modified_ledger uint32 }
+	if err := json.Unmarshal(body, &j); err != nil {
+		return err
+	}
+	ae, err := accountEntryFromJSON(body)
+	if err != nil {
+		return err
+	}
+	e.LastModifiedLedgerSeq = j.Last_modified_ledger
+	e.Data.Type = stx.ACCOUNT
+	*e.Data.Account() = *ae
+	return nil
+}
+
+// Fetch an account over the network and reconstruct its ledger
+// AccountEntry, so that it can be rendered as txrep or compared with
+// other XDR.  Unlike GetAccountEntry, this does not return
+// trustlines or data entries, which are separate ledger entries.
+func (net *StellarNet) GetAccountEntryXdr(acct string) (
+	*stx.AccountEntry, error) {
+	body, err := net.Get("accounts/" + acct)
+	if err != nil {
+		return nil, err
+	}
+	return accountEntryFromJSON(body)
+}
+
+// Reconstructs the TrustLineEntry for each non-native balance in the
+// JSON horizon returns for account acct.
+func trustLinesFromJSON(acct AccountID, body []byte) (
+	[]stx.LedgerEntry, error) {
+	// HorizonBalance has its own UnmarshalJSON method, so parse the
+	// remaining fields separately
+	var hb struct {
+		Balances []HorizonBalance
+	}
+	var j struct {
+		Balances []struct {
+			Last_modified_ledger                  uint32
+			Is_authorized                         bool
+			Is_authorized_to_maintain_liabilities bool
+			Is_clawback_enabled                   bool
+		}
+	}
+	if err := json.Unmarshal(body, &hb); err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(body, &j); err != nil {
+		return nil, err
+	} else if len(j.Balances) != len(hb.Balances) {
+		return nil, horizonFailure("malformed balances")
+	}
+	var ret []stx.LedgerEntry
+	for i := range hb.Balances {
+		b, f := &hb.Balances[i], &j.Balances[i]
+		if b.Asset.Type == stx.ASSET_TYPE_NATIVE {
+			continue
+		}
+		ret = append(ret, stx.LedgerEntry{})
+		e := &ret[len(ret)-1]
+		e.LastModifiedLedgerSeq = f.Last_modified_ledger
+		e.Data.Type = stx.TRUSTLINE
+		tl := e.Data.TrustLine()
+		tl.AccountID = acct
+		tl.Asset = b.Asset
+		tl.Balance = int64(b.Balance)
+		tl.Limit = int64(b.Limit)
+		for _, fl := range []struct {
+			set  bool
+			flag stx.TrustLineFlags
+		}{
+			{f.Is_authorized, stx.AUTHORIZED_FLAG},
+			{f.Is_authorized_to_maintain_liabilities,
+				stx.AUTHORIZED_TO_MAINTAIN_LIABILITIES_FLAG},
+			{f.Is_clawback_enabled, stx.TRUSTLINE_CLAWBACK_ENABLED_FLAG},
+		} {
+			if fl.set {
+				tl.Flags |= uint32(fl.flag)
+			}
+		}
+		if b.Buying_liabilities != 0 || b.Selling_liabilities != 0 {
+			tl.Ext.V = 1
+			tl.Ext.V1().Liabilities = stx.Liabilities{
+				Buying:  int64(b.Buying_liabilities),
+				Selling: int64(b.Selling_liabilities),
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (net *StellarNet) getTrustLineEntry(k *stx.XdrAnon_LedgerKey_TrustLine,
+	e *stx.LedgerEntry) error {
+	body, err := net.Get("accounts/" + k.AccountID.String())
+	if err != nil {
+		return err
+	}
+	tls, err := trustLinesFromJSON(k.AccountID, body)
+	if err != nil {
+		return err
+	}
+	want := stcdetail.XdrToBin(&k.Asset)
+	for i := range tls {
+		if stcdetail.XdrToBin(&tls[i].Data.TrustLine().Asset) == want {
+			*e = tls[i]
+			return nil
+		}
+	}
+	return horizonFailure("no trustline for " + k.Asset.String())
+}
+
+// An offer as horizon returns it from the offers endpoints
+type horizonOffer struct {
+	Id                   stcdetail.JsonInt64
+	Seller               AccountID
+	Selling              HorizonBalance
+	Buying               HorizonBalance
+	Amount               stcdetail.JsonInt64e7
+	Price_r              struct{ N, D int32 }
+	Last_modified_ledger uint32
+}
+
+func (j *horizonOffer) ledgerEntry(e *stx.LedgerEntry) {
+	e.LastModifiedLedgerSeq = j.Last_modified_ledger
+	e.Data.Type = stx.OFFER
+	*e.Data.Offer() = stx.OfferEntry{
+		SellerID: j.Seller,
+		OfferID:  stx.Int64(j.Id),
+		Selling:  j.Selling.Asset,
+		Buying:   j.Buying.Asset,
+		Amount:   int64(j.Amount),
+		Price:    stx.Price{N: j.Price_r.N, D: j.Price_r.D},
+	}
+}
+
+func (net *StellarNet) getOfferEntry(k *stx.XdrAnon_LedgerKey_Offer,
+	e *stx.LedgerEntry) error {
+	var j horizonOffer
+	if err := net.GetJSON(fmt.Sprintf("offers/%d", k.OfferID),
+		&j); err != nil {
+		return err
+	}
+	j.ledgerEntry(e)
+	e.Data.Offer().OfferID = k.OfferID
+	return nil
+}
+
+func (net *StellarNet) getDataEntry(k *stx.XdrAnon_LedgerKey_Data,
+	e *stx.LedgerEntry) error {
+	var j struct {
+		Value string
+	}
+	if err := net.GetJSON("accounts/"+k.AccountID.String()+"/data/"+
+		url.PathEscape(k.DataName), &j); err != nil {
+		return err
+	}
+	e.Data.Type = stx.DATA
+	d := e.Data.Data()
+	d.AccountID = k.AccountID
+	d.DataName = k.DataName
+	return stcdetail.XdrFromBase64(
+		stx.XDR_DataValue(&d.DataValue), j.Value)
+}
+
+// Fetch the ledger entry with a particular key over the network.
+// Horizon only serves accounts, trustlines, offers, and data entries,
+// so other types of key produce an error.  Horizon does not report
+// when a data entry was last modified, nor whether an offer is
+// passive, so these fields are left zero.
+func (net *StellarNet) GetLedgerEntry(key *stx.LedgerKey) (
+	*stx.LedgerEntry, error) {
+	ret := &stx.LedgerEntry{}
+	var err error
+	switch key.Type {
+	case stx.ACCOUNT:
+		var body []byte
+		if body, err = net.Get("accounts/" +
+			key.Account().AccountID.String()); err == nil {
+			err = accountLedgerEntryFromJSON(body, ret)
+		}
+	case stx.TRUSTLINE:
+		err = net.getTrustLineEntry(key.TrustLine(), ret)
+	case stx.OFFER:
+		err = net.getOfferEntry(key.Offer(), ret)
+	case stx.DATA:
+		err = net.getDataEntry(key.Data(), ret)
+	default:
+		err = horizonFailure("cannot fetch " + key.Type.String() +
+			" ledger entries from horizon")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
 // Returns the network ID, a string that is hashed into transaction
 // IDs to ensure that signature are not valid across networks (e.g., a
 // testnet signature cannot work on the public network).  If the
@@ -406,17 +855,80 @@ func (net *StellarNet) GetAccountEntry(acct string) (
 // StellarTestNet requires fetching the network ID since the Stellar
 // test network is periodically reset.
 func (net *StellarNet) GetNetworkId() string {
+	net.mu.Lock()
+	id := net.NetworkId
+	net.mu.Unlock()
+	if id != "" {
+		return id
+	}
+	var np struct{ Network_passphrase string }
+	if err := net.GetJSON("/", &np); err != nil ||
+		np.Network_passphrase == "" {
+		return ""
+	}
+	net.mu.Lock()
+	defer net.mu.Unlock()
 	if net.NetworkId == "" {
-		var np struct{ Network_passphrase string }
-		if err := net.GetJSON("/", &np); err == nil &&
-			np.Network_passphrase != "" {
-			net.NetworkId = np.Network_passphrase
-			net.Edits.Set("net", "network-id", net.NetworkId)
-		}
+		net.NetworkId = np.Network_passphrase
+		net.Edits.Set("net", "network-id", net.NetworkId)
 	}
 	return net.NetworkId
 }
 
+// Status information from the root of a Horizon server.
+type HorizonRoot struct {
+	Horizon_version       string
+	Core_version          string
+	History_latest_ledger uint32
+	History_elder_ledger  uint32
+	Core_latest_ledger    uint32
+	Network_passphrase    string
+}
+
+func (net *StellarNet) GetHorizonRoot() (*HorizonRoot, error) {
+	var ret HorizonRoot
+	if err := net.GetJSON("/", &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// How far the latest ledger must fall behind LastLedger before
+// CheckReset concludes the network has been reset, to tolerate
+// load-balanced Horizon servers that lag behind one another.
+const resetSlack = 1000
+
+var ErrWrongNetwork = errors.New(
+	"Horizon server reports a different network-id")
+
+// Checks whether the network appears to have been reset (as the test
+// network is periodically) since the last ledger recorded in
+// LastLedger.  A reset keeps the same network-id but starts over from
+// the genesis ledger, so accounts, sequence numbers, and signers
+// learned before the reset no longer exist.  If there was no reset,
+// records the latest ledger in LastLedger to be saved with the
+// network's configuration.
+func (net *StellarNet) CheckReset() (bool, error) {
+	root, err := net.GetHorizonRoot()
+	if err != nil {
+		return false, err
+	}
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	if root.Network_passphrase != "" && net.NetworkId != "" &&
+		root.Network_passphrase != net.NetworkId {
+		return false, ErrWrongNetwork
+	}
+	latest := root.History_latest_ledger
+	if latest+resetSlack < net.LastLedger {
+		return true, nil
+	} else if latest > net.LastLedger {
+		net.LastLedger = latest
+		net.Edits.Set("net", "last-ledger", fmt.Sprint(latest))
+	}
+	return false, nil
+}
+
 func showLedgerKey(k stx.LedgerKey) string {
 	switch k.Type {
 	case stx.ACCOUNT:
@@ -548,6 +1060,114 @@ func (net *StellarNet) GetTxResult(txid string) (*HorizonTxResult, error) {
 	return &ret, nil
 }
 
+// Longest wait between attempts to reconnect in WatchTransactions.
+const maxWatchBackoff = time.Minute
+
+// Streams transactions on account acct (or on the whole network if
+// acct is empty), calling cb on each.  Starts after the transaction
+// whose paging token is cursor, or with new transactions if cursor is
+// empty.  Unlike StreamJSON, WatchTransactions reconnects after
+// temporary errors (see IsTemporary), resuming after the last
+// transaction received so that none are missed or repeated.  Returns
+// when ctx is Done, when cb returns an error, or on any other error.
+func (net *StellarNet) WatchTransactions(ctx context.Context,
+	acct, cursor string, cb func(*HorizonTxResult) error) error {
+	query := "transactions"
+	if acct != "" {
+		query = "accounts/" + acct + "/transactions"
+	}
+	if cursor == "" {
+		cursor = "now"
+	}
+	backoff := time.Second
+	for {
+		var cberr error
+		err := net.StreamJSON(ctx, query+"?cursor="+url.QueryEscape(cursor),
+			func(r *HorizonTxResult) error {
+				backoff = time.Second
+				cursor = r.PagingToken
+				cberr = cb(r)
+				return cberr
+			})
+		if cberr != nil {
+			return cberr
+		} else if err == nil || ctx != nil && ctx.Err() != nil ||
+			!IsTemporary(err) {
+			return err
+		}
+		if ctx != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+		} else {
+			time.Sleep(backoff)
+		}
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
+
+// Returns the source account and operations of a transaction, or of
+// the inner transaction of a fee bump.
+func txSourceOps(e *stx.TransactionEnvelope) (string, []stx.Operation) {
+	switch e.Type {
+	case stx.ENVELOPE_TYPE_TX_V0:
+		src := stx.MuxedAccount{Type: stx.KEY_TYPE_ED25519}
+		*src.Ed25519() = e.V0().Tx.SourceAccountEd25519
+		return src.ToSignerKey().String(), e.V0().Tx.Operations
+	case stx.ENVELOPE_TYPE_TX:
+		tx := &e.V1().Tx
+		return tx.SourceAccount.ToSignerKey().String(), tx.Operations
+	case stx.ENVELOPE_TYPE_TX_FEE_BUMP:
+		tx := &e.FeeBump().Tx.InnerTx.V1().Tx
+		return tx.SourceAccount.ToSignerKey().String(), tx.Operations
+	}
+	return "", nil
+}
+
+func opsKey(ops []stx.Operation) string {
+	out := strings.Builder{}
+	for i := range ops {
+		out.WriteString(stcdetail.XdrToBin(&ops[i]))
+	}
+	return out.String()
+}
+
+var errStopIteration = errors.New("stop iteration")
+
+// Returns transactions by the same source account as e, applied
+// within window of the present, that have exactly the same operations
+// as e.  A non-empty result suggests that e is an accidental
+// re-submission of a transaction that has already executed.
+func (net *StellarNet) RecentDuplicates(e *TransactionEnvelope,
+	window time.Duration) ([]*HorizonTxResult, error) {
+	src, ops := txSourceOps(e.TransactionEnvelope)
+	if src == "" || len(ops) == 0 {
+		return nil, nil
+	}
+	key := opsKey(ops)
+	cutoff := time.Now().Add(-window)
+	var ret []*HorizonTxResult
+	err := net.Iterate(nil, "accounts/"+src+"/transactions",
+		url.Values{"order": {"desc"}}, func(r *HorizonTxResult) error {
+			if r.Time.Before(cutoff) {
+				return errStopIteration
+			}
+			rsrc, rops := txSourceOps(&r.Env)
+			if rsrc == src && opsKey(rops) == key {
+				ret = append(ret, r)
+			}
+			return nil
+		})
+	if err == errStopIteration {
+		err = nil
+	}
+	return ret, err
+}
+
 // A Fee Value is currently 32 bits, but could become 64 bits if
 // CAP-0015 is adopted.
 type FeeVal = uint32
@@ -776,6 +1396,8 @@ func (net *StellarNet) GetFeeStats() (*FeeStats, error) {
 	if err := net.GetJSON("fee_stats", &ret); err != nil {
 		return nil, err
 	}
+	net.mu.Lock()
+	defer net.mu.Unlock()
 	net.FeeCache = &ret
 	net.FeeCacheTime = now
 	return &ret, nil
@@ -784,8 +1406,11 @@ func (net *StellarNet) GetFeeStats() (*FeeStats, error) {
 // Like GetFeeStats but a version cached for 1 minute
 func (net *StellarNet) GetFeeCache() (*FeeStats, error) {
 	now := time.Now()
-	if net.FeeCache != nil && now.Sub(net.FeeCacheTime) < 60*time.Second {
-		return net.FeeCache, nil
+	net.mu.Lock()
+	fs, when := net.FeeCache, net.FeeCacheTime
+	net.mu.Unlock()
+	if fs != nil && now.Sub(when) < 60*time.Second {
+		return fs, nil
 	}
 	return net.GetFeeStats()
 }
@@ -838,7 +1463,8 @@ type TxFailure struct {
 }
 
 type codeExtractor struct {
-	msg string
+	msg  string
+	name string
 }
 func (x *codeExtractor) Sprintf(string, ...interface{}) string {
 	return ""
@@ -850,6 +1476,7 @@ func (x *codeExtractor) Marshal(name string, val xdr.XdrType) {
 	switch t := val.(type) {
 	case xdr.XdrEnum:
 		x.msg = enumDesc(t)
+		x.name = t.String()
 	case xdr.XdrAggregate:
 		t.XdrRecurse(x, "")
 	}
@@ -863,7 +1490,7 @@ func extractCode(t xdr.XdrType) string {
 	}
 
 	out := strings.Builder{}
-	stcdetail.XdrToTxrep(&out, "", t)
+	stcdetail.WriteTxrep(&out, "", t)
 	return strings.TrimSuffix(out.String(), "\n")
 }
 
@@ -888,22 +1515,64 @@ func (e TxFailure) Error() string {
 	}
 }
 
+// Returns the names of the transaction result code and, if the
+// transaction failed because of its operations, each operation's
+// result code (e.g., "txFAILED", "PAYMENT_NO_TRUST").  The names can
+// be passed to stcdetail.ExplainResultCode.
+func (e TxFailure) ResultCodes() []string {
+	ret := []string{e.Result.Code.String()}
+	if e.Result.Code != stx.TxFAILED {
+		return ret
+	}
+	for i := range *e.Result.Results() {
+		if code := (*e.Result.Results())[i].Code; code != stx.OpINNER {
+			ret = append(ret, code.String())
+		} else {
+			x := codeExtractor{}
+			x.Marshal("", (*e.Result.Results())[i].Tr().XdrUnionBody())
+			ret = append(ret, x.name)
+		}
+	}
+	return ret
+}
+
 // Post a new transaction to the network.  In the event that the
 // transaction is successfully submitted to horizon but rejected by
 // the Stellar network, the error will be of type TxFailure, which
-// contains the transaction result.
+// contains the transaction result.  If horizon is rate limiting
+// requests or has an internal error, the error is a
+// *stcdetail.HTTPerror.  If a policy refuses the transaction (see
+// CheckPolicy), the error is a PolicyError and nothing is submitted,
+// as with a WrongNetworkError if e was written for another network
+// (see CheckNetwork).
 func (net *StellarNet) Post(e *TransactionEnvelope) (
 	*TransactionResult, error) {
+	if err := net.CheckNetwork(e); err != nil {
+		return nil, err
+	}
 	if net.Horizon == "" {
 		return nil, badHorizonURL
 	}
+	if err := net.CheckPolicy(e, PolicyPost); err != nil {
+		return nil, err
+	}
 	tx := stcdetail.XdrToBase64(e)
-	resp, err := http.PostForm(net.Horizon + "transactions/",
-		url.Values{"tx": {tx}})
+	req, err := stcdetail.NewRequest("POST", net.Horizon+"transactions/",
+		strings.NewReader(url.Values{"tx": {tx}}.Encode()), net.HTTPHeader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= 500 {
+		// No transaction result, e.g., because of rate limiting
+		return nil, stcdetail.NewHTTPerror(resp)
+	}
 
 	js := json.NewDecoder(resp.Body)
 	var res struct {
@@ -923,7 +1592,9 @@ func (net *StellarNet) Post(e *TransactionEnvelope) (
 	if err = stcdetail.XdrFromBase64(&ret, res.Result_xdr); err != nil {
 		return nil, err
 	}
-	if ret.Result.Code != stx.TxSUCCESS {
+	// A fee bump whose inner transaction succeeded has its own code
+	if c := ret.Result.Code; c != stx.TxSUCCESS &&
+		c != stx.TxFEE_BUMP_INNER_SUCCESS {
 		return nil, TxFailure{&ret}
 	}
 	return &ret, nil
@@ -0,0 +1,94 @@
+package stc
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// A share of a private key, as produced by SplitKey, consists of the
+// bytes (threshold, x-coordinate, public key hint[4], share value[32],
+// checksum[2]), where the checksum is the first two bytes of the
+// SHA-256 hash of everything before it.  Each share is written as 40
+// words from stcdetail.ShareWords.
+const keyShareLen = 1 + 1 + 4 + ed25519.SeedSize + 2
+
+var InvalidKeyShare = errors.New("Invalid key share")
+
+// Splits a private key into n shares, any k of which can reconstruct
+// it with JoinKeyShares.  Each share is returned as a line of words
+// meant to be copied down by hand.
+func (sk PrivateKey) SplitKey(k, n int) ([]string, error) {
+	ed, ok := sk.PrivateKeyInterface.(stcdetail.Ed25519Priv)
+	if !ok {
+		return nil, errors.New("SplitKey: unsupported private key type")
+	}
+	shares, err := stcdetail.ShamirSplit(ed25519.PrivateKey(ed).Seed(), k, n)
+	if err != nil {
+		return nil, err
+	}
+	hint := sk.Public().Hint()
+	ret := make([]string, n)
+	for i, s := range shares {
+		buf := append([]byte{byte(k), s[0]}, hint[:]...)
+		buf = append(buf, s[1:]...)
+		sum := sha256.Sum256(buf)
+		ret[i] = stcdetail.BytesToWords(append(buf, sum[:2]...))
+	}
+	return ret, nil
+}
+
+// Decodes a share produced by SplitKey, returning the threshold, the
+// public key hint, and the share itself in the format of
+// stcdetail.ShamirJoin.
+func parseKeyShare(share string) (int, []byte, []byte, error) {
+	bs, err := stcdetail.WordsToBytes(share)
+	if err != nil {
+		return 0, nil, nil, err
+	} else if len(bs) != keyShareLen {
+		return 0, nil, nil, fmt.Errorf("share has %d words instead of %d",
+			len(bs), keyShareLen)
+	}
+	body := bs[:keyShareLen-2]
+	if sum := sha256.Sum256(body); !bytes.Equal(sum[:2], bs[len(body):]) {
+		return 0, nil, nil, errors.New("share checksum mismatch (mistyped word?)")
+	}
+	return int(body[0]), body[2:6], append([]byte{body[1]}, body[6:]...), nil
+}
+
+// Reconstructs a private key from shares produced by SplitKey.
+// Fails if there are fewer shares than the threshold, or if the
+// shares do not all come from the same key.
+func JoinKeyShares(shares []string) (PrivateKey, error) {
+	var k int
+	var hint []byte
+	var raw [][]byte
+	for i, share := range shares {
+		t, h, s, err := parseKeyShare(share)
+		if err != nil {
+			return PrivateKey{}, fmt.Errorf("share %d: %s", i+1, err)
+		} else if i == 0 {
+			k, hint = t, h
+		} else if t != k || !bytes.Equal(h, hint) {
+			return PrivateKey{}, fmt.Errorf("share %d: from a different key",
+				i+1)
+		}
+		raw = append(raw, s)
+	}
+	if len(raw) < k || k == 0 {
+		return PrivateKey{}, fmt.Errorf("need %d shares, only have %d",
+			k, len(raw))
+	}
+	seed, err := stcdetail.ShamirJoin(raw)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	ret := PrivateKey{stcdetail.Ed25519Priv(ed25519.NewKeyFromSeed(seed))}
+	if h := ret.Public().Hint(); !bytes.Equal(h[:], hint) {
+		return PrivateKey{}, InvalidKeyShare
+	}
+	return ret, nil
+}
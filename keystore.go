@@ -0,0 +1,83 @@
+package stc
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// A source of private keys by name, such as the key files that the
+// stc command keeps in $STCDIR/keys.  Set StellarNet.Keys to look
+// keys up elsewhere, such as in a secrets manager.
+type KeyStore interface {
+	// Returns the key called name, or ErrNoSuchKey if there is none.
+	LoadKey(name string) (PrivateKey, error)
+	// Returns the names of all keys, in sorted order.
+	KeyNames() []string
+}
+
+// Error returned by a KeyStore for a key name it does not have.
+var ErrNoSuchKey = errors.New("No such key")
+
+// A KeyStore consisting of the key files in a directory, which may be
+// encrypted (see PrivateKey.Save).  LoadKey prompts for the passphrase
+// of encrypted keys.
+type DirKeyStore string
+
+// Returns true if name can be the name of a key in a DirKeyStore, as
+// opposed to a path.
+func isKeyName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsRune(name, '/')
+}
+
+func (d DirKeyStore) LoadKey(name string) (PrivateKey, error) {
+	if !isKeyName(name) {
+		return PrivateKey{}, ErrNoSuchKey
+	}
+	sk, err := LoadPrivateKey(path.Join(string(d), name))
+	if os.IsNotExist(err) {
+		return PrivateKey{}, ErrNoSuchKey
+	}
+	return sk, err
+}
+
+func (d DirKeyStore) KeyNames() []string {
+	f, err := os.Open(string(d))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	names, _ := f.Readdirnames(-1)
+	sort.Strings(names)
+	return names
+}
+
+// A KeyStore held entirely in memory, mapping names to keys.
+type MemKeyStore map[string]PrivateKey
+
+func (m MemKeyStore) LoadKey(name string) (PrivateKey, error) {
+	if sk, ok := m[name]; ok {
+		return sk, nil
+	}
+	return PrivateKey{}, ErrNoSuchKey
+}
+
+func (m MemKeyStore) KeyNames() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns net.Keys, or if that is nil, the key files in $STCDIR/keys.
+func (net *StellarNet) GetKeyStore() KeyStore {
+	if net.Keys != nil {
+		return net.Keys
+	}
+	return DirKeyStore(ConfigPath("keys"))
+}
@@ -0,0 +1,140 @@
+package stc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Fetches the open offers of account acct over the network.  Horizon
+// does not say whether offers are passive, so Flags is left zero.
+func (net *StellarNet) GetOffers(acct string) ([]stx.OfferEntry, error) {
+	var ret []stx.OfferEntry
+	err := net.Iterate(context.Background(),
+		"accounts/"+acct+"/offers", nil, func(o *horizonOffer) {
+			var e stx.LedgerEntry
+			o.ledgerEntry(&e)
+			ret = append(ret, *e.Data.Offer())
+		})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Describes the terms of an offer, such as "sells 100e7 USD for XLM
+// at 0.5 XLM per USD".
+func (net *StellarNet) OfferString(o *stx.OfferEntry) string {
+	var price float64
+	if o.Price.D != 0 {
+		price = float64(o.Price.N) / float64(o.Price.D)
+	}
+	sell, buy := net.assetName(&o.Selling), net.assetName(&o.Buying)
+	return fmt.Sprintf("sells %s %s for %s at %.7g %s per %s",
+		stcdetail.ScaleFmt(o.Amount, 7), sell, buy, price, buy, sell)
+}
+
+// An operation that modifies or deletes an existing offer
+type offerUpdate struct {
+	op     int
+	id     int64
+	source string
+}
+
+func offerUpdates(e *TransactionEnvelope) []offerUpdate {
+	txsrc, ops := txSourceOps(e.TransactionEnvelope)
+	var ret []offerUpdate
+	for i := range ops {
+		var id int64
+		switch ops[i].Body.Type {
+		case stx.MANAGE_SELL_OFFER:
+			id = ops[i].Body.ManageSellOfferOp().OfferID
+		case stx.MANAGE_BUY_OFFER:
+			id = ops[i].Body.ManageBuyOfferOp().OfferID
+		}
+		if id == 0 {
+			continue
+		}
+		src := txsrc
+		if ops[i].SourceAccount != nil {
+			src = ops[i].SourceAccount.ToSignerKey().String()
+		}
+		ret = append(ret, offerUpdate{i, id, src})
+	}
+	return ret
+}
+
+// Fetches the current state of every offer that an operation in e
+// modifies or deletes into net.Offers, so that txrep output shows its
+// terms next to the operation's offerID.  Offers already in
+// net.Offers are not fetched again.
+func (net *StellarNet) FetchOffers(e *TransactionEnvelope) error {
+	for _, u := range offerUpdates(e) {
+		net.mu.Lock()
+		_, ok := net.Offers[u.id]
+		net.mu.Unlock()
+		if ok {
+			continue
+		}
+		var k stx.LedgerKey
+		k.Type = stx.OFFER
+		k.Offer().OfferID = u.id
+		le, err := net.GetLedgerEntry(&k)
+		if err != nil && !IsNotFound(err) {
+			return err
+		}
+		net.mu.Lock()
+		if net.Offers == nil {
+			net.Offers = make(map[int64]*stx.OfferEntry)
+		}
+		if err != nil {
+			net.Offers[u.id] = nil
+		} else {
+			net.Offers[u.id] = le.Data.Offer()
+		}
+		net.mu.Unlock()
+	}
+	return nil
+}
+
+func (net *StellarNet) offer(id int64) (*stx.OfferEntry, bool) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	o, ok := net.Offers[id]
+	return o, ok
+}
+
+// Returns a comment describing the current terms of offer id, if
+// FetchOffers has fetched it.
+func (net *StellarNet) OfferNote(id int64) string {
+	o, ok := net.offer(id)
+	if !ok {
+		return ""
+	} else if o == nil {
+		return "offer does not exist"
+	}
+	return "currently " + net.OfferString(o)
+}
+
+// Fetches the offers that operations in e modify or delete, and
+// returns a warning for each operation that would fail because its
+// offer does not exist or belongs to a different account.
+func (net *StellarNet) OfferWarnings(e *TransactionEnvelope) []string {
+	if err := net.FetchOffers(e); err != nil {
+		return []string{fmt.Sprintf("cannot fetch offers: %s", err)}
+	}
+	var ret []string
+	for _, u := range offerUpdates(e) {
+		if o, _ := net.offer(u.id); o == nil {
+			ret = append(ret, fmt.Sprintf("operation %d: offer %d does "+
+				"not exist", u.op, u.id))
+		} else if seller := o.SellerID.String(); seller != u.source {
+			ret = append(ret, fmt.Sprintf("operation %d: offer %d "+
+				"belongs to %s, not the operation's source %s",
+				u.op, u.id, seller, u.source))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,203 @@
+package stc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// An operation as listed by horizon's operations endpoints.  Horizon
+// describes operations only in JSON, but the listing functions below
+// have it embed each operation's transaction, whose XDR Op and Result
+// are decoded from.  JSON holds the whole record, including the
+// fields specific to each type of operation.
+type HorizonOperation struct {
+	// Horizon's ID for the operation, which encodes the ledger,
+	// transaction, and operation numbers
+	ID          int64
+	PagingToken string
+	// Type of operation in horizon's terms, such as "payment"
+	Type          string
+	SourceAccount string
+	Txhash        stx.Hash
+	// Whether the transaction containing the operation succeeded
+	Success bool
+	Time    time.Time
+	// The operation, decoded from its transaction's envelope, or nil
+	// if horizon did not embed the transaction
+	Op *stx.Operation
+	// The result of the operation, or nil if the transaction failed
+	// before executing operations or was not embedded
+	Result *stx.OperationResult
+	JSON   json.RawMessage
+}
+
+// Returns the results of the operations in a transaction, including
+// the inner transaction of a fee bump, or nil if the transaction
+// failed before executing them.
+func txOpResults(r *stx.TransactionResult) []stx.OperationResult {
+	switch r.Result.Code {
+	case stx.TxSUCCESS, stx.TxFAILED:
+		return *r.Result.Results()
+	case stx.TxFEE_BUMP_INNER_SUCCESS, stx.TxFEE_BUMP_INNER_FAILED:
+		ir := &r.Result.InnerResultPair().Result.Result
+		if ir.Code == stx.TxSUCCESS || ir.Code == stx.TxFAILED {
+			return *ir.Results()
+		}
+	}
+	return nil
+}
+
+// Parses horizon's timestamps, which are in UTC, into local time.
+func horizonTime(s string) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02T15:04:05Z", s, time.UTC)
+	return t.Local(), err
+}
+
+func (op *HorizonOperation) UnmarshalJSON(data []byte) error {
+	var j struct {
+		Id                     string
+		Paging_token           string
+		Type                   string
+		Source_account         string
+		Transaction_hash       string
+		Transaction_successful bool
+		Created_at             string
+		Transaction            *struct {
+			Envelope_xdr string
+			Result_xdr   string
+		}
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	var err error
+	if op.ID, err = strconv.ParseInt(j.Id, 10, 64); err != nil {
+		return err
+	} else if _, err = fmt.Sscanf(j.Transaction_hash, "%v",
+		stx.XDR_Hash(&op.Txhash)); err != nil {
+		return err
+	} else if op.Time, err = horizonTime(j.Created_at); err != nil {
+		return err
+	}
+	op.PagingToken = j.Paging_token
+	op.Type = j.Type
+	op.SourceAccount = j.Source_account
+	op.Success = j.Transaction_successful
+	op.JSON = append(json.RawMessage(nil), data...)
+	op.Op, op.Result = nil, nil
+	if j.Transaction == nil {
+		return nil
+	}
+
+	var env stx.TransactionEnvelope
+	var res stx.TransactionResult
+	if err = stcdetail.XdrFromBase64(&env,
+		j.Transaction.Envelope_xdr); err != nil {
+		return err
+	} else if err = stcdetail.XdrFromBase64(&res,
+		j.Transaction.Result_xdr); err != nil {
+		return err
+	}
+	// The low 12 bits of an operation ID number operations from 1
+	i := int(op.ID&0xfff) - 1
+	if _, ops := txSourceOps(&env); i >= 0 && i < len(ops) {
+		op.Op = &ops[i]
+	}
+	if results := txOpResults(&res); i >= 0 && i < len(results) {
+		op.Result = &results[i]
+	}
+	return nil
+}
+
+// An effect of an operation, as listed by horizon's effects
+// endpoints.  Horizon describes effects only in JSON, without XDR, so
+// JSON holds the whole record, including the fields specific to each
+// type of effect (such as amount and asset_code for
+// "account_credited").
+type HorizonEffect struct {
+	// ID of the operation that had the effect (which
+	// HorizonOperation.ID matches)
+	OpID        int64
+	PagingToken string
+	// Account affected
+	Account string
+	// Type of effect in horizon's terms, such as "account_credited"
+	Type string
+	Time time.Time
+	JSON json.RawMessage
+}
+
+func (e *HorizonEffect) UnmarshalJSON(data []byte) error {
+	var j struct {
+		Id           string
+		Paging_token string
+		Account      string
+		Type         string
+		Created_at   string
+	}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	// Effect IDs are the operation ID and a sequence number
+	var err error
+	opid := strings.SplitN(j.Id, "-", 2)[0]
+	if e.OpID, err = strconv.ParseInt(opid, 10, 64); err != nil {
+		return err
+	} else if e.Time, err = horizonTime(j.Created_at); err != nil {
+		return err
+	}
+	e.PagingToken = j.Paging_token
+	e.Account = j.Account
+	e.Type = j.Type
+	e.JSON = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (net *StellarNet) iterateOperations(ctx context.Context,
+	path string, params url.Values,
+	cb func(*HorizonOperation) error) error {
+	q := url.Values{"join": {"transactions"}}
+	for k, v := range params {
+		q[k] = v
+	}
+	return net.Iterate(ctx, path, q, cb)
+}
+
+// Calls cb on each operation that involves account acct, as described
+// for Iterate, which params (such as cursor and order) are passed to.
+// Returning an error from cb stops the iteration.
+func (net *StellarNet) AccountOperations(ctx context.Context, acct string,
+	params url.Values, cb func(*HorizonOperation) error) error {
+	return net.iterateOperations(ctx, "accounts/"+acct+"/operations",
+		params, cb)
+}
+
+// Calls cb on each operation of transaction txid, like
+// AccountOperations.
+func (net *StellarNet) TxOperations(ctx context.Context, txid string,
+	params url.Values, cb func(*HorizonOperation) error) error {
+	return net.iterateOperations(ctx, "transactions/"+txid+"/operations",
+		params, cb)
+}
+
+// Calls cb on each effect on account acct, as described for Iterate,
+// which params (such as cursor and order) are passed to.  Returning an
+// error from cb stops the iteration.
+func (net *StellarNet) AccountEffects(ctx context.Context, acct string,
+	params url.Values, cb func(*HorizonEffect) error) error {
+	return net.Iterate(ctx, "accounts/"+acct+"/effects", params, cb)
+}
+
+// Calls cb on each effect of transaction txid, like AccountEffects.
+func (net *StellarNet) TxEffects(ctx context.Context, txid string,
+	params url.Values, cb func(*HorizonEffect) error) error {
+	return net.Iterate(ctx, "transactions/"+txid+"/effects", params, cb)
+}
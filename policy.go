@@ -0,0 +1,96 @@
+package stc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// What a TxPolicy is asked to approve.
+type PolicyAction string
+
+const (
+	PolicySign PolicyAction = "sign"
+	PolicyPost PolicyAction = "post"
+)
+
+// A TxPolicy decides whether a transaction may be signed or posted,
+// allowing organization-specific rules such as amount limits or
+// allow-listed destinations.  CheckTx returns nil to approve action
+// on e, or an error explaining why not.
+type TxPolicy interface {
+	CheckTx(net *StellarNet, e *TransactionEnvelope,
+		action PolicyAction) error
+}
+
+// Error returned by SignTx, SignInnerTx, and Post when a policy
+// refuses a transaction.
+type PolicyError struct {
+	Action PolicyAction
+	Reason error
+}
+
+func (e PolicyError) Error() string {
+	return fmt.Sprintf("policy does not allow %s: %s", e.Action, e.Reason)
+}
+
+// A TxPolicy that runs a shell command, which approves the
+// transaction by exiting with status 0.  The command gets the
+// transaction envelope in JSON on standard input, and environment
+// variables STC_ACTION (sign or post), STC_NETWORK, and STC_TXHASH.
+// When it refuses, whatever it wrote to standard output or standard
+// error is the reason.
+type CommandPolicy string
+
+func (c CommandPolicy) CheckTx(net *StellarNet, e *TransactionEnvelope,
+	action PolicyAction) error {
+	input, err := stcdetail.XdrToJson(e)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("/bin/sh", "-c", string(c))
+	cmd.Env = append(os.Environ(),
+		"STC_ACTION="+string(action),
+		"STC_NETWORK="+net.Name,
+		"STC_TXHASH="+fmt.Sprintf("%x", net.HashTx(e)[:]),
+	)
+	cmd.Stdin = bytes.NewReader(input)
+	out, err := cmd.CombinedOutput()
+	if msg := strings.TrimSpace(string(out)); err != nil && msg != "" {
+		return fmt.Errorf("%s", msg)
+	}
+	return err
+}
+
+// Adds a policy that must approve every transaction before SignTx,
+// SignInnerTx, or Post acts on it.  Policies are consulted after the
+// network's own Policy command, in the order they were added.
+func (net *StellarNet) AddPolicy(p TxPolicy) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.Policies = append(net.Policies, p)
+}
+
+// Returns nil if the network's Policy command and every policy added
+// with AddPolicy approve action on e, and otherwise a PolicyError for
+// the first one that refuses.
+func (net *StellarNet) CheckPolicy(e *TransactionEnvelope,
+	action PolicyAction) error {
+	net.mu.Lock()
+	policies := append([]TxPolicy(nil), net.Policies...)
+	net.mu.Unlock()
+	if net.Policy != "" {
+		policies = append([]TxPolicy{CommandPolicy(net.Policy)},
+			policies...)
+	}
+	for _, p := range policies {
+		if err := p.CheckTx(net, e, action); err != nil {
+			return PolicyError{action, err}
+		}
+	}
+	return nil
+}
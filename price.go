@@ -0,0 +1,67 @@
+package stc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// Fetches the price of one unit of asset from net.PriceOracle, in
+// units of net.PriceCurrency.  asset is in the format of
+// stx.Asset.String() (e.g., "native" or "USD:GABC...").  The oracle
+// is queried with "GET PriceOracle?asset=ASSET" (or "&asset=ASSET" if
+// PriceOracle already contains a query) and must return a JSON object
+// whose "price" field is a number or a string containing one.
+// net.HTTPHeader is not sent, since it is meant for horizon.
+// Successful results are cached in net.PriceCache.
+func (net *StellarNet) GetPrice(asset string) (float64, error) {
+	net.mu.Lock()
+	cached, ok := net.PriceCache[asset]
+	net.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	if net.PriceOracle == "" {
+		return 0, badPriceOracle
+	}
+	sep := "?"
+	if strings.IndexByte(net.PriceOracle, '?') >= 0 {
+		sep = "&"
+	}
+	req, err := stcdetail.NewRequest("GET", net.PriceOracle+sep+
+		url.Values{"asset": {asset}}.Encode(), nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, stcdetail.NewHTTPerror(resp)
+	}
+	var j struct {
+		Price json.Number
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&j); err != nil {
+		return 0, err
+	}
+	p, err := strconv.ParseFloat(string(j.Price), 64)
+	if err != nil {
+		return 0, err
+	}
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	if net.PriceCache == nil {
+		net.PriceCache = make(map[string]float64)
+	}
+	net.PriceCache[asset] = p
+	return p, nil
+}
+
+const badPriceOracle horizonFailure = "No price-oracle configured"
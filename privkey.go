@@ -3,6 +3,8 @@ package stc
 import (
 	"bytes"
 	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/xdrpp/stc/stcdetail"
@@ -61,28 +63,78 @@ func (sk PrivateKey) Save(file string, passphrase []byte) error {
 	if len(passphrase) == 0 {
 		fmt.Fprintln(out, sk.String())
 	} else {
-		w0, err := armor.Encode(out, "PGP MESSAGE", nil)
+		w, err := encryptArmored(out, passphrase)
 		if err != nil {
 			return err
 		}
-		w, err := openpgp.SymmetricallyEncrypt(w0, passphrase, nil,
-			&packet.Config{
-				DefaultCipher:          packet.CipherAES256,
-				DefaultCompressionAlgo: packet.CompressionNone,
-				S2KCount:               65011712,
-			})
-		if err != nil {
-			w0.Close()
-			return err
-		}
 		fmt.Fprintln(w, sk.String())
 		w.Close()
-		w0.Close()
 		out.WriteString("\n")
 	}
 	return stcdetail.SafeCreateFile(file, out.String(), 0400)
 }
 
+type armoredWriter struct {
+	io.WriteCloser
+	armor io.WriteCloser
+}
+
+func (w armoredWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if err2 := w.armor.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Returns a writer that symmetrically encrypts its input to out in
+// ASCII-armored GPG format.  The caller must Close the writer.
+func encryptArmored(out io.Writer, passphrase []byte) (io.WriteCloser, error) {
+	w0, err := armor.Encode(out, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+	w, err := openpgp.SymmetricallyEncrypt(w0, passphrase, nil,
+		&packet.Config{
+			DefaultCipher:          packet.CipherAES256,
+			DefaultCompressionAlgo: packet.CompressionNone,
+			S2KCount:               65011712,
+		})
+	if err != nil {
+		w0.Close()
+		return nil, err
+	}
+	return armoredWriter{w, w0}, nil
+}
+
+// Decrypts the output of encryptArmored, returning the entire
+// plaintext after checking its integrity.
+func decryptArmored(in io.Reader, passphrase []byte) (io.Reader, error) {
+	block, err := armor.Decode(in)
+	if err != nil {
+		return nil, err
+	}
+	tried := false
+	md, err := openpgp.ReadMessage(block.Body, nil,
+		func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+			if tried {
+				return nil, InvalidPassphrase
+			}
+			tried = true
+			return passphrase, nil
+		}, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, err
+	} else if md.SignatureError != nil {
+		return nil, md.SignatureError
+	}
+	return bytes.NewReader(body), nil
+}
+
 var InvalidPassphrase = errors.New("Invalid passphrase")
 var InvalidKeyFile = errors.New("Invalid private key file")
 
@@ -122,11 +174,53 @@ func LoadPrivateKey(file string) (PrivateKey, error) {
 	return ret, nil
 }
 
-// Reads a private key from standard input.  If standard input is a
-// terminal, disables echo and prints prompt to standard error.
-func InputPrivateKey(prompt string) (PrivateKey, error) {
-	key := stcdetail.GetPass(prompt)
+var InvalidKeyFormat = errors.New("Unrecognized private key format")
+var MismatchedPublicKey = errors.New(
+	"Public half of secret key does not match its seed")
+
+// Parses a private key in strkey format (S...), or given in hex or
+// base64 as either a raw 32-byte ed25519 seed or a 64-byte
+// libsodium-style secret key (the seed followed by the public key),
+// as other SDKs often store keys.  Fails with MismatchedPublicKey if
+// the public half of a 64-byte key is not derived from its seed.
+func ParsePrivateKey(input string) (PrivateKey, error) {
+	input = strings.TrimSpace(input)
 	var sk PrivateKey
-	_, err := fmt.Fscan(bytes.NewBuffer(key), &sk)
-	return sk, err
+	if _, err := fmt.Sscan(input, &sk); err == nil {
+		return sk, nil
+	} else if len(input) == 56 && input[0] == 'S' {
+		// A mistyped strkey
+		return PrivateKey{}, err
+	}
+	bs, err := hex.DecodeString(input)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding,
+		base64.RawStdEncoding, base64.URLEncoding,
+		base64.RawURLEncoding} {
+		if err == nil {
+			break
+		}
+		bs, err = enc.DecodeString(input)
+	}
+	if err != nil {
+		return PrivateKey{}, InvalidKeyFormat
+	}
+	switch len(bs) {
+	case ed25519.SeedSize:
+		return PrivateKey{stcdetail.Ed25519Priv(
+			ed25519.NewKeyFromSeed(bs))}, nil
+	case ed25519.PrivateKeySize:
+		key := ed25519.NewKeyFromSeed(bs[:ed25519.SeedSize])
+		if !bytes.Equal(key, bs) {
+			return PrivateKey{}, MismatchedPublicKey
+		}
+		return PrivateKey{stcdetail.Ed25519Priv(key)}, nil
+	}
+	return PrivateKey{}, InvalidKeyFormat
+}
+
+// Reads a private key, in any format accepted by ParsePrivateKey,
+// from standard input.  If standard input is a terminal, disables
+// echo and prints prompt to standard error.
+func InputPrivateKey(prompt string) (PrivateKey, error) {
+	return ParsePrivateKey(string(stcdetail.GetPass(prompt)))
 }
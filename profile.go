@@ -0,0 +1,116 @@
+package stc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Name of the profile that selects the base configuration directory
+// itself, in which the other profiles live.
+const DefaultProfile = "default"
+
+// Subdirectory of the base configuration directory holding profiles.
+const profilesDir = "profiles"
+
+// The profile ConfigPath uses, or "" for the base directory.
+var stcProfile string
+
+var ErrInvalidProfile = errors.New("Invalid profile name")
+var ErrNoProfile = errors.New("No such profile")
+
+// Returns true if name can be the name of a profile created with
+// CreateProfile.  The rules are those of network names, and
+// DefaultProfile is reserved.
+func ValidProfileName(name string) bool {
+	return ValidNetName(name) && name != DefaultProfile
+}
+
+// Returns the configuration directory of profile name, which need not
+// exist.  A profile is a separate configuration directory, with its
+// own networks, learned signers, and keys, for keeping environments
+// such as work, personal, and testing apart.  Profile NAME lives in
+// profiles/NAME under $STCDIR (or the default configuration directory
+// if $STCDIR is unset), which is itself the directory of
+// DefaultProfile.
+func ProfileDir(name string) string {
+	if name == DefaultProfile {
+		return baseConfigDir()
+	}
+	return filepath.Join(baseConfigDir(), profilesDir, name)
+}
+
+// Makes ConfigPath use the directory of profile name, as setting
+// $STCPROFILE does, or the base configuration directory if name is
+// DefaultProfile.  Fails with ErrNoProfile rather than create a
+// profile that does not exist (see CreateProfile), so that a
+// misspelled name cannot silently start an empty configuration.
+// Call UseProfile before anything uses ConfigPath, since networks
+// already loaded keep the paths from which they were loaded.
+func UseProfile(name string) error {
+	if name == DefaultProfile {
+		stcDir, stcProfile = baseConfigDir(), ""
+		return nil
+	} else if !ValidProfileName(name) {
+		return fmt.Errorf("%s: %s", name, ErrInvalidProfile)
+	}
+	dir := ProfileDir(name)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s: %s", name, ErrNoProfile)
+	}
+	stcDir, stcProfile = dir, name
+	return nil
+}
+
+// Returns the name of the profile that ConfigPath uses.
+func CurrentProfile() string {
+	getConfigDir(false)
+	if stcProfile == "" {
+		return DefaultProfile
+	}
+	return stcProfile
+}
+
+// Creates profile name with a new configuration directory, which like
+// a new $STCDIR starts with the main network as its default network,
+// and returns the directory.  Fails if the profile already exists.
+func CreateProfile(name string) (string, error) {
+	if !ValidProfileName(name) {
+		return "", fmt.Errorf("%s: %s", name, ErrInvalidProfile)
+	}
+	// Set up the base directory as ConfigPath would, in case this is
+	// its first use
+	base := ProfileDir(DefaultProfile)
+	if _, err := os.Stat(base); os.IsNotExist(err) &&
+		os.MkdirAll(base, 0777) == nil {
+		initConfigDir(base)
+	}
+	dir := ProfileDir(name)
+	if _, err := os.Lstat(dir); err == nil {
+		return "", fmt.Errorf("%s: profile already exists", name)
+	} else if err := os.MkdirAll(filepath.Dir(dir), 0777); err != nil {
+		return "", err
+	} else if err = os.Mkdir(dir, 0777); err != nil {
+		return "", err
+	}
+	initConfigDir(dir)
+	return dir, nil
+}
+
+// Returns the names of all profiles:  DefaultProfile followed by the
+// others in sorted order.
+func ProfileNames() []string {
+	ret := []string{DefaultProfile}
+	fis, _ := ioutil.ReadDir(filepath.Join(baseConfigDir(), profilesDir))
+	var names []string
+	for _, fi := range fis {
+		if fi.IsDir() && ValidProfileName(fi.Name()) {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	return append(ret, names...)
+}
@@ -0,0 +1,234 @@
+package stc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// A SubmitQueue posts transactions to the network in sequence number
+// order for each source account, one at a time, backing off when
+// horizon is rate limiting requests or temporarily unavailable.
+// Pending transactions are kept in files in a directory, so that a
+// queue created on the same directory after a crash or restart
+// continues where the previous one left off.  Only one SubmitQueue
+// (in one process) should use a directory at a time.
+type SubmitQueue struct {
+	Net *StellarNet
+
+	// Directory holding one file for each pending transaction.
+	Dir string
+
+	// Minimum time between submissions, to stay under horizon's rate
+	// limit.
+	Interval time.Duration
+
+	// If not nil, called after each transaction leaves the queue,
+	// with the result of StellarNet.Post.  err is a TxFailure if the
+	// network rejected the transaction.
+	Done func(e *TransactionEnvelope, res *TransactionResult, err error)
+
+	mu      sync.Mutex
+	pending []*queueItem
+	counter int64
+	wake    chan struct{}
+}
+
+type queueItem struct {
+	file   string
+	source string
+	seq    stx.SequenceNumber
+	e      *TransactionEnvelope
+}
+
+const queueSuffix = ".tx"
+
+// Longest time a SubmitQueue waits before retrying a submission.
+const maxQueueBackoff = time.Minute
+
+func newQueueItem(file string, e *TransactionEnvelope) *queueItem {
+	it := &queueItem{file: file, e: e}
+	tx := e.TransactionEnvelope
+	if e.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		tx = e.InnerTx().TransactionEnvelope
+	}
+	if seq := stcdetail.TxSeqNum(tx); seq != nil {
+		it.seq = *seq
+	}
+	it.source, _ = txSourceOps(tx)
+	return it
+}
+
+// Creates a SubmitQueue that keeps pending transactions in dir
+// (creating it if necessary) and loads any transactions left there
+// by a previous SubmitQueue.
+func (net *StellarNet) NewSubmitQueue(dir string) (*SubmitQueue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	q := &SubmitQueue{
+		Net:  net,
+		Dir:  dir,
+		wake: make(chan struct{}, 1),
+	}
+	for _, fi := range files {
+		name := fi.Name()
+		if !strings.HasSuffix(name, queueSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		e, err := TxFromBase64(string(contents))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		q.pending = append(q.pending, newQueueItem(path, e))
+		if n, err := strconv.ParseInt(strings.TrimSuffix(name, queueSuffix),
+			10, 64); err == nil && n >= q.counter {
+			q.counter = n + 1
+		}
+	}
+	return q, nil
+}
+
+// Adds a transaction to the queue, saving it to disk before
+// returning.
+func (q *SubmitQueue) Add(e *TransactionEnvelope) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Names sort in the order transactions were added
+	path := filepath.Join(q.Dir, fmt.Sprintf("%020d%s", q.counter,
+		queueSuffix))
+	if err := stcdetail.SafeCreateFile(path, TxToBase64(e)+"\n",
+		0600); err != nil {
+		return err
+	}
+	q.counter++
+	q.pending = append(q.pending, newQueueItem(path, e))
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Returns the number of transactions waiting to be submitted.
+func (q *SubmitQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Returns the next transaction to submit:  the one with the lowest
+// sequence number among those with the same source account as the
+// oldest pending transaction.
+func (q *SubmitQueue) next() *queueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var ret *queueItem
+	for _, it := range q.pending {
+		if ret == nil {
+			ret = it
+		} else if it.source == ret.source && it.seq < ret.seq {
+			ret = it
+		}
+	}
+	return ret
+}
+
+func (q *SubmitQueue) remove(it *queueItem) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.pending {
+		if q.pending[i] == it {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	return os.Remove(it.file)
+}
+
+// Returns how long to wait before retrying after err, or false if err
+// is not worth retrying.  Honors horizon's Retry-After header.
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	if he, ok := err.(*stcdetail.HTTPerror); ok &&
+		he.Resp.StatusCode == http.StatusTooManyRequests {
+		return retryAfter(he.Resp, backoff), true
+	}
+	return backoff, IsTemporary(err)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// Submits queued transactions, waiting for more when the queue is
+// empty, until ctx is Done.  A transaction leaves the queue once it
+// succeeds, the network rejects it, or posting it fails with an
+// error that is not temporary; Done reports which.  Only returns an
+// error if a pending file cannot be removed.
+func (q *SubmitQueue) Run(ctx context.Context) error {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		it := q.next()
+		if it == nil {
+			select {
+			case <-ctx.Done():
+			case <-q.wake:
+			}
+			continue
+		}
+		res, err := q.Net.Post(it.e)
+		if err != nil {
+			if d, retry := retryDelay(err, backoff); retry {
+				if backoff *= 2; backoff > maxQueueBackoff {
+					backoff = maxQueueBackoff
+				}
+				sleepCtx(ctx, d)
+				continue
+			}
+		}
+		backoff = time.Second
+		if rerr := q.remove(it); rerr != nil {
+			return rerr
+		}
+		if q.Done != nil {
+			q.Done(it.e, res, err)
+		}
+		if q.Interval > 0 {
+			sleepCtx(ctx, q.Interval)
+		}
+	}
+	return nil
+}
+
+// Returns the pending transactions, oldest first.
+func (q *SubmitQueue) Pending() []*TransactionEnvelope {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ret := make([]*TransactionEnvelope, len(q.pending))
+	for i := range q.pending {
+		ret[i] = q.pending[i].e
+	}
+	return ret
+}
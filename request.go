@@ -0,0 +1,96 @@
+package stc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// A signing request is a transaction proposed for others to sign.
+// In text form, it is the transaction in txrep format preceded by a
+// header line recording the transaction's hash when it was proposed:
+//
+//	+++ request HASH
+//
+// Lines before the header may contain only comments.  Because
+// signatures do not affect the hash, approvers can add signatures to
+// a request without changing its header, but any other change to the
+// transaction makes RequestFromRep fail.
+const requestHeader = "+++ request "
+
+// Error returned by RequestFromRep when a transaction no longer has
+// the hash with which it was proposed.
+type RequestMismatch struct {
+	Proposed, Actual stx.Hash
+}
+
+func (e RequestMismatch) Error() string {
+	return fmt.Sprintf("transaction hash %x does not match hash %x "+
+		"of signing request", e.Actual[:], e.Proposed[:])
+}
+
+// Returns true if input looks like a signing request in text form,
+// meaning the first line that is neither blank nor a comment is a
+// request header.
+func IsSigningRequest(input string) bool {
+	for _, line := range strings.Split(input, "\n") {
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+			return strings.HasPrefix(line, requestHeader)
+		}
+	}
+	return false
+}
+
+// Renders e as a signing request, locked to its current hash on net.
+func (net *StellarNet) RequestToRep(e *TransactionEnvelope) string {
+	return fmt.Sprintf("%s%x\n%s", requestHeader, net.HashTx(e)[:],
+		net.TxToRep(e))
+}
+
+// Parses a signing request in text form, rejecting unknown fields as
+// TxFromRepStrict does.  Parse errors are of type
+// stcdetail.TxrepError, with line numbers counted from the start of
+// input.  If the transaction's hash on net differs from the one in
+// the header, returns the transaction along with a RequestMismatch
+// error.
+func (net *StellarNet) RequestFromRep(input string,
+	dialect stcdetail.TxrepDialect) (*TransactionEnvelope, error) {
+	fail := func(line int, f string, args ...interface{}) error {
+		return stcdetail.TxrepError{{Line: line,
+			Msg: fmt.Sprintf(f, args...)}}
+	}
+	lines := strings.SplitAfter(input, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		} else if !strings.HasPrefix(trimmed, requestHeader) {
+			return nil, fail(i+1, "expected %q line", requestHeader+"HASH")
+		}
+		var proposed stx.Hash
+		if bs, err := hex.DecodeString(strings.TrimSpace(
+			trimmed[len(requestHeader):])); err != nil ||
+			len(bs) != len(proposed) {
+			return nil, fail(i+1, "invalid transaction hash")
+		} else {
+			copy(proposed[:], bs)
+		}
+		e, err := TxFromRepStrict(strings.Join(lines[i+1:], ""), dialect)
+		if te, ok := err.(stcdetail.TxrepError); ok {
+			for j := range te {
+				te[j].Line += i + 1
+			}
+			return nil, te
+		} else if err != nil {
+			return nil, err
+		}
+		if actual := *net.HashTx(e); actual != proposed {
+			return e, RequestMismatch{proposed, actual}
+		}
+		return e, nil
+	}
+	return nil, fail(1, "signing request contains no transaction")
+}
@@ -0,0 +1,106 @@
+package stc
+
+import (
+	"fmt"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Returns the minimum balance, in stroops, of an account with
+// subentries trustlines, offers, signers, and data entries, based on
+// the network's current base reserve:  the base reserve times two
+// plus subentries.  This is the smallest viable starting balance for
+// a CreateAccount operation whose new account will immediately add
+// subentries, not counting fees.
+func (net *StellarNet) RecommendStartingBalance(subentries uint32) (
+	int64, error) {
+	lh, err := net.GetLedgerHeader()
+	if err != nil {
+		return 0, err
+	}
+	return minBalance(lh.BaseReserve, subentries), nil
+}
+
+func minBalance(baseReserve, subentries uint32) int64 {
+	return (2 + int64(subentries)) * int64(baseReserve)
+}
+
+// Returns whether op adds a subentry to its source account.
+func addsSubentry(op *stx.Operation) bool {
+	switch op.Body.Type {
+	case stx.CHANGE_TRUST:
+		return op.Body.ChangeTrustOp().Limit > 0
+	case stx.MANAGE_DATA:
+		return op.Body.ManageDataOp().DataValue != nil
+	case stx.SET_OPTIONS:
+		s := op.Body.SetOptionsOp().Signer
+		return s != nil && s.Weight > 0
+	case stx.MANAGE_SELL_OFFER:
+		o := op.Body.ManageSellOfferOp()
+		return o.OfferID == 0 && o.Amount > 0
+	case stx.MANAGE_BUY_OFFER:
+		o := op.Body.ManageBuyOfferOp()
+		return o.OfferID == 0 && o.BuyAmount > 0
+	case stx.CREATE_PASSIVE_SELL_OFFER:
+		return op.Body.CreatePassiveSellOfferOp().Amount > 0
+	}
+	return false
+}
+
+// Checks the starting balance of each account that e creates against
+// the minimum balance the account will need, counting the subentries
+// that later operations in e add to it.  Returns a warning for each
+// starting balance that is too low.  Accounts whose reserves e
+// sponsors are not checked.
+func (net *StellarNet) StartingBalanceWarnings(
+	e *TransactionEnvelope) []string {
+	src, ops := txSourceOps(e.TransactionEnvelope)
+	sponsored := map[string]bool{}
+	subentries := map[string]uint32{}
+	var creates []int
+	for i := range ops {
+		opsrc := src
+		if ops[i].SourceAccount != nil {
+			opsrc = ops[i].SourceAccount.ToSignerKey().String()
+		}
+		switch ops[i].Body.Type {
+		case stx.CREATE_ACCOUNT:
+			creates = append(creates, i)
+		case stx.BEGIN_SPONSORING_FUTURE_RESERVES:
+			sponsored[ops[i].Body.BeginSponsoringFutureReservesOp().
+				SponsoredID.String()] = true
+		default:
+			if addsSubentry(&ops[i]) {
+				subentries[opsrc]++
+			}
+		}
+	}
+	if len(creates) == 0 {
+		return nil
+	}
+	lh, err := net.GetLedgerHeader()
+	if err != nil {
+		return []string{fmt.Sprintf("cannot check starting balances: %s",
+			err)}
+	}
+
+	var ret []string
+	for _, i := range creates {
+		op := ops[i].Body.CreateAccountOp()
+		dest := op.Destination.String()
+		if sponsored[dest] {
+			continue
+		}
+		if min := minBalance(lh.BaseReserve, subentries[dest]); int64(
+			op.StartingBalance) < min {
+			ret = append(ret, fmt.Sprintf("operation %d: starting balance "+
+				"%s %s is below the minimum balance of %s %s for %s "+
+				"with %d subentries", i,
+				stcdetail.ScaleFmt(int64(op.StartingBalance), 7),
+				net.GetNativeAsset(), stcdetail.ScaleFmt(min, 7),
+				net.GetNativeAsset(), dest, subentries[dest]))
+		}
+	}
+	return ret
+}
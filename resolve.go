@@ -0,0 +1,77 @@
+package stc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Returns the accounts and Ed25519 signers whose comment in the
+// address book is exactly name, in sorted order.
+func (net *StellarNet) addressBookAccounts(name string) []string {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	found := map[string]bool{}
+	for acct, note := range net.Accounts {
+		if note == name {
+			found[acct] = true
+		}
+	}
+	for _, skis := range net.Signers {
+		for i := range skis {
+			if skis[i].Comment == name &&
+				skis[i].Key.Type == stx.SIGNER_KEY_TYPE_ED25519 {
+				found[skis[i].Key.String()] = true
+			}
+		}
+	}
+	ret := make([]string, 0, len(found))
+	for acct := range found {
+		ret = append(ret, acct)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Returns the account that name refers to, in strkey format, so that
+// people can name accounts the way they think of them.  name is
+// returned unchanged if it is already an account (G...) or muxed
+// account (M...) in strkey format.  Otherwise, it may be the exact
+// comment of an account or Ed25519 signer in net's address book, or
+// the name of a key in net's KeyStore (by default, a key stored in
+// $STCDIR/keys by the stc command's -keygen NAME), in which case the
+// key's public key is returned after prompting for its passphrase if
+// the key is encrypted.  Address-book names take precedence over key
+// names.  Fails if name refers to no account or to several accounts
+// in the address book.  TxFromRep and the stc command both resolve
+// accounts this way.
+func (net *StellarNet) ResolveAccount(name string) (string, error) {
+	var ma stx.MuxedAccount
+	strkeyErr := ma.UnmarshalText([]byte(name))
+	if strkeyErr == nil {
+		return name, nil
+	}
+	switch accts := net.addressBookAccounts(name); len(accts) {
+	case 0:
+	case 1:
+		return accts[0], nil
+	default:
+		return "", fmt.Errorf("account name %q is ambiguous (%s)",
+			name, strings.Join(accts, ", "))
+	}
+	if sk, err := net.GetKeyStore().LoadKey(name); err == nil {
+		return sk.Public().String(), nil
+	} else if err != ErrNoSuchKey {
+		return "", fmt.Errorf("key %s: %s", name, err)
+	}
+	if len(name) >= 56 && strings.IndexFunc(name, func(c rune) bool {
+		return !stx.IsStrKeyChar(c)
+	}) < 0 {
+		// Probably a mistyped strkey rather than a name
+		return "", strkeyErr
+	}
+	return "", fmt.Errorf("unknown account %q", stcdetail.Redact(name))
+}
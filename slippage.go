@@ -0,0 +1,194 @@
+package stc
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// The exchange a path payment operation asks for.  For
+// PATH_PAYMENT_STRICT_SEND, SendAmount is exact and DestAmount is the
+// least the destination may receive (destMin).  For
+// PATH_PAYMENT_STRICT_RECEIVE, DestAmount is exact and SendAmount is
+// the most the source may send (sendMax).  Either way, the operation
+// fails rather than exchange at a worse rate than
+// DestAmount/SendAmount.
+type PathPaymentLimits struct {
+	// Index of the operation in the transaction
+	Op         int
+	StrictSend bool
+	SendAsset  stx.Asset
+	SendAmount int64
+	DestAsset  stx.Asset
+	DestAmount int64
+}
+
+// Returns the limits of each path payment in e.
+func PathPayments(e *TransactionEnvelope) []PathPaymentLimits {
+	_, ops := txSourceOps(e.TransactionEnvelope)
+	var ret []PathPaymentLimits
+	for i := range ops {
+		switch ops[i].Body.Type {
+		case stx.PATH_PAYMENT_STRICT_SEND:
+			op := ops[i].Body.PathPaymentStrictSendOp()
+			ret = append(ret, PathPaymentLimits{
+				Op:         i,
+				StrictSend: true,
+				SendAsset:  op.SendAsset,
+				SendAmount: op.SendAmount,
+				DestAsset:  op.DestAsset,
+				DestAmount: op.DestMin,
+			})
+		case stx.PATH_PAYMENT_STRICT_RECEIVE:
+			op := ops[i].Body.PathPaymentStrictReceiveOp()
+			ret = append(ret, PathPaymentLimits{
+				Op:         i,
+				SendAsset:  op.SendAsset,
+				SendAmount: op.SendMax,
+				DestAsset:  op.DestAsset,
+				DestAmount: op.DestAmount,
+			})
+		}
+	}
+	return ret
+}
+
+// Returns the worst exchange rate the path payment accepts, in units
+// of DestAsset per unit of SendAsset, or 0 if SendAmount is not
+// positive.
+func (l *PathPaymentLimits) WorstRate() float64 {
+	if l.SendAmount <= 0 {
+		return 0
+	}
+	return float64(l.DestAmount) / float64(l.SendAmount)
+}
+
+// Error returned by BestPath when the order books currently offer no
+// way to make a path payment.
+var ErrNoPath = horizonFailure("no path found between assets")
+
+func horizonAssetParams(v url.Values, prefix string, a *stx.Asset) {
+	switch a.Type {
+	case stx.ASSET_TYPE_NATIVE:
+		v.Set(prefix+"_type", "native")
+		return
+	case stx.ASSET_TYPE_CREDIT_ALPHANUM4:
+		v.Set(prefix+"_type", "credit_alphanum4")
+	default:
+		v.Set(prefix+"_type", "credit_alphanum12")
+	}
+	parts := strings.SplitN(a.String(), ":", 2)
+	v.Set(prefix+"_code", parts[0])
+	v.Set(prefix+"_issuer", parts[1])
+}
+
+// Formats an amount in stroops as horizon expects in queries.
+func horizonAmount(v int64) string {
+	bs, _ := stcdetail.JsonInt64e7(v).MarshalText()
+	return string(bs)
+}
+
+// Asks horizon for the best path currently available for a path
+// payment.  For strict send, returns the most of DestAsset that
+// SendAmount can buy; for strict receive, returns the least of
+// SendAsset needed to buy DestAmount.  Returns ErrNoPath if no path
+// exists.
+func (net *StellarNet) BestPath(l *PathPaymentLimits) (int64, error) {
+	v := url.Values{}
+	var query string
+	if l.StrictSend {
+		horizonAssetParams(v, "source_asset", &l.SendAsset)
+		v.Set("source_amount", horizonAmount(l.SendAmount))
+		v.Set("destination_assets", l.DestAsset.String())
+		query = "paths/strict-send?"
+	} else {
+		horizonAssetParams(v, "destination_asset", &l.DestAsset)
+		v.Set("destination_amount", horizonAmount(l.DestAmount))
+		v.Set("source_assets", l.SendAsset.String())
+		query = "paths/strict-receive?"
+	}
+	var j struct {
+		Embedded struct {
+			Records []struct {
+				Source_amount      stcdetail.JsonInt64e7
+				Destination_amount stcdetail.JsonInt64e7
+			}
+		} `json:"_embedded"`
+	}
+	if err := net.GetJSON(query+v.Encode(), &j); err != nil {
+		return 0, err
+	}
+	var best int64
+	for i, r := range j.Embedded.Records {
+		if l.StrictSend && (i == 0 || int64(r.Destination_amount) > best) {
+			best = int64(r.Destination_amount)
+		} else if !l.StrictSend &&
+			(i == 0 || int64(r.Source_amount) < best) {
+			best = int64(r.Source_amount)
+		}
+	}
+	if len(j.Embedded.Records) == 0 {
+		return 0, ErrNoPath
+	}
+	return best, nil
+}
+
+// Compares each path payment in e with the best path horizon
+// currently finds, and returns a warning for each one that could not
+// execute now or that tolerates a worse exchange rate than the
+// current one by more than maxSlippage (e.g., 0.05 for 5%).
+func (net *StellarNet) SlippageWarnings(e *TransactionEnvelope,
+	maxSlippage float64) []string {
+	var ret []string
+	for _, l := range PathPayments(e) {
+		send := net.assetName(&l.SendAsset)
+		dest := net.assetName(&l.DestAsset)
+		best, err := net.BestPath(&l)
+		if err == ErrNoPath {
+			ret = append(ret, fmt.Sprintf("operation %d: no path currently "+
+				"exchanges %s for %s", l.Op, send, dest))
+			continue
+		} else if err != nil {
+			ret = append(ret, fmt.Sprintf("operation %d: cannot find "+
+				"paths: %s", l.Op, err))
+			continue
+		}
+		var slippage float64
+		if l.StrictSend {
+			if best < l.DestAmount {
+				ret = append(ret, fmt.Sprintf("operation %d: would fail, "+
+					"since %s %s currently buys at most %s %s, less than "+
+					"destMin", l.Op, stcdetail.ScaleFmt(l.SendAmount, 7),
+					send, stcdetail.ScaleFmt(best, 7), dest))
+				continue
+			}
+			slippage = 1 - float64(l.DestAmount)/float64(best)
+		} else {
+			if best > l.SendAmount {
+				ret = append(ret, fmt.Sprintf("operation %d: would fail, "+
+					"since %s %s currently costs at least %s %s, more than "+
+					"sendMax", l.Op, stcdetail.ScaleFmt(l.DestAmount, 7),
+					dest, stcdetail.ScaleFmt(best, 7), send))
+				continue
+			}
+			slippage = 1 - float64(best)/float64(l.SendAmount)
+		}
+		if slippage > maxSlippage {
+			ret = append(ret, fmt.Sprintf("operation %d: accepts %.1f%% "+
+				"worse exchange of %s for %s than the current best path",
+				l.Op, 100*slippage, send, dest))
+		}
+	}
+	return ret
+}
+
+// Returns the asset code, or the network's name for the native asset.
+func (net *StellarNet) assetName(a *stx.Asset) string {
+	if a.Type == stx.ASSET_TYPE_NATIVE {
+		return net.GetNativeAsset()
+	}
+	return strings.SplitN(a.String(), ":", 2)[0]
+}
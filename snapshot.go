@@ -0,0 +1,199 @@
+package stc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// An AccountSnapshot holds the ledger entries that make up an
+// account's state:  the AccountEntry itself, followed by its
+// trustlines, offers, and data entries.  In text form, each entry is
+// in txrep format, preceded by a header line naming the entry:
+//
+//	--- account GABC...
+//	--- trustline GABC...[USD:GDEF...]
+//
+// Lines before the first header may contain only comments.  The
+// headers are for people reading the snapshot; the entries they
+// precede determine the contents.
+type AccountSnapshot []stx.LedgerEntry
+
+// Prefix of the header line that starts each entry of a snapshot.
+const snapshotHeader = "--- "
+
+// Returns true if input looks like an AccountSnapshot in text form,
+// meaning the first line that is neither blank nor a comment is a
+// snapshot header.
+func IsAccountSnapshot(input string) bool {
+	for _, line := range strings.Split(input, "\n") {
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+			return strings.HasPrefix(line, snapshotHeader)
+		}
+	}
+	return false
+}
+
+// Fetches the current state of account acct over the network.  As
+// with GetLedgerEntry, horizon does not say when data entries were
+// last modified or whether offers are passive, so these fields are
+// left zero.
+func (net *StellarNet) GetAccountSnapshot(acct string) (
+	AccountSnapshot, error) {
+	body, err := net.Get("accounts/" + acct)
+	if err != nil {
+		return nil, err
+	}
+	ret := AccountSnapshot{{}}
+	if err = accountLedgerEntryFromJSON(body, &ret[0]); err != nil {
+		return nil, err
+	}
+	id := ret[0].Data.Account().AccountID
+
+	tls, err := trustLinesFromJSON(id, body)
+	if err != nil {
+		return nil, err
+	}
+	ret = append(ret, tls...)
+
+	err = net.Iterate(context.Background(),
+		"accounts/"+acct+"/offers", nil, func(o *horizonOffer) {
+			ret = append(ret, stx.LedgerEntry{})
+			o.ledgerEntry(&ret[len(ret)-1])
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var j struct{ Data map[string]HorizonDataValue }
+	if err = json.Unmarshal(body, &j); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(j.Data))
+	for name := range j.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var e stx.LedgerEntry
+		e.Data.Type = stx.DATA
+		d := e.Data.Data()
+		d.AccountID = id
+		d.DataName = name
+		d.DataValue = j.Data[name].Bytes()
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
+
+// Renders an AccountSnapshot in text form, with each entry in txrep.
+func (net *StellarNet) SnapshotToRep(s AccountSnapshot) string {
+	out := &strings.Builder{}
+	for i := range s {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(out, "%s%s\n", snapshotHeader,
+			showLedgerKey(stcdetail.GetLedgerEntryKey(&s[i])))
+		out.WriteString(net.ToRep(&s[i]))
+	}
+	return out.String()
+}
+
+// Parses an AccountSnapshot in text form.  Errors are of type
+// stcdetail.TxrepError, with line numbers counted from the start of
+// input.
+func SnapshotFromRep(input string) (AccountSnapshot, error) {
+	var s AccountSnapshot
+	var errs stcdetail.TxrepError
+	fail := func(line int, f string, args ...interface{}) {
+		errs = append(errs, struct {
+			Line int
+			Msg  string
+		}{line, fmt.Sprintf(f, args...)})
+	}
+	lines := strings.SplitAfter(input, "\n")
+	parse := func(start, end int) {
+		if start == 0 {
+			return
+		}
+		s = append(s, stx.LedgerEntry{})
+		if te := stcdetail.XdrFromTxrep(strings.NewReader(
+			strings.Join(lines[start:end], "")), "",
+			&s[len(s)-1]); te != nil {
+			for i := range te {
+				fail(te[i].Line+start, "%s", te[i].Msg)
+			}
+		}
+	}
+	start := 0
+	for i, line := range lines {
+		if !strings.HasPrefix(line, snapshotHeader) {
+			if trimmed := strings.TrimSpace(line); start == 0 &&
+				trimmed != "" && trimmed[0] != '#' {
+				fail(i+1, "expected %q line", snapshotHeader+"ENTRY")
+				return nil, errs
+			}
+			continue
+		}
+		parse(start, i)
+		start = i + 1
+	}
+	parse(start, len(lines))
+	if len(s) == 0 {
+		fail(1, "snapshot contains no ledger entries")
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return s, nil
+}
+
+// Describes how account state changed between snapshots a and b, in
+// the same format as AccountDelta:  a line saying which entries were
+// created, updated, or deleted, followed by the fields that changed.
+// When a ledger entry changes, so does the ledger in which it was last
+// modified, so LastModifiedLedgerSeq is ignored.  Returns the empty
+// string if nothing changed.
+func (net *StellarNet) SnapshotDiff(a, b AccountSnapshot,
+	prefix string) string {
+	pprefix := prefix + "  "
+	out := &strings.Builder{}
+	rep := func(e *stx.LedgerEntry) string {
+		return net.ToRep(&e.Data)
+	}
+	key := func(e *stx.LedgerEntry) string {
+		k := stcdetail.GetLedgerEntryKey(e)
+		return stcdetail.XdrToBin(&k)
+	}
+	old := make(map[string]*stx.LedgerEntry, len(a))
+	for i := range a {
+		old[key(&a[i])] = &a[i]
+	}
+	seen := make(map[string]bool, len(b))
+	for i := range b {
+		k := key(&b[i])
+		seen[k] = true
+		ks := showLedgerKey(stcdetail.GetLedgerEntryKey(&b[i]))
+		if ae, ok := old[k]; !ok {
+			fmt.Fprintf(out, "%screated %s\n%s", prefix, ks,
+				stcdetail.RepDiff(pprefix, "", rep(&b[i])))
+		} else if diff := stcdetail.RepDiff(pprefix, rep(ae),
+			rep(&b[i])); diff != "" {
+			fmt.Fprintf(out, "%supdated %s\n%s", prefix, ks, diff)
+		}
+	}
+	for i := range a {
+		if !seen[key(&a[i])] {
+			fmt.Fprintf(out, "%sdeleted %s\n%s", prefix,
+				showLedgerKey(stcdetail.GetLedgerEntryKey(&a[i])),
+				stcdetail.RepDiff(pprefix, rep(&a[i]), ""))
+		}
+	}
+	return out.String()
+}
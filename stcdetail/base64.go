@@ -1,8 +1,12 @@
 package stcdetail
 
 import (
+	"bufio"
 	"encoding/base64"
 	"github.com/xdrpp/goxdr/xdr"
+	"io"
+	"io/ioutil"
+	"net/url"
 	"strings"
 )
 
@@ -20,7 +24,13 @@ func XdrToBase64(es ...xdr.XdrType) string {
 	return out.String()
 }
 
+// Number of base64 characters XdrFromBase64 decodes at a time.
+const base64Chunk = 4096
+
 // Parse base64-encoded binary XDR into an XDR aggregate structure.
+// The base64 is decoded a piece at a time into a single buffer, which
+// variable-length opaque fields of e then share, so that even a large
+// envelope is copied only once.
 func XdrFromBase64(e xdr.XdrType, input string) (err error) {
 	defer func() {
 		if i := recover(); i != nil {
@@ -31,8 +41,181 @@ func XdrFromBase64(e xdr.XdrType, input string) (err error) {
 			return
 		}
 	}()
-	in := strings.NewReader(input)
-	b64i := base64.NewDecoder(base64.StdEncoding, in)
-	e.XdrMarshal(&xdr.XdrIn{b64i}, "")
+	if len(input)%4 != 0 || strings.ContainsAny(input, "\r\n") {
+		// Let base64.NewDecoder decide what to make of these
+		in := strings.NewReader(input)
+		b64i := base64.NewDecoder(base64.StdEncoding, in)
+		e.XdrMarshal(&xdrReaderIn{in: b64i}, "")
+		return nil
+	}
+	buf := make([]byte, base64.StdEncoding.DecodedLen(len(input)))
+	var chunk [base64Chunk]byte
+	n := 0
+	for off := 0; off < len(input); off += base64Chunk {
+		m := copy(chunk[:], input[off:])
+		k, err := base64.StdEncoding.Decode(buf[n:], chunk[:m])
+		if ce, ok := err.(base64.CorruptInputError); ok {
+			return ce + base64.CorruptInputError(off)
+		} else if err != nil {
+			return err
+		} else if k < m/4*3 && off+m < len(input) {
+			// Padding before the end of the input
+			return base64.CorruptInputError(off +
+				strings.IndexByte(string(chunk[:m]), '='))
+		}
+		n += k
+	}
+	e.XdrMarshal(&xdrSliceIn{buf: buf[:n]}, "")
 	return nil
 }
+
+func isBase64Space(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// Value of base64Token.next at the end of the token
+const tokenEnd = -2
+
+// Reads from in up to the next whitespace or the end of input,
+// starting with next if it is a byte that has already been read.
+type base64Token struct {
+	in   io.ByteReader
+	next int
+}
+
+func (t *base64Token) Read(p []byte) (n int, err error) {
+	for n < len(p) && t.next != tokenEnd {
+		if t.next < 0 {
+			var c byte
+			if c, err = t.in.ReadByte(); err == io.EOF {
+				t.next, err = tokenEnd, nil
+				break
+			} else if err != nil {
+				return
+			}
+			t.next = int(c)
+		}
+		if c := byte(t.next); isBase64Space(c) {
+			t.next = tokenEnd
+		} else {
+			p[n] = c
+			n++
+			t.next = -1
+		}
+	}
+	if n == 0 && t.next == tokenEnd {
+		err = io.EOF
+	}
+	return
+}
+
+// Reads the next base64-encoded binary XDR value from in into e,
+// decoding it as it goes, so that neither the base64 nor the binary
+// XDR is ever held in memory in full.  Skips whitespace before the
+// value, which ends at the next whitespace or the end of input.
+// Returns io.EOF if in holds nothing but whitespace.  To read a
+// stream of several values, such as one transaction per line, pass a
+// *bufio.Reader or other io.ByteReader, of which each call consumes
+// exactly one value and the whitespace character after it.  Other
+// Readers are wrapped in a bufio.Reader, which may read past the
+// value.
+func XdrFromBase64Reader(e xdr.XdrType, in io.Reader) (err error) {
+	br, ok := in.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(in)
+	}
+	tok := &base64Token{in: br, next: -1}
+	for tok.next < 0 {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		} else if !isBase64Space(c) {
+			tok.next = int(c)
+		}
+	}
+	defer func() {
+		if i := recover(); i != nil {
+			var ok bool
+			if err, ok = i.(error); !ok {
+				panic(i)
+			}
+		}
+		// Leave br at the start of the next value
+		io.Copy(ioutil.Discard, tok)
+	}()
+	b64i := base64.NewDecoder(base64.StdEncoding, tok)
+	e.XdrMarshal(&xdrReaderIn{in: b64i}, "")
+	var extra [1]byte
+	if _, err = io.ReadFull(b64i, extra[:]); err == io.EOF {
+		return nil
+	} else if err == nil {
+		err = xdr.XdrError("trailing data after base64 XDR")
+	}
+	return
+}
+
+// Returns the query parameter xdr of a URL, including one in a
+// fragment such as Stellar Laboratory's "#txsigner?xdr=...".
+func xdrURLParam(input string) string {
+	u, err := url.Parse(input)
+	if err != nil {
+		return ""
+	}
+	x := u.Query().Get("xdr")
+	if i := strings.IndexByte(u.Fragment, '?'); x == "" && i >= 0 {
+		if q, err := url.ParseQuery(u.Fragment[i+1:]); err == nil {
+			x = q.Get("xdr")
+		}
+	}
+	// An unescaped '+' in a query means space, but not in base64
+	return strings.ReplaceAll(x, " ", "+")
+}
+
+// Extracts base64-encoded data from text a user might paste:  base64
+// with surrounding whitespace or quotes or broken across lines,
+// URL-safe base64 (RFC 4648 section 5) with or without padding, a
+// percent-encoded string, a "data:" URI, or an http or https URL
+// (such as a Stellar Laboratory link) with the base64 in an xdr
+// parameter.  Returns the data in standard base64 and true, or "" and
+// false if input does not contain valid non-empty base64.
+func ExtractBase64(input string) (string, bool) {
+	s := strings.TrimSpace(input)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	if strings.HasPrefix(s, "data:") {
+		i := strings.IndexByte(s, ',')
+		if i < 0 || !strings.HasSuffix(s[:i], ";base64") {
+			return "", false
+		}
+		s = s[i+1:]
+	} else if strings.HasPrefix(s, "https://") ||
+		strings.HasPrefix(s, "http://") {
+		s = xdrURLParam(s)
+	}
+	if strings.IndexByte(s, '%') >= 0 {
+		var err error
+		if s, err = url.PathUnescape(s); err != nil {
+			return "", false
+		}
+	}
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		case '-':
+			return '+'
+		case '_':
+			return '/'
+		}
+		return r
+	}, s)
+	if n := len(s) % 4; n != 0 && !strings.HasSuffix(s, "=") {
+		s += strings.Repeat("=", 4-n)
+	}
+	if bs, err := base64.StdEncoding.DecodeString(s); err != nil ||
+		len(bs) == 0 {
+		return "", false
+	}
+	return s, true
+}
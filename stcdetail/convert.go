@@ -0,0 +1,99 @@
+package stcdetail
+
+import (
+	"encoding/hex"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xdrpp/stc/stx"
+)
+
+// Renders a transaction envelope as text for ConvertAll.  Besides the
+// formats below, callers may supply their own (for instance, one that
+// annotates txrep with the comments in a network's address book), but
+// ConvertAll calls it from several goroutines at once.
+type TxFormat func(e *stx.TransactionEnvelope) (string, error)
+
+// Predefined TxFormats.  Like the stc command's output, each result
+// ends with a newline.
+var (
+	// Txrep, without annotations.  A transaction containing illegal
+	// values produces both output and an XdrBadValue error.
+	TxrepFormat TxFormat = func(e *stx.TransactionEnvelope) (string, error) {
+		var out strings.Builder
+		err := WriteTxrep(&out, "", e)
+		return out.String(), err
+	}
+	// Base64-encoded binary XDR
+	Base64Format TxFormat = func(e *stx.TransactionEnvelope) (string, error) {
+		return XdrToBase64(e) + "\n", nil
+	}
+	// Hex-encoded binary XDR
+	HexFormat TxFormat = func(e *stx.TransactionEnvelope) (string, error) {
+		return hex.EncodeToString([]byte(XdrToBin(e))) + "\n", nil
+	}
+	// JSON in the format of XdrToJson
+	JSONFormat TxFormat = func(e *stx.TransactionEnvelope) (string, error) {
+		out, err := XdrToJson(e)
+		return string(out), err
+	}
+)
+
+// Result of converting one input with ConvertAll.
+type ConvertResult struct {
+	Output string
+	Err    error
+}
+
+var errConvertInput = errors.New("input is not a base64 XDR transaction")
+
+func convertOne(input string, format TxFormat) (ret ConvertResult) {
+	b64, ok := ExtractBase64(input)
+	if !ok {
+		ret.Err = errConvertInput
+		return
+	}
+	var e stx.TransactionEnvelope
+	if ret.Err = XdrFromBase64(&e, b64); ret.Err == nil {
+		ret.Output, ret.Err = format(&e)
+	}
+	return
+}
+
+// Converts a batch of transaction envelopes to format, such as the
+// thousands of transactions in a history archive checkpoint, using
+// workers goroutines (or one per CPU if workers <= 0) so as to keep
+// every core busy.  Each input is a transaction envelope in
+// base64-encoded binary XDR, or any text that ExtractBase64 accepts.
+// Returns one result per input, in the same order as inputs; a bad
+// input only affects its own result.
+func ConvertAll(inputs []string, format TxFormat,
+	workers int) []ConvertResult {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(inputs) {
+		workers = len(inputs)
+	}
+	results := make([]ConvertResult, len(inputs))
+	next := int64(-1)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(inputs) {
+					return
+				}
+				results[i] = convertOne(inputs[i], format)
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
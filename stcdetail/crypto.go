@@ -13,6 +13,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
 // Computes the SHA-256 hash of an arbitrary XDR data structure.
@@ -55,20 +58,88 @@ func Verify(pk *stx.PublicKey, message []byte, sig []byte) bool {
 // Verify the signature on a transaction.
 func VerifyTx(pk *stx.SignerKey, network string, tx stx.Signable,
 	sig []byte) bool {
-	switch pk.Type {
+	if pk.Type == stx.SIGNER_KEY_TYPE_HASH_X {
+		// Does not depend on the transaction, so skip hashing it
+		return VerifyPair{Key: pk, Sig: sig}.Verify()
+	}
+	return VerifyPair{pk, TxPayloadHash(network, tx), sig}.Verify()
+}
+
+// A signature to check with VerifyParallel:  Sig is a signature by Key
+// on the transaction whose TxPayloadHash is Hash.
+type VerifyPair struct {
+	Key  *stx.SignerKey
+	Hash *stx.Hash
+	Sig  []byte
+}
+
+// Returns true if p.Sig is a valid signature, with the same meaning
+// as VerifyTx.  Hash may be nil for SIGNER_KEY_TYPE_HASH_X keys; for
+// other keys, a nil Hash makes the signature invalid.
+func (p VerifyPair) Verify() bool {
+	if p.Key == nil ||
+		(p.Hash == nil && p.Key.Type != stx.SIGNER_KEY_TYPE_HASH_X) {
+		return false
+	}
+	switch p.Key.Type {
 	case stx.SIGNER_KEY_TYPE_ED25519:
-		return ed25519.Verify(pk.Ed25519()[:],
-			TxPayloadHash(network, tx)[:], sig)
+		return ed25519.Verify(p.Key.Ed25519()[:], p.Hash[:], p.Sig)
 	case stx.SIGNER_KEY_TYPE_PRE_AUTH_TX:
-		return bytes.Equal(TxPayloadHash(network, tx)[:], pk.PreAuthTx()[:])
+		return bytes.Equal(p.Hash[:], p.Key.PreAuthTx()[:])
 	case stx.SIGNER_KEY_TYPE_HASH_X:
-		x := sha256.Sum256(sig)
-		return bytes.Equal(x[:], pk.HashX()[:])
+		x := sha256.Sum256(p.Sig)
+		return bytes.Equal(x[:], p.Key.HashX()[:])
 	default:
 		return false
 	}
 }
 
+// Fewest signatures per goroutine VerifyParallel will use.  Below
+// this, starting a goroutine costs more than the verifications it
+// saves.
+const minVerifyBatch = 4
+
+// Checks many signatures, as when finding which of the signatures on
+// a multi-operation envelope belong to which of several accounts'
+// signers, and returns whether each is valid, in order.  This is not
+// batch ed25519 verification, which checks many signatures at once in
+// less time than checking them one by one:  each signature is checked
+// on its own with VerifyPair.Verify, in goroutines spread over all
+// CPUs.  To save work, compute each payload hash once with
+// TxPayloadHash and share it among the pairs for that transaction,
+// rather than having VerifyTx recompute it for every key and
+// signature.
+func VerifyParallel(pairs []VerifyPair) []bool {
+	ret := make([]bool, len(pairs))
+	workers := runtime.NumCPU()
+	if n := len(pairs) / minVerifyBatch; n < workers {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := range pairs {
+			ret[i] = pairs[i].Verify()
+		}
+		return ret
+	}
+	next := int64(-1)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(pairs) {
+					return
+				}
+				ret[i] = pairs[i].Verify()
+			}
+		}()
+	}
+	wg.Wait()
+	return ret
+}
+
 type PrivateKeyInterface interface {
 	String() string
 	Sign([]byte) ([]byte, error)
@@ -104,9 +175,9 @@ func NewEd25519Priv() Ed25519Priv {
 // read.  If set to a terminal, then a prompt will be displayed and
 // echo will be disabled while the user types the passphrase.  The
 // default is os.Stdin.  If set to nil, then GetPass will attempt to
-// open /dev/tty.  Set it to io.MultiReader() (i.e., an io.Reader that
-// always returns EOF) to assume an empty passphrase every time
-// GetPass is called.
+// open the terminal (/dev/tty, or CONIN$ on Windows).  Set it to
+// io.MultiReader() (i.e., an io.Reader that always returns EOF) to
+// assume an empty passphrase every time GetPass is called.
 var PassphraseFile io.Reader = os.Stdin
 
 // If PassphraseFile is a terminal, then the user will be prompted for
@@ -122,16 +193,17 @@ func getTtyFd(f interface{}) int {
 }
 
 // Read a passphrase from PassphraseFile and return it as a byte
-// array.  If PassphraseFile is nil, attempt to open "/dev/tty".  If
-// PassphraseFile is a terminal, then write prompt to PassphrasePrompt
-// before reading the passphrase and disable echo.
+// array.  If PassphraseFile is nil, attempt to open the terminal
+// ("/dev/tty", or the console on Windows).  If PassphraseFile is a
+// terminal, then write prompt to PassphrasePrompt before reading the
+// passphrase and disable echo.  The passphrase is
+// registered with AddSecret, so that Redact keeps it out of output.
 func GetPass(prompt string) []byte {
 	if PassphraseFile == nil {
-		var err error
-		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		in, out, err := openTty()
 		if err == nil {
-			PassphraseFile = tty
-			PassphrasePrompt = tty
+			PassphraseFile = in
+			PassphrasePrompt = out
 		} else {
 			fmt.Fprintln(os.Stderr, err.Error())
 			PassphraseFile = io.MultiReader()
@@ -143,9 +215,11 @@ func GetPass(prompt string) []byte {
 		fmt.Fprint(PassphrasePrompt, prompt)
 		bytePassword, _ := terminal.ReadPassword(fd)
 		fmt.Fprintln(PassphrasePrompt, "")
+		AddSecret(bytePassword)
 		return bytePassword
 	} else {
 		line, _ := ReadTextLine(PassphraseFile)
+		AddSecret(line)
 		return line
 	}
 }
@@ -1,13 +1,22 @@
 package stcdetail_test
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"github.com/xdrpp/goxdr/xdr"
 	"github.com/xdrpp/stc"
 	. "github.com/xdrpp/stc/stcdetail"
 	"github.com/xdrpp/stc/stx"
+	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -128,6 +137,46 @@ func ExampleXdrToJson() {
 	// }
 }
 
+func ExampleXdrToCanonicalJSON() {
+	var mykey stc.PrivateKey
+	fmt.Sscan("SDWHLWL24OTENLATXABXY5RXBG6QFPLQU7VMKFH4RZ7EWZD2B7YRAYFS",
+		&mykey)
+
+	txe := stc.NewTransactionEnvelope()
+	txe.SetSourceAccount(mykey.Public())
+	txe.V1().Tx.SeqNum = 3319833626148865
+	txe.V1().Tx.Memo = stc.MemoText("<\"Hi\">\n")
+	txe.Append(nil, stc.BumpSequence{BumpTo: 3319833626148870})
+	txe.SetFee(100)
+
+	j, _ := XdrToCanonicalJSON(txe)
+	fmt.Println(string(j))
+
+	// Output:
+	// {"signatures":[],"tx":{"ext":{"v":0},"fee":100,"memo":{"text":"<\"Hi\">\n","type":"MEMO_TEXT"},"operations":[{"body":{"bumpSequenceOp":{"bumpTo":"3319833626148870"},"type":"BUMP_SEQUENCE"},"sourceAccount":null}],"seqNum":"3319833626148865","sourceAccount":"GDFR4HZMNZCNHFEIBWDQCC4JZVFQUGXUQ473EJ4SUPFOJ3XBG5DUCS2G","timeBounds":null},"type":"ENVELOPE_TYPE_TX"}
+}
+
+func TestCanonicalJSONInvalidUTF8(t *testing.T) {
+	var js [][]byte
+	for _, memo := range []string{"a\xff", "a\xfe", "a\ufffd"} {
+		txe := stc.NewTransactionEnvelope()
+		txe.V1().Tx.Memo = stc.MemoText(memo)
+		j, err := XdrToCanonicalJSON(txe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range js {
+			if bytes.Equal(js[i], j) {
+				t.Errorf("memos %d and %d both format as %s", i, len(js), j)
+			}
+		}
+		js = append(js, j)
+	}
+	if !bytes.Contains(js[0], []byte(`"text":{"base64":"Yf8="}`)) {
+		t.Errorf("invalid UTF-8 formatted as %s", js[0])
+	}
+}
+
 func TestJsonToXdr(t *testing.T) {
 	var mykey stc.PrivateKey
 	fmt.Sscan("SDWHLWL24OTENLATXABXY5RXBG6QFPLQU7VMKFH4RZ7EWZD2B7YRAYFS",
@@ -307,7 +356,7 @@ func ExampleGetTxrepField() {
 	op0src := "tx.operations[0].sourceAccount"
 	*GetTxrepField(txe, op0src).XdrPointer().(**stx.MuxedAccount) = &a2
 
-	XdrToTxrep(os.Stdout, "", txe)
+	WriteTxrep(os.Stdout, "", txe)
 	// output:
 	// type: ENVELOPE_TYPE_TX
 	// tx.sourceAccount: GATPALHEEUERWYW275QDBNBMCM4KEHYJU34OPIZ6LKJAXK6B4IJ73V4L
@@ -325,3 +374,896 @@ func ExampleGetTxrepField() {
 	// tx.ext.v: 0
 	// signatures.len: 0
 }
+
+// Accepts the first limit bytes written to it, then fails.
+type limitWriter struct {
+	limit int
+	short bool
+	strings.Builder
+}
+
+var errWriteLimit = errors.New("write limit reached")
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if left := w.limit - w.Len(); len(p) > left {
+		w.Builder.Write(p[:left])
+		if w.short {
+			return left, nil
+		}
+		return left, errWriteLimit
+	}
+	return w.Builder.Write(p)
+}
+
+func TestWriteTxrepWriteError(t *testing.T) {
+	txe := stc.NewTransactionEnvelope()
+	for i := 0; i < 10; i++ {
+		txe.Append(nil, &stc.Payment{Amount: 1000})
+	}
+	var full strings.Builder
+	if err := WriteTxrep(&full, "", txe); err != nil {
+		t.Fatal(err)
+	}
+	for _, short := range []bool{false, true} {
+		w := &limitWriter{limit: full.Len() / 2, short: short}
+		err := WriteTxrep(w, "", txe)
+		if short && err != io.ErrShortWrite ||
+			!short && err != errWriteLimit {
+			t.Errorf("short=%v: WriteTxrep returned %v", short, err)
+		} else if w.Len() != w.limit {
+			t.Errorf("short=%v: wrote %d bytes", short, w.Len())
+		}
+		w.Reset()
+		if err = stc.DefaultStellarNet("test").WriteTxRep(w,
+			txe); err == nil {
+			t.Errorf("short=%v: WriteTxRep returned nil", short)
+		}
+	}
+}
+
+func TestXdrToTxrep(t *testing.T) {
+	txe := stc.NewTransactionEnvelope()
+	txe.Append(nil, &stc.Payment{Amount: 1000})
+	w := &limitWriter{limit: 10}
+	if bv := XdrToTxrep(w, "", txe); bv != nil {
+		t.Errorf("XdrToTxrep reported %v for write error", bv)
+	}
+	txe.V1().Tx.Memo.Type = 99
+	var out strings.Builder
+	if bv := XdrToTxrep(&out, "", txe); len(bv) != 1 ||
+		!strings.Contains(bv[0].Field, "memo") {
+		t.Errorf("XdrToTxrep returned %v for bad memo type", bv)
+	}
+}
+
+func TestQuoteSEP11(t *testing.T) {
+	for _, s := range []string{"", "plain text", "\"\\\n\t\x00\x7f\xff",
+		"café"} {
+		q := QuoteSEP11(s)
+		for i := 0; i < len(q); i++ {
+			if q[i] < 0x20 || q[i] >= 0x7f {
+				t.Errorf("QuoteSEP11(%q) contains byte 0x%02x", s, q[i])
+			}
+		}
+		if u, rest, err := UnquoteSEP11(q + " comment"); err != nil {
+			t.Errorf("UnquoteSEP11(%s): %s", q, err)
+		} else if u != s || rest != " comment" {
+			t.Errorf("UnquoteSEP11(%s) = %q, %q", q, u, rest)
+		}
+	}
+	for _, q := range []string{`abc`, `"abc`, `"\t"`, `"é"`, `"\x4"`,
+		"\"\x01\""} {
+		if _, _, err := UnquoteSEP11(q); err == nil {
+			t.Errorf("UnquoteSEP11 accepted invalid string %s", q)
+		}
+	}
+}
+
+func TestTxrepSourceMap(t *testing.T) {
+	txe := stc.NewTransactionEnvelope()
+	txe.Append(nil, &stc.Payment{Amount: 1000})
+	txe.Append(nil, &stc.ManageData{DataName: "example"})
+	*txe.Signatures() = make([]stx.DecoratedSignature, 1)
+	bin := XdrToBin(txe)
+	rep := "\n" + stc.DefaultStellarNet("test").TxToRep(txe)
+	pos := 0
+	for _, span := range TxrepSourceMap(txe) {
+		if span.Offset != pos {
+			t.Errorf("%s starts at %d, not %d", span.Field, span.Offset, pos)
+		}
+		if !strings.Contains(rep, "\n" + span.Field + ": ") {
+			t.Errorf("%s is not a txrep field", span.Field)
+		}
+		pos += span.Length
+	}
+	if pos != len(bin) {
+		t.Errorf("source map covers %d of %d bytes", pos, len(bin))
+	}
+}
+
+func TestForEachXdrField(t *testing.T) {
+	txe := stc.NewTransactionEnvelope()
+	txe.Append(nil, &stc.Payment{Amount: 1000})
+	txe.Append(nil, &stc.Payment{Amount: 2000})
+	var names []string
+	ForEachXdrField(txe, func(name string, depth int,
+		val xdr.XdrType) XdrWalk {
+		if _, ok := val.(*stx.PaymentOp); ok {
+			names = append(names, name)
+			return XdrWalkStop
+		} else if name == "tx.memo" {
+			return XdrWalkPrune
+		} else if strings.HasPrefix(name, "tx.memo.") {
+			t.Errorf("visited %s inside pruned value", name)
+		}
+		return XdrWalkInto
+	})
+	if len(names) != 1 || names[0] != "tx.operations[0].body.paymentOp" {
+		t.Errorf("unexpected visits %v", names)
+	} else if GetTxrepField(txe, names[0]) == nil {
+		t.Errorf("GetTxrepField does not accept name %s", names[0])
+	}
+}
+
+func TestGetTxrepFields(t *testing.T) {
+	txe := stc.NewTransactionEnvelope()
+	txe.Append(nil, &stc.Payment{Amount: 1000})
+	txe.Append(nil, &stc.ManageData{DataName: "example"})
+	txe.Append(nil, &stc.Payment{Amount: 3000})
+	fields := GetTxrepFields(txe, "tx.operations[*].body.paymentOp.amount")
+	if len(fields) != 2 ||
+		fields[0].Name != "tx.operations[0].body.paymentOp.amount" ||
+		fields[1].Name != "tx.operations[2].body.paymentOp.amount" {
+		t.Fatalf("unexpected matches %v", fields)
+	} else if *fields[1].Val.XdrPointer().(*int64) != 3000 {
+		t.Errorf("wrong amount %v", fields[1].Val)
+	} else if f := GetTxrepField(txe,
+		"tx.operations[*].body.paymentOp.amount"); f != fields[0].Val {
+		t.Errorf("GetTxrepField returned %v", f)
+	}
+	if fields = GetTxrepFields(txe,
+		"tx.operations[*].sourceAccount"); len(fields) != 3 {
+		t.Errorf("unexpected matches %v", fields)
+	} else if _, ok := fields[0].Val.XdrPointer().(**stx.MuxedAccount); !ok {
+		t.Errorf("wildcard match is not the pointer %v", fields[0].Val)
+	}
+	if fields = GetTxrepFields(txe, "tx.fee"); len(fields) != 1 ||
+		fields[0].Name != "tx.fee" {
+		t.Errorf("unexpected matches %v", fields)
+	}
+	if fields = GetTxrepFields(txe, "tx.operations[*].nosuch"); len(fields) != 0 {
+		t.Errorf("unexpected matches %v", fields)
+	}
+}
+
+func TestValidateFieldPath(t *testing.T) {
+	txe := stc.NewTransactionEnvelope()
+	txe.Append(nil, &stc.Payment{Amount: 1000})
+	txe.Append(nil, &stc.ManageData{DataName: "example"})
+	for in, out := range map[string]string{
+		"tx.fee":                          "tx.fee",
+		"TX.Fee":                          "tx.fee",
+		"tx.operations.LEN":               "tx.operations.len",
+		"tx.timeBounds._present":          "tx.timeBounds._present",
+		"tx.operations[0].body.amount":    "tx.operations[0].body.paymentOp.amount",
+		"tx.operations[1].body.dataName":  "tx.operations[1].body.manageDataOp.dataName",
+		"tx.operations[*].body.paymentOp": "tx.operations[*].body.paymentOp",
+		"tx.operations[3].body.bumpTo":    "tx.operations[3].body.bumpSequenceOp.bumpTo",
+	} {
+		if got, err := ValidateFieldPath(txe, in); err != nil {
+			t.Errorf("ValidateFieldPath(%q): %s", in, err)
+		} else if got != out {
+			t.Errorf("ValidateFieldPath(%q) = %q, want %q", in, got, out)
+		}
+	}
+	for in, suggestion := range map[string]string{
+		"tx.operations[1].body.amount":  "tx.operations[1].body.paymentOp.amount",
+		"tx.operations[3].body.trustor": "tx.operations[3].body.allowTrustOp.trustor",
+		"tx.fees":                       "tx.fee",
+		"tx.operations[x]":              "",
+		"tx.fee.len":                    "",
+	} {
+		_, err := ValidateFieldPath(txe, in)
+		if fpe, ok := err.(*FieldPathError); !ok {
+			t.Errorf("ValidateFieldPath(%q) returned %v", in, err)
+		} else if suggestion != "" && (len(fpe.Suggestions) == 0 ||
+			fpe.Suggestions[0] != suggestion) {
+			t.Errorf("ValidateFieldPath(%q) suggests %v", in, fpe.Suggestions)
+		}
+	}
+	if got, err := ValidateFieldPath(&stx.Asset{}, ""); err != nil || got != "" {
+		t.Errorf("ValidateFieldPath of empty path returned %q, %v", got, err)
+	}
+}
+
+func TestTxTotals(t *testing.T) {
+	var src, dst stx.MuxedAccount
+	fmt.Sscan("GDFR4HZMNZCNHFEIBWDQCC4JZVFQUGXUQ473EJ4SUPFOJ3XBG5DUCS2G", &src)
+	fmt.Sscan("GATPALHEEUERWYW275QDBNBMCM4KEHYJU34OPIZ6LKJAXK6B4IJ73V4L", &dst)
+	txe := stc.NewTransactionEnvelope()
+	txe.SetSourceAccount(&src)
+	txe.V1().Tx.Fee = 200
+	txe.Append(nil, &stc.Payment{Destination: dst,
+		Asset: stc.NativeAsset(), Amount: 1000})
+	txe.Append(&dst, &stc.PathPaymentStrictReceive{SendAsset: stc.NativeAsset(),
+		SendMax: 500, DestAsset: stc.NativeAsset(), DestAmount: 400})
+	tt := TxTotals(txe.TransactionEnvelope)
+	if tt.Sent["native"] != 1400 {
+		t.Errorf("total sent %d, expected 1400", tt.Sent["native"])
+	}
+	if d := tt.MaxDebit[src.String()]["native"]; d != 1200 {
+		t.Errorf("source max debit %d, expected 1200", d)
+	}
+	if d := tt.MaxDebit[dst.String()]["native"]; d != 500 {
+		t.Errorf("op source max debit %d, expected 500", d)
+	}
+}
+
+func TestLockFileWait(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stctest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := dir + "/file"
+	defer func(d time.Duration) { LockTimeout = d }(LockTimeout)
+
+	lf, err := LockFile(path, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	LockTimeout = 50 * time.Millisecond
+	if _, err := LockFile(path, 0666); err == nil {
+		t.Fatal("second LockFile succeeded")
+	} else if _, ok := err.(ErrLocked); !ok {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	LockTimeout = 5 * time.Second
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		lf.WriteString("first\n")
+		lf.Commit()
+	}()
+	lf2, err := LockFile(path, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf2.Abort()
+	if contents, err := lf2.ReadFile(); err != nil {
+		t.Fatal(err)
+	} else if string(contents) != "first\n" {
+		t.Errorf("read %q after waiting for lock", contents)
+	}
+	lf2.WriteString("second\n")
+	if err := lf2.Commit(); err != nil {
+		t.Errorf("commit after waiting for lock: %s", err)
+	}
+}
+
+func TestFileTxn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stctest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := dir+"/a", dir+"/b"
+	read := func(path string) string {
+		contents, _ := ioutil.ReadFile(path)
+		return string(contents)
+	}
+
+	var txn FileTxn
+	txn.WriteFile(a, "a1", 0666)
+	txn.WriteFile(b, "b1", 0666)
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	} else if read(a) != "a1" || read(b) != "b1" {
+		t.Fatal("FileTxn did not write files")
+	}
+
+	txn.WriteFile(a, "a2", 0666)
+	txn.WriteFile(b, "b2", 0666)
+	// Another process changes b while the transaction holds its lock
+	time.Sleep(10 * time.Millisecond)
+	ioutil.WriteFile(b, []byte("other"), 0666)
+	if err := txn.Commit(); err == nil {
+		t.Error("FileTxn committed despite concurrent change")
+	}
+	if read(a) != "a1" {
+		t.Errorf("a is %q after failed commit", read(a))
+	}
+	if _, err := os.Stat(a + ".lock"); !os.IsNotExist(err) {
+		t.Error("failed commit left lockfile behind")
+	}
+
+	// Installing b fails because its backup cannot be replaced, so a
+	// is rolled back, which must leave a's backup in place
+	defer func(suffix string) { BackupSuffix = suffix }(BackupSuffix)
+	BackupSuffix = "~"
+	os.Mkdir(b+"~", 0777)
+	ioutil.WriteFile(b+"~/keep", nil, 0666)
+	txn.WriteFile(a, "a3", 0666)
+	txn.WriteFile(b, "b3", 0666)
+	if err := txn.Commit(); err == nil {
+		t.Error("FileTxn committed despite failed install")
+	}
+	if read(a) != "a1" || read(a+"~") != "a1" {
+		t.Errorf("after rollback a is %q and a~ is %q, want a1",
+			read(a), read(a+"~"))
+	}
+	if files, _ := filepath.Glob(dir + "/*.lock*"); len(files) != 0 {
+		t.Errorf("failed commit left %v behind", files)
+	}
+}
+
+func TestBackupSuffix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stctest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(suffix string) { BackupSuffix = suffix }(BackupSuffix)
+	path := dir + "/tx"
+	read := func(path string) string {
+		contents, _ := ioutil.ReadFile(path)
+		return string(contents)
+	}
+
+	SafeWriteFile(path, "v1", 0666)
+	SafeWriteFile(path, "v2", 0666)
+	if read(path+"~") != "v1" {
+		t.Errorf("backup is %q, want v1", read(path+"~"))
+	}
+
+	BackupSuffix = ".bak"
+	SafeWriteFile(path, "v3", 0666)
+	if read(path+".bak") != "v2" || read(path+"~") != "v1" {
+		t.Error("BackupSuffix .bak not honored")
+	}
+
+	BackupSuffix = ""
+	if err := SafeWriteFile(path, "v4", 0666); err != nil {
+		t.Fatal(err)
+	} else if read(path) != "v4" {
+		t.Errorf("file is %q, want v4", read(path))
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 3 {
+		t.Errorf("empty BackupSuffix left %d files, want 3", len(files))
+	}
+}
+
+func TestExplainResultCode(t *testing.T) {
+	for _, c := range []struct{ code, same string }{
+		{"txBAD_SEQ", "tx_bad_seq"},
+		{"opBAD_AUTH", "op_bad_auth"},
+		{"PAYMENT_NO_TRUST", "op_no_trust"},
+		{"PATH_PAYMENT_STRICT_RECEIVE_NO_TRUST", "op_no_trust"},
+		{"CREATE_ACCOUNT_ALREADY_EXIST", "op_already_exists"},
+	} {
+		if HorizonResultCode(c.code) != c.same {
+			t.Errorf("HorizonResultCode(%q) = %q, want %q", c.code,
+				HorizonResultCode(c.code), c.same)
+		}
+		if hint := ExplainResultCode(c.code); hint == "" ||
+			hint != ExplainResultCode(c.same) {
+			t.Errorf("ExplainResultCode(%q) = %q", c.code, hint)
+		}
+	}
+	if ExplainResultCode("CREATE_ACCOUNT_LOW_RESERVE") ==
+		ExplainResultCode("op_low_reserve") {
+		t.Error("operation-specific hint not used")
+	}
+	if hint := ExplainResultCode("NO_SUCH_CODE"); hint != "" {
+		t.Errorf("unknown code has hint %q", hint)
+	}
+}
+
+func TestExplainTxrepField(t *testing.T) {
+	for _, c := range []struct {
+		field string
+		want  []string
+	}{
+		{"tx.memo.type", []string{"MemoType (enum)",
+			"MEMO_TEXT - text of up to 28 bytes"}},
+		{"tx.operations[2].body.paymentOp.amount", []string{
+			"tx.operations[].body.paymentOp.amount\n", "Type: Int64",
+			"Operations: PAYMENT\n"}},
+		{"destination", []string{"Type: AccountID", "Type: MuxedAccount",
+			"ACCOUNT_MERGE, PATH_PAYMENT_STRICT_RECEIVE"}},
+		{"tx.operations.len", []string{
+			"at most 100 elements, count in tx.operations.len"}},
+		{"manageDataOp.dataValue._present", []string{"at most 64 bytes",
+			"Optional"}},
+		{"type", []string{"ENVELOPE_TYPE_TX_FEE_BUMP",
+			"CLAIM_PREDICATE_UNCONDITIONAL"}},
+	} {
+		doc := ExplainTxrepField(c.field)
+		for _, w := range c.want {
+			if !strings.Contains(doc, w) {
+				t.Errorf("ExplainTxrepField(%q) lacks %q:\n%s",
+					c.field, w, doc)
+			}
+		}
+	}
+	if doc := ExplainTxrepField("tx.memo.type"); strings.Contains(doc,
+		"feeBump") {
+		t.Errorf("fee bump duplicates not elided:\n%s", doc)
+	}
+	for _, f := range []string{"", "nosuchfield", "paymentOp.amount.n"} {
+		if doc := ExplainTxrepField(f); doc != "" {
+			t.Errorf("ExplainTxrepField(%q) = %q", f, doc)
+		}
+	}
+}
+
+func TestSeqArithmetic(t *testing.T) {
+	for _, c := range []struct {
+		seq   stx.SequenceNumber
+		delta int64
+		want  stx.SequenceNumber
+		ok    bool
+	}{
+		{5, 1, 6, true},
+		{5, -5, 0, true},
+		{5, -6, 0, false},
+		{MaxSeqNum - 1, 1, MaxSeqNum, true},
+		{MaxSeqNum, 1, 0, false},
+		{MaxSeqNum - 10, math.MaxInt64, 0, false},
+		{-1, 1, 0, false},
+		{0, math.MinInt64, 0, false},
+	} {
+		got, err := AddSeq(c.seq, c.delta)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("AddSeq(%d, %d) = %d, %v", c.seq, c.delta, got, err)
+		} else if _, ok := err.(SeqRangeError); err != nil && !ok {
+			t.Errorf("AddSeq(%d, %d) error has type %T", c.seq, c.delta, err)
+		}
+	}
+	if next, err := NextSeq(41); err != nil || next != 42 {
+		t.Errorf("NextSeq(41) = %d, %v", next, err)
+	}
+	if _, err := NextSeq(MaxSeqNum); err == nil {
+		t.Error("NextSeq(MaxSeqNum) did not fail")
+	}
+	if h := SeqHeadroom(MaxSeqNum - 3); h != 3 {
+		t.Errorf("SeqHeadroom(MaxSeqNum-3) = %d", h)
+	}
+	if _, err := BumpSeqOp(-1); err == nil {
+		t.Error("BumpSeqOp accepted a negative target")
+	}
+}
+
+func TestSeqProblems(t *testing.T) {
+	txe := stc.NewTransactionEnvelope()
+	txe.V1().Tx.SeqNum = 100
+	op, err := BumpSeqOp(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txe.Append(nil, stc.BumpSequence(op))
+	if p := SeqProblems(txe.TransactionEnvelope); len(p) != 0 {
+		t.Errorf("bump to 1000 has problems: %v", p)
+	}
+	for _, to := range []stx.SequenceNumber{-1, 100, 50, MaxSeqNum} {
+		(*txe.Operations())[0].Body.BumpSequenceOp().BumpTo = to
+		if p := SeqProblems(txe.TransactionEnvelope); len(p) != 1 ||
+			!strings.HasPrefix(p[0], "operation 0: ") {
+			t.Errorf("wrong problems for bump to %d: %v", to, p)
+		}
+	}
+
+	// A low bump of another account is fine
+	other := stc.NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519).Public()
+	(*txe.Operations())[0].SourceAccount = other.ToMuxedAccount()
+	(*txe.Operations())[0].Body.BumpSequenceOp().BumpTo = 50
+	if p := SeqProblems(txe.TransactionEnvelope); len(p) != 0 {
+		t.Errorf("bump of another account has problems: %v", p)
+	}
+	txe.V1().Tx.SeqNum = -5
+	if p := SeqProblems(txe.TransactionEnvelope); len(p) != 1 ||
+		!strings.Contains(p[0], "negative") {
+		t.Errorf("wrong problems for negative sequence number: %v", p)
+	}
+	if seq := TxSeqNum(txe.TransactionEnvelope); seq == nil || *seq != -5 {
+		t.Error("TxSeqNum does not point to the sequence number")
+	}
+}
+
+func TestTxSize(t *testing.T) {
+	var e stx.TransactionEnvelope
+	e.Type = stx.ENVELOPE_TYPE_TX
+	tx := &e.V1().Tx
+	if s := TxSize(&e); s.Operations != 0 || len(s.Problems()) != 1 {
+		t.Errorf("wrong problems for empty transaction: %v", s.Problems())
+	}
+	tx.Operations = make([]stx.Operation, 3)
+	for i := range tx.Operations {
+		tx.Operations[i].Body.Type = stx.INFLATION
+	}
+	tx.Fee = 300
+	*e.Signatures() = make([]stx.DecoratedSignature, 2)
+	s := TxSize(&e)
+	if s.Bytes != len(XdrToBin(&e)) || s.Operations != 3 ||
+		s.Signatures != 2 || s.Fee != 300 || s.MinFee != 300 {
+		t.Errorf("wrong stats %+v", s)
+	}
+	if p := s.Problems(); len(p) != 0 {
+		t.Errorf("unexpected problems %v", p)
+	}
+
+	var fb stx.TransactionEnvelope
+	fb.Type = stx.ENVELOPE_TYPE_TX_FEE_BUMP
+	fb.FeeBump().Tx.InnerTx.Type = stx.ENVELOPE_TYPE_TX
+	*fb.FeeBump().Tx.InnerTx.V1() = *e.V1()
+	fb.FeeBump().Tx.Fee = 300
+	*fb.Signatures() = make([]stx.DecoratedSignature, 1)
+	s = TxSize(&fb)
+	if s.Operations != 3 || s.Signatures != 3 || s.MinFee != 400 {
+		t.Errorf("wrong fee bump stats %+v", s)
+	}
+	if p := s.Problems(); len(p) != 1 || !strings.Contains(p[0], "fee") {
+		t.Errorf("wrong fee bump problems %v", p)
+	}
+
+	tx.Operations = make([]stx.Operation, stx.MAX_OPS_PER_TX+1)
+	tx.Fee = 1000000
+	if p := TxSize(&e).Problems(); len(p) != 1 ||
+		!strings.Contains(p[0], "operations") {
+		t.Errorf("wrong problems for too many operations: %v", p)
+	}
+}
+
+func TestExtractBase64(t *testing.T) {
+	const b64 = "AAAAAgAAAAD+/w=="
+	for _, in := range []string{
+		b64,
+		"  " + b64 + "\n",
+		"\"AAAAAgAA\nAAD+/w==\n\"",
+		"AAAAAgAAAAD-_w",
+		"AAAAAgAAAAD%2B%2Fw%3D%3D",
+		"data:application/octet-stream;base64," + b64,
+		"https://laboratory.stellar.org/#txsigner?xdr=" +
+			"AAAAAgAAAAD%2B%2Fw%3D%3D&network=test",
+		"https://example.com/tx?network=test&xdr=AAAAAgAAAAD+/w==",
+	} {
+		if out, ok := ExtractBase64(in); !ok || out != b64 {
+			t.Errorf("ExtractBase64(%q) = %q, %v", in, out, ok)
+		}
+	}
+	for _, in := range []string{
+		"", "tx.fee: 100\n", "{}", "https://example.com/?memo=hello",
+		"data:text/plain,AAAAAgAAAAD",
+	} {
+		if out, ok := ExtractBase64(in); ok {
+			t.Errorf("ExtractBase64(%q) = %q", in, out)
+		}
+	}
+}
+
+// Exposes only Read, so LineReader cannot peek or read ahead.
+type plainReader struct{ io.Reader }
+
+func TestXdrFromBase64(t *testing.T) {
+	txe := stc.NewTransactionEnvelope()
+	for i := 0; i < 100; i++ {
+		val := []byte(fmt.Sprintf("value %d", i))
+		txe.Append(nil, &stc.ManageData{DataName: "key", DataValue: &val})
+	}
+	b64 := XdrToBase64(txe)
+	if len(b64) <= 4096 {
+		t.Fatalf("envelope only %d bytes of base64", len(b64))
+	}
+	for _, in := range []string{b64, b64[:3000] + "\r\n" + b64[3000:]} {
+		e := stc.NewTransactionEnvelope()
+		if err := XdrFromBase64(e, in); err != nil {
+			t.Error(err)
+		} else if XdrToBase64(e) != b64 {
+			t.Error("XdrFromBase64 does not round trip")
+		}
+	}
+	for _, in := range []string{b64[:len(b64)-8], b64[:4095] + "=" + b64[4096:],
+		""} {
+		e := stc.NewTransactionEnvelope()
+		if err := XdrFromBase64(e, in); err == nil {
+			t.Errorf("XdrFromBase64 accepted bad input of length %d", len(in))
+		}
+	}
+	err := XdrFromBase64(stc.NewTransactionEnvelope(),
+		b64[:4200]+"*"+b64[4201:])
+	if err != base64.CorruptInputError(4200) {
+		t.Errorf("wrong error for bad base64 character: %v", err)
+	}
+	bin := XdrToBin(txe)
+	if err := XdrFromBin(stc.NewTransactionEnvelope(),
+		bin[:len(bin)-3]); err == nil {
+		t.Error("XdrFromBin accepted truncated input")
+	}
+}
+
+func TestXdrFromBase64Reader(t *testing.T) {
+	var b64s []string
+	for i := 0; i < 3; i++ {
+		txe := stc.NewTransactionEnvelope()
+		txe.Append(nil, &stc.Payment{Amount: int64(i)})
+		b64s = append(b64s, XdrToBase64(txe))
+	}
+	in := bufio.NewReader(strings.NewReader("\n  " + b64s[0] + "\n\n" +
+		"AAAA" + b64s[1] + "\n" + b64s[1] + "AAAA\n" + "not,base64\n" +
+		b64s[2]))
+	for i, want := range []string{b64s[0], "", "", "", b64s[2]} {
+		e := stc.NewTransactionEnvelope()
+		if err := XdrFromBase64Reader(e, in); want == "" {
+			if err == nil {
+				t.Errorf("XdrFromBase64Reader accepted bad envelope %d", i)
+			}
+		} else if err != nil {
+			t.Errorf("XdrFromBase64Reader envelope %d: %s", i, err)
+		} else if XdrToBase64(e) != want {
+			t.Errorf("XdrFromBase64Reader envelope %d is wrong", i)
+		}
+	}
+	if err := XdrFromBase64Reader(stc.NewTransactionEnvelope(),
+		in); err != io.EOF {
+		t.Errorf("XdrFromBase64Reader at end of input returned %v", err)
+	}
+	e, err := stc.TxFromBase64Reader(plainReader{strings.NewReader(b64s[1])})
+	if err != nil {
+		t.Error(err)
+	} else if stc.TxToBase64(e) != b64s[1] {
+		t.Error("TxFromBase64Reader is wrong")
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 100000)
+	input := "a\r\nb\rc\nd\x00\xff\r\r\n" + long + "\nlast"
+	want := []string{"a", "b", "c", "d\x00\xff", "", long, "last"}
+	for _, r := range []io.Reader{strings.NewReader(input),
+		plainReader{strings.NewReader(input)}} {
+		lr := NewLineReader(r)
+		for i, w := range want {
+			line, err := lr.ReadLine()
+			if string(line) != w {
+				t.Errorf("line %d: got %q, want %q", i, line, w)
+			}
+			if (err == io.EOF) != (i == len(want)-1) {
+				t.Errorf("line %d: unexpected error %v", i, err)
+			}
+		}
+		if line, err := lr.ReadLine(); len(line) != 0 || err != io.EOF {
+			t.Errorf("read %q, %v past end of input", line, err)
+		}
+	}
+
+	r := plainReader{strings.NewReader("one\r\ntwo\n")}
+	if line, _ := ReadTextLine(r); string(line) != "one" {
+		t.Errorf("ReadTextLine stripped CRLF wrong: %q", line)
+	}
+	if rest, _ := ioutil.ReadAll(r); string(rest) != "two\n" {
+		t.Errorf("ReadTextLine read past the end of the line: %q", rest)
+	}
+
+	var e stx.TransactionEnvelope
+	te := XdrFromTxrep(strings.NewReader(
+		"type: ENVELOPE_TYPE_TX\r\ntx.fee: 100\r\ntx.seqNum: x\r\n"), "", &e)
+	if len(te) != 1 || te[0].Line != 3 {
+		t.Errorf("wrong error for CRLF txrep: %v", te)
+	} else if e.V1().Tx.Fee != 100 {
+		t.Errorf("CRLF txrep parsed fee %d", e.V1().Tx.Fee)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	sk := stc.NewPrivateKey(stx.PUBLIC_KEY_TYPE_ED25519)
+	secret, public := sk.String(), sk.Public().String()
+	mistyped := secret[:55] + "A"
+	if secret[55] == 'A' {
+		mistyped = secret[:55] + "B"
+	}
+	AddSecret([]byte("my long passphrase"))
+	AddSecret([]byte("abc"))
+
+	in := fmt.Sprintf("key %s (%s) typo %s pw my long passphrase abc\n",
+		secret, public, mistyped)
+	want := fmt.Sprintf("key %[1]s (%s) typo %[1]s pw %[1]s abc\n",
+		RedactedText, public)
+	if got := Redact(in); got != want {
+		t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+	}
+	if !HasSecret(in) || HasSecret(want) {
+		t.Errorf("HasSecret wrong for %q or %q", in, want)
+	}
+
+	var out strings.Builder
+	if n, err := fmt.Fprint(RedactWriter(&out), in); err != nil ||
+		n != len(in) {
+		t.Errorf("RedactWriter wrote %d bytes, err %v", n, err)
+	} else if out.String() != want {
+		t.Errorf("RedactWriter wrote %q, want %q", out.String(), want)
+	}
+
+	te := TxrepError{{Line: 3, Msg: "bad value " + secret}}
+	if msg := te.FileError("tx"); strings.Contains(msg, secret) {
+		t.Errorf("TxrepError shows secret: %s", msg)
+	}
+}
+
+func TestPrivateTempFile(t *testing.T) {
+	tmp := t.TempDir()
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+	f, err := PrivateTempFile("", "stc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	fmt.Fprint(f, "draft")
+	f.Close()
+	dir := filepath.Dir(path)
+	if di, err := os.Stat(dir); err != nil {
+		t.Fatal(err)
+	} else if filepath.Dir(dir) != tmp || di.Mode().Perm() != 0700 {
+		t.Errorf("temp file in %s with mode %v", dir, di.Mode())
+	} else if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0600 {
+		t.Errorf("temp file has mode %v", fi.Mode())
+	}
+
+	if err = ShredFile(path); err != nil {
+		t.Error(err)
+	} else if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("shredded file still exists: %v", err)
+	} else if err = ShredFile(path); err != nil {
+		t.Errorf("ShredFile of missing file: %s", err)
+	}
+
+	os.Chmod(dir, 0755)
+	if _, err = PrivateTempFile("", "stc"); err == nil {
+		t.Errorf("used %s, which other users can read", dir)
+	}
+	if f, err = PrivateTempFile(tmp, "stc"); err != nil {
+		t.Error(err)
+	} else {
+		f.Close()
+		ShredFile(f.Name())
+	}
+}
+
+func TestVerifyParallel(t *testing.T) {
+	const network = "Test SDF Network ; September 2015"
+	txe := stc.NewTransactionEnvelope()
+	txe.Append(nil, &stc.ManageData{DataName: "verify"})
+	hash := TxPayloadHash(network, txe)
+	var pairs []VerifyPair
+	for i := 0; i < 10; i++ {
+		sk := NewEd25519Priv()
+		sig, _ := sk.Sign(hash[:])
+		if i%3 == 0 {
+			sig[i] ^= 1
+		}
+		key := sk.Public().ToSignerKey()
+		pairs = append(pairs, VerifyPair{&key, hash, sig})
+	}
+	preimage := []byte("preimage")
+	var hashx, preauth, other stx.SignerKey
+	hashx.Type = stx.SIGNER_KEY_TYPE_HASH_X
+	*hashx.HashX() = sha256.Sum256(preimage)
+	preauth.Type = stx.SIGNER_KEY_TYPE_PRE_AUTH_TX
+	*preauth.PreAuthTx() = *hash
+	other.Type = stx.SIGNER_KEY_TYPE_PRE_AUTH_TX
+	pairs = append(pairs, VerifyPair{&hashx, nil, preimage},
+		VerifyPair{&hashx, hash, []byte("wrong")},
+		VerifyPair{&preauth, hash, nil}, VerifyPair{&other, hash, nil})
+
+	got := VerifyParallel(pairs)
+	if len(got) != len(pairs) {
+		t.Fatalf("VerifyParallel returned %d results for %d pairs",
+			len(got), len(pairs))
+	}
+	for i, p := range pairs {
+		if want := VerifyTx(p.Key, network, txe, p.Sig); got[i] != want {
+			t.Errorf("VerifyParallel pair %d is %v, VerifyTx %v", i, got[i], want)
+		}
+	}
+	if n := len(VerifyParallel(nil)); n != 0 {
+		t.Errorf("VerifyParallel(nil) returned %d results", n)
+	}
+	for _, p := range []VerifyPair{{pairs[1].Key, nil, pairs[1].Sig},
+		{&preauth, nil, nil}, {nil, hash, preimage}} {
+		if p.Verify() {
+			t.Errorf("pair with nil key or hash verified: %+v", p)
+		}
+	}
+}
+
+func TestPredicate(t *testing.T) {
+	for _, c := range []struct{ in, out string }{
+		{"unconditional", "unconditional"},
+		{" before_abs( 2025-01-01 ) ", "before_abs(2025-01-01T00:00:00Z)"},
+		{"before_abs(1735689600)", "before_abs(2025-01-01T00:00:00Z)"},
+		{"before_rel(72h)", "before_rel(259200)"},
+		{"and(before_abs(2025-01-01T01:00:00+01:00),\n  not(before_rel(60)))",
+			"and(before_abs(2025-01-01T00:00:00Z), not(before_rel(60)))"},
+		{"or(unconditional, and(unconditional, unconditional))",
+			"or(unconditional, and(unconditional, unconditional))"},
+	} {
+		p, err := ParsePredicate(c.in)
+		if err != nil {
+			t.Errorf("ParsePredicate(%q): %s", c.in, err)
+			continue
+		} else if s := PredicateString(p); s != c.out {
+			t.Errorf("ParsePredicate(%q) is %s, expected %s", c.in, s, c.out)
+		}
+		ind := PredicateIndent(p, "  ", "  ")
+		if p2, err := ParsePredicate(ind); err != nil {
+			t.Errorf("ParsePredicate rejected indented %q: %s", ind, err)
+		} else if PredicateString(p2) != c.out {
+			t.Errorf("indented %q parsed as %s", ind, PredicateString(p2))
+		}
+	}
+
+	p, _ := ParsePredicate("and(before_abs(2025-01-01), not(before_rel(60)))")
+	if ind, exp := PredicateIndent(p, "> ", "  "), `and(
+>   before_abs(2025-01-01T00:00:00Z),
+>   not(
+>     before_rel(60)
+>   )
+> )`; ind != exp {
+		t.Errorf("PredicateIndent produced\n%s\nexpected\n%s", ind, exp)
+	}
+
+	for _, in := range []string{"", "and(unconditional)", "not(maybe)",
+		"before_abs(yesterday)", "before_rel(1.5s)", "unconditional x",
+		"or(unconditional, unconditional"} {
+		if _, err := ParsePredicate(in); err == nil {
+			t.Errorf("ParsePredicate accepted %q", in)
+		} else if _, ok := err.(PredicateError); !ok {
+			t.Errorf("ParsePredicate(%q) error has type %T", in, err)
+		}
+	}
+}
+
+func TestConvertAll(t *testing.T) {
+	var inputs, reps []string
+	for i := 0; i < 50; i++ {
+		txe := stc.NewTransactionEnvelope()
+		for j := 0; j <= i%5; j++ {
+			txe.Append(nil, &stc.Payment{Amount: int64(i*10 + j)})
+		}
+		inputs = append(inputs, XdrToBase64(txe))
+		var out strings.Builder
+		WriteTxrep(&out, "", txe.TransactionEnvelope)
+		reps = append(reps, out.String())
+	}
+	inputs[7] = "not base64!"
+	inputs[8] = "AAAA"
+	inputs[9] = `"` + inputs[9] + "\"\n"
+	for _, workers := range []int{0, 1, 3, 100} {
+		res := ConvertAll(inputs, TxrepFormat, workers)
+		if len(res) != len(inputs) {
+			t.Fatalf("ConvertAll returned %d results for %d inputs",
+				len(res), len(inputs))
+		}
+		for i := range res {
+			if i == 7 || i == 8 {
+				if res[i].Err == nil {
+					t.Errorf("ConvertAll accepted %q", inputs[i])
+				}
+			} else if res[i].Err != nil {
+				t.Errorf("ConvertAll input %d: %s", i, res[i].Err)
+			} else if res[i].Output != reps[i] {
+				t.Errorf("ConvertAll input %d with %d workers:\n%s",
+					i, workers, res[i].Output)
+			}
+		}
+	}
+	res := ConvertAll(inputs[:2], Base64Format, 2)
+	if res[0].Output != inputs[0]+"\n" || res[1].Output != inputs[1]+"\n" {
+		t.Errorf("Base64Format changed its input: %v", res)
+	}
+	if len(ConvertAll(nil, JSONFormat, 0)) != 0 {
+		t.Error("ConvertAll returned results for no inputs")
+	}
+}
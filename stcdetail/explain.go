@@ -0,0 +1,313 @@
+package stcdetail
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xdrpp/goxdr/xdr"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Information about one txrep field, gathered by walking every arm of
+// every union in a transaction envelope.  Paths are generic, with []
+// in place of vector indices.
+type fieldInfo struct {
+	path     string
+	typ      xdr.XdrType
+	valid    map[int32]bool
+	optional bool
+	ops      map[stx.OperationType]bool
+	// Whether the field is a union arm, which ValidateFieldPath
+	// lets shorthand paths omit
+	arm bool
+}
+
+type fieldWalker struct {
+	txrState
+	fields map[string]*fieldInfo
+	order  []string
+	ops    []stx.OperationType
+	active map[string]bool
+}
+
+func (w *fieldWalker) Sprintf(f string, args ...interface{}) string {
+	return fmt.Sprintf(f, args...)
+}
+
+func (w *fieldWalker) record(i xdr.XdrType) *fieldInfo {
+	path := strings.ReplaceAll(w.name(), "[0]", "[]")
+	if path == "" {
+		return &fieldInfo{}
+	}
+	fi := w.fields[path]
+	if fi == nil {
+		fi = &fieldInfo{path: path, ops: map[stx.OperationType]bool{}}
+		w.fields[path] = fi
+		w.order = append(w.order, path)
+		if u, ok := w.front.next.obj.(xdr.XdrUnion); ok &&
+			u.XdrUnionTagName() != w.front.field {
+			fi.arm = true
+		}
+	}
+	if _, ok := i.(xdr.XdrPtr); !ok {
+		fi.typ = i
+		fi.valid = w.validTags()
+	}
+	if n := len(w.ops); n > 0 {
+		fi.ops[w.ops[n-1]] = true
+	}
+	return fi
+}
+
+// Returns true for aggregates that txrep shows as a single field.
+func isTxrepLeaf(i xdr.XdrType) bool {
+	switch i.(type) {
+	case *stx.Asset, stx.IsAccount, *stx.SignerKey, fmt.Stringer:
+		return true
+	}
+	return false
+}
+
+func (w *fieldWalker) Marshal(field string, i xdr.XdrType) {
+	w.push(field, i)
+	defer w.pop()
+	fi := w.record(i)
+
+	if isTxrepLeaf(i) {
+		return
+	}
+	switch v := i.(type) {
+	case xdr.XdrPtr:
+		fi.optional = true
+		v.SetPresent(true)
+		v.XdrMarshalValue(w, "")
+	case xdr.XdrVec:
+		if v.XdrBound() > 0 {
+			v.SetVecLen(1)
+			v.XdrMarshalN(w, "", 1)
+		}
+	case xdr.XdrUnion:
+		// Recursive types such as ClaimPredicate are only expanded
+		// once.
+		if name := v.XdrTypeName(); w.active[name] {
+			return
+		} else {
+			w.active[name] = true
+			defer delete(w.active, name)
+		}
+		var tags []int32
+		for t := range v.XdrValidTags() {
+			// Version 0 envelopes have the same fields as version 1
+			if _, ok := v.(*stx.TransactionEnvelope); ok &&
+				t == int32(stx.ENVELOPE_TYPE_TX_V0) {
+				continue
+			}
+			tags = append(tags, t)
+		}
+		if len(tags) == 0 {
+			v.XdrRecurse(w, "")
+			return
+		}
+		sort.Slice(tags, func(a, b int) bool { return tags[a] < tags[b] })
+		_, isBody := v.(*stx.XdrAnon_Operation_Body)
+		for _, t := range tags {
+			v.XdrUnionTag().SetU32(uint32(t))
+			if isBody {
+				w.ops = append(w.ops, stx.OperationType(t))
+			}
+			v.XdrRecurse(w, "")
+			if isBody {
+				w.ops = w.ops[:len(w.ops)-1]
+			}
+		}
+	case xdr.XdrAggregate:
+		if name := v.XdrTypeName(); w.active[name] {
+			return
+		} else {
+			w.active[name] = true
+			defer delete(w.active, name)
+		}
+		v.XdrRecurse(w, "")
+	}
+}
+
+var typeFieldsMu sync.Mutex
+var typeFieldsCache = map[reflect.Type]*fieldWalker{}
+
+// Returns the fields of all possible values of t's type, walking a
+// fresh value of the type the first time so t itself is not changed.
+func getTypeFields(t xdr.XdrType) *fieldWalker {
+	typ := reflect.TypeOf(t.XdrPointer())
+	typeFieldsMu.Lock()
+	defer typeFieldsMu.Unlock()
+	if w := typeFieldsCache[typ]; w != nil {
+		return w
+	}
+	// Wrappers such as stc.TransactionEnvelope point to generated
+	// types, which are themselves XdrTypes; primitive types are not,
+	// but walking them changes nothing.
+	if fresh, ok := reflect.New(typ.Elem()).Interface().(xdr.XdrType); ok {
+		t = fresh
+	}
+	w := &fieldWalker{
+		fields: map[string]*fieldInfo{},
+		active: map[string]bool{},
+	}
+	w.Marshal("", t)
+	typeFieldsCache[typ] = w
+	return w
+}
+
+func getTxrepFields() *fieldWalker {
+	return getTypeFields(&stx.TransactionEnvelope{})
+}
+
+var indexRe = regexp.MustCompile(`\[[0-9]*\]`)
+
+func atMost(bound uint32, what string) string {
+	if bound == 0xffffffff {
+		return "any number of " + what
+	}
+	return fmt.Sprintf("at most %d %s", bound, what)
+}
+
+// Describes the type of field path for ExplainTxrepField.
+func explainType(path string, t xdr.XdrType) string {
+	name := t.XdrTypeName()
+	if _, ok := t.(xdr.XdrAggregate); ok && isTxrepLeaf(t) {
+		return name
+	}
+	switch v := xdr.XdrBaseType(t).(type) {
+	case xdr.XdrString:
+		return fmt.Sprintf("%s (%s)", name, atMost(v.XdrBound(), "bytes"))
+	case xdr.XdrVecOpaque:
+		return fmt.Sprintf("%s (%s)", name, atMost(v.XdrBound(), "bytes"))
+	case xdr.XdrArrayOpaque:
+		return fmt.Sprintf("%s (%d bytes)", name, v.XdrArraySize())
+	case xdr.XdrVec:
+		return fmt.Sprintf("%s (%s, count in %s)", name,
+			atMost(v.XdrBound(), "elements"), dotJoin(path, ps_len))
+	case xdr.XdrEnum:
+		return name + " (enum)"
+	case xdr.XdrUnion:
+		return name + " (union)"
+	case xdr.XdrAggregate:
+		return name + " (struct)"
+	}
+	return name
+}
+
+// Returns the documentation for field (a txrep field name such as
+// tx.operations[0].body.paymentOp.amount, or any suffix of one such
+// as paymentOp.amount or amount), or the empty string if no field
+// matches.  Vector indices may be omitted, so tx.operations[] matches
+// any operation.  The documentation lists the XDR type of each
+// matching field, its bounds, the allowed values of enums with their
+// meanings, and the operations in which the field appears.  Fields
+// that match in several places with the same type and meaning are
+// described together.
+func ExplainTxrepField(field string) string {
+	field = indexRe.ReplaceAllString(field, "[]")
+	for _, suffix := range []string{"." + ps_present, "." + ps_len} {
+		field = strings.TrimSuffix(field, suffix)
+	}
+	if field == "" {
+		return ""
+	}
+
+	type group struct {
+		paths []string
+		*fieldInfo
+	}
+	var groups []*group
+	byKey := map[string]*group{}
+	w := getTxrepFields()
+	for _, path := range w.order {
+		fi := w.fields[path]
+		if path != field && !strings.HasSuffix(path, "."+field) &&
+			!strings.HasSuffix(path, "."+field+"[]") {
+			continue
+		}
+		// Fields of inner transactions repeat those of plain ones
+		if inner := strings.TrimPrefix(path, "feeBump.tx.innerTx."); inner != path && w.fields[inner] != nil {
+			continue
+		}
+		leaf := path[strings.LastIndexByte(path, '.')+1:]
+		key := fmt.Sprintf("%s %s %v", leaf, fi.typ.XdrTypeName(),
+			fi.optional)
+		g := byKey[key]
+		if g == nil {
+			g = &group{fieldInfo: &fieldInfo{
+				typ:      fi.typ,
+				valid:    fi.valid,
+				optional: fi.optional,
+				ops:      map[stx.OperationType]bool{},
+			}}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.paths = append(g.paths, path)
+		for op := range fi.ops {
+			g.ops[op] = true
+		}
+	}
+
+	out := &strings.Builder{}
+	for n, g := range groups {
+		if n > 0 {
+			out.WriteString("\n")
+		}
+		for _, path := range g.paths {
+			fmt.Fprintln(out, path)
+		}
+		path := strings.TrimSuffix(g.paths[0], "[]")
+		leaf := path[strings.LastIndexByte(path, '.')+1:]
+		parent := path[:len(path)-len(leaf)]
+		parent = parent[strings.LastIndexByte(
+			strings.TrimSuffix(parent, "."), '.')+1:]
+		fmt.Fprintf(out, "    Type: %s\n", explainType(path, g.typ))
+		for _, k := range []string{parent + leaf, leaf,
+			g.typ.XdrTypeName()} {
+			if doc, ok := fieldDocs[k]; ok {
+				fmt.Fprintf(out, "    %s\n", doc)
+				break
+			}
+		}
+		if g.optional {
+			fmt.Fprintf(out, "    Optional: set %s to false to omit\n",
+				dotJoin(leaf, ps_present))
+		}
+		if en, ok := xdr.XdrBaseType(g.typ).(xdr.XdrEnum); ok {
+			var vals []int32
+			for v := range en.XdrEnumNames() {
+				if g.valid == nil || g.valid[v] {
+					vals = append(vals, v)
+				}
+			}
+			sort.Slice(vals, func(a, b int) bool { return vals[a] < vals[b] })
+			fmt.Fprintf(out, "    Values:\n")
+			for _, v := range vals {
+				name := en.XdrEnumNames()[v]
+				if doc, ok := enumDocs[name]; ok {
+					fmt.Fprintf(out, "        %s - %s\n", name, doc)
+				} else {
+					fmt.Fprintf(out, "        %s\n", name)
+				}
+			}
+		}
+		var allOps stx.OperationType
+		if n := len(g.ops); n > 0 && n < len(allOps.XdrEnumNames()) {
+			var ops []string
+			for op := range g.ops {
+				ops = append(ops, op.String())
+			}
+			sort.Strings(ops)
+			fmt.Fprintf(out, "    Operations: %s\n", strings.Join(ops, ", "))
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,142 @@
+package stcdetail
+
+// Annotations used by ExplainTxrepField.  fieldDocs is keyed by the
+// last two components of a txrep field name, the last component, or
+// the XDR type name of the field, tried in that order.  enumDocs is
+// keyed by enum value name.
+var fieldDocs = map[string]string{
+	// Types
+	"AccountID":      "An account, in strkey format (G...).",
+	"MuxedAccount":   "An account, in strkey format (G..., or M... for a multiplexed account).",
+	"Asset":          "An asset: native, or CODE:ISSUER for an issued asset.",
+	"AssetCode":      "An asset code of 1 to 12 characters.",
+	"Int64":          "An amount in stroops (units of 10^-7); txrep comments show the value divided by 10^7.",
+	"SequenceNumber": "A sequence number; transactions must use one more than the source account's current sequence number.",
+	"TimePoint":      "A time in seconds since the Unix epoch (see -date); 0 means no bound.",
+	"SignerKey":      "A signer: an account (G...), a pre-authorized transaction hash (T...), or a hash(x) (X...).",
+	"PublicKey":      "An account, in strkey format (G...).",
+	"Price":          "A price, expressed as the fraction n/d.",
+	"Hash":           "A 32-byte hash, in hex.",
+	"SignatureHint":  "The last 4 bytes of the public key that made a signature.",
+	"Signature":      "An ed25519 signature, in hex.",
+
+	// Transactions
+	"type":          "Selects which of the following fields are present.",
+	"sourceAccount": "Account whose signature authorizes the transaction or operation; an operation without one uses the transaction's source account.",
+	"fee":           "Maximum total fee, in stroops, that the source account pays for the transaction.",
+	"feeSource":     "Account that pays the fee of a fee-bump transaction.",
+	"seqNum":        "Sequence number of the transaction, one more than the source account's current sequence number.",
+	"timeBounds":    "Interval of time during which the transaction is valid.",
+	"minTime":       "Earliest time at which the transaction is valid.",
+	"maxTime":       "Latest time at which the transaction is valid, or 0 for no limit.",
+	"memo":          "Data attached to the transaction for the benefit of the recipient.",
+	"text":          "Memo text.",
+	"id":            "Memo number.",
+	"hash":          "Memo hash, in hex.",
+	"retHash":       "Hash of a transaction being refunded, in hex.",
+	"operations":    "The operations of the transaction, which succeed or fail together.",
+	"signatures":    "Signatures on the transaction hash.",
+	"v":             "Version of the extension, which must be 0.",
+	"innerTx":       "The transaction whose fee is being bumped.",
+
+	// Operations
+	"destination":                "Account that receives the funds.",
+	"startingBalance":            "Amount of native asset with which to fund the new account.",
+	"amount":                     "Amount of the asset, in stroops.",
+	"sendAsset":                  "Asset deducted from the source account.",
+	"sendMax":                    "Most of sendAsset the source account may spend.",
+	"sendAmount":                 "Amount of sendAsset deducted from the source account.",
+	"destAsset":                  "Asset the destination receives.",
+	"destAmount":                 "Amount of destAsset the destination receives.",
+	"destMin":                    "Least amount of destAsset the destination may receive.",
+	"path":                       "Assets through which the payment is converted, in order.",
+	"selling":                    "Asset the offer sells.",
+	"buying":                     "Asset the offer buys.",
+	"buyAmount":                  "Amount of buying asset to buy, or 0 to delete the offer.",
+	"n":                          "Numerator of the price.",
+	"d":                          "Denominator of the price.",
+	"price":                      "Price of one unit of selling in terms of buying.",
+	"offerID":                    "Offer to modify or delete, or 0 to create a new offer.",
+	"inflationDest":              "Account receiving the source account's inflation votes (no longer used).",
+	"clearFlags":                 "Flags to clear (AUTH_REQUIRED=1, AUTH_REVOCABLE=2, AUTH_IMMUTABLE=4, AUTH_CLAWBACK_ENABLED=8 for accounts).",
+	"setFlags":                   "Flags to set (AUTH_REQUIRED=1, AUTH_REVOCABLE=2, AUTH_IMMUTABLE=4, AUTH_CLAWBACK_ENABLED=8 for accounts).",
+	"masterWeight":               "Weight of the account's own key as a signer.",
+	"lowThreshold":               "Signature weight required for low-threshold operations.",
+	"medThreshold":               "Signature weight required for medium-threshold operations.",
+	"highThreshold":              "Signature weight required for high-threshold operations.",
+	"homeDomain":                 "Domain hosting the account's stellar.toml file.",
+	"signer":                     "Signer to add, update, or (with weight 0) remove.",
+	"revokeSponsorshipOp.signer": "Signer whose sponsorship is revoked or transferred.",
+	"key":                        "Key of the signer.",
+	"weight":                     "Weight of the signer, or 0 to remove it.",
+	"line":                       "Asset of the trustline.",
+	"limit":                      "Most of the asset the trustline can hold, or 0 to remove the trustline.",
+	"trustor":                    "Account whose trustline is changed.",
+	"authorize":                  "Authorization to grant the trustor (0 none, 1 authorized, 2 authorized to maintain liabilities).",
+	"dataName":                   "Name of the account data entry.",
+	"dataValue":                  "Value of the account data entry (up to 64 bytes); omit to delete the entry.",
+	"bumpTo":                     "New sequence number of the source account, if higher than the current one.",
+	"claimants":                  "Accounts that may claim the balance, and when.",
+	"predicate":                  "Condition under which the claimant may claim the balance; may also be written on one line as an expression such as and(before_abs(2025-01-01), not(before_rel(3600))).",
+	"andPredicates":              "Conditions that must all hold.",
+	"orPredicates":               "Conditions of which at least one must hold.",
+	"notPredicate":               "Condition that must not hold.",
+	"absBefore":                  "Deadline, in seconds since the Unix epoch.",
+	"relBefore":                  "Deadline, in seconds after the balance is created.",
+	"balanceID":                  "Claimable balance to claim or claw back.",
+	"sponsoredID":                "Account whose reserves the source account pays for until END_SPONSORING_FUTURE_RESERVES.",
+	"ledgerKey":                  "Ledger entry whose sponsorship is revoked or transferred.",
+	"from":                       "Account from which the asset is clawed back.",
+}
+
+var enumDocs = map[string]string{
+	"ENVELOPE_TYPE_TX_V0":       "transaction with an ed25519 source account (deprecated)",
+	"ENVELOPE_TYPE_TX":          "transaction",
+	"ENVELOPE_TYPE_TX_FEE_BUMP": "transaction paying a larger fee for another transaction",
+
+	"MEMO_NONE":   "no memo",
+	"MEMO_TEXT":   "text of up to 28 bytes",
+	"MEMO_ID":     "unsigned 64-bit number",
+	"MEMO_HASH":   "32-byte hash",
+	"MEMO_RETURN": "32-byte hash of a transaction being refunded",
+
+	"CREATE_ACCOUNT":                   "create and fund a new account",
+	"PAYMENT":                          "send an amount of an asset",
+	"PATH_PAYMENT_STRICT_RECEIVE":      "send an exact amount, converting assets through the order book",
+	"MANAGE_SELL_OFFER":                "create, update, or delete an offer to sell",
+	"CREATE_PASSIVE_SELL_OFFER":        "create an offer that does not cross an offer of the same price",
+	"SET_OPTIONS":                      "change flags, thresholds, signers, or home domain",
+	"CHANGE_TRUST":                     "create, update, or delete a trustline",
+	"ALLOW_TRUST":                      "authorize a trustline (deprecated by SET_TRUST_LINE_FLAGS)",
+	"ACCOUNT_MERGE":                    "delete the source account, sending its balance to another",
+	"INFLATION":                        "run inflation (no longer used)",
+	"MANAGE_DATA":                      "set or delete an account data entry",
+	"BUMP_SEQUENCE":                    "increase the source account's sequence number",
+	"MANAGE_BUY_OFFER":                 "create, update, or delete an offer to buy",
+	"PATH_PAYMENT_STRICT_SEND":         "send an exact amount, converting assets through the order book",
+	"CREATE_CLAIMABLE_BALANCE":         "set aside funds that claimants can claim later",
+	"CLAIM_CLAIMABLE_BALANCE":          "claim a claimable balance",
+	"BEGIN_SPONSORING_FUTURE_RESERVES": "start paying reserves for another account",
+	"END_SPONSORING_FUTURE_RESERVES":   "stop paying reserves for the source account",
+	"REVOKE_SPONSORSHIP":               "revoke or transfer the sponsorship of a ledger entry or signer",
+	"CLAWBACK":                         "take back an amount of an asset from an account",
+	"CLAWBACK_CLAIMABLE_BALANCE":       "take back a claimable balance",
+	"SET_TRUST_LINE_FLAGS":             "set or clear the authorization flags of a trustline",
+
+	"CLAIM_PREDICATE_UNCONDITIONAL":        "always",
+	"CLAIM_PREDICATE_AND":                  "all of andPredicates",
+	"CLAIM_PREDICATE_OR":                   "any of orPredicates",
+	"CLAIM_PREDICATE_NOT":                  "not notPredicate",
+	"CLAIM_PREDICATE_BEFORE_ABSOLUTE_TIME": "before absBefore",
+	"CLAIM_PREDICATE_BEFORE_RELATIVE_TIME": "less than relBefore seconds after creation",
+
+	"REVOKE_SPONSORSHIP_LEDGER_ENTRY": "a ledger entry, in ledgerKey",
+	"REVOKE_SPONSORSHIP_SIGNER":       "a signer of an account, in signer",
+
+	"ACCOUNT":           "an account",
+	"TRUSTLINE":         "a trustline",
+	"OFFER":             "an offer",
+	"DATA":              "an account data entry",
+	"CLAIMABLE_BALANCE": "a claimable balance",
+	"LIQUIDITY_POOL":    "a liquidity pool",
+}
@@ -0,0 +1,221 @@
+package stcdetail
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/xdrpp/goxdr/xdr"
+)
+
+// Error returned by ValidateFieldPath for a path that names no field,
+// or that could mean several fields.
+type FieldPathError struct {
+	Path string
+	Msg  string
+	// Canonical paths of fields the caller may have meant
+	Suggestions []string
+}
+
+func (e *FieldPathError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Path, e.Msg)
+	if len(e.Suggestions) > 0 {
+		msg += " (did you mean " + strings.Join(e.Suggestions, ", ") + "?)"
+	}
+	return msg
+}
+
+// Most suggestions a FieldPathError lists.
+const maxPathSuggestions = 5
+
+var pathIndexRe = regexp.MustCompile(`^\[([0-9]+|\*|)\]$`)
+var presentRe = regexp.MustCompile(`(?i)^(_inner)*_present$`)
+
+func trimDot(comp string) string {
+	return strings.TrimPrefix(comp, ".")
+}
+
+// Reports whether path components u match the components p of a
+// generic path, ignoring case, where u may omit union arms.
+func (w *fieldWalker) matchPath(u, p []string) bool {
+	j := 0
+	prefix := ""
+	for _, c := range p {
+		prefix += c
+		if j < len(u) && (c == "[]" && u[j][0] == '[' ||
+			strings.EqualFold(trimDot(u[j]), trimDot(c))) {
+			j++
+		} else if fi := w.fields[prefix]; fi == nil || !fi.arm {
+			return false
+		}
+	}
+	return j == len(u)
+}
+
+// Fills the [] components of generic path p with indices, in order,
+// using [0] once indices run out.
+func fillIndices(p string, indices []string) string {
+	comps := splitTxrepName(p)
+	for i := range comps {
+		if comps[i] == "[]" {
+			if len(indices) > 0 {
+				comps[i], indices = indices[0], indices[1:]
+			} else {
+				comps[i] = "[0]"
+			}
+		}
+	}
+	return strings.Join(comps, "")
+}
+
+// Returns the edit distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cur[j] = prev[j-1]
+			if a[i-1] != b[j-1] {
+				cur[j]++
+			}
+			if cur[j] > prev[j]+1 {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j] > cur[j-1]+1 {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Checks that path names a field of t's type in txrep, and returns
+// its canonical form, so that editors and other tools can accept the
+// shorthand people type.  Field names match regardless of case, and
+// union arms may be omitted.  When several fields match, the one that
+// exists in t (with its current union arms and vector lengths) is
+// chosen, so if the first operation of t is a payment,
+// tx.operations[0].body.AMOUNT becomes
+// tx.operations[0].body.paymentOp.amount.  Vector indices may be
+// numbers, [*] (as accepted by GetTxrepFields), or []; they are kept
+// as given.  The path may end with the txrep pseudo-fields len or
+// _present of vectors and pointers.  The field need not exist in t, so
+// a path to a union arm that is not active is valid.  On failure,
+// returns a *FieldPathError, whose Suggestions list canonical paths of
+// similarly named fields.
+func ValidateFieldPath(t xdr.XdrType, path string) (string, error) {
+	w := getTypeFields(t)
+	comps := splitTxrepName(path)
+	var indices []string
+	for _, c := range comps {
+		if c[0] == '[' {
+			if !pathIndexRe.MatchString(c) {
+				return "", &FieldPathError{Path: path,
+					Msg: fmt.Sprintf("invalid index %s", c)}
+			}
+			indices = append(indices, c)
+		}
+	}
+	var pseudo string
+	if n := len(comps); n > 0 {
+		if last := trimDot(comps[n-1]); strings.EqualFold(last, ps_len) {
+			pseudo = ps_len
+		} else if presentRe.MatchString(last) {
+			pseudo = strings.ToLower(last)
+		}
+		if pseudo != "" {
+			comps = comps[:n-1]
+		}
+	}
+	if len(comps) == 0 {
+		if pseudo == "" {
+			return "", nil
+		}
+		return "", &FieldPathError{Path: path, Msg: "no such field"}
+	}
+
+	var cands []string
+	for _, p := range w.order {
+		fi := w.fields[p]
+		if !w.matchPath(comps, splitTxrepName(p)) {
+			continue
+		}
+		switch _, isVec := fi.typ.(xdr.XdrVec); pseudo {
+		case "":
+		case ps_len:
+			if !isVec {
+				continue
+			}
+		default:
+			if !fi.optional {
+				continue
+			}
+		}
+		cands = append(cands, p)
+	}
+	canon := func(p string) string {
+		return dotJoin(fillIndices(p, indices), pseudo)
+	}
+	if len(cands) > 1 {
+		exists := func(p string) bool {
+			field := fillIndices(p, indices)
+			field = strings.ReplaceAll(field, "[]", wildcardIndex)
+			return len(GetTxrepFields(t, field)) > 0
+		}
+		generic := make([]string, len(comps))
+		for i, c := range comps {
+			if generic[i] = c; c[0] == '[' {
+				generic[i] = "[]"
+			}
+		}
+		var present []string
+		for _, p := range cands {
+			if strings.EqualFold(strings.Join(generic, ""), p) {
+				// Omitting nothing beats omitting a union arm
+				present = []string{p}
+				break
+			} else if exists(p) {
+				present = append(present, p)
+			}
+		}
+		if len(present) > 0 {
+			cands = present
+		}
+	}
+	switch len(cands) {
+	case 1:
+		return canon(cands[0]), nil
+	case 0:
+	default:
+		err := &FieldPathError{Path: path, Msg: "ambiguous field path"}
+		for _, p := range cands {
+			if len(err.Suggestions) == maxPathSuggestions {
+				break
+			}
+			err.Suggestions = append(err.Suggestions, canon(p))
+		}
+		return "", err
+	}
+
+	// Suggest fields whose last component is the same or close
+	err := &FieldPathError{Path: path, Msg: "no such field"}
+	leaf := strings.ToLower(trimDot(comps[len(comps)-1]))
+	for dist := 0; dist <= 2 && len(err.Suggestions) == 0; dist++ {
+		for _, p := range w.order {
+			pc := splitTxrepName(p)
+			if len(err.Suggestions) == maxPathSuggestions {
+				break
+			} else if editDistance(leaf,
+				strings.ToLower(trimDot(pc[len(pc)-1]))) == dist {
+				err.Suggestions = append(err.Suggestions,
+					fillIndices(p, indices))
+			}
+		}
+	}
+	return "", err
+}
@@ -4,6 +4,8 @@ import "bytes"
 import "encoding/base64"
 import "encoding/json"
 import "fmt"
+import "sort"
+import "unicode/utf8"
 import "github.com/xdrpp/goxdr/xdr"
 
 type jsonIn struct {
@@ -191,3 +193,176 @@ func XdrToJson(src xdr.XdrAggregate) (json []byte, err error) {
 	j.aggregate(src)
 	return j.out.Bytes(), nil
 }
+
+type jsonCanon struct {
+	obj map[string]interface{}
+	arr []interface{}
+}
+
+func (j *jsonCanon) put(name string, v interface{}) {
+	if j.obj == nil {
+		j.arr = append(j.arr, v)
+	} else {
+		j.obj[name] = v
+	}
+}
+
+func canonAggregate(val xdr.XdrAggregate) interface{} {
+	switch v := val.(type) {
+	case xdr.XdrVec:
+		j := &jsonCanon{arr: []interface{}{}}
+		v.XdrMarshalN(j, "", v.GetVecLen())
+		return j.arr
+	case xdr.XdrArray:
+		j := &jsonCanon{arr: []interface{}{}}
+		v.XdrRecurse(j, "")
+		return j.arr
+	default:
+		j := &jsonCanon{obj: map[string]interface{}{}}
+		v.XdrRecurse(j, "")
+		return j.obj
+	}
+}
+
+func (_ *jsonCanon) Sprintf(f string, args ...interface{}) string {
+	return fmt.Sprintf(f, args...)
+}
+func (j *jsonCanon) Marshal(name string, val xdr.XdrType) {
+	switch v := val.(type) {
+	case *xdr.XdrBool:
+		j.put(name, bool(*v))
+	case xdr.XdrEnum:
+		j.put(name, v.String())
+	case xdr.XdrNum32:
+		j.put(name, json.Number(v.String()))
+	case xdr.XdrString:
+		if s := v.GetString(); utf8.ValidString(s) {
+			j.put(name, s)
+		} else {
+			j.put(name, map[string]interface{}{
+				"base64": base64.StdEncoding.EncodeToString([]byte(s)),
+			})
+		}
+	case xdr.XdrBytes:
+		j.put(name, base64.StdEncoding.EncodeToString(v.GetByteSlice()))
+	case fmt.Stringer:
+		j.put(name, v.String())
+	case xdr.XdrPtr:
+		if !v.GetPresent() {
+			j.put(name, nil)
+		} else {
+			v.XdrMarshalValue(j, name)
+		}
+	case xdr.XdrAggregate:
+		if HideFieldName(name, val) {
+			v.XdrRecurse(j, "")
+		} else {
+			j.put(name, canonAggregate(v))
+		}
+	default:
+		xdr.XdrPanic("XdrToCanonicalJSON can't handle type %T", val)
+	}
+}
+
+func canonString(out *bytes.Buffer, s string) {
+	out.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case '\b':
+			out.WriteString(`\b`)
+		case '\f':
+			out.WriteString(`\f`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(out, `\u%04x`, r)
+			} else {
+				out.WriteRune(r)
+			}
+		}
+	}
+	out.WriteByte('"')
+}
+
+func canonValue(out *bytes.Buffer, val interface{}) {
+	switch v := val.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		fmt.Fprint(out, v)
+	case json.Number:
+		out.WriteString(string(v))
+	case string:
+		canonString(out, v)
+	case []interface{}:
+		out.WriteByte('[')
+		for i := range v {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			canonValue(out, v[i])
+		}
+		out.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			canonString(out, k)
+			out.WriteByte(':')
+			canonValue(out, v[k])
+		}
+		out.WriteByte('}')
+	}
+}
+
+// Format an XDR structure as canonical JSON, for hashing or for audit
+// logs that must compare byte for byte.  Unlike XdrToJson, whose
+// layout may change to suit human readers, the output of
+// XdrToCanonicalJSON is guaranteed to remain the same for the same
+// XDR value in future versions of this package (though a new protocol
+// version can change the XDR itself).  Specifically:
+//
+// * There is no whitespace outside strings and no trailing newline.
+//
+// * Object keys are the XDR field names, sorted by byte value.
+//
+// * 32-bit integers are JSON numbers in decimal with no leading zeros,
+// sign (unless negative), fraction, or exponent.  64-bit integers are
+// JSON strings in the same format, to avoid loss of precision.
+//
+// * Booleans are true or false, enums their symbolic names as
+// strings, absent pointers null, and opaque data base64 with padding
+// (RFC 4648 section 4).  Strings escape only '"' and '\\' (with a
+// backslash) and control characters (as \b, \f, \n, \r, or \t, else
+// as \u00xx in lower-case hex), as in RFC 8785.  A string that is not
+// valid UTF-8 appears instead as an object whose one key, "base64",
+// holds the string's bytes in base64, so no two strings look alike.
+//
+// * Strkeys and other types with a String method appear as JSON
+// strings containing that string.
+func XdrToCanonicalJSON(src xdr.XdrAggregate) (ret []byte, err error) {
+	defer func() {
+		if i := recover(); i != nil {
+			ret = nil
+			err = i.(error)
+		}
+	}()
+	out := bytes.Buffer{}
+	canonValue(&out, canonAggregate(src))
+	return out.Bytes(), nil
+}
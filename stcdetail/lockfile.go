@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"time"
 )
 
 type ErrIsDirectory string
@@ -23,6 +24,50 @@ func (e ErrFileHasChanged) Error() string {
 	return string(e) + ": file has changed since read"
 }
 
+type ErrLocked string
+
+func (e ErrLocked) Error() string {
+	return string(e) + ": locked by another process (remove " + string(e) +
+		".lock if no other process is running)"
+}
+
+// How long LockFile waits for another process to release a lock
+// before failing with ErrLocked.  Zero means fail immediately.
+var LockTimeout = 10 * time.Second
+
+// Suffix of the backup that SafeWriteFile, FileTxn, and LockedFile
+// Commit keep of a file when replacing it, in the style of editor
+// backups.  The default is "~", unless the environment variable
+// STCBACKUP is set.  If empty, no backup is kept; a temporary one
+// still lets FileTxn roll back, but is deleted once the commit
+// succeeds.
+var BackupSuffix = func() string {
+	if suffix, ok := os.LookupEnv("STCBACKUP"); ok {
+		return suffix
+	}
+	return "~"
+}()
+
+// Exclusively creates lockpath, retrying until LockTimeout has passed
+// if it already exists.
+func createLock(lockpath string, perm os.FileMode) (*os.File, error) {
+	deadline := time.Now().Add(LockTimeout)
+	delay := 10 * time.Millisecond
+	for {
+		f, err := os.OpenFile(lockpath, os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+			perm)
+		if err == nil || !os.IsExist(err) {
+			return f, err
+		} else if !time.Now().Before(deadline) {
+			return nil, ErrLocked(strings.TrimSuffix(lockpath, ".lock"))
+		}
+		time.Sleep(delay)
+		if delay < 500*time.Millisecond {
+			delay *= 2
+		}
+	}
+}
+
 func clearAtime(sys interface{}) bool {
 	v := reflect.ValueOf(sys)
 	if v.Kind() == reflect.Ptr {
@@ -86,6 +131,8 @@ type lockedFile struct {
 	f        *os.File
 	*bufio.Writer
 	fi os.FileInfo
+	// Where install() saved the previous contents of path
+	backup string
 }
 
 func (lf *lockedFile) Abort() {
@@ -115,7 +162,9 @@ func (lf *lockedFile) Status() os.FileInfo {
 	return lf.fi
 }
 
-func (lf *lockedFile) Commit() error {
+// Writes the lockfile to disk and checks that neither it nor the
+// target has changed, so that all that remains is to rename it.
+func (lf *lockedFile) prepare() error {
 	var ea errAccum
 	ea.accum(lf.Flush())
 	lf.Writer = nil
@@ -141,16 +190,90 @@ func (lf *lockedFile) Commit() error {
 		lf.Abort()
 		return err
 	}
+	return nil
+}
 
-	tildepath := lf.path + "~"
-	os.Remove(tildepath)
-	os.Link(lf.path, tildepath)
+// Atomically replaces to with a hard link to from or, if that is not
+// possible, a copy of from with permissions perm, using tmp as a
+// scratch name.  Unlike renaming from, this leaves from in place.
+func linkOver(from, to, tmp string, perm os.FileMode) error {
+	os.Remove(tmp)
+	if os.Link(from, tmp) != nil {
+		if err := copyFile(from, tmp, perm); err != nil {
+			os.Remove(tmp)
+			return err
+		} else if err = os.Chmod(tmp, perm); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, to); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
 
-	if ea.accum(os.Rename(lf.lockpath, lf.path)) == nil {
-		lf.lockpath = ""
+// Replaces the target with the prepared lockfile, keeping a backup.
+// The backup is a hard link when possible, and otherwise a copy, so
+// that even on filesystems without hard links replacing a file never
+// leaves it without a backup.  The target becomes another link to
+// (or copy of) the lockfile, which stays in place, so the lock is
+// held until Abort releases it.
+func (lf *lockedFile) install() error {
+	lf.backup = lf.path + BackupSuffix
+	if BackupSuffix == "" {
+		lf.backup = lf.lockpath + "~"
 	}
-	lf.Abort()
-	return ea.error
+	os.Remove(lf.backup)
+	if lf.fi != nil && os.Link(lf.path, lf.backup) != nil {
+		if err := copyFile(lf.path, lf.backup,
+			lf.fi.Mode()&os.ModePerm); err != nil {
+			return err
+		}
+	}
+	fi, err := os.Stat(lf.lockpath)
+	if err != nil {
+		return err
+	}
+	return linkOver(lf.lockpath, lf.path, lf.lockpath+".new",
+		fi.Mode()&os.ModePerm)
+}
+
+// Deletes the temporary backup that install() keeps when BackupSuffix
+// is empty.
+func (lf *lockedFile) finish() {
+	if BackupSuffix == "" && lf.backup != "" {
+		os.Remove(lf.backup)
+	}
+}
+
+func copyFile(from, to string, perm os.FileMode) error {
+	contents, err := ioutil.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to, contents, perm)
+}
+
+// Undoes install() using the backup, which is left in place, since
+// it may be the user's only copy of the file's previous contents.
+func (lf *lockedFile) rollback() {
+	if lf.fi != nil {
+		linkOver(lf.backup, lf.path, lf.lockpath+".new",
+			lf.fi.Mode()&os.ModePerm)
+	} else {
+		os.Remove(lf.path)
+	}
+}
+
+func (lf *lockedFile) Commit() error {
+	defer lf.Abort()
+	if err := lf.prepare(); err != nil {
+		return err
+	}
+	defer lf.finish()
+	return lf.install()
 }
 
 func (lf *lockedFile) ReadFile() ([]byte, error) {
@@ -205,24 +328,37 @@ func doLockFile(path string, perm os.FileMode,
 	}
 	if path == "" {
 		return nil, os.ErrInvalid
-	} else if fi, e := os.Stat(path); e != nil && !os.IsNotExist(e) {
-		return nil, e
-	} else if e == nil && fi.Mode().IsDir() {
+	} else if fi, e := os.Stat(path); e == nil && fi.Mode().IsDir() {
 		return nil, ErrIsDirectory(path)
+	}
+
+	// Take the lock before looking at the file, since another process
+	// holding the lock may be about to replace it.
+	f, err := createLock(lf.lockpath, perm)
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (LockedFile, error) {
+		f.Close()
+		os.Remove(lf.lockpath)
+		return nil, err
+	}
+	if fi, e := os.Stat(path); e != nil && !os.IsNotExist(e) {
+		return fail(e)
+	} else if e == nil && fi.Mode().IsDir() {
+		return fail(ErrIsDirectory(path))
 	} else if e == nil {
 		// Would be impolite to increase permissions...
-		perm &= fi.Mode()
+		if err = f.Chmod(perm & fi.Mode() & os.ModePerm); err != nil {
+			return fail(err)
+		}
 		lf.fi = fi
 	}
 
 	if readfi != nil && (lf.fi == nil || FileChanged(readfi, lf.fi)) {
-		return nil, ErrFileHasChanged(path)
+		return fail(ErrFileHasChanged(path))
 	}
 
-	f, err := os.OpenFile(lf.lockpath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
-	if err != nil {
-		return nil, err
-	}
 	lf.f = f
 	lf.Writer = bufio.NewWriter(lf.f)
 	return &lf, nil
@@ -234,6 +370,12 @@ func doLockFile(path string, perm os.FileMode,
 // you have just written.  You must call Abort() or Commit() on the
 // returned interface.  Since it is safe to call both, best practice
 // is to defer a call to Abort() immediately.
+//
+// The lockfile also serves as an advisory lock among stc processes:
+// if it already exists, LockFile waits up to LockTimeout for the
+// other process to commit or abort before failing with ErrLocked.
+// Hence, a read-modify-write cycle using ReadFile and Commit does not
+// lose updates made concurrently by other processes.
 func LockFile(path string, perm os.FileMode) (LockedFile, error) {
 	return doLockFile(path, perm, nil)
 }
@@ -252,8 +394,10 @@ func LockFileIfUnchanged(path string, fi os.FileInfo) (LockedFile, error) {
 // Writes data to file path in a safe way.  If path is "foo", then
 // data is first written to a file called "foo.lock" and that file is
 // flushed to disk.  Then, if a file called "foo" already exists,
-// "foo" is linked to "foo~" to keep a backup.  Finally, "foo.lock" is
-// renamed to "foo".  Fails if "foo.lock" already exists.
+// "foo" is linked or copied to "foo~" to keep a backup (see
+// BackupSuffix).  Finally, "foo.lock" is
+// renamed to "foo".  Fails if "foo.lock" still exists after waiting
+// LockTimeout.
 func SafeWriteFile(path string, data string, perm os.FileMode) error {
 	lf, err := LockFile(path, perm)
 	if err != nil {
@@ -282,3 +426,73 @@ func SafeCreateFile(path string, data string, perm os.FileMode) error {
 	lf.WriteString(data)
 	return lf.Commit()
 }
+
+// A set of files to be updated together.  Lock each file through
+// the FileTxn (or use WriteFile), then call Commit to replace all of
+// them.  Commit first writes and checks every lockfile, so that most
+// failures (such as a full disk or a file changed by another process)
+// leave all the files untouched.  If renaming one of the lockfiles
+// still fails, Commit restores the files it already replaced from
+// their backups (see BackupSuffix).  A FileTxn must not lock the same file twice.
+type FileTxn struct {
+	files []*lockedFile
+}
+
+// Like LockFile, but the file will be committed with the rest of the
+// transaction.  Do not call Commit on the returned LockedFile.
+func (txn *FileTxn) LockFile(path string, perm os.FileMode) (
+	LockedFile, error) {
+	lf, err := LockFile(path, perm)
+	if err != nil {
+		return nil, err
+	}
+	txn.files = append(txn.files, lf.(*lockedFile))
+	return lf, nil
+}
+
+// Like SafeWriteFile, but the file is only replaced when the
+// transaction commits.
+func (txn *FileTxn) WriteFile(path string, data string,
+	perm os.FileMode) error {
+	lf, err := txn.LockFile(path, perm)
+	if err != nil {
+		return err
+	}
+	_, err = lf.WriteString(data)
+	return err
+}
+
+// Replaces all files locked through the transaction, or none of them
+// if there is an error.  Every lock is held until all the files have
+// been replaced (or restored), so that no other process sees some of
+// the files updated and others not.
+func (txn *FileTxn) Commit() error {
+	defer txn.Abort()
+	for _, lf := range txn.files {
+		if err := lf.prepare(); err != nil {
+			return err
+		}
+	}
+	var err error
+	for i, lf := range txn.files {
+		if err = lf.install(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				txn.files[j].rollback()
+			}
+			break
+		}
+	}
+	for _, lf := range txn.files {
+		lf.finish()
+	}
+	return err
+}
+
+// Releases the locks on all files without changing them.  Safe to
+// call after Commit, so best practice is to defer a call to Abort.
+func (txn *FileTxn) Abort() {
+	for _, lf := range txn.files {
+		lf.Abort()
+	}
+	txn.files = nil
+}
@@ -0,0 +1,252 @@
+package stcdetail
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xdrpp/stc/stx"
+)
+
+// Formats accepted by before_abs in ParsePredicate, in addition to
+// seconds since the Unix epoch.  Dates without a time zone are in UTC,
+// so that a transaction means the same thing wherever it is parsed.
+var predicateDateFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func predicateDate(t stx.Int64) string {
+	return time.Unix(int64(t), 0).UTC().Format(time.RFC3339)
+}
+
+func formatPredicate(out *strings.Builder, p *stx.ClaimPredicate,
+	prefix, indent string) {
+	nl := "\n"
+	if indent == "" {
+		nl = ""
+	}
+	compound := func(name string, ps ...*stx.ClaimPredicate) {
+		fmt.Fprintf(out, "%s(%s", name, nl)
+		for i, sub := range ps {
+			out.WriteString(prefix + indent)
+			formatPredicate(out, sub, prefix+indent, indent)
+			if i < len(ps)-1 {
+				out.WriteString(",")
+				if nl == "" {
+					out.WriteString(" ")
+				}
+			}
+			out.WriteString(nl)
+		}
+		out.WriteString(prefix + ")")
+	}
+	sub := func(ps []stx.ClaimPredicate) []*stx.ClaimPredicate {
+		ret := make([]*stx.ClaimPredicate, len(ps))
+		for i := range ps {
+			ret[i] = &ps[i]
+		}
+		return ret
+	}
+	switch p.Type {
+	case stx.CLAIM_PREDICATE_UNCONDITIONAL:
+		out.WriteString("unconditional")
+	case stx.CLAIM_PREDICATE_AND:
+		compound("and", sub(*p.AndPredicates())...)
+	case stx.CLAIM_PREDICATE_OR:
+		compound("or", sub(*p.OrPredicates())...)
+	case stx.CLAIM_PREDICATE_NOT:
+		if np := *p.NotPredicate(); np != nil {
+			compound("not", np)
+		} else {
+			compound("not")
+		}
+	case stx.CLAIM_PREDICATE_BEFORE_ABSOLUTE_TIME:
+		fmt.Fprintf(out, "before_abs(%s)", predicateDate(*p.AbsBefore()))
+	case stx.CLAIM_PREDICATE_BEFORE_RELATIVE_TIME:
+		fmt.Fprintf(out, "before_rel(%d)", *p.RelBefore())
+	default:
+		out.WriteString(p.Type.String())
+	}
+}
+
+// Renders a ClaimPredicate on one line in the syntax accepted by
+// ParsePredicate, for example:
+//
+//	and(before_abs(2025-01-01T00:00:00Z), not(before_rel(3600)))
+//
+// Absolute times are shown as dates in UTC, and relative times in
+// seconds.
+func PredicateString(p *stx.ClaimPredicate) string {
+	out := &strings.Builder{}
+	formatPredicate(out, p, "", "")
+	return out.String()
+}
+
+// Like PredicateString, but puts each condition of and, or, and not
+// on its own line, indented by indent more than the line containing
+// it.  Every line after the first starts with prefix.  The result
+// also parses with ParsePredicate.
+func PredicateIndent(p *stx.ClaimPredicate, prefix, indent string) string {
+	out := &strings.Builder{}
+	formatPredicate(out, p, prefix, indent)
+	return out.String()
+}
+
+// Error returned by ParsePredicate for invalid input.
+type PredicateError struct {
+	Column int
+	Msg    string
+}
+
+func (e PredicateError) Error() string {
+	return fmt.Sprintf("predicate column %d: %s", e.Column, e.Msg)
+}
+
+type predicateParser struct {
+	input string
+	pos   int
+}
+
+func (pp *predicateParser) fail(f string, args ...interface{}) {
+	panic(PredicateError{pp.pos + 1, fmt.Sprintf(f, args...)})
+}
+
+func (pp *predicateParser) skipSpace() {
+	for pp.pos < len(pp.input) && strings.IndexByte(" \t\r\n",
+		pp.input[pp.pos]) >= 0 {
+		pp.pos++
+	}
+}
+
+func (pp *predicateParser) expect(c byte) {
+	pp.skipSpace()
+	if pp.pos >= len(pp.input) || pp.input[pp.pos] != c {
+		pp.fail("expected %q", c)
+	}
+	pp.pos++
+}
+
+// Returns the text up to the next closing parenthesis, trimmed.
+func (pp *predicateParser) arg() string {
+	start := pp.pos
+	end := strings.IndexByte(pp.input[start:], ')')
+	if end < 0 {
+		pp.fail("missing %q", ')')
+	}
+	pp.pos += end
+	return strings.TrimSpace(pp.input[start:pp.pos])
+}
+
+func (pp *predicateParser) time(arg string) stx.Int64 {
+	if n, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return stx.Int64(n)
+	}
+	for _, f := range predicateDateFormats {
+		if t, err := time.ParseInLocation(f, arg, time.UTC); err == nil {
+			return stx.Int64(t.Unix())
+		}
+	}
+	pp.fail("cannot parse date %q", arg)
+	return 0
+}
+
+func (pp *predicateParser) duration(arg string) stx.Int64 {
+	if n, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return stx.Int64(n)
+	} else if d, err := time.ParseDuration(arg); err == nil &&
+		d%time.Second == 0 {
+		return stx.Int64(d / time.Second)
+	}
+	pp.fail("cannot parse whole number of seconds %q", arg)
+	return 0
+}
+
+func (pp *predicateParser) predicate(p *stx.ClaimPredicate) {
+	pp.skipSpace()
+	start := pp.pos
+	for pp.pos < len(pp.input) && (pp.input[pp.pos] == '_' ||
+		pp.input[pp.pos] >= 'a' && pp.input[pp.pos] <= 'z') {
+		pp.pos++
+	}
+	name := pp.input[start:pp.pos]
+	pair := func() []stx.ClaimPredicate {
+		ps := make([]stx.ClaimPredicate, 2)
+		pp.expect('(')
+		pp.predicate(&ps[0])
+		pp.expect(',')
+		pp.predicate(&ps[1])
+		pp.expect(')')
+		return ps
+	}
+	switch name {
+	case "unconditional":
+		p.Type = stx.CLAIM_PREDICATE_UNCONDITIONAL
+	case "and":
+		p.Type = stx.CLAIM_PREDICATE_AND
+		*p.AndPredicates() = pair()
+	case "or":
+		p.Type = stx.CLAIM_PREDICATE_OR
+		*p.OrPredicates() = pair()
+	case "not":
+		p.Type = stx.CLAIM_PREDICATE_NOT
+		np := &stx.ClaimPredicate{}
+		pp.expect('(')
+		pp.predicate(np)
+		pp.expect(')')
+		*p.NotPredicate() = np
+	case "before_abs":
+		p.Type = stx.CLAIM_PREDICATE_BEFORE_ABSOLUTE_TIME
+		pp.expect('(')
+		*p.AbsBefore() = pp.time(pp.arg())
+		pp.expect(')')
+	case "before_rel":
+		p.Type = stx.CLAIM_PREDICATE_BEFORE_RELATIVE_TIME
+		pp.expect('(')
+		*p.RelBefore() = pp.duration(pp.arg())
+		pp.expect(')')
+	case "":
+		pp.fail("expected predicate")
+	default:
+		pp.pos = start
+		pp.fail("unknown predicate %q", name)
+	}
+}
+
+// Parses a ClaimPredicate written as an expression, which is much
+// easier to write by hand than the txrep of the recursive union.  The
+// expression is one of
+//
+//	unconditional
+//	and(PREDICATE, PREDICATE)
+//	or(PREDICATE, PREDICATE)
+//	not(PREDICATE)
+//	before_abs(TIME)
+//	before_rel(SECONDS)
+//
+// where TIME is seconds since the Unix epoch or a date such as
+// 2025-01-01 or 2025-01-01T12:00:00Z (UTC unless a time zone is
+// given), and SECONDS may also be a duration such as 72h.  Whitespace,
+// including newlines, may appear between elements.  Errors are of type
+// PredicateError.
+func ParsePredicate(input string) (ret *stx.ClaimPredicate, err error) {
+	pp := &predicateParser{input: input}
+	defer func() {
+		if i := recover(); i != nil {
+			if e, ok := i.(PredicateError); ok {
+				ret, err = nil, e
+				return
+			}
+			panic(i)
+		}
+	}()
+	ret = &stx.ClaimPredicate{}
+	pp.predicate(ret)
+	if pp.skipSpace(); pp.pos < len(input) {
+		pp.fail("unexpected %q", input[pp.pos:])
+	}
+	return ret, nil
+}
@@ -3,6 +3,7 @@ package stcdetail
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -72,10 +73,13 @@ func (pp printer) doPretty(prefix string, v reflect.Value) {
 			pp.recPretty(fmt.Sprintf("%s[%d]", prefix, i), "", v.Index(i))
 		}
 	case reflect.Map:
-		iter := v.MapRange()
-		for iter.Next() {
-			pp.recPretty(fmt.Sprintf("%s[%q]", prefix, iter.Key().Interface()),
-				"", iter.Value())
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, k := range keys {
+			pp.recPretty(fmt.Sprintf("%s[%q]", prefix, k.Interface()),
+				"", v.MapIndex(k))
 		}
 	default:
 		pp.recPretty(prefix, "", v)
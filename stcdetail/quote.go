@@ -0,0 +1,107 @@
+package stcdetail
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Returns true if bs is non-empty, valid UTF-8 consisting only of
+// printable characters, tabs, and newlines.  Such byte strings are
+// more readable quoted as text than rendered in hex.
+func IsText(bs []byte) bool {
+	if len(bs) == 0 || !utf8.Valid(bs) {
+		return false
+	}
+	for _, r := range string(bs) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// Render a string in the restricted syntax of SEP-0011:  the string
+// is surrounded by double quotes, printable ASCII characters appear
+// literally, double quote, backslash, and newline are written as \",
+// \\, and \n respectively, and every other byte is written as \xNN.
+// Unlike Go's %q format, the output does not depend on whether the
+// string contains valid UTF-8.
+func QuoteSEP11(s string) string {
+	out := strings.Builder{}
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c == '\n':
+			out.WriteString(`\n`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&out, `\x%02x`, c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// Parse a string in the syntax produced by QuoteSEP11.  Leading
+// spaces are skipped.  Returns the unquoted string and whatever text
+// follows the closing double quote (typically a comment).
+func UnquoteSEP11(in string) (ret string, rest string, err error) {
+	in = strings.TrimLeft(in, " \t")
+	if len(in) == 0 || in[0] != '"' {
+		return "", in, fmt.Errorf("string must start with '\"'")
+	}
+	out := strings.Builder{}
+	for i := 1; i < len(in); i++ {
+		c := in[i]
+		switch {
+		case c == '"':
+			return out.String(), in[i+1:], nil
+		case c < 0x20 || c >= 0x7f:
+			return "", in, fmt.Errorf("unescaped byte 0x%02x in string", c)
+		case c != '\\':
+			out.WriteByte(c)
+			continue
+		}
+		if i++; i >= len(in) {
+			break
+		}
+		switch in[i] {
+		case '"', '\\':
+			out.WriteByte(in[i])
+		case 'n':
+			out.WriteByte('\n')
+		case 'x':
+			if i+2 < len(in) {
+				hi, ok1 := unhex(in[i+1])
+				lo, ok2 := unhex(in[i+2])
+				if ok1 && ok2 {
+					out.WriteByte(hi<<4 | lo)
+					i += 2
+					continue
+				}
+			}
+			return "", in, fmt.Errorf("invalid \\x escape in string")
+		default:
+			return "", in, fmt.Errorf("invalid escape \\%c in string", in[i])
+		}
+	}
+	return "", in, fmt.Errorf("unterminated string")
+}
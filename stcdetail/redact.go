@@ -0,0 +1,105 @@
+package stcdetail
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// Text that Redact substitutes for each secret it removes.
+var RedactedText = "[REDACTED]"
+
+// Patterns of secrets that Redact removes.  The default matches
+// Stellar secret keys in strkey format (S...), including ones with a
+// bad checksum, since a mistyped secret key is still mostly secret.
+// Applications may add patterns for their own secrets, such as API
+// keys, but should only do so before calling Redact from multiple
+// goroutines.
+var RedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bS[A-Z2-7]{55}\b`),
+}
+
+// Secrets shorter than this are not worth redacting, since they would
+// blot out ordinary words without protecting much.
+const minSecretLen = 4
+
+var secretsMu sync.Mutex
+var secrets [][]byte
+
+// Registers a secret for Redact to remove wherever it appears, such
+// as a passphrase (which GetPass registers automatically).  Secrets
+// shorter than 4 bytes are ignored.
+func AddSecret(secret []byte) {
+	if len(secret) < minSecretLen {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if bytes.Equal(s, secret) {
+			return
+		}
+	}
+	secrets = append(secrets, append([]byte(nil), secret...))
+}
+
+// Returns s with every match of RedactPatterns and every secret
+// registered with AddSecret replaced by RedactedText, so that s can
+// safely appear in logs, error messages, and temporary files.
+func Redact(s string) string {
+	return string(redactBytes([]byte(s)))
+}
+
+func redactBytes(b []byte) []byte {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	repl := []byte(RedactedText)
+	for _, s := range secrets {
+		if bytes.Contains(b, s) {
+			b = bytes.ReplaceAll(b, s, repl)
+		}
+	}
+	for _, re := range RedactPatterns {
+		b = re.ReplaceAllLiteral(b, repl)
+	}
+	return b
+}
+
+// Returns true if s contains a match of RedactPatterns or a secret
+// registered with AddSecret, so that Redact would change it.
+func HasSecret(s string) bool {
+	b := []byte(s)
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if bytes.Contains(b, s) {
+			return true
+		}
+	}
+	for _, re := range RedactPatterns {
+		if re.Match(b) {
+			return true
+		}
+	}
+	return false
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write(redactBytes(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Returns a Writer that passes everything written to it through
+// Redact before writing it to w.  Each Write is redacted separately,
+// so a secret split across two Writes escapes; fmt.Fprintf and
+// similar functions issue a single Write per call.
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w}
+}
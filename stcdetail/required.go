@@ -0,0 +1,68 @@
+package stcdetail
+
+import (
+	"github.com/xdrpp/stc/stx"
+)
+
+// Fields of each operation type that strict txrep input must supply,
+// relative to the operation body.  Leaving any of these out produces
+// an operation that is almost certainly not what was intended, such
+// as a payment to the all-zero account.
+var requiredOpFields = map[stx.OperationType][]string{
+	stx.CREATE_ACCOUNT: {"createAccountOp.destination",
+		"createAccountOp.startingBalance"},
+	stx.PAYMENT: {"paymentOp.destination", "paymentOp.asset",
+		"paymentOp.amount"},
+	stx.PATH_PAYMENT_STRICT_RECEIVE: {
+		"pathPaymentStrictReceiveOp.sendAsset",
+		"pathPaymentStrictReceiveOp.sendMax",
+		"pathPaymentStrictReceiveOp.destination",
+		"pathPaymentStrictReceiveOp.destAsset",
+		"pathPaymentStrictReceiveOp.destAmount"},
+	stx.PATH_PAYMENT_STRICT_SEND: {
+		"pathPaymentStrictSendOp.sendAsset",
+		"pathPaymentStrictSendOp.sendAmount",
+		"pathPaymentStrictSendOp.destination",
+		"pathPaymentStrictSendOp.destAsset",
+		"pathPaymentStrictSendOp.destMin"},
+	stx.MANAGE_SELL_OFFER: {"manageSellOfferOp.selling",
+		"manageSellOfferOp.buying", "manageSellOfferOp.amount",
+		"manageSellOfferOp.price.n", "manageSellOfferOp.price.d"},
+	stx.MANAGE_BUY_OFFER: {"manageBuyOfferOp.selling",
+		"manageBuyOfferOp.buying", "manageBuyOfferOp.buyAmount",
+		"manageBuyOfferOp.price.n", "manageBuyOfferOp.price.d"},
+	stx.CREATE_PASSIVE_SELL_OFFER: {"createPassiveSellOfferOp.selling",
+		"createPassiveSellOfferOp.buying", "createPassiveSellOfferOp.amount",
+		"createPassiveSellOfferOp.price.n",
+		"createPassiveSellOfferOp.price.d"},
+	stx.CHANGE_TRUST: {"changeTrustOp.line", "changeTrustOp.limit"},
+	stx.ALLOW_TRUST: {"allowTrustOp.trustor", "allowTrustOp.asset",
+		"allowTrustOp.authorize"},
+	stx.ACCOUNT_MERGE: {"destination"},
+	stx.MANAGE_DATA:   {"manageDataOp.dataName"},
+	stx.BUMP_SEQUENCE: {"bumpSequenceOp.bumpTo"},
+	stx.CREATE_CLAIMABLE_BALANCE: {"createClaimableBalanceOp.asset",
+		"createClaimableBalanceOp.amount"},
+	stx.CLAIM_CLAIMABLE_BALANCE: {"claimClaimableBalanceOp.balanceID.v0"},
+	stx.BEGIN_SPONSORING_FUTURE_RESERVES: {
+		"beginSponsoringFutureReservesOp.sponsoredID"},
+	stx.CLAWBACK: {"clawbackOp.asset", "clawbackOp.from",
+		"clawbackOp.amount"},
+	stx.CLAWBACK_CLAIMABLE_BALANCE: {
+		"clawbackClaimableBalanceOp.balanceID.v0"},
+	stx.SET_TRUST_LINE_FLAGS: {"setTrustLineFlagsOp.trustor",
+		"setTrustLineFlagsOp.asset"},
+}
+
+// Reports each required field of operation body (whose txrep name is
+// name) that was missing from the input.  Errors are anchored at
+// line, which should be the line of the operation type.
+func (xs *xdrScan) checkRequired(name string, body *stx.XdrAnon_Operation_Body,
+	line int) {
+	for _, f := range requiredOpFields[body.Type] {
+		if field := dotJoin(name, f); xs.missing[field] {
+			xs.report(line, "%s operation is missing required field %s",
+				body.Type, field)
+		}
+	}
+}
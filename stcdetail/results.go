@@ -0,0 +1,145 @@
+package stcdetail
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/xdrpp/stc/stx"
+)
+
+// Likely causes and fixes for transaction and operation result codes,
+// used by ExplainResultCode.  Keys are either XDR names of result codes
+// (e.g., "PAYMENT_NO_TRUST"), for advice specific to one operation, or
+// horizon's names (e.g., "op_no_trust"), which cover the same failure
+// in every operation.  Programs can add or replace entries.
+var ResultCodeHints = map[string]string{
+	"tx_too_early": "the transaction's time bounds have not started; " +
+		"wait or change minTime",
+	"tx_too_late": "the transaction expired; change maxTime (and " +
+		"re-sign)",
+	"tx_missing_operation": "add at least one operation",
+	"tx_bad_seq": "the sequence number is not one more than the " +
+		"source account's; update it with -u and re-sign",
+	"tx_bad_auth": "signatures are missing, invalid, or for another " +
+		"network; check -net and the signers' weights",
+	"tx_insufficient_balance": "the source account cannot pay the fee " +
+		"without dropping below its minimum balance",
+	"tx_no_account": "the source account does not exist; create and " +
+		"fund it first",
+	"tx_insufficient_fee": "the fee is below the network's minimum; " +
+		"raise it (-u sets the current fee)",
+	"tx_bad_auth_extra": "the transaction has signatures that are not " +
+		"needed; remove the extra signatures",
+	"tx_internal_error": "an error in stellar-core; try again later",
+	"tx_not_supported": "the transaction type is not supported by the " +
+		"network's protocol version",
+	"tx_bad_sponsorship": "a sponsorship begun in the transaction was " +
+		"never ended; add an END_SPONSORING_FUTURE_RESERVES operation",
+	"op_bad_auth": "an operation's source account has not signed with " +
+		"enough weight for the operation's threshold",
+	"op_no_account": "an operation's source account does not exist",
+	"op_not_supported": "the operation is not supported by the " +
+		"network's protocol version",
+	"op_too_many_subentries": "the account has the maximum number of " +
+		"subentries (trustlines, offers, signers, and data)",
+	"op_exceeded_work_limit": "the operation did too much work; break " +
+		"it into smaller operations",
+	"op_too_many_sponsoring": "the sponsoring account sponsors too " +
+		"many entries",
+	"op_underfunded": "the source account does not have enough of the " +
+		"asset, after reserves and liabilities",
+	"op_low_reserve": "the account would drop below its minimum " +
+		"balance; add more of the native asset",
+	"op_no_trust": "the destination lacks a trustline for this asset; " +
+		"it must add one with CHANGE_TRUST",
+	"op_not_authorized": "the issuer has not authorized the account to " +
+		"hold this asset",
+	"op_line_full": "the destination's trustline limit would be " +
+		"exceeded; it must raise the limit with CHANGE_TRUST",
+	"op_no_issuer": "the asset's issuer does not exist; check the " +
+		"asset code and issuer",
+	"op_no_destination": "the destination account does not exist; use " +
+		"CREATE_ACCOUNT to create it",
+	"op_malformed": "an argument of the operation is invalid, such as " +
+		"a negative amount or an invalid asset",
+	"op_src_no_trust": "the source account lacks a trustline for the " +
+		"asset it is sending",
+	"op_src_not_authorized": "the issuer has not authorized the source " +
+		"account to send this asset",
+	"op_too_few_offers": "there is no path with enough offers to " +
+		"convert between the assets",
+	"op_over_source_max": "the path would cost more than sendMax; raise " +
+		"sendMax or try again later",
+	"op_under_dest_min": "the path would deliver less than destMin; " +
+		"lower destMin or try again later",
+	"op_cross_self": "the offer would cross one of the account's own " +
+		"offers",
+	"op_offer_not_found": "no offer with this offerID belongs to the " +
+		"source account",
+	"op_already_exists": "the account already exists; use PAYMENT to " +
+		"send it funds",
+	"op_has_sub_entries": "the account still has trustlines, offers, " +
+		"signers, or data; remove them before merging",
+	"op_is_sponsor": "the account sponsors other entries, so it cannot " +
+		"be merged",
+	"op_immutable_set": "the account has AUTH_IMMUTABLE set, so its " +
+		"flags cannot change and it cannot be merged",
+	"op_dest_full": "the destination would hold more than the maximum " +
+		"amount of the native asset",
+	"op_bad_seq": "bumpTo is not a valid sequence number",
+	"op_invalid_limit": "the trustline limit is below the current " +
+		"balance plus liabilities",
+	"op_trust_not_required": "the asset's issuer does not have " +
+		"AUTH_REQUIRED set, so trustlines need not be authorized",
+	"op_cant_revoke":      "the issuer does not have AUTH_REVOCABLE set",
+	"op_self_not_allowed": "an account cannot trust an asset it issues",
+	"op_does_not_exist":   "the entry to change or remove does not exist",
+	"op_not_sponsor":      "the source account is not the entry's sponsor",
+	"CREATE_ACCOUNT_LOW_RESERVE": "the starting balance is below the " +
+		"minimum balance for a new account",
+	"CHANGE_TRUST_LOW_RESERVE": "the account needs more of the native " +
+		"asset to cover the reserve for another trustline",
+	"ACCOUNT_MERGE_NO_ACCOUNT": "the destination account does not " +
+		"exist",
+	"SET_OPTIONS_BAD_SIGNER": "a signer cannot be the account itself; " +
+		"use masterWeight instead",
+}
+
+// Converts the XDR name of a result code to the name horizon uses,
+// e.g., "txBAD_SEQ" to "tx_bad_seq" and "PAYMENT_NO_TRUST" to
+// "op_no_trust".  Returns code unchanged if it is not recognized.
+func HorizonResultCode(code string) string {
+	if len(code) > 2 && (code[:2] == "tx" || code[:2] == "op") &&
+		code[2] != '_' {
+		return code[:2] + "_" + strings.ToLower(code[2:])
+	}
+	// Strip the longest operation type name (e.g., prefer
+	// PATH_PAYMENT_STRICT_RECEIVE to PAYMENT)
+	var ops []string
+	for _, op := range stx.OperationType(0).XdrEnumNames() {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return len(ops[i]) > len(ops[j]) })
+	for _, op := range ops {
+		if strings.HasPrefix(code, op+"_") {
+			rest := code[len(op)+1:]
+			if rest == "ALREADY_EXIST" {
+				rest = "ALREADY_EXISTS"
+			}
+			return "op_" + strings.ToLower(rest)
+		}
+	}
+	return code
+}
+
+// Returns a short explanation of a transaction or operation result
+// code and its most likely fix, or "" if ResultCodeHints has nothing
+// to say about it.  code can be the XDR name (e.g., "txBAD_SEQ" or
+// "PAYMENT_NO_TRUST") or horizon's name (e.g., "tx_bad_seq" or
+// "op_no_trust").
+func ExplainResultCode(code string) string {
+	if hint, ok := ResultCodeHints[code]; ok {
+		return hint
+	}
+	return ResultCodeHints[HorizonResultCode(code)]
+}
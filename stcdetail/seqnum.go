@@ -0,0 +1,128 @@
+package stcdetail
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/xdrpp/stc/stx"
+)
+
+// The largest sequence number.  Each transaction must have its source
+// account's sequence number plus one, so an account whose sequence
+// number reaches MaxSeqNum (for instance, through a BumpSequence
+// operation) can never submit another transaction.
+const MaxSeqNum = stx.SequenceNumber(math.MaxInt64)
+
+// Error returned by AddSeq and NextSeq when a result would be
+// negative or exceed MaxSeqNum.
+type SeqRangeError struct {
+	Seq   stx.SequenceNumber
+	Delta int64
+}
+
+func (e SeqRangeError) Error() string {
+	if e.Delta == 0 {
+		return fmt.Sprintf("sequence number %d is out of range", e.Seq)
+	}
+	return fmt.Sprintf("sequence number %d%+d is out of range", e.Seq,
+		e.Delta)
+}
+
+// Returns seq + delta, or fails with a SeqRangeError if seq is
+// negative or the result would be negative or exceed MaxSeqNum.
+func AddSeq(seq stx.SequenceNumber, delta int64) (stx.SequenceNumber, error) {
+	if seq < 0 || delta > 0 && int64(MaxSeqNum-seq) < delta ||
+		delta < 0 && int64(seq)+delta < 0 {
+		return 0, SeqRangeError{seq, delta}
+	}
+	return seq + stx.SequenceNumber(delta), nil
+}
+
+// Returns the sequence number that the next transaction of an account
+// whose sequence number is seq must have, or fails with a
+// SeqRangeError if seq is MaxSeqNum or negative.
+func NextSeq(seq stx.SequenceNumber) (stx.SequenceNumber, error) {
+	return AddSeq(seq, 1)
+}
+
+// Returns how far the sequence number of an account can still advance
+// from seq, which is the number of transactions it can still submit,
+// or 0 if seq is negative.  A BumpSequence operation to target leaves
+// the account SeqHeadroom(target) transactions.
+func SeqHeadroom(seq stx.SequenceNumber) int64 {
+	if seq < 0 {
+		return 0
+	}
+	return int64(MaxSeqNum - seq)
+}
+
+// Returns a pointer to the sequence number of e, or of the inner
+// transaction of a fee bump, or nil if e has an invalid type.
+func TxSeqNum(e *stx.TransactionEnvelope) *stx.SequenceNumber {
+	switch e.Type {
+	case stx.ENVELOPE_TYPE_TX_V0:
+		return &e.V0().Tx.SeqNum
+	case stx.ENVELOPE_TYPE_TX:
+		return &e.V1().Tx.SeqNum
+	case stx.ENVELOPE_TYPE_TX_FEE_BUMP:
+		if e.FeeBump().Tx.InnerTx.Type == stx.ENVELOPE_TYPE_TX {
+			return &e.FeeBump().Tx.InnerTx.V1().Tx.SeqNum
+		}
+	}
+	return nil
+}
+
+// Returns a BumpSequence operation body that raises its source
+// account's sequence number to target, for TransactionEnvelope.Append
+// (as stc.BumpSequence).  Fails with a SeqRangeError if target is
+// negative, which the network would reject.
+func BumpSeqOp(target stx.SequenceNumber) (stx.BumpSequenceOp, error) {
+	if target < 0 {
+		return stx.BumpSequenceOp{}, SeqRangeError{target, 0}
+	}
+	return stx.BumpSequenceOp{BumpTo: target}, nil
+}
+
+// Returns a description of each sequence number in e that can never
+// be reached:  a negative sequence number for the transaction, which
+// no account can have, and BumpSequence operations that will fail, do
+// nothing, or leave their account unable to submit any more
+// transactions.  A transaction sequence number of 0, which stc uses
+// until the real one is known, is not reported.
+func SeqProblems(e *stx.TransactionEnvelope) []string {
+	tx, _, _ := innerTx(e)
+	if tx == nil {
+		return nil
+	}
+	var ret []string
+	if tx.SeqNum < 0 {
+		ret = append(ret, fmt.Sprintf(
+			"sequence number %d is negative and can never be valid",
+			tx.SeqNum))
+	}
+	src := acctKey(&tx.SourceAccount)
+	for i := range tx.Operations {
+		op := &tx.Operations[i]
+		if op.Body.Type != stx.BUMP_SEQUENCE {
+			continue
+		}
+		opsrc := src
+		if op.SourceAccount != nil {
+			opsrc = acctKey(op.SourceAccount)
+		}
+		switch to := op.Body.BumpSequenceOp().BumpTo; {
+		case to < 0:
+			ret = append(ret, fmt.Sprintf(
+				"operation %d: bumpTo %d is negative and will fail", i, to))
+		case to == MaxSeqNum:
+			ret = append(ret, fmt.Sprintf("operation %d: bumpTo is the "+
+				"largest sequence number, after which %s can never "+
+				"submit another transaction", i, opsrc))
+		case opsrc == src && to <= tx.SeqNum:
+			ret = append(ret, fmt.Sprintf("operation %d: bumpTo %d has "+
+				"no effect, since the transaction's sequence number is %d",
+				i, to, tx.SeqNum))
+		}
+	}
+	return ret
+}
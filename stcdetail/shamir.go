@@ -0,0 +1,186 @@
+package stcdetail
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Arithmetic in GF(2^8) with the AES polynomial x^8+x^4+x^3+x+1,
+// using log and exp tables over the generator 3.
+var gfExp [510]byte
+var gfLog [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = byte(i)
+		// multiply by 3 = x + 1
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// Splits secret into n shares, any k of which suffice to reconstruct
+// it with ShamirJoin (while fewer than k reveal nothing about it).
+// Each share is one byte longer than secret:  the first byte is the
+// share's x coordinate (1 through n), and the rest are the values of
+// one random polynomial of degree k-1 per byte of secret.
+func ShamirSplit(secret []byte, k, n int) ([][]byte, error) {
+	if k < 1 || n < k || n > 255 {
+		return nil, fmt.Errorf("invalid %d-of-%d secret sharing", k, n)
+	}
+	coef := make([]byte, k-1)
+	ret := make([][]byte, n)
+	for i := range ret {
+		ret[i] = make([]byte, len(secret)+1)
+		ret[i][0] = byte(i + 1)
+	}
+	for j, s := range secret {
+		if _, err := rand.Read(coef); err != nil {
+			return nil, err
+		}
+		for i := range ret {
+			x := ret[i][0]
+			// Horner's rule
+			y := byte(0)
+			for c := len(coef) - 1; c >= 0; c-- {
+				y = gfMul(y^coef[c], x)
+			}
+			ret[i][j+1] = y ^ s
+		}
+	}
+	return ret, nil
+}
+
+// Reconstructs a secret from shares produced by ShamirSplit.  If
+// fewer than the original threshold of shares are supplied, the
+// result is garbage, so callers should check the result some other
+// way.
+func ShamirJoin(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares to join")
+	}
+	n := len(shares[0])
+	seen := map[byte]bool{}
+	for _, s := range shares {
+		if len(s) != n || n < 2 {
+			return nil, errors.New("shares have inconsistent lengths")
+		} else if s[0] == 0 || seen[s[0]] {
+			return nil, fmt.Errorf("invalid or duplicate share %d", s[0])
+		}
+		seen[s[0]] = true
+	}
+	ret := make([]byte, n-1)
+	for i, si := range shares {
+		// Lagrange basis polynomial for share i evaluated at 0
+		l := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				l = gfMul(l, gfDiv(sj[0], sj[0]^si[0]))
+			}
+		}
+		for b := range ret {
+			ret[b] ^= gfMul(l, si[b+1])
+		}
+	}
+	return ret, nil
+}
+
+// One word for each byte value, for writing binary data (such as
+// secret shares) by hand.  The first four letters of each word are
+// unique, so longer words can be abbreviated.
+var ShareWords = [256]string{
+	"able", "acid", "aged", "also", "anchor", "apple", "april", "arch",
+	"arena", "army", "atom", "aunt", "autumn", "avoid", "awake", "axis",
+	"baby", "bacon", "badge", "bake", "bald", "bamboo", "banana", "barn",
+	"basket", "beach", "beard", "bench", "berry", "bicycle", "bird", "blade",
+	"blanket", "bloom", "board", "boat", "bone", "bottle", "brave", "bread",
+	"brick", "bridge", "brush", "bubble", "bucket", "butter", "cabin", "cactus",
+	"cake", "camel", "cargo", "candle", "canoe", "canvas", "carbon", "carpet",
+	"castle", "cattle", "cave", "cedar", "chair", "chalk", "cheese", "cherry",
+	"chess", "chicken", "circle", "city", "clay", "cliff", "clock", "cloud",
+	"coast", "cobalt", "coffee", "comet", "copper", "coral", "cotton", "couch",
+	"cousin", "crane", "crayon", "cream", "cricket", "crown", "cube", "curtain",
+	"cycle", "daisy", "dance", "dawn", "decade", "deer", "desert", "diamond",
+	"dinner", "dolphin", "donkey", "door", "dragon", "drum", "duck", "dune",
+	"eagle", "earth", "echo", "eclipse", "eel", "eight", "elbow", "elephant",
+	"ember", "empty", "engine", "envelope", "equal", "eraser", "exit", "fabric",
+	"falcon", "family", "farm", "feather", "fence", "ferry", "fiber", "field",
+	"finger", "fire", "fish", "flag", "flame", "flute", "foam", "forest",
+	"fossil", "fountain", "fox", "frame", "frog", "fruit", "funnel", "galaxy",
+	"garden", "garlic", "gate", "gentle", "giant", "ginger", "glacier", "glass",
+	"globe", "glove", "goat", "gold", "grape", "gravel", "guitar", "hammer",
+	"harbor", "harvest", "hat", "hawk", "hazel", "helmet", "hero", "hill",
+	"hockey", "honey", "horse", "hotel", "house", "humor", "husky", "ice",
+	"igloo", "indigo", "inkwell", "island", "ivory", "jacket", "jaguar", "jazz",
+	"jelly", "jewel", "jungle", "kayak", "kernel", "kettle", "kidney", "kite",
+	"kitten", "koala", "ladder", "lake", "lamp", "lantern", "laptop", "lava",
+	"lemon", "leopard", "letter", "lily", "lion", "lizard", "lobster", "locket",
+	"lumber", "magnet", "mango", "maple", "marble", "meadow", "melon", "mirror",
+	"monkey", "moon", "mosaic", "motor", "mountain", "muffin", "mushroom", "napkin",
+	"nest", "nickel", "noodle", "north", "oasis", "ocean", "olive", "onion",
+	"orange", "orbit", "orchid", "otter", "oven", "owl", "oyster", "paddle",
+	"palace", "panda", "paper", "parrot", "peach", "pencil", "pepper", "piano",
+	"pillow", "pilot", "planet", "plum", "pocket", "pony", "potato", "puzzle",
+}
+
+var shareWordIndex = func() map[string]byte {
+	ret := map[string]byte{}
+	for i, w := range ShareWords {
+		ret[wordKey(w)] = byte(i)
+	}
+	return ret
+}()
+
+func wordKey(w string) string {
+	if len(w) > 4 {
+		return w[:4]
+	}
+	return w
+}
+
+// Encodes bytes as a space-separated list of ShareWords.
+func BytesToWords(bs []byte) string {
+	ws := make([]string, len(bs))
+	for i, b := range bs {
+		ws[i] = ShareWords[b]
+	}
+	return strings.Join(ws, " ")
+}
+
+// Decodes the output of BytesToWords, ignoring case and accepting
+// words abbreviated to their first four letters.
+func WordsToBytes(s string) ([]byte, error) {
+	ws := strings.Fields(strings.ToLower(s))
+	ret := make([]byte, len(ws))
+	for i, w := range ws {
+		b, ok := shareWordIndex[wordKey(w)]
+		if !ok || !strings.HasPrefix(ShareWords[b], w) {
+			return nil, fmt.Errorf("unknown word %q", w)
+		}
+		ret[i] = b
+	}
+	return ret, nil
+}
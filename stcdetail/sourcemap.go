@@ -0,0 +1,111 @@
+package stcdetail
+
+import (
+	"fmt"
+	"github.com/xdrpp/goxdr/xdr"
+	"github.com/xdrpp/stc/stx"
+	"io"
+	"strings"
+)
+
+// The location of one txrep field within the binary XDR encoding of
+// a structure.
+type XdrSpan struct {
+	Field  string // txrep field name, e.g., "tx.fee"
+	Offset int    // byte offset in the output of XdrToBin
+	Length int    // number of bytes, including padding
+}
+
+type byteCounter int
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+type sourceMapper struct {
+	spans []XdrSpan
+	pos   int
+	txrState
+}
+
+func (*sourceMapper) Sprintf(f string, args ...interface{}) string {
+	return fmt.Sprintf(f, args...)
+}
+
+func (sm *sourceMapper) add(field string, n int) {
+	sm.spans = append(sm.spans, XdrSpan{field, sm.pos, n})
+	sm.pos += n
+}
+
+func (sm *sourceMapper) Marshal(field string, i xdr.XdrType) {
+	sm.push(field, i)
+	defer sm.pop()
+	name := sm.name()
+
+	if k, ok := i.(xdr.XdrArrayOpaque); ok && k.XdrArraySize() == 32 &&
+		field == "sourceAccountEd25519" {
+		name = name[:len(name)-len(field)] + "sourceAccount"
+	}
+
+	switch v := i.(type) {
+	case *stx.Asset, stx.IsAccount, *stx.SignerKey:
+		// rendered on a single txrep line despite being unions
+	case xdr.XdrPtr:
+		sm.add(sm.present(), 4)
+		v.XdrMarshalValue(sm, "")
+		return
+	case xdr.XdrVec:
+		sm.add(sm.length(), 4)
+		v.XdrMarshalN(sm, "", v.GetVecLen())
+		return
+	case xdr.XdrAggregate:
+		v.XdrRecurse(sm, "")
+		return
+	}
+	var c byteCounter
+	i.XdrMarshal(&xdr.XdrOut{&c}, "")
+	sm.add(name, int(c))
+}
+
+// Returns the byte range that each field of t's txrep occupies in the
+// binary XDR encoding of t (as returned by XdrToBin), in order.  The
+// spans are contiguous and cover the entire encoding.  Pseudo-fields
+// (len and _present) get spans for the length or flag that XDR
+// encodes.  This is useful for annotating hex dumps and for tracking
+// down differences between XDR implementations.
+func TxrepSourceMap(t xdr.XdrType) []XdrSpan {
+	sm := sourceMapper{}
+	t.XdrMarshal(&sm, "")
+	return sm.spans
+}
+
+// Writes the binary XDR encoding of t to out as a hex dump, with each
+// txrep field's name beside its bytes.  Each line shows the offset
+// and up to 16 bytes, grouped into 4-byte XDR words.
+func WriteXdrDump(out io.Writer, t xdr.XdrType) {
+	bin := XdrToBin(t)
+	for _, span := range TxrepSourceMap(t) {
+		bs := bin[span.Offset : span.Offset+span.Length]
+		for off := 0; off == 0 || off < len(bs); off += 16 {
+			end := off + 16
+			if end > len(bs) {
+				end = len(bs)
+			}
+			words := []string{}
+			for w := off; w < end; w += 4 {
+				we := w + 4
+				if we > end {
+					we = end
+				}
+				words = append(words, fmt.Sprintf("%x", bs[w:we]))
+			}
+			label := span.Field
+			if off > 0 {
+				label = "..."
+			}
+			fmt.Fprintf(out, "%06x  %-35s  %s\n", span.Offset+off,
+				strings.Join(words, " "), label)
+		}
+	}
+}
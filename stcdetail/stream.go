@@ -4,12 +4,38 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
 	"time"
 )
 
+// Headers to send with every HTTP request made by NewRequest, such
+// as User-Agent.
+var DefaultHeader = http.Header{}
+
+// Like http.NewRequest, but adds DefaultHeader and then header (which
+// may be nil) to the request, with header taking precedence.  A
+// header whose only value is empty is removed instead.
+func NewRequest(method, url string, body io.Reader,
+	header http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range []http.Header{DefaultHeader, header} {
+		for k, vs := range h {
+			if len(vs) == 1 && vs[0] == "" {
+				req.Header.Del(k)
+			} else {
+				req.Header[k] = vs
+			}
+		}
+	}
+	return req, nil
+}
+
 // A status line for a non-200 HTTP response
 type HTTPerror struct {
 	Resp *http.Response
@@ -116,7 +142,13 @@ needs to reconnect.
 */
 func Stream(ctx context.Context, url string,
 	cb func(eventType string, data []byte) error) error {
-	req, err := http.NewRequest("GET", url, nil)
+	return StreamHeader(ctx, url, nil, cb)
+}
+
+// Like Stream, but sends additional HTTP headers with the request.
+func StreamHeader(ctx context.Context, url string, header http.Header,
+	cb func(eventType string, data []byte) error) error {
+	req, err := NewRequest("GET", url, nil, header)
 	if err != nil {
 		return err
 	}
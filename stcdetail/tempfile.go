@@ -0,0 +1,123 @@
+package stcdetail
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// Error returned by PrivateTempFile when a temporary directory could
+// be read or changed by other users.
+type ErrInsecureDir string
+
+func (e ErrInsecureDir) Error() string {
+	return string(e) + ": directory is accessible to other users"
+}
+
+// Returns the owner of a file, if the system reports one.
+func fileUid(fi os.FileInfo) (int, bool) {
+	v := reflect.ValueOf(fi.Sys())
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	uid := v.FieldByName("Uid")
+	switch uid.Kind() {
+	case reflect.Uint32, reflect.Uint64, reflect.Uint:
+		return int(uid.Uint()), true
+	case reflect.Int32, reflect.Int64, reflect.Int:
+		return int(uid.Int()), true
+	}
+	return 0, false
+}
+
+// Returns the private directory for the current user's temporary
+// files under os.TempDir(), creating it with mode 0700 if necessary.
+// Fails rather than use a directory that is a symbolic link, belongs
+// to another user, or is accessible to other users, since on shared
+// systems another user could otherwise create it first to watch or
+// replace the files in it.
+func PrivateTempDir() (string, error) {
+	name := "stc"
+	if uid := os.Getuid(); uid >= 0 {
+		name = fmt.Sprintf("stc-%d", uid)
+	}
+	dir := filepath.Join(os.TempDir(), name)
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	} else if !fi.IsDir() {
+		return "", ErrInsecureDir(dir)
+	} else if uid, ok := fileUid(fi); ok && uid != os.Getuid() {
+		return "", ErrInsecureDir(dir)
+	} else if os.Getuid() >= 0 && fi.Mode().Perm()&077 != 0 {
+		return "", ErrInsecureDir(dir)
+	}
+	return dir, nil
+}
+
+// Creates a new temporary file readable and writable only by the
+// current user (mode 0600), like ioutil.TempFile.  If dir is "", the
+// file goes in PrivateTempDir() rather than a directory shared with
+// other users.  Set dir to a memory file system (such as a tmpfs
+// mount) to keep the file off disk.  Remove the file with ShredFile.
+func PrivateTempFile(dir, pattern string) (*os.File, error) {
+	if dir == "" {
+		var err error
+		if dir, err = PrivateTempDir(); err != nil {
+			return nil, err
+		}
+	}
+	f, err := ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, err
+	} else if err = f.Chmod(0600); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// Overwrites the contents of a file with zeros and flushes them to
+// disk before removing it, so that the contents do not linger in
+// free blocks.  (This is the best a program can do, but file systems
+// that copy on write or keep snapshots, as well as SSDs, may still
+// retain the old contents.)  Returns nil if path does not exist.
+func ShredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err == nil && fi.Mode().IsRegular() {
+		zeros := make([]byte, 8192)
+		for left := fi.Size(); left > 0 && err == nil; {
+			n := int64(len(zeros))
+			if left < n {
+				n = left
+			}
+			_, err = f.Write(zeros[:n])
+			left -= n
+		}
+		if err == nil {
+			err = f.Sync()
+		}
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err2 := os.Remove(path); err == nil {
+		err = err2
+	}
+	return err
+}
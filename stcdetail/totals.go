@@ -0,0 +1,154 @@
+package stcdetail
+
+import (
+	"math"
+
+	"github.com/xdrpp/stc/stx"
+)
+
+// Amounts keyed by asset (in the format of stx.Asset.String(), e.g.,
+// "native" or "USD:GABC...").
+type AssetAmounts map[string]int64
+
+func (aa AssetAmounts) add(asset *stx.Asset, amount int64) {
+	k := asset.String()
+	if sum := aa[k] + amount; amount > 0 && sum < aa[k] {
+		aa[k] = math.MaxInt64
+	} else {
+		aa[k] = sum
+	}
+}
+
+// A summary of the value a transaction moves, for review before
+// signing.  Accounts are keyed by AccountID strkey (so multiplexed
+// accounts are combined with their underlying account).
+type TxAmounts struct {
+	// Amounts delivered to other accounts (or claimable balances) by
+	// the whole transaction.  For path payments, this counts the
+	// destination amount.
+	Sent AssetAmounts
+
+	// Amounts each source account sends, by the same measure as
+	// Sent.
+	BySource map[string]AssetAmounts
+
+	// The most each source account can lose, counting fees, the
+	// sendMax of path payments, and the full amount of offers.
+	MaxDebit map[string]AssetAmounts
+
+	// Source accounts of ACCOUNT_MERGE operations, whose entire
+	// native balance is sent.
+	Merged []string
+}
+
+func (tt *TxAmounts) source(src string) (AssetAmounts, AssetAmounts) {
+	if tt.BySource[src] == nil {
+		tt.BySource[src] = AssetAmounts{}
+		tt.MaxDebit[src] = AssetAmounts{}
+	}
+	return tt.BySource[src], tt.MaxDebit[src]
+}
+
+// Returns the transaction and fee-paying source account of e, which
+// for a fee-bump is the inner transaction and the fee source.
+func innerTx(e *stx.TransactionEnvelope) (*stx.Transaction, *stx.MuxedAccount,
+	int64) {
+	switch e.Type {
+	case stx.ENVELOPE_TYPE_TX_V0:
+		v0 := &e.V0().Tx
+		tx := &stx.Transaction{
+			SourceAccount: stx.MuxedAccount{Type: stx.KEY_TYPE_ED25519},
+			Fee:           v0.Fee,
+			SeqNum:        v0.SeqNum,
+			TimeBounds:    v0.TimeBounds,
+			Memo:          v0.Memo,
+			Operations:    v0.Operations,
+		}
+		*tx.SourceAccount.Ed25519() = v0.SourceAccountEd25519
+		return tx, &tx.SourceAccount, int64(v0.Fee)
+	case stx.ENVELOPE_TYPE_TX:
+		tx := &e.V1().Tx
+		return tx, &tx.SourceAccount, int64(tx.Fee)
+	case stx.ENVELOPE_TYPE_TX_FEE_BUMP:
+		fb := &e.FeeBump().Tx
+		return &fb.InnerTx.V1().Tx, &fb.FeeSource, fb.Fee
+	}
+	return nil, nil, 0
+}
+
+func acctKey(ma *stx.MuxedAccount) string {
+	return ma.ToSignerKey().String()
+}
+
+var nativeAsset = stx.Asset{Type: stx.ASSET_TYPE_NATIVE}
+
+// Computes the totals of amounts sent and possibly debited by a
+// transaction.
+func TxTotals(e *stx.TransactionEnvelope) *TxAmounts {
+	tt := &TxAmounts{
+		Sent:     AssetAmounts{},
+		BySource: map[string]AssetAmounts{},
+		MaxDebit: map[string]AssetAmounts{},
+	}
+	tx, feeSource, fee := innerTx(e)
+	if tx == nil {
+		return tt
+	}
+	_, debit := tt.source(acctKey(feeSource))
+	debit.add(&nativeAsset, fee)
+
+	for i := range tx.Operations {
+		op := &tx.Operations[i]
+		src := &tx.SourceAccount
+		if op.SourceAccount != nil {
+			src = op.SourceAccount
+		}
+		sent, debit := tt.source(acctKey(src))
+		send := func(asset *stx.Asset, amount, max int64) {
+			tt.Sent.add(asset, amount)
+			sent.add(asset, amount)
+			debit.add(asset, max)
+		}
+		switch op.Body.Type {
+		case stx.CREATE_ACCOUNT:
+			b := op.Body.CreateAccountOp().StartingBalance
+			send(&nativeAsset, b, b)
+		case stx.PAYMENT:
+			p := op.Body.PaymentOp()
+			send(&p.Asset, p.Amount, p.Amount)
+		case stx.PATH_PAYMENT_STRICT_RECEIVE:
+			p := op.Body.PathPaymentStrictReceiveOp()
+			tt.Sent.add(&p.DestAsset, p.DestAmount)
+			sent.add(&p.DestAsset, p.DestAmount)
+			debit.add(&p.SendAsset, p.SendMax)
+		case stx.PATH_PAYMENT_STRICT_SEND:
+			p := op.Body.PathPaymentStrictSendOp()
+			tt.Sent.add(&p.DestAsset, p.DestMin)
+			sent.add(&p.DestAsset, p.DestMin)
+			debit.add(&p.SendAsset, p.SendAmount)
+		case stx.CREATE_CLAIMABLE_BALANCE:
+			c := op.Body.CreateClaimableBalanceOp()
+			send(&c.Asset, c.Amount, c.Amount)
+		case stx.MANAGE_SELL_OFFER:
+			o := op.Body.ManageSellOfferOp()
+			debit.add(&o.Selling, o.Amount)
+		case stx.CREATE_PASSIVE_SELL_OFFER:
+			o := op.Body.CreatePassiveSellOfferOp()
+			debit.add(&o.Selling, o.Amount)
+		case stx.MANAGE_BUY_OFFER:
+			o := op.Body.ManageBuyOfferOp()
+			if o.Price.N > 0 && o.Price.D > 0 {
+				// Selling amount is buyAmount * price, rounded up
+				n, d := int64(o.Price.N), int64(o.Price.D)
+				if o.BuyAmount <= math.MaxInt64/n {
+					debit.add(&o.Selling, (o.BuyAmount*n+d-1)/d)
+				} else {
+					debit.add(&o.Selling, math.MaxInt64)
+				}
+			}
+		case stx.ACCOUNT_MERGE:
+			tt.Merged = append(tt.Merged, acctKey(src))
+		}
+	}
+	return tt
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package stcdetail
+
+import (
+	"os"
+)
+
+// Opens the terminal for reading a passphrase and writing a prompt.
+func openTty() (in, out *os.File, err error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	return tty, tty, err
+}
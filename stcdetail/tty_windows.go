@@ -0,0 +1,19 @@
+package stcdetail
+
+import (
+	"os"
+)
+
+// Opens the console for reading a passphrase and writing a prompt.
+// Windows has no /dev/tty, but CONIN$ and CONOUT$ name the console
+// even when standard input and output are redirected.
+func openTty() (in, out *os.File, err error) {
+	if in, err = os.OpenFile("CONIN$", os.O_RDWR, 0); err != nil {
+		return nil, nil, err
+	}
+	if out, err = os.OpenFile("CONOUT$", os.O_RDWR, 0); err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+	return in, out, nil
+}
@@ -5,11 +5,18 @@
 package stcdetail
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"github.com/xdrpp/goxdr/xdr"
 	"github.com/xdrpp/stc/stx"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,6 +26,58 @@ const (
 	ps_present = "_present"
 )
 
+// Variants of the txrep syntax.  An XdrType passed to WriteTxrep or
+// XdrFromTxrep selects a dialect by implementing the method
+// GetTxrepDialect() TxrepDialect.  The default is TxrepStc.
+type TxrepDialect int
+
+const (
+	// The dialect stc has always used.  The native asset is rendered
+	// using the network's configured name (e.g., XLM) and strings
+	// use Go's quoting syntax.
+	TxrepStc TxrepDialect = iota
+
+	// Strict SEP-0011, for interoperating with other
+	// implementations.  The native asset is always rendered and
+	// parsed as "native", strings use only the escapes \", \\, \n, and
+	// \xNN (see QuoteSEP11), and booleans must be exactly true or
+	// false.
+	TxrepSEP11
+
+	// The stc dialect, but leaving out lines that the rest of the
+	// output makes redundant:  _present: true before the contents of
+	// a pointer, and the len of a non-empty vector, whose entries
+	// are enumerated.  All dialects accept these lines being left
+	// out on input.
+	TxrepCompact
+)
+
+func (d TxrepDialect) String() string {
+	switch d {
+	case TxrepStc:
+		return "stc"
+	case TxrepSEP11:
+		return "sep11"
+	case TxrepCompact:
+		return "compact"
+	}
+	return fmt.Sprintf("TxrepDialect(%d)", int(d))
+}
+
+func getTxrepStrict(t xdr.XdrType) bool {
+	if i, ok := t.(interface{ GetTxrepStrict() bool }); ok {
+		return i.GetTxrepStrict()
+	}
+	return false
+}
+
+func getTxrepDialect(t xdr.XdrType) TxrepDialect {
+	if i, ok := t.(interface{ GetTxrepDialect() TxrepDialect }); ok {
+		return i.GetTxrepDialect()
+	}
+	return TxrepStc
+}
+
 //
 // Generating TxRep
 //
@@ -91,7 +150,7 @@ func dotJoin(a string, b string) string {
 	} else if b[0] == '[' {
 		return a + b
 	}
-	return fmt.Sprintf("%s.%s", a, b)
+	return a + "." + b
 }
 
 type xdrHolder struct {
@@ -118,6 +177,8 @@ func xparentUnion(h *xdrHolder) xdr.XdrUnion {
 
 type txrState struct {
 	front *xdrHolder
+	// Popped holders, for reuse by push
+	free *xdrHolder
 	err XdrBadValue
 }
 
@@ -133,11 +194,14 @@ func (xs *txrState) validTags() map[int32]bool {
 
 func (xs *txrState) push(field string, obj xdr.XdrType) {
 	parent := xs.front
-	h := &xdrHolder {
-		field: field,
-		obj: obj,
-		next: parent,
+	h := xs.free
+	if h != nil {
+		xs.free = h.next
+		*h = xdrHolder{}
+	} else {
+		h = &xdrHolder{}
 	}
+	h.field, h.obj, h.next = field, obj, parent
 	xs.front = h
 
 	if _, ok := obj.(xdr.XdrPtr); ok {
@@ -157,13 +221,30 @@ func (xs *txrState) push(field string, obj xdr.XdrType) {
 }
 
 func (xs *txrState) pop() {
-	xs.front = xs.front.next
+	h := xs.front
+	xs.front = h.next
+	h.obj, h.next = nil, xs.free
+	xs.free = h
 }
 
+// Returns the envelope whose signatures are being marshaled.  Inside
+// the inner transaction of a fee bump, this is a new envelope
+// containing just the inner transaction, so that inner signatures
+// are checked against the inner transaction's hash.
 func (xs *txrState) envelope() *stx.TransactionEnvelope {
 	for h := xs.front; h != nil; h = h.next {
-		if e, ok := h.obj.(*stx.TransactionEnvelope); ok {
+		switch e := h.obj.(type) {
+		case *stx.TransactionEnvelope:
 			return e
+		case *stx.TransactionV1Envelope:
+			if h.next == nil {
+				break
+			} else if _, ok := h.next.obj.(
+				*stx.XdrAnon_FeeBumpTransaction_InnerTx); ok {
+				ret := &stx.TransactionEnvelope{Type: stx.ENVELOPE_TYPE_TX}
+				*ret.V1() = *e
+				return ret
+			}
 		}
 	}
 	return nil
@@ -189,16 +270,68 @@ type txStringCtx struct {
 	accountIDNote func(string) string
 	sigNote       func(*stx.TransactionEnvelope, *stx.DecoratedSignature) string
 	signerNote    func(*stx.SignerKey) string
+	offerNote     func(int64) string
 	getHelp       func(string) bool
-	out           io.Writer
+	out           txrepWriter
+	// First error writing out, after which nothing more is written
+	werr          error
 	native        string
+	dialect       TxrepDialect
 	txrState
 }
 
+// Where txrep output goes:  a caller's in-memory or buffered writer
+// as is, or else a pooled bufio.Writer, which reports short writes
+// as io.ErrShortWrite and keeps the first error.
+type txrepWriter interface {
+	io.Writer
+	io.StringWriter
+}
+
+var txrepWriterPool = sync.Pool{
+	New: func() interface{} { return bufio.NewWriterSize(nil, 8192) },
+}
+
+// The generated XdrRecurse methods name every field with Sprintf,
+// which would dominate the cost of txrep generation, so the formats
+// they use most are handled without fmt.
 func (xp *txStringCtx) Sprintf(f string, args ...interface{}) string {
+	switch len(args) {
+	case 1:
+		if s, ok := args[0].(string); ok && strings.HasPrefix(f, "%s") &&
+			strings.IndexByte(f[2:], '%') < 0 {
+			return s + f[2:]
+		}
+	case 2:
+		if s, ok := args[0].(string); ok && f == "%s[%d]" {
+			if i, ok := args[1].(int); ok {
+				return s + "[" + strconv.Itoa(i) + "]"
+			}
+		}
+	}
 	return fmt.Sprintf(f, args...)
 }
 
+func (xp *txStringCtx) printf(f string, args ...interface{}) {
+	if xp.werr == nil {
+		_, xp.werr = fmt.Fprintf(xp.out, f, args...)
+	}
+}
+
+// Writes the line "name: val", where val is the concatenation of
+// vals, without the allocations of printf.
+func (xp *txStringCtx) field(name string, vals ...string) {
+	if xp.werr != nil {
+		return
+	}
+	xp.out.WriteString(name)
+	xp.out.WriteString(": ")
+	for _, v := range vals {
+		xp.out.WriteString(v)
+	}
+	_, xp.werr = xp.out.WriteString("\n")
+}
+
 var exp10 [20]uint64
 
 func init() {
@@ -217,26 +350,74 @@ func ScaleFmt(val int64, exp int) string {
 	}
 	unit := exp10[exp]
 
-	out := ""
-	for tmag := mag / unit; ; tmag /= 1000 {
-		if out != "" {
-			out = "," + out
-		}
-		if tmag < 1000 {
-			out = fmt.Sprintf("%d", tmag) + out
-			break
-		}
-		out = fmt.Sprintf("%03d", tmag%1000) + out
-	}
+	digits := strconv.FormatUint(mag/unit, 10)
+	out := make([]byte, 0, 48)
 	if val < 0 {
-		out = "-" + out
+		out = append(out, '-')
+	}
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, digits[i])
 	}
 
 	mag %= unit
 	if mag > 0 {
-		out += strings.TrimRight(fmt.Sprintf(".%0*d", exp, mag), "0")
+		frac := strconv.FormatUint(mag, 10)
+		out = append(out, '.')
+		for i := len(frac); i < exp; i++ {
+			out = append(out, '0')
+		}
+		out = append(out, strings.TrimRight(frac, "0")...)
 	}
-	return out + "e" + fmt.Sprintf("%d", exp)
+	out = append(out, 'e')
+	return string(strconv.AppendInt(out, int64(exp), 10))
+}
+
+// Describes the worst exchange rate a path payment accepts, when
+// marshaling the destMin of a strict send or the sendMax of a strict
+// receive.
+func (xp *txStringCtx) worstRate() string {
+	h := xp.front
+	if h.next == nil {
+		return ""
+	}
+	asset := func(a *stx.Asset) string {
+		if a.Type == stx.ASSET_TYPE_NATIVE {
+			return xp.native
+		}
+		return strings.SplitN(a.String(), ":", 2)[0]
+	}
+	switch op := h.next.obj.(type) {
+	case *stx.PathPaymentStrictSendOp:
+		if h.field == "destMin" && op.SendAmount > 0 {
+			return fmt.Sprintf("at least %.7g %s per %s",
+				float64(op.DestMin)/float64(op.SendAmount),
+				asset(&op.DestAsset), asset(&op.SendAsset))
+		}
+	case *stx.PathPaymentStrictReceiveOp:
+		if h.field == "sendMax" && op.DestAmount > 0 {
+			return fmt.Sprintf("at most %.7g %s per %s",
+				float64(op.SendMax)/float64(op.DestAmount),
+				asset(&op.SendAsset), asset(&op.DestAsset))
+		}
+	}
+	return ""
+}
+
+// Comments on the offerID of an operation that modifies or deletes an
+// existing offer.
+func (xp *txStringCtx) offerIDNote(id int64) string {
+	h := xp.front
+	if id == 0 || h.field != "offerID" || h.next == nil {
+		return ""
+	}
+	switch h.next.obj.(type) {
+	case *stx.ManageSellOfferOp, *stx.ManageBuyOfferOp:
+		return xp.offerNote(id)
+	}
+	return ""
 }
 
 func dateComment(ut uint64) string {
@@ -254,10 +435,32 @@ func PrintVecOpaque(bs []byte) string {
 	if len(bs) == 0 {
 		return "0 bytes"
 	}
-	return fmt.Sprintf("%x", bs)
+	return hex.EncodeToString(bs)
+}
+
+// Returns the value being marshaled if its XDR type is DataValue.  A
+// DataValue arrives as stx.XdrType_DataValue, except that an optional
+// one (as in ManageDataOp) arrives as the plain XdrVecOpaque under a
+// pointer of type DataValue*.  DataValues are quoted as text when
+// IsText says they are text, and otherwise shown in hex.
+func (xs *txrState) dataValue(i xdr.XdrType) (xdr.XdrVecOpaque, bool) {
+	switch v := i.(type) {
+	case stx.XdrType_DataValue:
+		return v.XdrVecOpaque, true
+	case xdr.XdrVecOpaque:
+		h := xs.front
+		if h != nil && h.next != nil && h.next.obj.XdrTypeName() ==
+			(stx.XdrType_DataValue{}).XdrTypeName()+"*" {
+			return v, true
+		}
+	}
+	return xdr.XdrVecOpaque{}, false
 }
 
 func (xp *txStringCtx) Marshal(field string, i xdr.XdrType) {
+	if xp.werr != nil {
+		return
+	}
 	xp.push(field, i)
 	defer xp.pop()
 	name := xp.name()
@@ -282,34 +485,47 @@ func (xp *txStringCtx) Marshal(field string, i xdr.XdrType) {
 		copy(pk.Ed25519()[:], k.GetByteSlice())
 		i = pk
 	}
+	if str, ok := xdr.XdrBaseType(i).(xdr.XdrString); ok &&
+		xp.dialect == TxrepSEP11 {
+		xp.printf("%s: %s\n", name, QuoteSEP11(str.GetString()))
+		return
+	}
+	if dv, ok := xp.dataValue(i); ok && xp.dialect != TxrepSEP11 &&
+		IsText(dv.GetByteSlice()) {
+		xp.printf("%s: %q\n", name, dv.GetByteSlice())
+		return
+	}
 	switch v := i.(type) {
 	case stx.XdrType_SequenceNumber:
-		fmt.Fprintf(xp.out, "%s: %d\n", name, v.XdrValue())
+		xp.printf("%s: %d\n", name, v.XdrValue())
 	case stx.XdrType_TimePoint:
 		tp := v.XdrValue().(stx.TimePoint)
-		fmt.Fprintf(xp.out, "%s: %d%s\n", name, tp, dateComment(tp))
+		xp.printf("%s: %d%s\n", name, tp, dateComment(tp))
 	case *stx.Asset:
 		asset := v.String()
 		if asset == "native" {
 			asset = xp.native
 		}
-		fmt.Fprintf(xp.out, "%s: %s\n", name, asset)
+		xp.field(name, asset)
 	case stx.IsAccount:
 		ac := v.String()
+		if xp.dialect != TxrepSEP11 && isZeroAccountRep(v) {
+			ac = zeroAccountRep
+		}
 		if hint := xp.accountIDNote(ac); hint != "" {
-			fmt.Fprintf(xp.out, "%s: %s (%s)\n", name, ac, hint)
+			xp.field(name, ac, " (", hint, ")")
 		} else {
-			fmt.Fprintf(xp.out, "%s: %s\n", name, ac)
+			xp.field(name, ac)
 		}
 	case *stx.SignerKey:
 		if hint := xp.signerNote(v); hint != "" {
-			fmt.Fprintf(xp.out, "%s: %s (%s)\n", name, v, hint)
+			xp.printf("%s: %s (%s)\n", name, v, hint)
 		} else {
-			fmt.Fprintf(xp.out, "%s: %s\n", name, v)
+			xp.field(name, v.String())
 		}
 	case xdr.XdrEnum:
-		if xp.getHelp(name) {
-			fmt.Fprintf(xp.out, "%s: %s (", name, v.String())
+		if xp.getHelp(name) || xp.getHelp(v.XdrTypeName()) {
+			xp.printf("%s: %s (", name, v.String())
 			var notfirst bool
 			valid := xp.validTags()
 			for n, name := range v.XdrEnumNames() {
@@ -317,28 +533,50 @@ func (xp *txStringCtx) Marshal(field string, i xdr.XdrType) {
 					continue
 				}
 				if notfirst {
-					fmt.Fprintf(xp.out, ", %s", name)
+					xp.printf(", %s", name)
 				} else {
 					notfirst = true
-					fmt.Fprintf(xp.out, "%s", name)
+					xp.printf("%s", name)
 				}
 			}
-			fmt.Fprintf(xp.out, ")\n")
+			xp.printf(")\n")
 		} else {
-			fmt.Fprintf(xp.out, "%s: %s\n", name, v.String())
+			xp.field(name, v.String())
 		}
 	case stx.XdrType_Int64:
-		fmt.Fprintf(xp.out, "%s: %s (%s)\n", name, v.String(),
-			ScaleFmt(int64(v.GetU64()), 7))
+		if field == "absBefore" {
+			xp.printf("%s: %s%s\n", name, v.String(),
+				dateComment(v.GetU64()))
+			break
+		} else if field == "relBefore" && v.GetU64() < 1<<32 {
+			xp.printf("%s: %s (%s)\n", name, v.String(),
+				time.Duration(v.GetU64())*time.Second)
+			break
+		} else if note := xp.offerIDNote(int64(v.GetU64()));
+		note != "" {
+			xp.printf("%s: %s (%s)\n", name, v.String(), note)
+			break
+		} else if rate := xp.worstRate(); rate != "" {
+			xp.printf("%s: %s (%s; %s)\n", name, v.String(),
+				ScaleFmt(int64(v.GetU64()), 7), rate)
+			break
+		}
+		xp.field(name, strconv.FormatInt(int64(v.GetU64()), 10), " (",
+			ScaleFmt(int64(v.GetU64()), 7), ")")
 	case xdr.XdrVecOpaque:
-		fmt.Fprintf(xp.out, "%s: %s\n", name, PrintVecOpaque(v.GetByteSlice()))
+		xp.field(name, PrintVecOpaque(v.GetByteSlice()))
 	case fmt.Stringer:
-		fmt.Fprintf(xp.out, "%s: %s\n", name, v.String())
+		xp.field(name, v.String())
 	case xdr.XdrPtr:
-		fmt.Fprintf(xp.out, "%s: %v\n", xp.present(), v.GetPresent())
+		if xp.dialect != TxrepCompact || !v.GetPresent() {
+			xp.field(xp.present(), strconv.FormatBool(v.GetPresent()))
+		}
 		v.XdrMarshalValue(xp, "")
 	case xdr.XdrVec:
-		fmt.Fprintf(xp.out, "%s: %d\n", xp.length(), v.GetVecLen())
+		if xp.dialect != TxrepCompact || v.GetVecLen() == 0 {
+			xp.field(xp.length(),
+				strconv.FormatUint(uint64(v.GetVecLen()), 10))
+		}
 		v.XdrMarshalN(xp, "", v.GetVecLen())
 	case *stx.DecoratedSignature:
 		var hint string
@@ -347,18 +585,30 @@ func (xp *txStringCtx) Marshal(field string, i xdr.XdrType) {
 		} else {
 			hint = fmt.Sprintf("%x", v.Hint)
 		}
-		fmt.Fprintf(xp.out, "%[1]s.hint: %[2]s\n%[1]s.signature: %[3]s\n",
+		xp.printf("%[1]s.hint: %[2]s\n%[1]s.signature: %[3]s\n",
 			name, hint, PrintVecOpaque(v.Signature))
 	case xdr.XdrAggregate:
 		v.XdrRecurse(xp, "")
 	default:
-		fmt.Fprintf(xp.out, "%s: %v\n", name, i)
+		xp.printf("%s: %v\n", name, i)
 	}
 }
 
 // Writes a human-readable version of a transaction or other XdrType
-// structure to out in txrep format.  The following methods on t can
-// be used to add comments into the output
+// structure to out in txrep format, like WriteTxrep, and returns any
+// illegal values.  Errors writing to out are not reported.
+//
+// Deprecated: Use WriteTxrep, which also reports write errors.
+func XdrToTxrep(out io.Writer, name string, t xdr.XdrType) XdrBadValue {
+	bv, _ := WriteTxrep(out, name, t).(XdrBadValue)
+	return bv
+}
+
+// Writes a human-readable version of a transaction or other XdrType
+// structure to out in txrep format.  Stops at the first error writing
+// to out (including a short write) and returns it; otherwise, returns
+// an XdrBadValue listing any illegal values, or nil.  The following
+// methods on t can be used to add comments into the output
 //
 // Comment for AccountID:
 //   AccountIDNote(string) string
@@ -369,18 +619,42 @@ func (xp *txStringCtx) Marshal(field string, i xdr.XdrType) {
 // Comment for Signature:
 //   SigNote(*TransactionEnvelope, *DecoratedSignature) string
 //
-// Help comment for field fieldname:
+// Comment for the offerID of an operation modifying an offer:
+//   OfferNote(int64) string
+//
+// Help comment for an enum field, requested either by the field name
+// or by the enum's type name (e.g., "OperationType"):
 //   GetHelp(fieldname string) bool
-func XdrToTxrep(out io.Writer, name string, t xdr.XdrType) XdrBadValue {
+//
+// Name of the native asset (ignored for TxrepSEP11):
+//   GetNativeAsset() string
+//
+// Dialect of txrep to produce:
+//   GetTxrepDialect() TxrepDialect
+func WriteTxrep(out io.Writer, name string, t xdr.XdrType) error {
 	ctx := txStringCtx{
 		accountIDNote: func(string) string { return "" },
 		signerNote: func(*stx.SignerKey) string { return "" },
+		offerNote: func(int64) string { return "" },
 		sigNote: func(*stx.TransactionEnvelope,
 			*stx.DecoratedSignature) string {
 			return ""
 		},
 		getHelp: func(string) bool { return false },
-		out:     out,
+		dialect: getTxrepDialect(t),
+	}
+	var pooled *bufio.Writer
+	switch w := out.(type) {
+	case *strings.Builder, *bytes.Buffer, *bufio.Writer:
+		ctx.out = w.(txrepWriter)
+	default:
+		pooled = txrepWriterPool.Get().(*bufio.Writer)
+		pooled.Reset(out)
+		defer func() {
+			pooled.Reset(nil)
+			txrepWriterPool.Put(pooled)
+		}()
+		ctx.out = pooled
 	}
 
 	if i, ok := t.(interface{ AccountIDNote(string) string }); ok {
@@ -394,18 +668,26 @@ func XdrToTxrep(out io.Writer, name string, t xdr.XdrType) XdrBadValue {
 	}); ok {
 		ctx.sigNote = i.SigNote
 	}
+	if i, ok := t.(interface{ OfferNote(int64) string }); ok {
+		ctx.offerNote = i.OfferNote
+	}
 	if i, ok := t.(interface{ GetHelp(string) bool }); ok {
 		ctx.getHelp = i.GetHelp
 	}
 	if i, ok := t.(interface{ GetNativeAsset() string }); ok {
 		ctx.native = i.GetNativeAsset()
 	}
-	if ctx.native == "" {
+	if ctx.native == "" || ctx.dialect == TxrepSEP11 {
 		ctx.native = "native"
 	}
 
 	t.XdrMarshal(&ctx, name)
-	if len(ctx.err) > 0 {
+	if pooled != nil && ctx.werr == nil {
+		ctx.werr = pooled.Flush()
+	}
+	if ctx.werr != nil {
+		return ctx.werr
+	} else if len(ctx.err) > 0 {
 		return ctx.err
 	}
 	return nil
@@ -425,7 +707,7 @@ type TxrepError []struct {
 func (e TxrepError) render(prefix string) string {
 	out := &strings.Builder{}
 	for i := range e {
-		fmt.Fprintf(out, "%s%d: %s\n", prefix, e[i].Line, e[i].Msg)
+		fmt.Fprintf(out, "%s%d: %s\n", prefix, e[i].Line, Redact(e[i].Msg))
 	}
 	return out.String()
 }
@@ -458,6 +740,10 @@ type xdrScan struct {
 	setHelp func(string)
 	native  *string
 	lastlv *lineval
+	dialect TxrepDialect
+	resolveAccount func(string) (string, error)
+	// In strict mode, names of fields absent from the input
+	missing map[string]bool
 }
 
 func (*xdrScan) Sprintf(f string, args ...interface{}) string {
@@ -500,6 +786,8 @@ func (xs *xdrScan) Marshal(field string, i xdr.XdrType) {
 	lv, ok = xs.kvs[name]
 	if ok {
 		xs.lastlv = &lv
+	} else if xs.missing != nil {
+		xs.missing[name] = true
 	}
 	defer func() {
 		switch e := recover().(type) {
@@ -514,6 +802,49 @@ func (xs *xdrScan) Marshal(field string, i xdr.XdrType) {
 	if init, hasInit := i.(interface{ XdrInitialize() }); hasInit {
 		init.XdrInitialize()
 	}
+	if dv, isdv := xs.dataValue(i); isdv && ok &&
+		xs.dialect != TxrepSEP11 {
+		if bs, err, handled := scanDataValue(val); handled {
+			if err != nil {
+				xs.setHelp(name)
+				xs.report(lv.line, "%s", err.Error())
+			} else {
+				dv.SetByteSlice(bs)
+			}
+			if len(val) > 0 && val[len(val)-1] == '?' {
+				xs.setHelp(name)
+			}
+			delete(xs.kvs, name)
+			return
+		}
+	}
+	if ok && xs.dialect != TxrepSEP11 && xs.scanZeroAccount(i, val) {
+		delete(xs.kvs, name)
+		return
+	}
+	if ok && xs.dialect != TxrepSEP11 && xs.resolveAccount != nil &&
+		xs.scanAccountName(name, i, lv) {
+		delete(xs.kvs, name)
+		return
+	}
+	if ok && xs.dialect == TxrepSEP11 && xs.scanSEP11(name, i, lv) {
+		delete(xs.kvs, name)
+		return
+	}
+	if cp, iscp := i.(*stx.ClaimPredicate); iscp && ok {
+		// A predicate written as an expression on one line
+		if xs.dialect == TxrepSEP11 {
+			xs.report(lv.line,
+				"SEP-0011 txrep does not allow predicate expressions")
+		} else if p, err := ParsePredicate(val); err != nil {
+			xs.setHelp(name)
+			xs.report(lv.line, "%s", err.Error())
+		} else {
+			*cp = *p
+		}
+		delete(xs.kvs, name)
+		return
+	}
 	switch v := i.(type) {
 	case xdr.XdrArrayOpaque:
 		if !ok {
@@ -542,8 +873,12 @@ func (xs *xdrScan) Marshal(field string, i xdr.XdrType) {
 		}
 	case *xdr.XdrSize:
 		var size uint32
-		lv = xs.kvs[xs.length()]
-		fmt.Sscan(lv.val, &size)
+		if lv, ok = xs.kvs[xs.length()]; ok {
+			delete(xs.kvs, xs.length())
+			fmt.Sscan(lv.val, &size)
+		} else {
+			size, lv = xs.impliedLen(name)
+		}
 		if size <= v.XdrBound() {
 			v.SetU32(size)
 		} else {
@@ -565,7 +900,9 @@ func (xs *xdrScan) Marshal(field string, i xdr.XdrType) {
 		}
 	case xdr.XdrPtr:
 		val = "false"
-		if _, err := fmt.Sscanf(xs.kvs[xs.present()].val, "%s", &val);
+		plv := xs.kvs[xs.present()]
+		delete(xs.kvs, xs.present())
+		if _, err := fmt.Sscanf(plv.val, "%s", &val);
 		err != nil {
 			if ok {
 				val = "true"
@@ -587,10 +924,21 @@ func (xs *xdrScan) Marshal(field string, i xdr.XdrType) {
 		default:
 			// We are throwing error anyway, so also try parsing any fields
 			v.SetPresent(true)
-			xs.report(xs.kvs[xs.present()].line,
+			xs.report(plv.line,
 				"%s (%s) must be true or false", xs.present(), val)
 		}
 		v.XdrMarshalValue(xs, "")
+	case *stx.XdrAnon_Operation_Body:
+		line := 0
+		if tlv, hasType := xs.kvs[dotJoin(name, "type")]; hasType {
+			line = tlv.line
+		} else if xs.lastlv != nil {
+			line = xs.lastlv.line
+		}
+		v.XdrRecurse(xs, "")
+		if xs.missing != nil {
+			xs.checkRequired(name, v, line)
+		}
 	case xdr.XdrAggregate:
 		v.XdrRecurse(xs, "")
 	default:
@@ -602,34 +950,291 @@ func (xs *xdrScan) Marshal(field string, i xdr.XdrType) {
 	delete(xs.kvs, name)
 }
 
-type inputLine []byte
+// Returns the length of vector name implied by the highest index
+// among the input's fields, for input that leaves out name.len, and
+// the line of that field.
+func (xs *xdrScan) impliedLen(name string) (uint32, lineval) {
+	var size uint32
+	var lv lineval
+	prefix := name + "["
+	for f, flv := range xs.kvs {
+		if !strings.HasPrefix(f, prefix) {
+			continue
+		}
+		end := strings.IndexByte(f[len(prefix):], ']')
+		if end < 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(f[len(prefix):len(prefix)+end], 10, 31)
+		if err == nil && uint32(n) >= size {
+			size, lv = uint32(n)+1, flv
+		}
+	}
+	return size, lv
+}
+
+// Parses the forms of DataValue beyond plain hex:  a quoted string,
+// or the prefixes text:, hex:, or b64: (standard base64).  The text:
+// form runs up to a # comment or the end of the line, less trailing
+// whitespace and any trailing ? help marker, so text containing # or
+// ending with ? or whitespace must be quoted instead.  Returns handled
+// false for anything else.
+func scanDataValue(val string) (bs []byte, err error, handled bool) {
+	tval := strings.TrimLeft(val, " ")
+	var word string
+	switch {
+	case strings.HasPrefix(tval, "\""):
+		var str string
+		_, err = fmt.Sscanf(tval, "%q", &str)
+		return []byte(str), err, true
+	case strings.HasPrefix(tval, "text:"):
+		text := tval[5:]
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimRight(text, " \t")
+		text = strings.TrimRight(strings.TrimSuffix(text, "?"), " \t")
+		return []byte(text), nil, true
+	case strings.HasPrefix(tval, "hex:"):
+		fmt.Sscan(tval[4:], &word)
+		bs, err = hex.DecodeString(word)
+		return bs, err, true
+	case strings.HasPrefix(tval, "b64:"):
+		fmt.Sscan(tval[4:], &word)
+		bs, err = base64.StdEncoding.DecodeString(word)
+		return bs, err, true
+	}
+	return nil, nil, false
+}
+
+// How the stc dialect renders the all-zero account (see
+// stx.IsZeroAccountID), so that an account that was never filled in
+// does not look like a real one.  SEP-0011 has no such literal, so
+// the TxrepSEP11 dialect uses the zero account's strkey.
+const zeroAccountRep = "NONE"
+
+// Returns true for a zero account that can be rendered as
+// zeroAccountRep without losing information, meaning it does not
+// have a multiplexed ID.
+func isZeroAccountRep(ac stx.IsAccount) bool {
+	ma := ac.ToMuxedAccount()
+	return ma != nil && ma.Type == stx.KEY_TYPE_ED25519 &&
+		stx.IsZeroAccountID(ma)
+}
+
+// Sets i to the zero account if it is an account and val is
+// zeroAccountRep.  Returns false if i should be parsed as usual.
+func (xs *xdrScan) scanZeroAccount(i xdr.XdrType, val string) bool {
+	var word string
+	if fmt.Sscan(val, &word); word != zeroAccountRep {
+		return false
+	}
+	switch v := xdr.XdrBaseType(i).(type) {
+	case *stx.PublicKey:
+		*v = stx.PublicKey{}
+	case *stx.MuxedAccount:
+		*v = stx.MuxedAccount{}
+	default:
+		return false
+	}
+	return true
+}
+
+// Sets i to the account named by the first word of lv.val, if i is
+// an account and the word is a name rather than a strkey.  Returns
+// false if i should be parsed as usual.
+func (xs *xdrScan) scanAccountName(name string, i xdr.XdrType,
+	lv lineval) bool {
+	var word string
+	fmt.Sscan(lv.val, &word)
+	help := strings.HasSuffix(word, "?")
+	word = strings.TrimSuffix(word, "?")
+	var v fmt.Scanner
+	switch b := xdr.XdrBaseType(i).(type) {
+	case *stx.PublicKey:
+		v = b
+	case *stx.MuxedAccount:
+		v = b
+	default:
+		return false
+	}
+	if word == "" {
+		return false
+	} else if _, err := fmt.Sscan(word, v); err == nil {
+		return false
+	}
+	acct, err := xs.resolveAccount(word)
+	if err == nil && acct == "" {
+		return false
+	} else if err == nil {
+		_, err = fmt.Sscan(acct, v)
+	}
+	if err != nil {
+		xs.setHelp(name)
+		xs.report(lv.line, "%s", err.Error())
+	} else if help {
+		xs.setHelp(name)
+	}
+	return true
+}
+
+// Handles the cases in which strict SEP-0011 syntax is narrower than
+// what stc accepts by default.  Returns false to let Marshal parse
+// the value as usual.
+func (xs *xdrScan) scanSEP11(name string, i xdr.XdrType, lv lineval) bool {
+	var word string
+	fmt.Sscan(lv.val, &word)
+	switch v := xdr.XdrBaseType(i).(type) {
+	case xdr.XdrString:
+		s, rest, err := UnquoteSEP11(lv.val)
+		if err != nil {
+			xs.setHelp(name)
+			xs.report(lv.line, "%s", err.Error())
+		} else {
+			v.SetString(s)
+			if strings.HasSuffix(strings.TrimRight(rest, " "), "?") {
+				xs.setHelp(name)
+			}
+		}
+		return true
+	case *xdr.XdrBool:
+		switch word {
+		case "true":
+			v.SetU32(1)
+		case "false":
+			v.SetU32(0)
+		default:
+			xs.report(lv.line, "%s (%s) must be true or false", name, word)
+		}
+		return true
+	case *stx.Asset:
+		if word != "native" && strings.IndexByte(word, ':') < 0 {
+			xs.setHelp(name)
+			xs.report(lv.line,
+				"SEP-0011 requires the native asset to be written native")
+			return true
+		}
+	}
+	return false
+}
+
+// A LineReader reads lines of text from an io.Reader without reading
+// past the end of each line, so that other code can go on reading
+// from the same io.Reader (e.g., os.Stdin) afterwards.  Lines may end
+// in "\n", "\r\n", or a lone "\r", and may be of any length and
+// contain any bytes, including NUL and invalid UTF-8.
+type LineReader struct {
+	r   io.Reader
+	buf [1]byte
+	// The last line ended in '\r', so skip a following '\n'
+	skipLF bool
+}
+
+// Returns a LineReader that reads from r.
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{r: r}
+}
 
-func (il *inputLine) Scan(ss fmt.ScanState, _ rune) error {
-	t, e := ss.Token(false, func(r rune) bool { return r != '\n' })
-	*il = inputLine(t)
-	return e
+func (lr *LineReader) readByte() (byte, error) {
+	if br, ok := lr.r.(io.ByteReader); ok {
+		return br.ReadByte()
+	}
+	for {
+		if n, err := lr.r.Read(lr.buf[:]); n == 1 {
+			return lr.buf[0], nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
 }
 
-// Read a line of text without using bufio.
+// Returns the next line, without its line terminator.  The error is
+// io.EOF if the input ends before a line terminator, in which case
+// the line holds whatever followed the last terminator, possibly
+// nothing.
+func (lr *LineReader) ReadLine() ([]byte, error) {
+	var line []byte
+	for {
+		c, err := lr.readByte()
+		if err != nil {
+			return line, err
+		}
+		if lr.skipLF {
+			lr.skipLF = false
+			if c == '\n' {
+				continue
+			}
+		}
+		switch c {
+		case '\n':
+			return line, nil
+		case '\r':
+			if bs, ok := lr.r.(io.ByteScanner); ok {
+				// Peek, so a later LineReader need not skip the '\n'
+				if c, err = bs.ReadByte(); err == nil && c != '\n' {
+					bs.UnreadByte()
+				}
+			} else {
+				lr.skipLF = true
+			}
+			return line, nil
+		}
+		line = append(line, c)
+	}
+}
+
+// Read a line of text without using bufio, as LineReader does.  Since
+// ReadTextLine keeps no state between calls, a lone '\r' only ends a
+// line if r is an io.ByteScanner (such as a bufio.Reader); otherwise
+// it is kept unless it immediately precedes '\n'.
 func ReadTextLine(r io.Reader) ([]byte, error) {
-	var line inputLine
-	var c rune
-	fmt.Fscan(r, &line)
-	_, err := fmt.Fscanf(r, "%c", &c)
-	if err == nil && c != '\n' {
-		err = io.EOF
+	if _, ok := r.(io.ByteScanner); ok {
+		return NewLineReader(r).ReadLine()
+	}
+	var line []byte
+	lr := LineReader{r: r}
+	for {
+		c, err := lr.readByte()
+		if err != nil {
+			return line, err
+		} else if c == '\n' {
+			break
+		}
+		line = append(line, c)
 	}
 	if len(line) > 0 && line[len(line)-1] == '\r' {
 		line = line[:len(line)-1]
 	}
-	return []byte(line), err
+	return line, nil
+}
+
+// Name of the txrep pseudo-field that records the passphrase of the
+// network for which a transaction was written.  It is not part of
+// the XDR, and so comes before the other fields.
+const NetworkPassphraseField = "networkPassphrase"
+
+// Passes the quoted network passphrase of pseudo-field field, if the
+// input has one, to set, and removes the field from kvs.
+func (xs *xdrScan) scanNetworkPassphrase(field string, set func(string)) {
+	lv, ok := xs.kvs[field]
+	if !ok {
+		return
+	}
+	delete(xs.kvs, field)
+	var id string
+	if _, err := fmt.Sscanf(lv.val, "%q", &id); err != nil || id == "" {
+		xs.report(lv.line, "invalid quoted network passphrase")
+		return
+	}
+	set(id)
 }
 
 func (xs *xdrScan) readKvs(in io.Reader) {
 	xs.kvs = map[string]lineval{}
+	lr := NewLineReader(in)
 	lineno := 0
 	for {
-		bline, err := ReadTextLine(in)
+		bline, err := lr.ReadLine()
 		if err != nil && (err != io.EOF || len(bline) == 0) {
 			if err != io.EOF {
 				xs.report(lineno, "%s", err.Error())
@@ -650,11 +1255,40 @@ func (xs *xdrScan) readKvs(in io.Reader) {
 	}
 }
 
+// Reports an error for each field left in kvs after unmarshaling,
+// in the order the fields appeared in the input.
+func (xs *xdrScan) reportUnused() {
+	unused := make([]string, 0, len(xs.kvs))
+	for f := range xs.kvs {
+		unused = append(unused, f)
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return xs.kvs[unused[i]].line < xs.kvs[unused[j]].line
+	})
+	for _, f := range unused {
+		xs.report(xs.kvs[f].line, "unknown field %s", f)
+	}
+}
+
 // Parse input in Txrep format into an XdrType type.  If the XdrType
 // has a method named SetHelp(string), then it is called for field
-// names when the value ends with '?'.
+// names when the value ends with '?'.  If it has a method
+// GetTxrepDialect() TxrepDialect, the input must conform to that
+// dialect.  Lines whose field names t does not use (because of a typo
+// such as tx.memo.txt, or because they belong to a union arm other
+// than the selected one) are ignored, unless t has a method
+// GetTxrepStrict() bool that returns true, in which case each such
+// line is an error, as is leaving out a field that an operation
+// requires (such as the destination of a payment).  If t has a method
+// ResolveAccount(string) (string, error), then outside the SEP-0011
+// dialect an account may be written as any name that the method
+// turns into a strkey; an empty result without an error means the
+// name is unknown, and the value is parsed as usual.  Likewise, if t
+// has a method SetNetworkPassphrase(string), then outside the
+// SEP-0011 dialect it receives the value of the NetworkPassphraseField
+// pseudo-field, which must be a quoted string.
 func XdrFromTxrep(in io.Reader, name string, t xdr.XdrType) TxrepError {
-	xs := &xdrScan{}
+	xs := &xdrScan{dialect: getTxrepDialect(t)}
 	if sh, ok := t.(interface{ SetHelp(string) }); ok {
 		xs.setHelp = sh.SetHelp
 	} else {
@@ -664,9 +1298,26 @@ func XdrFromTxrep(in io.Reader, name string, t xdr.XdrType) TxrepError {
 		na := nam.GetNativeAsset()
 		xs.native = &na
 	}
+	if ra, ok := t.(interface {
+		ResolveAccount(string) (string, error)
+	}); ok {
+		xs.resolveAccount = ra.ResolveAccount
+	}
+	strict := getTxrepStrict(t)
+	if strict {
+		xs.missing = map[string]bool{}
+	}
 	xs.readKvs(in)
+	if snp, ok := t.(interface{ SetNetworkPassphrase(string) }); ok &&
+		xs.kvs != nil && xs.dialect != TxrepSEP11 {
+		xs.scanNetworkPassphrase(dotJoin(name, NetworkPassphraseField),
+			snp.SetNetworkPassphrase)
+	}
 	if xs.kvs != nil {
 		t.XdrMarshal(xs, name)
+		if strict {
+			xs.reportUnused()
+		}
 	}
 	if len(xs.err) != 0 {
 		return xs.err
@@ -707,14 +1358,81 @@ func (xe *xdrExtractor) Marshal(field string, i xdr.XdrType) {
 // Extract and return a field with a particular txrep name from an XDR
 // data structure.  Returns nil if the field name doesn't exist,
 // either because it is invalid or because a containing pointer is nil
-// or because a union has a different active case.
+// or because a union has a different active case.  If field contains
+// the wildcard index [*], returns the first field it matches (see
+// GetTxrepFields).
 //
 // Note that for pointer fields this functionreturns the pointer, not
 // the underlying value.  Hence the XdrPointer() method returns a
 // pointer-to-pointer type that is guaranteed not to be nil even if
 // the pointer is nil.
 func GetTxrepField(t xdr.XdrType, field string) (ret xdr.XdrType) {
+	if strings.Contains(field, wildcardIndex) {
+		if fields := GetTxrepFields(t, field); len(fields) > 0 {
+			return fields[0].Val
+		}
+		return nil
+	}
 	xe := xdrExtractor{ target: field }
 	t.XdrMarshal(&xe, "")
 	return xe.result
 }
+
+// Index that matches every element of a vector in GetTxrepFields.
+const wildcardIndex = "[*]"
+
+// A field found by GetTxrepFields.
+type TxrepFieldMatch struct {
+	// Txrep name of the field, with actual vector indices
+	Name string
+	Val  xdr.XdrType
+}
+
+// Splits a txrep field name into components, each starting with "."
+// or "[" except for the first.
+func splitTxrepName(name string) []string {
+	var ret []string
+	start := 0
+	for i := 1; i < len(name); i++ {
+		if name[i] == '.' || name[i] == '[' {
+			ret = append(ret, name[start:i])
+			start = i
+		}
+	}
+	if start < len(name) {
+		ret = append(ret, name[start:])
+	}
+	return ret
+}
+
+// Like GetTxrepField, but pattern may contain the wildcard index [*]
+// in place of any vector index, and all matching fields are returned
+// in the order they appear in txrep, each with its actual name.  For
+// example, tx.operations[*].body.paymentOp.amount returns the amounts
+// of all PAYMENT operations, with names such as
+// tx.operations[2].body.paymentOp.amount, and skips operations of
+// other types, whose paymentOp union arm is not active.  Without a
+// wildcard, returns at most the one field that GetTxrepField would.
+func GetTxrepFields(t xdr.XdrType, pattern string) []TxrepFieldMatch {
+	pat := splitTxrepName(pattern)
+	var ret []TxrepFieldMatch
+	ForEachXdrField(t, func(name string, _ int, val xdr.XdrType) XdrWalk {
+		comps := splitTxrepName(name)
+		if len(comps) > len(pat) {
+			return XdrWalkPrune
+		}
+		for i, c := range comps {
+			if c != pat[i] && !(pat[i] == wildcardIndex && c[0] == '[') {
+				return XdrWalkPrune
+			}
+		}
+		if len(comps) < len(pat) {
+			return XdrWalkInto
+		}
+		// A pointer and its target have the same name; keep the
+		// pointer, as GetTxrepField does.
+		ret = append(ret, TxrepFieldMatch{name, val})
+		return XdrWalkPrune
+	})
+	return ret
+}
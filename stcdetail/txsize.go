@@ -0,0 +1,77 @@
+package stcdetail
+
+import (
+	"fmt"
+
+	"github.com/xdrpp/stc/stx"
+)
+
+// The smallest fee per operation, in stroops, that the network
+// accepts.
+const MinBaseFee = 100
+
+// The largest (non-Soroban) transaction envelope stellar-core
+// accepts, in bytes of XDR.
+const MaxTxBytes = 100 * 1024
+
+// Size and fee statistics of a transaction envelope, as returned by
+// TxSize.  For fee bumps, operations are those of the inner
+// transaction, and signatures count both the fee bump's and the
+// inner transaction's.  Bytes is 0 if e cannot be marshaled, as
+// happens when it has more operations than the XDR allows.
+type TxStats struct {
+	Bytes      int
+	Operations int
+	Signatures int
+
+	// The fee the envelope offers to pay, in stroops.
+	Fee int64
+
+	// The smallest fee the network accepts for the envelope:
+	// MinBaseFee per operation, plus one more for a fee bump.
+	MinFee int64
+}
+
+// Computes the size and fee statistics of e.
+func TxSize(e *stx.TransactionEnvelope) TxStats {
+	tx, _, fee := innerTx(e)
+	ret := TxStats{
+		Signatures: len(*e.Signatures()),
+		Fee:        fee,
+	}
+	if tx != nil {
+		ret.Operations = len(tx.Operations)
+	}
+	func() {
+		defer func() { recover() }()
+		ret.Bytes = len(XdrToBin(e))
+	}()
+	ret.MinFee = MinBaseFee * int64(ret.Operations)
+	if e.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		ret.Signatures += len(e.FeeBump().Tx.InnerTx.V1().Signatures)
+		ret.MinFee += MinBaseFee
+	}
+	return ret
+}
+
+// Returns a description of each way in which the envelope measured
+// by s is too large for the network to accept or offers too small a
+// fee.
+func (s TxStats) Problems() []string {
+	var ret []string
+	if s.Operations == 0 {
+		ret = append(ret, "transaction has no operations")
+	} else if s.Operations > stx.MAX_OPS_PER_TX {
+		ret = append(ret, fmt.Sprintf("%d operations exceeds the limit of %d",
+			s.Operations, stx.MAX_OPS_PER_TX))
+	}
+	if s.Bytes > MaxTxBytes {
+		ret = append(ret, fmt.Sprintf("%d bytes exceeds the limit of %d",
+			s.Bytes, MaxTxBytes))
+	}
+	if s.Fee < s.MinFee {
+		ret = append(ret, fmt.Sprintf("fee %d is below the minimum of %d",
+			s.Fee, s.MinFee))
+	}
+	return ret
+}
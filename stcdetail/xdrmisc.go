@@ -1,7 +1,10 @@
 package stcdetail
 
 import (
+	"encoding/binary"
+	"fmt"
 	"github.com/xdrpp/goxdr/xdr"
+	"io"
 	"reflect"
 	"strings"
 )
@@ -35,11 +38,114 @@ func XdrFromBin(t xdr.XdrType, input string) (err error) {
 			panic(i)
 		}
 	}()
-	in := strings.NewReader(input)
-	t.XdrMarshal(&xdr.XdrIn{in}, "")
+	t.XdrMarshal(&xdrSliceIn{buf: []byte(input)}, "")
 	return
 }
 
+// Unmarshals binary XDR from memory.  Unlike xdr.XdrIn, which
+// allocates a buffer for every field it reads, xdrSliceIn allocates
+// nothing itself:  variable-length opaque fields share the storage of
+// buf (with their capacity limited, so appending to them copies).
+type xdrSliceIn struct {
+	buf []byte
+	trivSprintf
+}
+
+func (xi *xdrSliceIn) next(n uint32) []byte {
+	if uint64(n) > uint64(len(xi.buf)) {
+		xdr.XdrPanic("%s", io.ErrUnexpectedEOF)
+	}
+	ret := xi.buf[:n:n]
+	xi.buf = xi.buf[n:]
+	return ret
+}
+
+func (xi *xdrSliceIn) pad(n uint32) {
+	for _, b := range xi.next(-n & 3) {
+		if b != 0 {
+			xdr.XdrPanic("padding contained non-zero bytes")
+		}
+	}
+}
+
+func (xi *xdrSliceIn) Marshal(name string, i xdr.XdrType) {
+	switch v := i.(type) {
+	case xdr.XdrNum32:
+		v.SetU32(binary.BigEndian.Uint32(xi.next(4)))
+	case xdr.XdrNum64:
+		v.SetU64(binary.BigEndian.Uint64(xi.next(8)))
+	case xdr.XdrVarBytes:
+		n := binary.BigEndian.Uint32(xi.next(4))
+		v.SetByteSlice(xi.next(n))
+		xi.pad(n)
+	case xdr.XdrBytes:
+		bs := v.GetByteSlice()
+		copy(bs, xi.next(uint32(len(bs))))
+		xi.pad(uint32(len(bs)))
+	case xdr.XdrAggregate:
+		v.XdrRecurse(xi, name)
+	}
+}
+
+// Unmarshals binary XDR from a Reader, like xdr.XdrIn, but reads
+// fixed-size fields into a scratch buffer rather than allocating one
+// for each, and turns read errors into XdrErrors.
+type xdrReaderIn struct {
+	in      io.Reader
+	scratch [8]byte
+	trivSprintf
+}
+
+func (xi *xdrReaderIn) read(bs []byte) {
+	if _, err := io.ReadFull(xi.in, bs); err == io.EOF {
+		xdr.XdrPanic("%s", io.ErrUnexpectedEOF)
+	} else if err != nil {
+		xdr.XdrPanic("%s", err)
+	}
+}
+
+func (xi *xdrReaderIn) pad(n uint32) {
+	bs := xi.scratch[:-n&3]
+	xi.read(bs)
+	for _, b := range bs {
+		if b != 0 {
+			xdr.XdrPanic("padding contained non-zero bytes")
+		}
+	}
+}
+
+func (xi *xdrReaderIn) get32() uint32 {
+	xi.read(xi.scratch[:4])
+	return binary.BigEndian.Uint32(xi.scratch[:4])
+}
+
+func (xi *xdrReaderIn) Marshal(name string, i xdr.XdrType) {
+	switch v := i.(type) {
+	case xdr.XdrNum32:
+		v.SetU32(xi.get32())
+	case xdr.XdrNum64:
+		xi.read(xi.scratch[:8])
+		v.SetU64(binary.BigEndian.Uint64(xi.scratch[:8]))
+	case xdr.XdrVarBytes:
+		// Check the bound before allocating, since n comes from input
+		n := xi.get32()
+		if n > v.XdrBound() {
+			xdr.XdrPanic("Cannot store %d bytes in %s<%d>", n,
+				strings.TrimSuffix(v.XdrTypeName(), "<>"), v.XdrBound())
+		}
+		bs := make([]byte, n)
+		xi.read(bs)
+		v.SetByteSlice(bs)
+		xi.pad(n)
+	case xdr.XdrBytes:
+		bs := v.GetByteSlice()
+		xi.read(bs)
+		xi.pad(uint32(len(bs)))
+	case xdr.XdrAggregate:
+		v.XdrRecurse(xi, name)
+	}
+}
+
 type forEachXdr struct {
 	fn func(xdr.XdrType) bool
 	trivSprintf
@@ -115,3 +221,52 @@ func XdrExtract(t xdr.XdrType, out interface{}) bool {
 	t.XdrMarshal(&x, "")
 	return x.done
 }
+
+// Tells ForEachXdrField how to proceed after visiting a value.
+type XdrWalk int
+
+const (
+	XdrWalkInto  XdrWalk = iota // Visit fields within the value
+	XdrWalkPrune                // Skip fields within the value
+	XdrWalkStop                 // End the traversal immediately
+)
+
+type forEachXdrField struct {
+	fn      func(string, int, xdr.XdrType) XdrWalk
+	depth   int
+	stopped bool
+	txrState
+}
+
+func (*forEachXdrField) Sprintf(f string, args ...interface{}) string {
+	return fmt.Sprintf(f, args...)
+}
+
+func (w *forEachXdrField) Marshal(field string, val xdr.XdrType) {
+	if w.stopped {
+		return
+	}
+	w.push(field, val)
+	defer w.pop()
+	switch w.fn(w.name(), w.depth, val) {
+	case XdrWalkStop:
+		w.stopped = true
+	case XdrWalkInto:
+		if xa, ok := val.(xdr.XdrAggregate); ok {
+			w.depth++
+			xa.XdrRecurse(w, "")
+			w.depth--
+		}
+	}
+}
+
+// Like ForEachXdr, but also passes fn the txrep name of each value
+// (as accepted by GetTxrepField) and its depth--0 for t itself, 1 for
+// the fields of t, and so on.  Pointers and vectors count as a level,
+// so that the value of a pointer is at one more than the depth of the
+// pointer, while both have the same name.  The return value of fn
+// controls whether to recurse into the value, skip it, or stop.
+func ForEachXdrField(t xdr.XdrType,
+	fn func(name string, depth int, val xdr.XdrType) XdrWalk) {
+	t.XdrMarshal(&forEachXdrField{fn: fn}, "")
+}
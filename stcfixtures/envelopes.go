@@ -0,0 +1,248 @@
+package stcfixtures
+
+import (
+	"sort"
+
+	"github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Sequence number of the canned envelopes, which is that of the
+// first transaction of an account created in ledger 1.
+const Seq stx.SequenceNumber = 1<<32 + 1
+
+// Fee of the canned envelopes, the network's minimum per operation.
+const Fee = 100
+
+func muxed(k stc.PrivateKey) *stx.MuxedAccount {
+	return k.Public().ToMuxedAccount()
+}
+
+func unconditional() stx.ClaimPredicate {
+	return stx.ClaimPredicate{Type: stx.CLAIM_PREDICATE_UNCONDITIONAL}
+}
+
+// Returns the ID of the claimable balance that the canned
+// CREATE_CLAIMABLE_BALANCE envelope creates.
+func BalanceID() stx.ClaimableBalanceID {
+	var opid stx.OperationID
+	opid.Type = stx.ENVELOPE_TYPE_OP_ID
+	opid.Id().SourceAccount = Alice.Public()
+	opid.Id().SeqNum = Seq
+	var ret stx.ClaimableBalanceID
+	ret.Type = stx.CLAIMABLE_BALANCE_ID_TYPE_V0
+	*ret.V0() = stcdetail.XdrSHA256(&opid)
+	return ret
+}
+
+// Returns an operation of type t and the key of its source account,
+// or nil if stcfixtures does not know t.  The operation is one the
+// key could plausibly submit:  Alice pays and trades with Bob in
+// native XLM, USD, and EUR, Issuer authorizes and claws back Alice's
+// USD, and Sponsor sponsors Alice's reserves.
+func Op(t stx.OperationType) (stc.OperationBody, stc.PrivateKey) {
+	alice, bob, carol := Alice.Public(), Bob.Public(), Carol.Public()
+	switch t {
+	case stx.CREATE_ACCOUNT:
+		return stc.CreateAccount{
+			Destination:     carol,
+			StartingBalance: 100e7,
+		}, Alice
+	case stx.PAYMENT:
+		return stc.Payment{
+			Destination: *muxed(Bob),
+			Asset:       USD,
+			Amount:      10e7,
+		}, Alice
+	case stx.PATH_PAYMENT_STRICT_RECEIVE:
+		return stc.PathPaymentStrictReceive{
+			SendAsset:   stc.NativeAsset(),
+			SendMax:     20e7,
+			Destination: *muxed(Bob),
+			DestAsset:   USD,
+			DestAmount:  10e7,
+			Path:        []stx.Asset{EUR},
+		}, Alice
+	case stx.MANAGE_SELL_OFFER:
+		return stc.ManageSellOffer{
+			Selling: stc.NativeAsset(),
+			Buying:  USD,
+			Amount:  100e7,
+			Price:   stx.Price{N: 1, D: 2},
+		}, Alice
+	case stx.CREATE_PASSIVE_SELL_OFFER:
+		return stc.CreatePassiveSellOffer{
+			Selling: USD,
+			Buying:  EUR,
+			Amount:  10e7,
+			Price:   stx.Price{N: 1, D: 1},
+		}, Alice
+	case stx.SET_OPTIONS:
+		domain, weight := "example.com", stx.Uint32(1)
+		return stc.SetOptions{
+			HomeDomain:   &domain,
+			LowThreshold: &weight,
+			Signer: &stx.Signer{
+				Key:    carol.ToSignerKey(),
+				Weight: 1,
+			},
+		}, Alice
+	case stx.CHANGE_TRUST:
+		return stc.ChangeTrust{Line: USD, Limit: stc.MaxInt64}, Alice
+	case stx.ALLOW_TRUST:
+		return stc.AllowTrust{
+			Trustor:   alice,
+			Asset:     stc.MkAssetCode("USD"),
+			Authorize: stx.Uint32(stx.AUTHORIZED_FLAG),
+		}, Issuer
+	case stx.ACCOUNT_MERGE:
+		return stc.AccountMerge(*muxed(Bob)), Alice
+	case stx.INFLATION:
+		return stc.Inflation{}, Alice
+	case stx.MANAGE_DATA:
+		value := []byte("value")
+		return stc.ManageData{DataName: "fixture", DataValue: &value}, Alice
+	case stx.BUMP_SEQUENCE:
+		return stc.BumpSequence{BumpTo: Seq + 100}, Alice
+	case stx.MANAGE_BUY_OFFER:
+		return stc.ManageBuyOffer{
+			Selling:   USD,
+			Buying:    stc.NativeAsset(),
+			BuyAmount: 50e7,
+			Price:     stx.Price{N: 2, D: 1},
+		}, Alice
+	case stx.PATH_PAYMENT_STRICT_SEND:
+		return stc.PathPaymentStrictSend{
+			SendAsset:   stc.NativeAsset(),
+			SendAmount:  20e7,
+			Destination: *muxed(Bob),
+			DestAsset:   USD,
+			DestMin:     10e7,
+			Path:        []stx.Asset{EUR},
+		}, Alice
+	case stx.CREATE_CLAIMABLE_BALANCE:
+		notYet := stx.ClaimPredicate{Type: stx.CLAIM_PREDICATE_NOT}
+		rel := stx.ClaimPredicate{
+			Type: stx.CLAIM_PREDICATE_BEFORE_RELATIVE_TIME,
+		}
+		*rel.RelBefore() = 86400
+		*notYet.NotPredicate() = &rel
+		claimants := make([]stx.Claimant, 2)
+		claimants[0].Type = stx.CLAIMANT_TYPE_V0
+		claimants[0].V0().Destination = bob
+		claimants[0].V0().Predicate = unconditional()
+		claimants[1].Type = stx.CLAIMANT_TYPE_V0
+		claimants[1].V0().Destination = alice
+		claimants[1].V0().Predicate = notYet
+		return stc.CreateClaimableBalance{
+			Asset:     stc.NativeAsset(),
+			Amount:    10e7,
+			Claimants: claimants,
+		}, Alice
+	case stx.CLAIM_CLAIMABLE_BALANCE:
+		return stc.ClaimClaimableBalance{BalanceID: BalanceID()}, Bob
+	case stx.BEGIN_SPONSORING_FUTURE_RESERVES:
+		return stc.BeginSponsoringFutureReserves{SponsoredID: alice}, Sponsor
+	case stx.END_SPONSORING_FUTURE_RESERVES:
+		return stc.EndSponsoringFutureReserves{}, Alice
+	case stx.REVOKE_SPONSORSHIP:
+		op := stx.RevokeSponsorshipOp{
+			Type: stx.REVOKE_SPONSORSHIP_LEDGER_ENTRY,
+		}
+		key := op.LedgerKey()
+		key.Type = stx.TRUSTLINE
+		key.TrustLine().AccountID = alice
+		key.TrustLine().Asset = USD
+		return stc.RevokeSponsorship(op), Sponsor
+	case stx.CLAWBACK:
+		return stc.Clawback{Asset: USD, From: *muxed(Alice), Amount: 1e7},
+			Issuer
+	case stx.CLAWBACK_CLAIMABLE_BALANCE:
+		return stc.ClawbackClaimableBalance{BalanceID: BalanceID()}, Issuer
+	case stx.SET_TRUST_LINE_FLAGS:
+		return stc.SetTrustLineFlags{
+			Trustor:    alice,
+			Asset:      USD,
+			ClearFlags: stx.Uint32(stx.TRUSTLINE_CLAWBACK_ENABLED_FLAG),
+			SetFlags:   stx.Uint32(stx.AUTHORIZED_FLAG),
+		}, Issuer
+	}
+	return nil, stc.PrivateKey{}
+}
+
+// Returns every operation type, in numeric order.
+func OperationTypes() []stx.OperationType {
+	var ret []stx.OperationType
+	for v := range stx.OperationType(0).XdrEnumNames() {
+		ret = append(ret, stx.OperationType(v))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// Returns an unsigned transaction from Alice, with sequence number
+// Seq and fee Fee, whose only operation is the one Op returns for t.
+// The operation has its own source account when that is not Alice.
+// Returns nil if stcfixtures does not know t.  Each call returns a
+// new envelope, which the caller may modify.
+func Envelope(t stx.OperationType) *stc.TransactionEnvelope {
+	body, src := Op(t)
+	if body == nil {
+		return nil
+	}
+	e := stc.NewTransactionEnvelope()
+	e.SetSourceAccount(Alice.Public())
+	e.V1().Tx.SeqNum = Seq
+	var opsrc *stx.MuxedAccount
+	if src.Public().String() != Alice.Public().String() {
+		opsrc = muxed(src)
+	}
+	e.Append(opsrc, body)
+	e.SetFee(Fee)
+	return e
+}
+
+// Returns the canned envelope of each operation type, in the order
+// of OperationTypes.
+func Envelopes() []*stc.TransactionEnvelope {
+	var ret []*stc.TransactionEnvelope
+	for _, t := range OperationTypes() {
+		if e := Envelope(t); e != nil {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// Signs e on net with the key of each well-known account that e's
+// transaction or any of its operations uses as a source account,
+// which is enough for the canned envelopes to meet their thresholds
+// on accounts whose signers have not changed.
+func Sign(net *stc.StellarNet, e *stc.TransactionEnvelope) error {
+	for _, n := range names {
+		if !usesAccount(e, n.key.Public()) {
+			continue
+		}
+		if err := net.SignTx(n.key, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func usesAccount(e *stc.TransactionEnvelope, acct stc.AccountID) bool {
+	key := acct.String()
+	if e.SourceAccount().ToSignerKey().String() == key {
+		return true
+	}
+	if ops := e.Operations(); ops != nil {
+		for i := range *ops {
+			if src := (*ops)[i].SourceAccount; src != nil &&
+				src.ToSignerKey().String() == key {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package stcfixtures_test
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+	. "github.com/xdrpp/stc/stcfixtures"
+	"github.com/xdrpp/stc/stx"
+)
+
+var integration = flag.String("integration", "", "Run TestSelfTest "+
+	"against the horizon at `URL`, such as a local quickstart container")
+var integrationNet = flag.String("integration-passphrase",
+	"Standalone Network ; February 2017",
+	"Network passphrase of the -integration network")
+
+func TestKey(t *testing.T) {
+	// Downstream tests may hard-code these, so they must never change
+	const alice = "GDOJJSXGKWDOYJQJNE5OMWIEWUWTY5RGY7R7FWISX2EK7JLPD4HLAMDX"
+	if a := Alice.Public().String(); a != alice {
+		t.Errorf("Alice is %s", a)
+	}
+	if again := Key("alice"); again.String() != Alice.String() {
+		t.Error("Key is not deterministic")
+	}
+	seen := map[string]bool{}
+	for _, a := range Accounts() {
+		if seen[a.String()] {
+			t.Errorf("duplicate account %s", a)
+		}
+		seen[a.String()] = true
+	}
+	if len(seen) != 5 {
+		t.Errorf("%d accounts", len(seen))
+	}
+
+	net := &stc.StellarNet{Name: "test"}
+	Annotate(net)
+	if net.Accounts[Issuer.Public().String()] != "issuer" {
+		t.Errorf("Annotate did not name Issuer: %v", net.Accounts)
+	}
+}
+
+func TestEnvelopes(t *testing.T) {
+	net := &stc.StellarNet{Name: "test",
+		NetworkId: "Test SDF Network ; September 2015"}
+	types := OperationTypes()
+	if len(types) == 0 || types[0] != stx.CREATE_ACCOUNT {
+		t.Fatalf("OperationTypes returned %v", types)
+	}
+	for _, typ := range types {
+		e := Envelope(typ)
+		if e == nil {
+			t.Errorf("no canned envelope for %s", typ)
+			continue
+		}
+		ops := *e.Operations()
+		if len(ops) != 1 || ops[0].Body.Type != typ {
+			t.Errorf("envelope for %s has wrong operations", typ)
+			continue
+		}
+		if e.V1().Tx.SeqNum != Seq || e.V1().Tx.Fee != Fee {
+			t.Errorf("envelope for %s has wrong seqNum or fee", typ)
+		}
+		if ps := stcdetail.SeqProblems(e.TransactionEnvelope); len(ps) > 0 {
+			t.Errorf("envelope for %s: %v", typ, ps)
+		}
+
+		rep := net.TxToRep(e)
+		if e2, err := stc.TxFromRep(rep); err != nil {
+			t.Errorf("envelope for %s does not parse: %s\n%s", typ, err, rep)
+		} else if stc.TxToBase64(e2) != stc.TxToBase64(e) {
+			t.Errorf("envelope for %s does not round-trip", typ)
+		}
+
+		if err := Sign(net, e); err != nil {
+			t.Errorf("signing envelope for %s: %s", typ, err)
+			continue
+		}
+		want := 1
+		if ops[0].SourceAccount != nil {
+			want = 2
+		}
+		sigs := *e.Signatures()
+		if len(sigs) != want {
+			t.Errorf("envelope for %s has %d signatures, want %d",
+				typ, len(sigs), want)
+		}
+		for i := range sigs {
+			ok := false
+			for _, a := range Accounts() {
+				sk := a.ToSignerKey()
+				ok = ok || net.VerifySig(&sk, e, sigs[i].Signature)
+			}
+			if !ok {
+				t.Errorf("envelope for %s has a bad signature", typ)
+			}
+		}
+	}
+	if n := len(Envelopes()); n != len(types) {
+		t.Errorf("Envelopes returned %d envelopes for %d types",
+			n, len(types))
+	}
+	if e := Envelope(stx.OperationType(-1)); e != nil {
+		t.Error("Envelope accepted an invalid operation type")
+	}
+}
+
+func TestFund(t *testing.T) {
+	defer func(n int, d time.Duration) {
+		FundAttempts, FundBackoff = n, d
+	}(FundAttempts, FundBackoff)
+	FundAttempts, FundBackoff = 3, time.Millisecond
+
+	var mu sync.Mutex
+	funded := map[string]bool{Bob.Public().String(): true}
+	failures, requests := 1, 0
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case strings.HasPrefix(r.URL.Path, "/accounts/"):
+				if !funded[strings.TrimPrefix(r.URL.Path, "/accounts/")] {
+					w.WriteHeader(http.StatusNotFound)
+					w.Write([]byte(`{"status": 404}`))
+					return
+				}
+				w.Write([]byte(`{"sequence": "4294967296"}`))
+			case r.URL.Path == "/friendbot":
+				requests++
+				if failures > 0 {
+					failures--
+					w.WriteHeader(http.StatusGatewayTimeout)
+					w.Write([]byte(`{"status": 504}`))
+					return
+				}
+				funded[r.URL.Query().Get("addr")] = true
+				w.Write([]byte(`{}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	defer srv.Close()
+	net := &stc.StellarNet{Name: "test", Horizon: srv.URL + "/"}
+
+	if err := Fund(net, Alice.Public(), Bob.Public()); err != nil {
+		t.Fatal(err)
+	}
+	if !funded[Alice.Public().String()] {
+		t.Error("Alice was not funded")
+	}
+	if requests != 2 {
+		t.Errorf("%d friendbot requests, want 2 (one retry, none for Bob)",
+			requests)
+	}
+
+	failures = FundAttempts
+	if err := Fund(net, Carol.Public()); err == nil {
+		t.Error("Fund succeeded although friendbot always failed")
+	} else if !strings.Contains(err.Error(), Carol.Public().String()) {
+		t.Errorf("error does not name the account: %s", err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	if *integration == "" {
+		t.Skip("no -integration network")
+	}
+	horizon := *integration
+	if !strings.HasSuffix(horizon, "/") {
+		horizon += "/"
+	}
+	net, err := stc.NewMemStellarNet("integration", []byte(fmt.Sprintf(
+		"[net]\nnetwork-id = %q\nhorizon = %s\n",
+		*integrationNet, horizon)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := SelfTest(net, func(r Result) { t.Log(r) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range res {
+		if r.Err != nil {
+			t.Error(r)
+		}
+	}
+}
+
+func TestSelfTestOffline(t *testing.T) {
+	main := &stc.StellarNet{Name: "main",
+		NetworkId: "Public Global Stellar Network ; September 2015"}
+	if _, err := SelfTest(main, nil); err == nil {
+		t.Error("SelfTest ran on the public network")
+	}
+
+	defer func(n int) { FundAttempts = n }(FundAttempts)
+	FundAttempts = 1
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	down := &stc.StellarNet{Name: "test", Horizon: srv.URL + "/"}
+	var progress []string
+	res, err := SelfTest(down, func(r Result) {
+		progress = append(progress, r.Name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) == 0 || res[0].Name != "fund" || res[0].Err == nil {
+		t.Fatalf("funding did not fail: %v", res)
+	}
+	for _, r := range res[1:] {
+		if r.Err != nil || r.Skipped == "" {
+			t.Errorf("%s was not skipped after a failure", r.Name)
+		}
+	}
+	if len(progress) != len(res) {
+		t.Errorf("progress called %d times for %d checks",
+			len(progress), len(res))
+	}
+}
@@ -0,0 +1,54 @@
+package stcfixtures
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xdrpp/stc"
+)
+
+// How many times Fund asks the friendbot to create an account before
+// giving up, and how long it waits after the first failure.  Each
+// later wait is twice as long as the one before.  Test networks'
+// friendbots are often slow or briefly unavailable, especially when
+// many CI jobs start at once.
+var (
+	FundAttempts = 5
+	FundBackoff  = time.Second
+)
+
+// Creates and funds each of accts on net using its friendbot, which
+// the Stellar test network (and a standalone quickstart network)
+// provides.  An account that already exists is left alone, so Fund
+// may be called at the start of every test run.  A failed request is
+// retried as set by FundAttempts and FundBackoff.
+func Fund(net *stc.StellarNet, accts ...stc.AccountID) error {
+	for i := range accts {
+		acct := accts[i].String()
+		backoff := FundBackoff
+		for attempt := 1; ; attempt++ {
+			if _, err := net.GetAccountEntry(acct); err == nil {
+				break
+			}
+			_, err := net.Get("friendbot?addr=" + acct)
+			if err == nil {
+				break
+			} else if attempt >= FundAttempts {
+				return fmt.Errorf("funding %s: %s", acct, err)
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return nil
+}
+
+// Funds the well-known accounts on net (see Fund) and adds them to
+// its address book (see Annotate).
+func Bootstrap(net *stc.StellarNet) error {
+	if err := Fund(net, Accounts()...); err != nil {
+		return err
+	}
+	Annotate(net)
+	return nil
+}
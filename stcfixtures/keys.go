@@ -0,0 +1,73 @@
+// The stcfixtures package provides well-known test accounts and
+// canned transactions, so that projects built on stc (and stc's own
+// tests) can share one library of scenarios instead of each
+// generating keys and hand-building envelopes.  Every key is derived
+// from its name and so is the same on every machine and in every
+// run.  Since anyone can compute these keys, they must never hold
+// anything of value; use them only on test networks.
+package stcfixtures
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+
+	"github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stcdetail"
+)
+
+// Returns the test key named name, whose ed25519 seed is the SHA-256
+// hash of "stcfixtures:" followed by name.
+func Key(name string) stc.PrivateKey {
+	seed := sha256.Sum256([]byte("stcfixtures:" + name))
+	return stc.PrivateKey{
+		stcdetail.Ed25519Priv(ed25519.NewKeyFromSeed(seed[:])),
+	}
+}
+
+// The well-known test accounts.  Alice is the source of the canned
+// envelopes, Bob and Carol are counterparties, Issuer issues USD and
+// EUR, and Sponsor sponsors Alice's reserves.
+var (
+	Alice   = Key("alice")
+	Bob     = Key("bob")
+	Carol   = Key("carol")
+	Issuer  = Key("issuer")
+	Sponsor = Key("sponsor")
+)
+
+// Names of the well-known accounts, as Annotate records them.
+var names = []struct {
+	name string
+	key  *stc.PrivateKey
+}{
+	{"alice", &Alice},
+	{"bob", &Bob},
+	{"carol", &Carol},
+	{"issuer", &Issuer},
+	{"sponsor", &Sponsor},
+}
+
+// Returns the well-known accounts, in the order Alice, Bob, Carol,
+// Issuer, Sponsor.
+func Accounts() []stc.AccountID {
+	ret := make([]stc.AccountID, len(names))
+	for i := range names {
+		ret[i] = names[i].key.Public()
+	}
+	return ret
+}
+
+// Adds each well-known account to net's address book under its name,
+// so that txrep output shows, for instance, "(alice)" after Alice's
+// account ID.  Like AddHint, this does not save the configuration.
+func Annotate(net *stc.StellarNet) {
+	for _, n := range names {
+		net.AddHint(n.key.Public().String(), n.name)
+	}
+}
+
+// Test assets issued by Issuer.
+var (
+	USD = stc.MkAsset(Issuer.Public(), "USD")
+	EUR = stc.MkAsset(Issuer.Public(), "EUR")
+)
@@ -0,0 +1,334 @@
+package stcfixtures
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xdrpp/stc"
+	"github.com/xdrpp/stc/stx"
+)
+
+// Network passphrase of the public network, on which SelfTest
+// refuses to run.
+const publicNetworkId = "Public Global Stellar Network ; September 2015"
+
+// Outcome of one check of SelfTest.
+type Result struct {
+	Name string
+	// Why the check failed, or nil if it passed or was skipped
+	Err error
+	// Why the check was skipped, or "" if it ran
+	Skipped string
+	Elapsed time.Duration
+}
+
+func (r Result) String() string {
+	switch {
+	case r.Err != nil:
+		return fmt.Sprintf("FAIL %s: %s", r.Name, r.Err)
+	case r.Skipped != "":
+		return fmt.Sprintf("skip %s: %s", r.Name, r.Skipped)
+	}
+	return fmt.Sprintf("ok   %s (%s)", r.Name,
+		r.Elapsed.Round(time.Millisecond))
+}
+
+// Returned by a check that cannot run, with the reason.
+type skipCheck string
+
+func (s skipCheck) Error() string {
+	return string(s)
+}
+
+// State shared by the checks of one SelfTest run.  The accounts are
+// new in every run, so that SelfTest can be repeated against a
+// network that persists between runs.
+type selftest struct {
+	net           *stc.StellarNet
+	root, a, b, c stc.PrivateKey
+}
+
+// The checks SelfTest runs, in order.  Each relies on the ones
+// before it.
+var selftestChecks = []struct {
+	name string
+	run  func(*selftest) error
+}{
+	{"fund", (*selftest).fund},
+	{"create-accounts", (*selftest).createAccounts},
+	{"payment", (*selftest).payment},
+	{"multisig", (*selftest).multisig},
+	{"fee-bump", (*selftest).feeBump},
+	{"soroban-invoke", (*selftest).sorobanInvoke},
+}
+
+var errPublicNet = errors.New(
+	"refusing to run a self-test on the public network")
+
+// Runs a battery of checks against net, which must be a test network
+// with a friendbot, such as the standalone network of a local
+// stellar/quickstart container:  it funds a new account, creates
+// others with it, and submits payments, a multisig transaction (and
+// one lacking a signature, which must fail), and a fee bump, checking
+// balances after each.  This exercises the whole stack from building
+// transactions to submitting them and reading back the results.
+// Calls progress, if not nil, after each check.  Once a check fails,
+// the rest are skipped.  Returns an error without running anything if
+// net is the public network.
+func SelfTest(net *stc.StellarNet, progress func(Result)) ([]Result, error) {
+	if net.GetNetworkId() == publicNetworkId {
+		return nil, errPublicNet
+	}
+	run := fmt.Sprintf("selftest/%d/", time.Now().UnixNano())
+	s := &selftest{
+		net:  net,
+		root: Key(run + "root"),
+		a:    Key(run + "a"),
+		b:    Key(run + "b"),
+		c:    Key(run + "c"),
+	}
+	var ret []Result
+	failed := false
+	for _, check := range selftestChecks {
+		r := Result{Name: check.name}
+		if failed {
+			r.Skipped = "an earlier check failed"
+		} else {
+			start := time.Now()
+			err := check.run(s)
+			r.Elapsed = time.Since(start)
+			if skip, ok := err.(skipCheck); ok {
+				r.Skipped = string(skip)
+			} else if err != nil {
+				r.Err, failed = err, true
+			}
+		}
+		ret = append(ret, r)
+		if progress != nil {
+			progress(r)
+		}
+	}
+	return ret, nil
+}
+
+// Returns a new transaction from src, with src's next sequence
+// number, containing ops.
+func (s *selftest) tx(src stc.PrivateKey,
+	ops ...stc.OperationBody) (*stc.TransactionEnvelope, error) {
+	ae, err := s.net.GetAccountEntry(src.Public().String())
+	if err != nil {
+		return nil, err
+	}
+	e := stc.NewTransactionEnvelope()
+	e.SetSourceAccount(src.Public())
+	e.V1().Tx.SeqNum = ae.NextSeq()
+	for _, op := range ops {
+		e.Append(nil, op)
+	}
+	e.SetFee(Fee)
+	return e, nil
+}
+
+// Signs e with signers and submits it.
+func (s *selftest) post(e *stc.TransactionEnvelope,
+	signers ...stc.PrivateKey) (*stc.TransactionResult, error) {
+	for _, k := range signers {
+		if err := s.net.SignTx(k, e); err != nil {
+			return nil, err
+		}
+	}
+	return s.net.Post(e)
+}
+
+func (s *selftest) balance(k stc.PrivateKey) (int64, error) {
+	ae, err := s.net.GetAccountEntry(k.Public().String())
+	if err != nil {
+		return 0, err
+	}
+	return int64(ae.Balance), nil
+}
+
+// Checks that the native balance of k changed by delta since it was
+// before.
+func (s *selftest) checkBalance(what string, k stc.PrivateKey,
+	before, delta int64) error {
+	after, err := s.balance(k)
+	if err != nil {
+		return err
+	} else if after != before+delta {
+		return fmt.Errorf("%s balance changed by %d, expected %d",
+			what, after-before, delta)
+	}
+	return nil
+}
+
+func (s *selftest) fund() error {
+	return Fund(s.net, s.root.Public())
+}
+
+const selftestStartingBalance = 1000e7
+
+func (s *selftest) createAccounts() error {
+	var ops []stc.OperationBody
+	for _, k := range []stc.PrivateKey{s.a, s.b, s.c} {
+		ops = append(ops, stc.CreateAccount{
+			Destination:     k.Public(),
+			StartingBalance: selftestStartingBalance,
+		})
+	}
+	e, err := s.tx(s.root, ops...)
+	if err != nil {
+		return err
+	}
+	if _, err = s.post(e, s.root); err != nil {
+		return err
+	}
+	for _, k := range []stc.PrivateKey{s.a, s.b, s.c} {
+		if bal, err := s.balance(k); err != nil {
+			return err
+		} else if bal != selftestStartingBalance {
+			return fmt.Errorf("new account %s has balance %d, expected %d",
+				k.Public(), bal, int64(selftestStartingBalance))
+		}
+	}
+	return nil
+}
+
+// Returns a payment of amount stroops to k.
+func pay(k stc.PrivateKey, amount int64) stc.OperationBody {
+	return stc.Payment{
+		Destination: *muxed(k),
+		Asset:       stc.NativeAsset(),
+		Amount:      amount,
+	}
+}
+
+func (s *selftest) payment() error {
+	abal, err := s.balance(s.a)
+	if err != nil {
+		return err
+	}
+	bbal, err := s.balance(s.b)
+	if err != nil {
+		return err
+	}
+	e, err := s.tx(s.a, pay(s.b, 10e7))
+	if err != nil {
+		return err
+	}
+	res, err := s.post(e, s.a)
+	if err != nil {
+		return err
+	}
+	if err = s.checkBalance("sender", s.a, abal,
+		-10e7-int64(res.FeeCharged)); err != nil {
+		return err
+	}
+	return s.checkBalance("recipient", s.b, bbal, 10e7)
+}
+
+// Makes c a second signer of a, with thresholds requiring both, then
+// checks that a payment signed only by a fails and one signed by both
+// succeeds.
+func (s *selftest) multisig() error {
+	one, two := stx.Uint32(1), stx.Uint32(2)
+	e, err := s.tx(s.a, stc.SetOptions{
+		MasterWeight:  &one,
+		LowThreshold:  &two,
+		MedThreshold:  &two,
+		HighThreshold: &two,
+		Signer: &stx.Signer{
+			Key:    s.c.Public().ToSignerKey(),
+			Weight: 1,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = s.post(e, s.a); err != nil {
+		return err
+	}
+
+	if e, err = s.tx(s.a, pay(s.b, 1e7)); err != nil {
+		return err
+	}
+	_, err = s.post(e, s.a)
+	if tf, ok := err.(stc.TxFailure); !ok ||
+		tf.Result.Code != stx.TxBAD_AUTH {
+		return fmt.Errorf("payment with one of two signatures: "+
+			"expected txBAD_AUTH, got %v", err)
+	}
+
+	bbal, err := s.balance(s.b)
+	if err != nil {
+		return err
+	}
+	if e, err = s.tx(s.a, pay(s.b, 1e7)); err != nil {
+		return err
+	}
+	if _, err = s.post(e, s.a, s.c); err != nil {
+		return err
+	}
+	return s.checkBalance("recipient", s.b, bbal, 1e7)
+}
+
+// Has root pay the fee of a payment from b to a, and checks that b
+// paid nothing but the amount.
+func (s *selftest) feeBump() error {
+	var before [3]int64
+	for i, k := range []stc.PrivateKey{s.root, s.a, s.b} {
+		var err error
+		if before[i], err = s.balance(k); err != nil {
+			return err
+		}
+	}
+	inner, err := s.tx(s.b, pay(s.a, 5e7))
+	if err != nil {
+		return err
+	}
+	if err = s.net.SignTx(s.b, inner); err != nil {
+		return err
+	}
+	e := &stc.TransactionEnvelope{
+		TransactionEnvelope: &stx.TransactionEnvelope{
+			Type: stx.ENVELOPE_TYPE_TX_FEE_BUMP,
+		},
+	}
+	fb := &e.FeeBump().Tx
+	fb.FeeSource = *muxed(s.root)
+	fb.Fee = 4 * Fee
+	fb.InnerTx.Type = stx.ENVELOPE_TYPE_TX
+	*fb.InnerTx.V1() = *inner.V1()
+	res, err := s.post(e, s.root)
+	if err != nil {
+		return err
+	}
+	if err = s.checkBalance("fee source", s.root, before[0],
+		-int64(res.FeeCharged)); err != nil {
+		return err
+	} else if err = s.checkBalance("inner source", s.b, before[2],
+		-5e7); err != nil {
+		return err
+	}
+	return s.checkBalance("recipient", s.a, before[1], 5e7)
+}
+
+// Reports whether the XDR stc was built with has an operation type
+// named name.
+func hasOperation(name string) bool {
+	for _, n := range stx.OperationType(0).XdrEnumNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *selftest) sorobanInvoke() error {
+	if !hasOperation("INVOKE_HOST_FUNCTION") {
+		return skipCheck("this build's XDR predates Soroban and has no " +
+			"INVOKE_HOST_FUNCTION operation")
+	}
+	return skipCheck("invoking contracts is not yet implemented")
+}
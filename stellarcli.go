@@ -0,0 +1,144 @@
+package stc
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xdrpp/stc/stcdetail"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var InvalidIdentity = errors.New("Invalid stellar-cli identity file")
+
+// Derives the key for account number account from a BIP-39 mnemonic
+// seed phrase and optional passphrase, as specified by SEP-0005
+// (derivation path m/44'/148'/account').  This is how wallets and
+// stellar-cli turn seed phrases into keys.  The words are not checked
+// against the BIP-39 word list.
+func KeyFromMnemonic(mnemonic, passphrase string,
+	account uint32) PrivateKey {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	seed := pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase),
+		2048, 64, sha512.New)
+
+	// SLIP-0010 derivation, in which every step is hardened
+	mac := hmac.New(sha512.New, []byte("ed25519 seed"))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+	for _, n := range []uint32{44, 148, account} {
+		var data [37]byte
+		copy(data[1:33], i[:32])
+		binary.BigEndian.PutUint32(data[33:], n|0x80000000)
+		mac = hmac.New(sha512.New, i[32:])
+		mac.Write(data[:])
+		i = mac.Sum(nil)
+	}
+	return PrivateKey{stcdetail.Ed25519Priv(ed25519.NewKeyFromSeed(i[:32]))}
+}
+
+// Returns the global configuration directory of stellar-cli:
+// $STELLAR_CONFIG_HOME if set, and otherwise stellar under
+// $XDG_CONFIG_HOME or $HOME/.config.
+func stellarCliConfigDir() string {
+	if d, ok := os.LookupEnv("STELLAR_CONFIG_HOME"); ok {
+		return d
+	} else if d, ok := os.LookupEnv("XDG_CONFIG_HOME"); ok {
+		return filepath.Join(d, "stellar")
+	} else if d, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(d, ".config", "stellar")
+	}
+	return ".stellar"
+}
+
+// Returns the path of the stellar-cli identity file for name, which
+// may not exist.  A name containing a slash is a path.  Otherwise,
+// like stellar-cli, looks in the .stellar (or older .soroban)
+// directory of the current directory or nearest parent that has one,
+// and then in stellar-cli's global configuration directory.  If the
+// identity does not exist, returns its path in the global directory.
+func StellarCliIdentityPath(name string) string {
+	if strings.ContainsRune(name, '/') {
+		return name
+	}
+	file := name + ".toml"
+	var dirs []string
+	if _, ok := os.LookupEnv("STELLAR_CONFIG_HOME"); !ok {
+		if d, err := os.Getwd(); err == nil {
+			for {
+				dirs = append(dirs, filepath.Join(d, ".stellar"),
+					filepath.Join(d, ".soroban"))
+				parent := filepath.Dir(d)
+				if parent == d {
+					break
+				}
+				d = parent
+			}
+		}
+	}
+	global := filepath.Join(stellarCliConfigDir(), "identity", file)
+	for _, d := range dirs {
+		p := filepath.Join(d, "identity", file)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return global
+}
+
+// Reads an identity file of stellar-cli, which holds either a
+// secret_key in strkey format or a seed_phrase from which the key is
+// derived as by KeyFromMnemonic with account 0.
+func LoadStellarCliIdentity(file string) (PrivateKey, error) {
+	input, err := ioutil.ReadFile(file)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	// The files are simple enough that there is no need for a TOML
+	// parser.
+	vals := map[string]string{}
+	for _, line := range strings.Split(string(input), "\n") {
+		line = strings.TrimSpace(line)
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 || line[0] == '#' {
+			continue
+		}
+		val := strings.TrimSpace(line[eq+1:])
+		if uq, err := strconv.Unquote(val); err == nil {
+			val = uq
+		} else if len(val) >= 2 && val[0] == '\'' &&
+			val[len(val)-1] == '\'' {
+			val = val[1 : len(val)-1]
+		}
+		vals[strings.TrimSpace(line[:eq])] = val
+	}
+	var sk PrivateKey
+	if s, ok := vals["secret_key"]; ok {
+		if _, err = fmt.Sscan(s, &sk); err != nil {
+			return PrivateKey{}, err
+		}
+	} else if s, ok := vals["seed_phrase"]; ok && s != "" {
+		sk = KeyFromMnemonic(s, "", 0)
+	} else {
+		return PrivateKey{}, InvalidIdentity
+	}
+	return sk, nil
+}
+
+// Writes sk to a new stellar-cli identity file.  As with all
+// stellar-cli identities, the key is not encrypted.
+func (sk PrivateKey) SaveStellarCliIdentity(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return stcdetail.SafeCreateFile(file,
+		fmt.Sprintf("secret_key = %q\n", sk.String()), 0600)
+}
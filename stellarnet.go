@@ -1,14 +1,28 @@
 package stc
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"github.com/xdrpp/stc/ini"
 	"github.com/xdrpp/stc/stcdetail"
 	"github.com/xdrpp/stc/stx"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// A Stellar network, and what stc knows and has cached about it.  The
+// methods of a StellarNet are safe for concurrent use by multiple
+// goroutines, so that, for instance, the request handlers of a web
+// service can share one StellarNet.  The fields, however, are not
+// protected:  set them before sharing the StellarNet, and afterwards
+// neither modify them nor read the maps they hold (Signers, Accounts,
+// and so on) directly, but use methods such as AddSigner and
+// GetAddressBook instead.
 type StellarNet struct {
 	// Short name for network (used only in error messages).
 	Name string
@@ -19,34 +33,105 @@ type StellarNet struct {
 	// Name to use for native asset
 	NativeAsset string
 
+	// Txrep syntax to produce when rendering transactions
+	TxrepDialect stcdetail.TxrepDialect
+
+	// If true, TxToRep records the network in a networkPassphrase
+	// line, as the stc command does.
+	TxrepNetwork bool
+
 	// Base URL of horizon (including trailing slash).
 	Horizon string
 
+	// Base URL of a Soroban RPC server for the network, or "" if
+	// none is configured.
+	SorobanRPC string
+
+	// Extra HTTP headers to send to horizon, such as API keys for
+	// private or commercial horizon instances.  These take
+	// precedence over stcdetail.DefaultHeader.
+	HTTPHeader http.Header
+
 	// Set of signers to recognize when checking signatures on
 	// transactions and annotations to show when printing signers.
 	Signers SignerCache
 
+	// How and when each signer was learned.
+	SignerInfo SignerInfo
+
 	// Annotations to show on particular accounts when rendering them
 	// in human-readable txrep format.
 	Accounts AccountHints
 
+	// Additional sources of annotations, added by AddAnnotator.
+	Annotators []TxrepAnnotator
+
+	// Keys that ResolveAccount can look up by name, or nil for the
+	// key files in $STCDIR/keys (see GetKeyStore).
+	Keys KeyStore
+
 	// Changes will be saved to this file.
 	SavePath string
 
 	// Changes to be applied by Save().
 	Edits ini.IniEdits
 
+	// Latest ledger seen on the network, for detecting resets.
+	LastLedger uint32
+
 	// Cache of fee stats
 	FeeCache *FeeStats
 	FeeCacheTime time.Time
+
+	// URL of a price oracle used to show approximate values of
+	// amounts (see GetPrice), or "" to disable it.
+	PriceOracle string
+
+	// Currency of PriceOracle's prices, or "" for USD.
+	PriceCurrency string
+
+	// Cache of prices fetched by GetPrice
+	PriceCache map[string]float64
+
+	// Current offers by ID, fetched by FetchOffers, whose terms txrep
+	// shows next to operations that modify or delete them.  A nil
+	// entry means the offer does not exist.
+	Offers map[int64]*stx.OfferEntry
+
+	// Shell command that must approve each transaction before it is
+	// signed or posted (see CommandPolicy), or "" for none.
+	Policy string
+
+	// Additional policies, added by AddPolicy.
+	Policies []TxPolicy
+
+	// Protects the state that methods change (the caches, address
+	// book, signers, and Edits), so that concurrent callers do not
+	// corrupt it.  Never held while waiting on horizon or calling
+	// annotators, policies, or other callbacks.
+	mu sync.Mutex
 }
 
 func (net *StellarNet) AddHint(acct string, hint string) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	if net.Accounts == nil {
+		net.Accounts = make(AccountHints)
+	}
 	net.Accounts[acct] = hint
 	net.Edits.Set("accounts", acct, hint)
 }
 
 func (net *StellarNet) AddSigner(signer, comment string) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.addSigner(signer, comment)
+}
+
+func (net *StellarNet) addSigner(signer, comment string) {
+	if net.Signers == nil {
+		net.Signers = make(SignerCache)
+	}
 	net.Signers.Add(signer, comment)
 	net.Edits.Set("signers", signer, comment)
 }
@@ -55,6 +140,10 @@ func (net *StellarNet) GetNativeAsset() string {
 	return net.NativeAsset
 }
 
+func (net *StellarNet) GetTxrepDialect() stcdetail.TxrepDialect {
+	return net.TxrepDialect
+}
+
 // Returns true only if sig is a valid signature on e for public key
 // pk.
 func (net *StellarNet) VerifySig(
@@ -69,10 +158,87 @@ func (net *StellarNet) HashTx(tx stx.Signable) *stx.Hash {
 	return stcdetail.TxPayloadHash(net.GetNetworkId(), tx)
 }
 
+// Returns the signature payload of tx:  the SHA-256 hash of the
+// network ID followed by the XDR of tx tagged with its envelope type.
+// HashTx is the SHA-256 hash of the payload, and is what ed25519 keys
+// actually sign.  An external signer that insists on seeing the
+// payload must still sign its hash.
+func (net *StellarNet) SignaturePayload(tx stx.Signable) []byte {
+	var out bytes.Buffer
+	id := sha256.Sum256([]byte(net.GetNetworkId()))
+	out.Write(id[:])
+	tx.WriteTaggedTx(&out)
+	return out.Bytes()
+}
+
+var ErrBadSignature = errors.New("Signature does not verify")
+
+// Adds sig, a signature by pk made outside of stc (e.g., by a
+// hardware security module or remote signing service), to e.  For a
+// fee bump, the signature goes on whichever of the outer or inner
+// transaction it verifies for.  Fails with ErrBadSignature if it
+// verifies for neither, and with a WrongNetworkError if e was written
+// for a different network.
+func (net *StellarNet) AttachSignature(e *TransactionEnvelope,
+	pk PublicKey, sig []byte) error {
+	if err := net.CheckNetwork(e); err != nil {
+		return err
+	}
+	ds := stx.DecoratedSignature{Hint: pk.Hint(), Signature: sig}
+	key := pk.ToSignerKey()
+	if net.VerifySig(&key, e, sig) {
+		*e.Signatures() = append(*e.Signatures(), ds)
+		return nil
+	} else if e.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		inner := e.FeeBump().Tx.InnerTx.V1()
+		if net.VerifySig(&key, inner, sig) {
+			inner.Signatures = append(inner.Signatures, ds)
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+// Error returned by CheckNetwork for a transaction written for a
+// different network.
+type WrongNetworkError struct {
+	// Network passphrase recorded in the transaction
+	TxNetworkId string
+	// Network passphrase of the StellarNet
+	NetworkId string
+	// Name of the StellarNet
+	Name string
+}
+
+func (e WrongNetworkError) Error() string {
+	return fmt.Sprintf("transaction is for network %q, not %s (%q)",
+		e.TxNetworkId, e.Name, e.NetworkId)
+}
+
+// Returns a WrongNetworkError if e was parsed from txrep that records
+// a network other than net.  Transactions that do not record their
+// network pass.
+func (net *StellarNet) CheckNetwork(e *TransactionEnvelope) error {
+	if e.NetworkId == "" {
+		return nil
+	} else if id := net.GetNetworkId(); id != "" && id != e.NetworkId {
+		return WrongNetworkError{e.NetworkId, id, net.Name}
+	}
+	return nil
+}
+
 // Sign a transaction and append the signature to the
-// TransactionEnvelope.
+// TransactionEnvelope.  Fails with a WrongNetworkError if e was
+// written for a different network (see CheckNetwork), and with a
+// PolicyError if a policy refuses the transaction (see CheckPolicy).
 func (net *StellarNet) SignTx(sk stcdetail.PrivateKeyInterface,
 	e *TransactionEnvelope) error {
+	if err := net.CheckNetwork(e); err != nil {
+		return err
+	}
+	if err := net.CheckPolicy(e, PolicySign); err != nil {
+		return err
+	}
 	sig, err := sk.Sign(net.HashTx(e)[:])
 	if err != nil {
 		return err
@@ -85,6 +251,56 @@ func (net *StellarNet) SignTx(sk stcdetail.PrivateKeyInterface,
 	return nil
 }
 
+var ErrNotFeeBump = errors.New("Not a fee-bump transaction")
+
+// Sign the inner transaction of a fee bump and append the signature
+// to the inner transaction's signatures.  Since the outer transaction
+// includes the inner signatures, this invalidates any signatures
+// already on the outer transaction, so sign the inner transaction
+// first.  The network and policies are checked as for SignTx.
+func (net *StellarNet) SignInnerTx(sk stcdetail.PrivateKeyInterface,
+	e *TransactionEnvelope) error {
+	if e.Type != stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		return ErrNotFeeBump
+	}
+	if err := net.CheckNetwork(e); err != nil {
+		return err
+	}
+	if err := net.CheckPolicy(e, PolicySign); err != nil {
+		return err
+	}
+	inner := e.FeeBump().Tx.InnerTx.V1()
+	sig, err := sk.Sign(net.HashTx(inner)[:])
+	if err != nil {
+		return err
+	}
+	inner.Signatures = append(inner.Signatures, stx.DecoratedSignature{
+		Hint:      sk.Public().Hint(),
+		Signature: sig,
+	})
+	return nil
+}
+
+// Returns the indices of signatures on e that fail to verify even
+// though the Signers cache contains a key with a matching hint.  This
+// usually means the transaction has changed since it was signed (or
+// was signed for a different network).  Signatures whose hints match
+// no known signer cannot be checked and are not included.
+func (net *StellarNet) InvalidSignatures(e *TransactionEnvelope) []int {
+	var ret []int
+	id := net.GetNetworkId()
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	sigs := *e.Signatures()
+	for i := range sigs {
+		if len(net.Signers[sigs[i].Hint]) > 0 &&
+			net.Signers.Lookup(id, e.TransactionEnvelope, &sigs[i]) == nil {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
 // An annotated SignerKey that can be used to authenticate
 // transactions.  Prints and Scans as a StrKey-format SignerKey, a
 // space, and then the comment.
@@ -120,8 +336,23 @@ func (ski *SignerKeyInfo) Scan(ss fmt.ScanState, c rune) error {
 // having the Signers.  The signatures in a TransactionEnvelope
 // envelope are, however, accompanied by a 4-byte SignatureHint,
 // making it efficient to look up signers if they are in a SignerCache.
+// A SignerCache does no locking of its own; StellarNet guards its
+// Signers, and Clone makes a copy that is safe to use while the
+// original changes.
 type SignerCache map[stx.SignatureHint][]SignerKeyInfo
 
+// Returns a copy of c that shares no storage with it.
+func (c SignerCache) Clone() SignerCache {
+	if c == nil {
+		return nil
+	}
+	ret := make(SignerCache, len(c))
+	for hint, skis := range c {
+		ret[hint] = append([]SignerKeyInfo(nil), skis...)
+	}
+	return ret
+}
+
 // Renders SignerCache as a a set of SignerKeyInfo structures, one per
 // line, suitable for saving to a file.
 func (c SignerCache) String() string {
@@ -159,6 +390,33 @@ func (c SignerCache) Lookup(networkID string, e *stx.TransactionEnvelope,
 	return nil
 }
 
+// Like Lookup, but for each signature in sigs, hashing e only once
+// and checking the signatures with stcdetail.VerifyParallel.  Entries
+// for signatures by unknown signers are nil.
+func (c SignerCache) LookupAll(networkID string, e *stx.TransactionEnvelope,
+	sigs []stx.DecoratedSignature) []*SignerKeyInfo {
+	ret := make([]*SignerKeyInfo, len(sigs))
+	hash := stcdetail.TxPayloadHash(networkID, e)
+	var pairs []stcdetail.VerifyPair
+	var which []int
+	var skis []*SignerKeyInfo
+	for i := range sigs {
+		cands := c[sigs[i].Hint]
+		for j := range cands {
+			pairs = append(pairs, stcdetail.VerifyPair{
+				Key: &cands[j].Key, Hash: hash, Sig: sigs[i].Signature})
+			which = append(which, i)
+			skis = append(skis, &cands[j])
+		}
+	}
+	for k, ok := range stcdetail.VerifyParallel(pairs) {
+		if i := which[k]; ok && ret[i] == nil {
+			ret[i] = skis[k]
+		}
+	}
+	return ret
+}
+
 // Adds a signer to a SignerCache if the signer is not already in the
 // cache.  If the signer is already in the cache, the comment is left
 // unchanged.
@@ -213,6 +471,220 @@ func (c SignerCache) Del(strkey string) error {
 	return nil
 }
 
+// Records where and when stc learned about a signer, so that signers
+// learned from the network can be audited.  Prints and parses as a
+// space-separated list of field=value pairs (omitting empty fields).
+type SignerMeta struct {
+	// Account on which the signer was seen, if any.
+	Account string
+	// Weight of the signer on Account when last seen.
+	Weight uint32
+	// How the signer was learned:  "horizon" for signers fetched
+	// with -l, "key" for local signing keys, or "legacy" for signers
+	// recorded before stc kept metadata.
+	Source string
+	// When the signer was last seen (zero if unknown).
+	Time time.Time
+	// Name of the network on which the signer was seen.
+	Network string
+}
+
+func (m SignerMeta) String() string {
+	var fields []string
+	add := func(k, v string) {
+		if v != "" {
+			fields = append(fields, k+"="+v)
+		}
+	}
+	add("account", m.Account)
+	if m.Account != "" || m.Weight != 0 {
+		add("weight", fmt.Sprint(m.Weight))
+	}
+	add("source", m.Source)
+	if !m.Time.IsZero() {
+		add("time", m.Time.UTC().Format(time.RFC3339))
+	}
+	add("network", m.Network)
+	return strings.Join(fields, " ")
+}
+
+// Parses the output of SignerMeta.String().  Unknown fields are
+// ignored, so that later versions can record more information.
+func ParseSignerMeta(s string) (ret SignerMeta, err error) {
+	for _, f := range strings.Fields(s) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return ret, fmt.Errorf("invalid signer metadata %q", f)
+		}
+		switch kv[0] {
+		case "account":
+			ret.Account = kv[1]
+		case "weight":
+			_, err = fmt.Sscan(kv[1], &ret.Weight)
+		case "source":
+			ret.Source = kv[1]
+		case "time":
+			ret.Time, err = time.Parse(time.RFC3339, kv[1])
+		case "network":
+			ret.Network = kv[1]
+		}
+		if err != nil {
+			return ret, fmt.Errorf("invalid signer metadata %q: %s", f, err)
+		}
+	}
+	return
+}
+
+// Metadata for signers, indexed by signer in strkey format.  A signer
+// may have an entry for each account on which it was seen.
+type SignerInfo map[string][]SignerMeta
+
+// Adds or replaces the metadata for signer on meta.Account.  Returns
+// true if there was already an entry for that account.
+func (si SignerInfo) Set(signer string, meta SignerMeta) bool {
+	ms := si[signer]
+	for i := range ms {
+		if ms[i].Account == meta.Account {
+			ms[i] = meta
+			return true
+		}
+	}
+	si[signer] = append(ms, meta)
+	return false
+}
+
+// Returns a copy of the metadata recorded for signer.
+func (net *StellarNet) GetSignerInfo(signer string) []SignerMeta {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return append([]SignerMeta(nil), net.SignerInfo[signer]...)
+}
+
+// Returns a copy of the known signers, which the caller may use
+// without racing with methods that change them.
+func (net *StellarNet) GetSigners() SignerCache {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return net.Signers.Clone()
+}
+
+// Returns a copy of the changes that Save would apply.
+func (net *StellarNet) GetEdits() ini.IniEdits {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return append(ini.IniEdits(nil), net.Edits...)
+}
+
+// Records metadata about a signer, to be saved with the network's
+// configuration.
+func (net *StellarNet) NoteSigner(signer string, meta SignerMeta) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.noteSigner(signer, meta)
+}
+
+func (net *StellarNet) noteSigner(signer string, meta SignerMeta) {
+	if net.SignerInfo == nil {
+		net.SignerInfo = make(SignerInfo)
+	}
+	net.SignerInfo.Set(signer, meta)
+	net.Edits.Del("signer-info", signer)
+	for _, m := range net.SignerInfo[signer] {
+		net.Edits.Add("signer-info", signer, m.String())
+	}
+}
+
+// Removes a signer and its metadata from the network's
+// configuration.  (Signers configured in global.conf or stc.conf
+// rather than the network's own file will reappear the next time the
+// network is loaded.)
+func (net *StellarNet) ForgetSigner(signer string) error {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return net.forgetSigner(signer)
+}
+
+func (net *StellarNet) forgetSigner(signer string) error {
+	if err := net.Signers.Del(signer); err != nil {
+		return err
+	}
+	delete(net.SignerInfo, signer)
+	net.Edits.Del("signers", signer)
+	net.Edits.Del("signer-info", signer)
+	return nil
+}
+
+// Discards the state that a network reset invalidates:  signers
+// learned from the network (keeping those of local signing keys),
+// cached fee stats, and LastLedger.  Returns the removed signers.
+// Account annotations are kept, since they record the user's own
+// names for keys.
+func (net *StellarNet) ResetNetworkData() []string {
+	ret := net.PruneSigners(func(_ string, metas []SignerMeta) bool {
+		for _, m := range metas {
+			if m.Source == "key" {
+				return true
+			}
+		}
+		return false
+	})
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.FeeCache = nil
+	net.LastLedger = 0
+	net.Edits.Del("net", "last-ledger")
+	return ret
+}
+
+// Removes every signer for which keep returns false, and returns the
+// removed signers in strkey format.  keep receives the signer's
+// metadata, which is empty if none was recorded.  keep is called
+// without net locked, so it may use net's methods.
+func (net *StellarNet) PruneSigners(
+	keep func(signer string, metas []SignerMeta) bool) []string {
+	net.mu.Lock()
+	metas := make(map[string][]SignerMeta)
+	for _, skis := range net.Signers {
+		for i := range skis {
+			key := skis[i].Key.String()
+			metas[key] = append([]SignerMeta(nil), net.SignerInfo[key]...)
+		}
+	}
+	net.mu.Unlock()
+
+	var ret []string
+	for key, m := range metas {
+		if !keep(key, m) {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	for _, key := range ret {
+		net.ForgetSigner(key)
+	}
+	return ret
+}
+
+const legacySignerComment = "signer for account "
+
+// Creates metadata for signers that were learned before stc kept
+// it, using the account in the signer's comment if there is one.
+func (net *StellarNet) migrateSignerInfo() {
+	for _, skis := range net.Signers {
+		for i := range skis {
+			key := skis[i].Key.String()
+			if len(net.SignerInfo[key]) > 0 {
+				continue
+			}
+			meta := SignerMeta{Source: "legacy", Network: net.Name}
+			if strings.HasPrefix(skis[i].Comment, legacySignerComment) {
+				meta.Account = skis[i].Comment[len(legacySignerComment):]
+			}
+			net.noteSigner(key, meta)
+		}
+	}
+}
+
 // Set of annotations to show as comments when showing Stellar
 // AccountID values.
 type AccountHints map[string]string
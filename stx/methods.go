@@ -54,6 +54,16 @@ func (ma MuxedAccount) ToSignerKey() (ret SignerKey) {
 	return
 }
 
+// Returns true if ac is the all-zero ed25519 key, strkey
+// GAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAWHF, which is
+// what an account holds before one has been filled in.  A
+// MuxedAccount is zero if its underlying key is, regardless of its
+// ID.
+func IsZeroAccountID(ac interface{ ToSignerKey() SignerKey }) bool {
+	k := ac.ToSignerKey()
+	return k.Type == SIGNER_KEY_TYPE_ED25519 && *k.Ed25519() == Uint256{}
+}
+
 func (body XdrAnon_Operation_Body) To_Operation_Body() XdrAnon_Operation_Body {
 	return body
 }
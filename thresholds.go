@@ -0,0 +1,300 @@
+package stc
+
+import (
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+)
+
+// The signing threshold (low, medium, or high) that an operation
+// requires of its source account.
+type ThresholdLevel int
+
+const (
+	LowThreshold ThresholdLevel = iota
+	MediumThreshold
+	HighThreshold
+)
+
+func (l ThresholdLevel) String() string {
+	switch l {
+	case LowThreshold:
+		return "low"
+	case MediumThreshold:
+		return "medium"
+	case HighThreshold:
+		return "high"
+	}
+	return fmt.Sprintf("ThresholdLevel(%d)", int(l))
+}
+
+// Returns the threshold level that op requires of its source account.
+// (The transaction itself requires only LowThreshold of the
+// transaction's source account.)
+func OpThreshold(op *stx.Operation) ThresholdLevel {
+	switch op.Body.Type {
+	case stx.ALLOW_TRUST, stx.SET_TRUST_LINE_FLAGS, stx.BUMP_SEQUENCE,
+		stx.CLAIM_CLAIMABLE_BALANCE, stx.INFLATION:
+		return LowThreshold
+	case stx.ACCOUNT_MERGE:
+		return HighThreshold
+	case stx.SET_OPTIONS:
+		so := op.Body.SetOptionsOp()
+		if so.MasterWeight != nil || so.LowThreshold != nil ||
+			so.MedThreshold != nil || so.HighThreshold != nil ||
+			so.Signer != nil {
+			return HighThreshold
+		}
+	}
+	return MediumThreshold
+}
+
+// Returns the threshold of a particular level.
+func (t *HorizonThresholds) Get(l ThresholdLevel) uint8 {
+	switch l {
+	case LowThreshold:
+		return t.Low_threshold
+	case MediumThreshold:
+		return t.Med_threshold
+	default:
+		return t.High_threshold
+	}
+}
+
+// Returns the total weight of signers that have authorized e, either
+// with a valid signature or, for pre-auth transaction signers, by
+// being the hash of e.
+func (net *StellarNet) SignedWeight(e *TransactionEnvelope,
+	signers []HorizonSigner) uint32 {
+	sigs := *e.Signatures()
+	hash := net.HashTx(e)
+	var pairs []stcdetail.VerifyPair
+	var which []int
+	for i := range signers {
+		key := &signers[i].Key
+		if key.Type == stx.SIGNER_KEY_TYPE_PRE_AUTH_TX {
+			pairs = append(pairs, stcdetail.VerifyPair{Key: key, Hash: hash})
+			which = append(which, i)
+			continue
+		}
+		hint := key.Hint()
+		for j := range sigs {
+			if sigs[j].Hint == hint {
+				pairs = append(pairs, stcdetail.VerifyPair{
+					Key: key, Hash: hash, Sig: sigs[j].Signature})
+				which = append(which, i)
+			}
+		}
+	}
+	var ret uint32
+	counted := make([]bool, len(signers))
+	for k, ok := range stcdetail.VerifyParallel(pairs) {
+		if i := which[k]; ok && !counted[i] {
+			ret += signers[i].Weight
+			counted[i] = true
+		}
+	}
+	return ret
+}
+
+// The threshold that a transaction requires of one source account.
+// Op is the index of the operation imposing the requirement, or -1
+// for the transaction itself (which requires LowThreshold of its
+// source account and, for a fee bump, of the fee source).
+type SigningRequirement struct {
+	Op      int
+	Account string
+	Level   ThresholdLevel
+}
+
+// Returns the signing requirements of each operation of e, in order,
+// after those of the transaction itself.  Accounts are AccountID
+// strkeys, so multiplexed accounts are reduced to their underlying
+// accounts.
+func SigningRequirements(e *TransactionEnvelope) []SigningRequirement {
+	key := func(ac stx.IsAccount) string {
+		return ac.ToMuxedAccount().ToSignerKey().String()
+	}
+	ret := []SigningRequirement{{-1, key(e.SourceAccount()), LowThreshold}}
+	ops := e.Operations()
+	src := key(e.SourceAccount())
+	if e.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		inner := &e.FeeBump().Tx.InnerTx.V1().Tx
+		ops, src = &inner.Operations, key(&inner.SourceAccount)
+		ret = append(ret, SigningRequirement{-1, src, LowThreshold})
+	}
+	if ops == nil {
+		return ret
+	}
+	for i := range *ops {
+		op := &(*ops)[i]
+		acct := src
+		if op.SourceAccount != nil {
+			acct = key(op.SourceAccount)
+		}
+		ret = append(ret, SigningRequirement{i, acct, OpThreshold(op)})
+	}
+	return ret
+}
+
+// Returns the total weight that signatures by keys would contribute
+// on an account with the given signers, for planning which keys must
+// sign a transaction.
+func SimulatedWeight(signers []HorizonSigner, keys []SignerKey) uint32 {
+	var ret uint32
+	for i := range signers {
+		k := signers[i].Key.String()
+		for j := range keys {
+			if keys[j].String() == k {
+				ret += signers[i].Weight
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Returns the source accounts of SET_OPTIONS operations in e, in
+// order of first appearance.
+func SetOptionsAccounts(e *TransactionEnvelope) []string {
+	var ret []string
+	src, ops := txSourceOps(e.TransactionEnvelope)
+	seen := map[string]bool{}
+	for i := range ops {
+		if ops[i].Body.Type != stx.SET_OPTIONS {
+			continue
+		}
+		acct := src
+		if ops[i].SourceAccount != nil {
+			acct = ops[i].SourceAccount.ToSignerKey().String()
+		}
+		if !seen[acct] {
+			seen[acct] = true
+			ret = append(ret, acct)
+		}
+	}
+	return ret
+}
+
+// Returns warnings about SET_OPTIONS operations in e that could lock
+// acct out of its account, by leaving it no signers with nonzero
+// weight or raising a threshold above the total weight of its
+// signers.  Pre-auth transaction signers do not count toward the
+// total, since each can only be used once.  ae is the state of the
+// account before e executes, or nil if e creates the account.
+func SetOptionsWarnings(e *TransactionEnvelope, acct string,
+	ae *HorizonAccountEntry) []string {
+	type signer struct {
+		weight  uint32
+		preauth bool
+	}
+	signers := map[string]signer{}
+	var th [3]uint32
+	if ae == nil {
+		signers[acct] = signer{weight: 1}
+	} else {
+		for _, s := range ae.Signers {
+			signers[s.Key.String()] = signer{s.Weight,
+				s.Key.Type == stx.SIGNER_KEY_TYPE_PRE_AUTH_TX}
+		}
+		th = [3]uint32{uint32(ae.Thresholds.Low_threshold),
+			uint32(ae.Thresholds.Med_threshold),
+			uint32(ae.Thresholds.High_threshold)}
+	}
+
+	src, ops := txSourceOps(e.TransactionEnvelope)
+	changed := false
+	for i := range ops {
+		if ops[i].Body.Type != stx.SET_OPTIONS {
+			continue
+		} else if ops[i].SourceAccount != nil {
+			if ops[i].SourceAccount.ToSignerKey().String() != acct {
+				continue
+			}
+		} else if src != acct {
+			continue
+		}
+		so := ops[i].Body.SetOptionsOp()
+		if so.MasterWeight != nil {
+			signers[acct] = signer{weight: *so.MasterWeight}
+			changed = true
+		}
+		for l, p := range []*stx.Uint32{so.LowThreshold, so.MedThreshold,
+			so.HighThreshold} {
+			if p != nil {
+				th[l] = *p
+				changed = true
+			}
+		}
+		if so.Signer != nil {
+			k := so.Signer.Key.String()
+			if so.Signer.Weight == 0 {
+				delete(signers, k)
+			} else {
+				signers[k] = signer{so.Signer.Weight,
+					so.Signer.Key.Type == stx.SIGNER_KEY_TYPE_PRE_AUTH_TX}
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	var total uint32
+	for _, s := range signers {
+		if !s.preauth {
+			total += s.weight
+		}
+	}
+	if total == 0 {
+		return []string{"leaves no signers with nonzero weight," +
+			" permanently locking the account"}
+	}
+	var ret []string
+	for l := HighThreshold; l >= LowThreshold; l-- {
+		if th[l] > total {
+			ret = append(ret, fmt.Sprintf(
+				"%s threshold %d exceeds total signer weight %d",
+				l, th[l], total))
+		}
+	}
+	return ret
+}
+
+// Checks every account whose options e sets for changes that could
+// lock the account, fetching the accounts' current signers from the
+// network.  Returns warnings prefixed with the account.
+func (net *StellarNet) LockoutWarnings(e *TransactionEnvelope) []string {
+	var ret []string
+	for _, acct := range SetOptionsAccounts(e) {
+		name := acct
+		if note := net.AccountIDNote(acct); note != "" {
+			name += " (" + note + ")"
+		}
+		ae, err := net.GetAccountEntry(acct)
+		if err != nil {
+			if !createsAccount(e, acct) {
+				ret = append(ret, fmt.Sprintf(
+					"account %s: cannot check SET_OPTIONS: %s", name, err))
+				continue
+			}
+			ae = nil
+		}
+		for _, w := range SetOptionsWarnings(e, acct, ae) {
+			ret = append(ret, fmt.Sprintf("account %s: %s", name, w))
+		}
+	}
+	return ret
+}
+
+func createsAccount(e *TransactionEnvelope, acct string) bool {
+	_, ops := txSourceOps(e.TransactionEnvelope)
+	for i := range ops {
+		if ops[i].Body.Type == stx.CREATE_ACCOUNT &&
+			ops[i].Body.CreateAccountOp().Destination.String() == acct {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package stc
+
+import (
+	"fmt"
+	"github.com/xdrpp/stc/stcdetail"
+	"github.com/xdrpp/stc/stx"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// The highest Stellar protocol version whose XDR stx supports.  This
+// must be updated when the XDR files are updated for a new protocol.
+const ProtocolVersion = 17
+
+// Optional capabilities of this version of stc, so that scripts can
+// test for them.
+var Features = []string{
+	"sep11",
+	"subcommands",
+	"lint-online",
+	"ledger-entry",
+	"signer-info",
+	"backup-keys",
+	"split-key",
+	"check-reset",
+	"address-book",
+	"template",
+	"watch",
+	"bundle",
+}
+
+// Describes the build of stc (or of the program using the stc
+// library).  Versions are module versions such as "v0.1.4", or
+// "(devel)" for a build from a source tree.
+type VersionInfo struct {
+	Version      string   `json:"version"`
+	GoxdrVersion string   `json:"goxdr_version"`
+	GoVersion    string   `json:"go_version"`
+	Protocol     int      `json:"protocol"`
+	StellarXdr   string   `json:"stellar_xdr"`
+	Features     []string `json:"features"`
+}
+
+const develVersion = "(devel)"
+
+// Returns version information from the build information embedded
+// in the running binary.
+func GetVersionInfo() *VersionInfo {
+	ret := &VersionInfo{
+		Version:      develVersion,
+		GoxdrVersion: develVersion,
+		GoVersion:    runtime.Version(),
+		Protocol:     ProtocolVersion,
+		StellarXdr:   stx.StellarCommit,
+		Features:     Features,
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ret
+	}
+	mods := append([]*debug.Module{&bi.Main}, bi.Deps...)
+	for _, m := range mods {
+		version := m.Version
+		if m.Replace != nil {
+			version = m.Replace.Version
+		}
+		if version == "" {
+			continue
+		}
+		switch m.Path {
+		case "github.com/xdrpp/stc":
+			ret.Version = version
+		case "github.com/xdrpp/goxdr":
+			ret.GoxdrVersion = version
+		}
+	}
+	return ret
+}
+
+func (vi *VersionInfo) String() string {
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "stc %s\n", vi.Version)
+	fmt.Fprintf(out, "goxdr %s\n", vi.GoxdrVersion)
+	fmt.Fprintf(out, "go %s\n", vi.GoVersion)
+	fmt.Fprintf(out, "protocol %d\n", vi.Protocol)
+	fmt.Fprintf(out, "stellar-xdr %s\n", vi.StellarXdr)
+	fmt.Fprintf(out, "features %s\n", strings.Join(vi.Features, " "))
+	return out.String()
+}
+
+// Returns the User-Agent header that stc sends to Horizon, e.g.,
+// "stc/v0.1.4".
+func UserAgent() string {
+	return "stc/" + GetVersionInfo().Version
+}
+
+// Identify stc to Horizon the way the Stellar SDKs do.  Programs
+// using the library can change stcdetail.DefaultHeader to identify
+// themselves instead.
+func init() {
+	version := GetVersionInfo().Version
+	stcdetail.DefaultHeader.Set("User-Agent", "stc/"+version)
+	stcdetail.DefaultHeader.Set("X-Client-Name", "stc")
+	stcdetail.DefaultHeader.Set("X-Client-Version", version)
+}
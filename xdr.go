@@ -8,6 +8,8 @@ between txrep format, and posting them.
 package stc
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"github.com/xdrpp/goxdr/xdr"
 	"github.com/xdrpp/stc/stcdetail"
@@ -43,7 +45,7 @@ func MkAsset(acc AccountID, code string) stx.Asset {
 	} else if len(code) <= 12 {
 		ret.Type = stx.ASSET_TYPE_CREDIT_ALPHANUM12
 		copy(ret.AlphaNum12().AssetCode[:], code)
-		ret.AlphaNum4().Issuer = acc
+		ret.AlphaNum12().Issuer = acc
 	} else {
 		xdr.XdrPanic("MkAsset: %q exceeds 12 characters", code)
 	}
@@ -89,11 +91,48 @@ func (net *StellarNet) NewSignerPreauth(tx stx.Signable,
 // Create a signer that requires the hash pre-image of some hash value x
 func NewSignerHashX(x stx.Hash, weight uint32) *stx.Signer {
 	ret := stx.Signer{Weight: weight}
-	ret.Key.Type = stx.SIGNER_KEY_TYPE_PRE_AUTH_TX
+	ret.Key.Type = stx.SIGNER_KEY_TYPE_HASH_X
 	*ret.Key.HashX() = x
 	return &ret
 }
 
+// Returns true if the hint of signature sig matches public key pk,
+// meaning pk is a candidate for the key that produced sig.  Since a
+// hint is only 4 bytes, several keys may match; use VerifySig to
+// check the signature itself.
+func MatchesHint(sig stx.DecoratedSignature, pk PublicKey) bool {
+	return pk.Type == stx.PUBLIC_KEY_TYPE_ED25519 && sig.Hint == pk.Hint()
+}
+
+// Returns the hint of a pre-authorized transaction signer for tx,
+// which is the signature hint of the SignerKey that NewSignerPreauth
+// creates.  Pre-authorized transactions do not carry signatures, but
+// the hint lets wallets match the signer against hints they have
+// recorded.
+func (net *StellarNet) PreauthHint(tx stx.Signable) stx.SignatureHint {
+	return net.NewSignerPreauth(tx, 0).Key.Hint()
+}
+
+// Returns the hint for a signature that satisfies a hash-X signer by
+// revealing preimage, the value whose SHA-256 hash is the signer key.
+// This is the hint to put in a DecoratedSignature whose Signature is
+// preimage.
+func HashXHint(preimage []byte) stx.SignatureHint {
+	return NewSignerHashX(sha256.Sum256(preimage), 0).Key.Hint()
+}
+
+// Returns a ManageData operation that sets account data entry name to
+// value, or deletes the entry if value is nil.  Note that values are
+// raw bytes and not base64, even though Horizon and other tools show
+// them in base64.
+func SetData(name string, value []byte) ManageData {
+	ret := ManageData{DataName: name}
+	if value != nil {
+		ret.DataValue = &value
+	}
+	return ret
+}
+
 // Allocate a uint32 when initializing types that take an XDR int*.
 func NewUint(v uint32) *uint32 { return &v }
 
@@ -150,6 +189,12 @@ func DemuxAcct(macct *MuxedAccount) (*AccountID, *uint64) {
 type TransactionEnvelope struct {
 	*stx.TransactionEnvelope
 	Help map[string]struct{}
+
+	// Network passphrase from the networkPassphrase line of the txrep
+	// from which the envelope was parsed, or "" if there was none.
+	// SignTx, SignInnerTx, and Post refuse to use the envelope on a
+	// different network (see CheckNetwork).
+	NetworkId string
 }
 
 func NewTransactionEnvelope() *TransactionEnvelope {
@@ -282,6 +327,148 @@ func (txe *TransactionEnvelope) SetSourceAccount(m0 stx.IsAccount) {
 	}
 }
 
+// Removes the signatures with the given indices from the envelope.
+// Out-of-range indices are ignored.
+func (txe *TransactionEnvelope) DelSignatures(idx ...int) {
+	sigs := txe.Signatures()
+	del := make(map[int]bool, len(idx))
+	for _, i := range idx {
+		del[i] = true
+	}
+	var nsigs []stx.DecoratedSignature
+	for i := range *sigs {
+		if !del[i] {
+			nsigs = append(nsigs, (*sigs)[i])
+		}
+	}
+	*sigs = nsigs
+}
+
+func v0ToV1(tx0 *stx.TransactionV0) (tx stx.Transaction) {
+	tx.SourceAccount.Type = stx.KEY_TYPE_ED25519
+	*tx.SourceAccount.Ed25519() = tx0.SourceAccountEd25519
+	tx.Fee = tx0.Fee
+	tx.SeqNum = tx0.SeqNum
+	tx.TimeBounds = tx0.TimeBounds
+	tx.Memo = tx0.Memo
+	tx.Operations = tx0.Operations
+	return
+}
+
+// Converts an ENVELOPE_TYPE_TX_V0 envelope into an ENVELOPE_TYPE_TX
+// one, for tools that do not accept the legacy format.  Signatures are
+// kept, since V0 transactions are signed as if they were the
+// equivalent V1 transaction.  Other envelope types are left
+// unchanged.
+func (txe *TransactionEnvelope) UpgradeEnvelope() {
+	if txe.Type != stx.ENVELOPE_TYPE_TX_V0 {
+		return
+	}
+	v0 := txe.V0()
+	tx, sigs := v0ToV1(&v0.Tx), v0.Signatures
+	txe.Type = stx.ENVELOPE_TYPE_TX
+	txe.V1().Tx = tx
+	txe.V1().Signatures = sigs
+}
+
+// Converts an ENVELOPE_TYPE_TX envelope into an ENVELOPE_TYPE_TX_V0
+// one, keeping signatures, for legacy tools.  This is possible only
+// when the source account is not multiplexed.  Other envelope types
+// are left unchanged.
+func (txe *TransactionEnvelope) DowngradeEnvelope() error {
+	if txe.Type != stx.ENVELOPE_TYPE_TX {
+		return nil
+	}
+	v1 := txe.V1()
+	if v1.Tx.SourceAccount.Type != stx.KEY_TYPE_ED25519 {
+		return ErrMuxedSource
+	}
+	var tx0 stx.TransactionV0
+	tx0.SourceAccountEd25519 = *v1.Tx.SourceAccount.Ed25519()
+	tx0.Fee = v1.Tx.Fee
+	tx0.SeqNum = v1.Tx.SeqNum
+	tx0.TimeBounds = v1.Tx.TimeBounds
+	tx0.Memo = v1.Tx.Memo
+	tx0.Operations = v1.Tx.Operations
+	sigs := v1.Signatures
+	txe.Type = stx.ENVELOPE_TYPE_TX_V0
+	txe.V0().Tx = tx0
+	txe.V0().Signatures = sigs
+	return nil
+}
+
+var ErrMuxedSource = errors.New(
+	"V0 envelopes cannot have a multiplexed source account")
+
+// Returns the inner transaction of a fee bump as an envelope of its
+// own, or nil if txe is not a fee bump.  The result shares operations
+// with txe but has its own copy of the signatures slice, so use
+// StellarNet.SignInnerTx to sign the inner transaction of txe.
+func (txe *TransactionEnvelope) InnerTx() *TransactionEnvelope {
+	if txe.Type != stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		return nil
+	}
+	ret := NewTransactionEnvelope()
+	*ret.V1() = *txe.FeeBump().Tx.InnerTx.V1()
+	return ret
+}
+
+// Returns a copy of the transaction that can be edited into a new one:
+// signatures are removed, the sequence number is zeroed, and the time
+// bounds are cleared.  The template of a fee bump is its inner
+// transaction, and templates always use ENVELOPE_TYPE_TX envelopes.
+func (txe *TransactionEnvelope) Template() *TransactionEnvelope {
+	var in stx.TransactionEnvelope
+	if err := stcdetail.XdrFromBin(&in,
+		stcdetail.XdrToBin(txe.TransactionEnvelope)); err != nil {
+		xdr.XdrPanic("Template: %s", err)
+	}
+	ret := NewTransactionEnvelope()
+	tx := &ret.V1().Tx
+	switch in.Type {
+	case stx.ENVELOPE_TYPE_TX_V0:
+		*tx = v0ToV1(&in.V0().Tx)
+	case stx.ENVELOPE_TYPE_TX:
+		*tx = in.V1().Tx
+	case stx.ENVELOPE_TYPE_TX_FEE_BUMP:
+		*tx = in.FeeBump().Tx.InnerTx.V1().Tx
+	default:
+		xdr.XdrPanic("Template: unknown TransactionEnvelope type %s",
+			in.Type)
+	}
+	tx.SeqNum = 0
+	tx.TimeBounds = nil
+	return ret
+}
+
+// Removes the source account of each operation whose source account
+// is the same as the transaction's, which does not change what the
+// transaction does but does change its hash.  For a fee bump, changes
+// the operations of the inner transaction.  Returns the number of
+// operations changed.
+func (txe *TransactionEnvelope) ElideOpSources() int {
+	var ops *[]stx.Operation
+	var src *stx.MuxedAccount
+	if txe.Type == stx.ENVELOPE_TYPE_TX_FEE_BUMP {
+		tx := &txe.FeeBump().Tx.InnerTx.V1().Tx
+		ops, src = &tx.Operations, &tx.SourceAccount
+	} else if ops = txe.Operations(); ops != nil {
+		src = txe.SourceAccount()
+	} else {
+		return 0
+	}
+	srcbin := stcdetail.XdrToBin(src)
+	n := 0
+	for i := range *ops {
+		if opsrc := (*ops)[i].SourceAccount; opsrc != nil &&
+			stcdetail.XdrToBin(opsrc) == srcbin {
+			(*ops)[i].SourceAccount = nil
+			n++
+		}
+	}
+	return n
+}
+
 func (txe *TransactionEnvelope) GetHelp(name string) bool {
 	_, ok := txe.Help[name]
 	return ok
@@ -295,46 +482,136 @@ func (txe *TransactionEnvelope) SetHelp(name string) {
 	}
 }
 
+// A source of comments for txrep output, in addition to the accounts
+// and signers configured in a StellarNet.  Each Note method returns ""
+// if the annotator has nothing to say about a value.  GetHelp returns
+// true to request the help comment listing the possible values of an
+// enum field, given the field name or the enum's type name (e.g.,
+// "OperationType"), as TransactionEnvelope.GetHelp does.  Embed
+// NullAnnotator to implement only some of the methods.
+type TxrepAnnotator interface {
+	AccountIDNote(acct string) string
+	SignerNote(key *stx.SignerKey) string
+	SigNote(txe *stx.TransactionEnvelope, sig *stx.DecoratedSignature) string
+	GetHelp(name string) bool
+}
+
+// A TxrepAnnotator that never produces any comments.
+type NullAnnotator struct{}
+
+func (NullAnnotator) AccountIDNote(string) string { return "" }
+
+func (NullAnnotator) SignerNote(*stx.SignerKey) string { return "" }
+
+func (NullAnnotator) SigNote(*stx.TransactionEnvelope,
+	*stx.DecoratedSignature) string {
+	return ""
+}
+
+func (NullAnnotator) GetHelp(string) bool { return false }
+
+// Adds a source of comments for txrep output.  When several sources
+// have something to say about the same value, their comments are
+// combined, with the network's own configuration first and then
+// annotators in the order they were added.  Annotators cannot
+// suppress the warning for a signature that matches no known signer;
+// their comments follow it.  Help comments are shown for a field
+// if the transaction or any annotator requests them.
+func (net *StellarNet) AddAnnotator(a TxrepAnnotator) {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.Annotators = append(net.Annotators, a)
+}
+
+// Returns the annotators added so far, which the caller may consult
+// without holding net.mu.
+func (net *StellarNet) annotators() []TxrepAnnotator {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return net.Annotators[:len(net.Annotators):len(net.Annotators)]
+}
+
+func joinNotes(notes []string) string {
+	var ret []string
+	for _, n := range notes {
+		if n != "" {
+			ret = append(ret, n)
+		}
+	}
+	return strings.Join(ret, "; ")
+}
+
 func (net *StellarNet) SigNote(txe *stx.TransactionEnvelope,
 	sig *stx.DecoratedSignature) string {
 	if txe == nil {
 		return ""
-	} else if ski := net.Signers.Lookup(net.GetNetworkId(), txe, sig); ski != nil {
-		return ski.String()
 	}
-	return fmt.Sprintf("bad signature/unknown key/%s is wrong network",
-		net.Name)
+	var notes []string
+	id := net.GetNetworkId()
+	net.mu.Lock()
+	if ski := net.Signers.Lookup(id, txe, sig); ski != nil {
+		notes = append(notes, ski.String())
+	} else {
+		notes = append(notes, fmt.Sprintf(
+			"bad signature/unknown key/%s is wrong network", net.Name))
+	}
+	net.mu.Unlock()
+	for _, a := range net.annotators() {
+		notes = append(notes, a.SigNote(txe, sig))
+	}
+	return joinNotes(notes)
 }
 
 func (net *StellarNet) AccountIDNote(acct string) string {
-	return net.Accounts[acct]
+	net.mu.Lock()
+	notes := []string{net.Accounts[acct]}
+	net.mu.Unlock()
+	for _, a := range net.annotators() {
+		notes = append(notes, a.AccountIDNote(acct))
+	}
+	return joinNotes(notes)
 }
 
 func (net *StellarNet) SignerNote(key *stx.SignerKey) string {
-	return net.Signers.LookupComment(key)
+	net.mu.Lock()
+	notes := []string{net.Signers.LookupComment(key)}
+	net.mu.Unlock()
+	for _, a := range net.annotators() {
+		notes = append(notes, a.SignerNote(key))
+	}
+	return joinNotes(notes)
 }
 
 // Write the human-readable Txrep of an XDR structure to a Writer.
-func (net *StellarNet) WriteRep(out io.Writer, name string, txe xdr.XdrType) {
-	type helper interface {
-		xdr.XdrType
-		GetHelp(string) bool
-	}
+// Returns the first error writing to out, after which the output is
+// incomplete, or an stcdetail.XdrBadValue describing illegal values
+// in txe.
+func (net *StellarNet) WriteRep(out io.Writer, name string,
+	txe xdr.XdrType) error {
 	if net == nil {
-		stcdetail.XdrToTxrep(out, name, txe)
-	} else if e, ok := txe.(helper); ok {
-		ntxe := struct {
-			helper
-			*StellarNet
-		}{e, (*StellarNet)(net)}
-		stcdetail.XdrToTxrep(out, name, ntxe)
-	} else {
-		ntxe := struct {
-			xdr.XdrType
-			*StellarNet
-		}{txe, (*StellarNet)(net)}
-		stcdetail.XdrToTxrep(out, name, ntxe)
+		return stcdetail.WriteTxrep(out, name, txe)
 	}
+	return stcdetail.WriteTxrep(out, name, annotatedXdr{txe, net})
+}
+
+// An XDR value together with the network whose configuration and
+// annotators comment on its txrep.
+type annotatedXdr struct {
+	xdr.XdrType
+	*StellarNet
+}
+
+func (ax annotatedXdr) GetHelp(name string) bool {
+	if h, ok := ax.XdrType.(interface{ GetHelp(string) bool }); ok &&
+		h.GetHelp(name) {
+		return true
+	}
+	for _, a := range ax.annotators() {
+		if a.GetHelp(name) {
+			return true
+		}
+	}
+	return false
 }
 
 // Convert an arbitrary XDR data structure to human-readable Txrep
@@ -345,22 +622,112 @@ func (net *StellarNet) ToRep(txe xdr.XdrType) string {
 	return out.String()
 }
 
-// Convert a TransactionEnvelope to human-readable Txrep format.
+// Convert a TransactionEnvelope to human-readable Txrep format.  If
+// net.TxrepNetwork is true and the dialect is not TxrepSEP11, the
+// output starts with a networkPassphrase line naming the network,
+// when its NetworkId is known, so that the transaction cannot
+// accidentally be signed or posted on another network.
 func (net *StellarNet) TxToRep(txe *TransactionEnvelope) string {
-	return net.ToRep(txe)
+	var out strings.Builder
+	net.WriteTxRep(&out, txe)
+	return out.String()
+}
+
+// Writes the output of TxToRep to out, returning the first error
+// writing to out, so that a failed write (such as to a closed pipe)
+// is not mistaken for complete output.  As with WriteRep, other
+// errors are an stcdetail.XdrBadValue describing illegal values in
+// txe, which are left out of the otherwise complete output.
+func (net *StellarNet) WriteTxRep(out io.Writer,
+	txe *TransactionEnvelope) error {
+	if net != nil && net.TxrepNetwork && net.NetworkId != "" &&
+		net.TxrepDialect != stcdetail.TxrepSEP11 {
+		line := fmt.Sprintf("%s: %q\n", stcdetail.NetworkPassphraseField,
+			net.NetworkId)
+		if n, err := io.WriteString(out, line); err != nil {
+			return err
+		} else if n < len(line) {
+			return io.ErrShortWrite
+		}
+	}
+	return net.WriteRep(out, "", txe)
 }
 
 // Parse a transaction in human-readable Txrep format into a
 // TransactionEnvelope.
 func TxFromRep(rep string) (*TransactionEnvelope, error) {
-	in := strings.NewReader(rep)
+	return TxFromRepDialect(rep, stcdetail.TxrepStc)
+}
+
+// Like TxFromRep, but accept only a particular dialect of Txrep
+// (e.g., stcdetail.TxrepSEP11 for strict SEP-0011 conformance).
+func TxFromRepDialect(rep string,
+	dialect stcdetail.TxrepDialect) (*TransactionEnvelope, error) {
+	return txFromRep(rep, dialect, false, nil)
+}
+
+// Like TxFromRepDialect, but reject fields that the transaction does
+// not use, rather than silently ignoring them.  This catches typos
+// such as tx.memo.txt for tx.memo.text, which would otherwise produce
+// a different transaction than intended.
+func TxFromRepStrict(rep string,
+	dialect stcdetail.TxrepDialect) (*TransactionEnvelope, error) {
+	return txFromRep(rep, dialect, true, nil)
+}
+
+// Like TxFromRepDialect in dialect net.TxrepDialect, or like
+// TxFromRepStrict if strict is true, except that outside the SEP-0011
+// dialect, accounts may be written as any name that ResolveAccount
+// accepts, such as an address-book comment.
+func (net *StellarNet) TxFromRep(rep string,
+	strict bool) (*TransactionEnvelope, error) {
+	return txFromRep(rep, net.TxrepDialect, strict, net)
+}
+
+func txFromRep(rep string, dialect stcdetail.TxrepDialect,
+	strict bool, net *StellarNet) (*TransactionEnvelope, error) {
 	txe := NewTransactionEnvelope()
-	if err := stcdetail.XdrFromTxrep(in, "", txe); err != nil {
+	in := strings.NewReader(rep)
+	if err := stcdetail.XdrFromTxrep(in, "", struct {
+		*TransactionEnvelope
+		dialectOpt
+		strictOpt
+		resolveOpt
+		networkOpt
+	}{txe, dialectOpt(dialect), strictOpt(strict),
+		resolveOpt{net}, networkOpt{txe}}); err != nil {
 		return txe, err
 	}
 	return txe, nil
 }
 
+type dialectOpt stcdetail.TxrepDialect
+
+func (d dialectOpt) GetTxrepDialect() stcdetail.TxrepDialect {
+	return stcdetail.TxrepDialect(d)
+}
+
+type strictOpt bool
+
+func (s strictOpt) GetTxrepStrict() bool {
+	return bool(s)
+}
+
+type networkOpt struct{ txe *TransactionEnvelope }
+
+func (n networkOpt) SetNetworkPassphrase(id string) {
+	n.txe.NetworkId = id
+}
+
+type resolveOpt struct{ net *StellarNet }
+
+func (r resolveOpt) ResolveAccount(name string) (string, error) {
+	if r.net == nil {
+		return "", nil
+	}
+	return r.net.ResolveAccount(name)
+}
+
 // Convert a TransactionEnvelope to base64-encoded binary XDR format.
 func TxToBase64(tx *TransactionEnvelope) string {
 	return stcdetail.XdrToBase64(tx)
@@ -375,6 +742,20 @@ func TxFromBase64(input string) (*TransactionEnvelope, error) {
 	return tx, nil
 }
 
+// Read the next TransactionEnvelope from a stream of transactions in
+// base64-encoded binary XDR separated by whitespace (such as one per
+// line), decoding it as it is read.  Returns io.EOF at the end of the
+// stream.  Pass a *bufio.Reader (or other io.ByteReader) to read more
+// than one transaction from the same stream, as described for
+// stcdetail.XdrFromBase64Reader.
+func TxFromBase64Reader(in io.Reader) (*TransactionEnvelope, error) {
+	tx := NewTransactionEnvelope()
+	if err := stcdetail.XdrFromBase64Reader(tx, in); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
 type assignXdr struct {
 	fields []interface{}
 }